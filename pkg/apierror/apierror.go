@@ -0,0 +1,198 @@
+// Package apierror is the error model of the HTTP APIs. Services return typed errors carrying a
+// stable code, the middleware writes them as RFC 7807 problem details.
+package apierror
+
+import (
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Kind classifies an error, it decides the HTTP status of the problem
+type Kind int
+
+const (
+	// KindInternal is a failure the client cannot act on, its details are never disclosed
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnavailable
+)
+
+// Status returns the HTTP status of the kind
+func (k Kind) Status() int {
+	switch k {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnauthenticated:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error the API reports to the client. Errors are declared once as variables and
+// compared with errors.Is, which matches on the code.
+type Error struct {
+	Kind Kind
+	// Code identifies the error for clients, e.g. "AUTH_INVALID_CREDENTIALS". A published code never changes.
+	Code string
+	// Title is a short summary of the code, the same for every occurrence
+	Title string
+	// Detail explains the occurrence, see WithDetail and WithMessage
+	Detail string
+	// Fields are the invalid fields of the request
+	Fields []FieldError
+	// Extensions are additional members of the problem, e.g. "max_age"
+	Extensions map[string]interface{}
+	cause      error
+	// detailKey is the catalog key of the detail, rendered in the language of the request
+	detailKey  string
+	detailArgs i18n.Args
+}
+
+// FieldError tells why a field of the request is invalid
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "client.ip"
+	Field string `json:"field"`
+	// Rule is the rule the value broke, e.g. "required" or "email"
+	Rule string `json:"rule"`
+	// Param is the parameter of the rule, e.g. "64" for "max"
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+	// key is the catalog key of the message, "validation." and the rule if empty
+	key string
+}
+
+var (
+	ErrInternal       = New(KindInternal, "INTERNAL_ERROR", "Internal server error")
+	ErrInvalidRequest = New(KindInvalid, "INVALID_REQUEST", "Invalid request")
+	ErrNotFound       = New(KindNotFound, "NOT_FOUND", "Not found")
+)
+
+var (
+	codesMu sync.Mutex
+	codes   = make(map[string]struct{})
+)
+
+// New declares an error. The title is English, the catalogs translate it under the code.
+func New(kind Kind, code string, title string) *Error {
+	codesMu.Lock()
+	codes[code] = struct{}{}
+	codesMu.Unlock()
+	return &Error{Kind: kind, Code: code, Title: title}
+}
+
+// Codes returns the sorted codes of the declared errors, the catalogs must translate each
+func Codes() []string {
+	codesMu.Lock()
+	defer codesMu.Unlock()
+	sorted := make([]string, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (e *Error) Error() string {
+	message := e.Code + ": " + e.Title
+	if detail := e.detail(i18n.Default()); detail != "" {
+		message += ": " + detail
+	}
+	if e.cause != nil {
+		message += ": " + e.cause.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches errors with the same code, so an error with a detail or a cause is still the error
+// it was derived from
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == e.Code
+}
+
+// Status returns the HTTP status of the error
+func (e *Error) Status() int {
+	return e.Kind.Status()
+}
+
+// Wrap returns a copy of the error caused by cause. The cause is logged, never disclosed.
+func (e *Error) Wrap(cause error) *Error {
+	copied := e.copy()
+	copied.cause = cause
+	return copied
+}
+
+// WithDetail returns a copy of the error explaining the occurrence with text that is not translated,
+// e.g. the message of a parser
+func (e *Error) WithDetail(detail string) *Error {
+	copied := e.copy()
+	copied.Detail, copied.detailKey, copied.detailArgs = detail, "", nil
+	return copied
+}
+
+// WithMessage returns a copy of the error explaining the occurrence with the message of the key in
+// the catalogs, rendered in the language of the request
+func (e *Error) WithMessage(key string, args i18n.Args) *Error {
+	copied := e.copy()
+	copied.Detail, copied.detailKey, copied.detailArgs = "", key, args
+	return copied
+}
+
+// detail renders the detail with the localizer
+func (e *Error) detail(localizer *i18n.Localizer) string {
+	if e.detailKey == "" {
+		return e.Detail
+	}
+	return localizer.Text(e.detailKey, e.detailArgs)
+}
+
+// WithFields returns a copy of the error with the invalid fields
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	copied := e.copy()
+	copied.Fields = append(append([]FieldError{}, e.Fields...), fields...)
+	return copied
+}
+
+// With returns a copy of the error with an extension member
+func (e *Error) With(key string, value interface{}) *Error {
+	copied := e.copy()
+	copied.Extensions = make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return copied
+}
+
+func (e *Error) copy() *Error {
+	copied := *e
+	return &copied
+}
+
+// From returns the Error in the chain of err. Other errors are internal, ErrInternal caused by them is returned.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return ErrInternal.Wrap(err)
+}
@@ -0,0 +1,199 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+var errTestTaken = New(KindConflict, "TEST_TAKEN", "Name taken")
+
+type testRequest struct {
+	Name   string `json:"name" binding:"required,max=8"`
+	Client *struct {
+		IP string `json:"ip" binding:"required"`
+	} `json:"client" binding:"required"`
+	Count int `json:"count"`
+}
+
+func newTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing.GinMiddleware("test"), Middleware())
+	router.POST("/things", handler)
+	router.NoRoute(NoRoute)
+	return router
+}
+
+func serve(router *gin.Engine, method string, path string, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set(tracing.RequestIDHeader, "request-1")
+	router.ServeHTTP(recorder, request)
+	var problem map[string]interface{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &problem)
+	return recorder, problem
+}
+
+func TestErrorIs(t *testing.T) {
+	derived := errTestTaken.WithDetail("thing is taken").Wrap(errors.New("duplicate key"))
+	if !errors.Is(derived, errTestTaken) {
+		t.Error("Expected a derived error to be the error it was derived from")
+	}
+	if errors.Is(derived, ErrInternal) {
+		t.Error("Expected errors with different codes to differ")
+	}
+	if errTestTaken.Detail != "" || errTestTaken.Unwrap() != nil {
+		t.Error("Expected deriving to leave the declared error untouched")
+	}
+	if From(errors.New("boom")).Code != ErrInternal.Code {
+		t.Error("Expected an untyped error to be internal")
+	}
+}
+
+func TestMiddlewareWritesProblem(t *testing.T) {
+	router := newTestRouter(func(c *gin.Context) {
+		_ = c.Error(errTestTaken.WithDetail("thing is taken").With("name", "thing"))
+	})
+
+	recorder, problem := serve(router, http.MethodPost, "/things", "")
+	if recorder.Code != http.StatusConflict || recorder.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Expected a 409 problem, got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	expected := map[string]interface{}{
+		"type":       TypePrefix + "TEST_TAKEN",
+		"title":      "Name taken",
+		"status":     float64(http.StatusConflict),
+		"detail":     "thing is taken",
+		"instance":   "/things",
+		"code":       "TEST_TAKEN",
+		"request_id": "request-1",
+		"name":       "thing",
+	}
+	for key, value := range expected {
+		if problem[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, problem[key])
+		}
+	}
+}
+
+func TestMiddlewareHidesInternalErrors(t *testing.T) {
+	router := newTestRouter(func(c *gin.Context) {
+		_ = c.Error(errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	})
+
+	recorder, problem := serve(router, http.MethodPost, "/things", "")
+	if recorder.Code != http.StatusInternalServerError || problem["code"] != ErrInternal.Code {
+		t.Fatalf("Expected an internal error, got %d %v", recorder.Code, problem)
+	}
+	if strings.Contains(recorder.Body.String(), "10.0.0.5") || problem["request_id"] != "request-1" {
+		t.Errorf("Expected only the request ID to be disclosed, got %s", recorder.Body.String())
+	}
+
+	router = newTestRouter(func(c *gin.Context) { panic("nil map") })
+	recorder, problem = serve(router, http.MethodPost, "/things", "")
+	if recorder.Code != http.StatusInternalServerError || problem["code"] != ErrInternal.Code {
+		t.Errorf("Expected a panic to be an internal error, got %d %v", recorder.Code, problem)
+	}
+
+	recorder, problem = serve(router, http.MethodGet, "/unknown", "")
+	if recorder.Code != http.StatusNotFound || problem["code"] != ErrNotFound.Code {
+		t.Errorf("Expected an unknown route to be a problem, got %d %v", recorder.Code, problem)
+	}
+}
+
+func TestBindJSONListsInvalidFields(t *testing.T) {
+	router := newTestRouter(func(c *gin.Context) {
+		var req testRequest
+		if err := BindJSON(c, &req); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []FieldError
+	}{
+		{"valid", `{"name": "thing", "client": {"ip": "203.0.113.7"}}`, nil},
+		{"invalid fields", `{"name": "long thing", "client": {}}`, []FieldError{
+			{Field: "name", Rule: "max", Param: "8", Message: "must have at most 8 characters"},
+			{Field: "client.ip", Rule: "required", Message: "is required"},
+		}},
+		{"wrong type", `{"name": "thing", "count": "many"}`, []FieldError{
+			{Field: "count", Rule: "type", Param: "int", Message: "must be of type int"},
+		}},
+		{"malformed", `{"name": `, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(tc.body)))
+			if tc.name == "valid" {
+				if recorder.Code != http.StatusNoContent {
+					t.Errorf("Expected a valid request to pass, got %d %s", recorder.Code, recorder.Body.String())
+				}
+				return
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil || problem.Code != ErrInvalidRequest.Code {
+				t.Fatalf("Expected an invalid request, got %d %s", recorder.Code, recorder.Body.String())
+			}
+			if len(problem.Errors) != len(tc.fields) {
+				t.Fatalf("Expected fields %+v, got %+v", tc.fields, problem.Errors)
+			}
+			for i, field := range tc.fields {
+				if problem.Errors[i] != field {
+					t.Errorf("Expected field %+v, got %+v", field, problem.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProblemIsLocalized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(i18n.Middleware(i18n.MustNewBundle(language.English, i18n.Catalogs)), Middleware())
+	router.POST("/things", func(c *gin.Context) {
+		var req testRequest
+		if err := BindJSON(c, &req); err != nil {
+			_ = c.Error(err)
+		}
+	})
+	router.NoRoute(NoRoute)
+
+	serveIn := func(lang string, method string, path string, body string) Problem {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Accept-Language", lang)
+		router.ServeHTTP(recorder, request)
+		var problem Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Expected a problem, got %s", recorder.Body.String())
+		}
+		return problem
+	}
+
+	problem := serveIn("ru-RU,ru;q=0.9", http.MethodPost, "/things", `{"name": "long thing", "client": {"ip": "203.0.113.7"}}`)
+	if problem.Title != "Некорректный запрос" || len(problem.Errors) != 1 || problem.Errors[0].Message != "должно содержать не более 8 символов" {
+		t.Errorf("Expected a Russian problem, got %+v", problem)
+	}
+	if problem = serveIn("kk", http.MethodPost, "/things", ""); problem.Detail != "Сұрау денесі бос" {
+		t.Errorf("Expected a Kazakh detail, got %+v", problem)
+	}
+	if problem = serveIn("de", http.MethodGet, "/unknown", ""); problem.Title != "Not found" || problem.Detail != "No route for GET /unknown" {
+		t.Errorf("Expected an English problem for an unsupported language, got %+v", problem)
+	}
+}
@@ -0,0 +1,106 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// BindJSON binds the JSON body of the request to obj. A malformed or invalid body is
+// ErrInvalidRequest listing the invalid fields.
+func BindJSON(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		return ValidationError(obj, err)
+	}
+	return nil
+}
+
+// ValidationError converts the error of binding obj to ErrInvalidRequest with the invalid fields
+func ValidationError(obj interface{}, err error) *Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			field := jsonField(reflect.TypeOf(obj), fieldErr.StructNamespace())
+			fields = append(fields, NewFieldError(field, fieldErr.Tag(), fieldErr.Param(), fieldErr.Kind()))
+		}
+		return ErrInvalidRequest.WithFields(fields...).Wrap(err)
+	case errors.As(err, &typeErr):
+		return ErrInvalidRequest.WithFields(FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: i18n.Default().Text("validation.type", fieldArgs(typeErr.Type.String())),
+		}).Wrap(err)
+	case errors.Is(err, io.EOF):
+		return ErrInvalidRequest.WithMessage("INVALID_REQUEST.empty_body", nil).Wrap(err)
+	}
+	return ErrInvalidRequest.WithMessage("INVALID_REQUEST.malformed_body", nil).Wrap(err)
+}
+
+// NewFieldError returns the error of a field whose value of the kind broke the rule, e.g.
+// ("name", "max", "64", reflect.String). The message is rendered in the language of the request.
+func NewFieldError(field string, rule string, param string, kind reflect.Kind) FieldError {
+	key := ruleKey(rule, kind)
+	return FieldError{
+		Field:   field,
+		Rule:    rule,
+		Param:   param,
+		Message: i18n.Default().Text(key, fieldArgs(param)),
+		key:     key,
+	}
+}
+
+// jsonField returns the JSON path of the field the validator names by its struct namespace,
+// e.g. "client.ip" for "TokenRequest.Client.IP"
+func jsonField(t reflect.Type, namespace string) string {
+	parts := strings.Split(namespace, ".")[1:]
+	names := make([]string, 0, len(parts))
+	for i, part := range parts {
+		name, index := part, ""
+		if bracket := strings.IndexByte(part, '['); bracket >= 0 {
+			name, index = part[:bracket], part[bracket:]
+		}
+		for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return strings.Join(append(names, parts[i:]...), ".")
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return strings.Join(append(names, parts[i:]...), ".")
+		}
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+			name = tag
+		}
+		names = append(names, name+index)
+		t = field.Type
+	}
+	return strings.Join(names, ".")
+}
+
+// ruleKey returns the catalog key of the message of a rule. Rules bounding a length have a
+// message for strings, one for collections and one for numbers.
+func ruleKey(rule string, kind reflect.Kind) string {
+	switch rule {
+	case "min", "max", "len":
+		switch kind {
+		case reflect.String:
+			return "validation." + rule + ".length"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return "validation." + rule + ".items"
+		}
+		return "validation." + rule
+	case "required", "email", "oneof", "url", "gt", "gte", "lt", "lte":
+		return "validation." + rule
+	}
+	return "validation.invalid"
+}
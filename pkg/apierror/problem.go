@@ -0,0 +1,162 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// TypePrefix prefixes the code in the type of a problem
+const TypePrefix = "urn:gomarketplace:problem:"
+
+// Problem is the body of an error response, RFC 7807 problem details with the code and the
+// request ID as extension members
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// RequestID is the ID to quote when reporting the error, it finds the logs of the request
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extensions are additional members, written next to the standard ones
+	Extensions map[string]interface{} `json:"-"`
+}
+
+type problemMembers Problem
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(problemMembers(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+	members := make(map[string]interface{}, len(p.Extensions))
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	// The standard members win over extensions of the same name
+	var standard map[string]json.RawMessage
+	if err = json.Unmarshal(data, &standard); err != nil {
+		return nil, err
+	}
+	for key, value := range standard {
+		members[key] = value
+	}
+	return json.Marshal(members)
+}
+
+// NewProblem returns the problem describing err in the response to r. An error that is not an
+// Error is internal, the client only learns the request failed. The title, the detail and the
+// messages of the fields are rendered in the language of the request, see i18n.FromContext.
+func NewProblem(r *http.Request, err error) Problem {
+	apiErr := From(err)
+	localizer := i18n.Default()
+	if r != nil {
+		localizer = i18n.FromContext(r.Context())
+	}
+
+	title, ok := localizer.Lookup(apiErr.Code, apiErr.Extensions)
+	if !ok {
+		title = apiErr.Title
+	}
+	problem := Problem{
+		Type:       TypePrefix + apiErr.Code,
+		Title:      title,
+		Status:     apiErr.Status(),
+		Detail:     apiErr.detail(localizer),
+		Code:       apiErr.Code,
+		Errors:     localizeFields(localizer, apiErr.Fields),
+		Extensions: apiErr.Extensions,
+	}
+	if r != nil {
+		problem.Instance = r.URL.Path
+		problem.RequestID = tracing.RequestIDFromContext(r.Context())
+	}
+	return problem
+}
+
+// localizeFields renders the messages of the fields with the localizer, messages the catalogs
+// lack are kept
+func localizeFields(localizer *i18n.Localizer, fields []FieldError) []FieldError {
+	if len(fields) == 0 {
+		return nil
+	}
+	localized := make([]FieldError, len(fields))
+	for i, field := range fields {
+		key := field.key
+		if key == "" {
+			key = "validation." + field.Rule
+		}
+		if message, ok := localizer.Lookup(key, fieldArgs(field.Param)); ok {
+			field.Message = message
+		}
+		localized[i] = field
+	}
+	return localized
+}
+
+// fieldArgs are the variables of the message of a rule, a numeric param also counts for plurals
+func fieldArgs(param string) i18n.Args {
+	args := i18n.Args{"param": param}
+	if n, err := strconv.Atoi(param); err == nil {
+		args["count"] = n
+	}
+	return args
+}
+
+// Abort writes err as a problem and aborts the request. Internal errors are logged, the client
+// only gets the request ID to quote.
+func Abort(c *gin.Context, err error) {
+	if From(err).Kind == KindInternal {
+		logging.FromContext(c.Request.Context()).Error(err)
+	}
+	write(c, err)
+}
+
+func write(c *gin.Context, err error) {
+	problem := NewProblem(c.Request, err)
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// Middleware writes the last error a handler attached with c.Error as a problem, unless the
+// handler wrote a response. A panicking handler is answered with ErrInternal.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			logging.FromContext(c.Request.Context()).WithField("stack", string(debug.Stack())).Error("Panic while handling the request: ", recovered)
+			if !c.Writer.Written() {
+				write(c, ErrInternal.Wrap(fmt.Errorf("panic: %v", recovered)))
+			}
+		}()
+
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		Abort(c, c.Errors.Last().Err)
+	}
+}
+
+// NoRoute answers requests to unknown routes, for gin.Engine.NoRoute
+func NoRoute(c *gin.Context) {
+	Abort(c, ErrNotFound.WithMessage("NOT_FOUND.route", i18n.Args{"method": c.Request.Method, "path": c.Request.URL.Path}))
+}
@@ -0,0 +1,104 @@
+package communication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer picks one of the endpoints of a service for a call.
+// The returned function must be called once the call is finished.
+type Balancer interface {
+	Pick(endpoints []Endpoint) (Endpoint, func())
+}
+
+// RoundRobinBalancer cycles through the endpoints
+type RoundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+func (r *RoundRobinBalancer) Pick(endpoints []Endpoint) (Endpoint, func()) {
+	n := r.next.Add(1) - 1
+	return endpoints[n%uint64(len(endpoints))], func() {}
+}
+
+// LeastPendingBalancer picks the endpoint with the fewest calls in flight
+type LeastPendingBalancer struct {
+	mu      sync.Mutex
+	pending map[string]int
+	next    int
+}
+
+func NewLeastPendingBalancer() *LeastPendingBalancer {
+	return &LeastPendingBalancer{pending: make(map[string]int)}
+}
+
+func (l *LeastPendingBalancer) Pick(endpoints []Endpoint) (Endpoint, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Start at a rotating offset so that ties are spread over the endpoints
+	l.next++
+	best := endpoints[l.next%len(endpoints)]
+	for i := range endpoints {
+		candidate := endpoints[(l.next+i)%len(endpoints)]
+		if l.pending[candidate.ID] < l.pending[best.ID] {
+			best = candidate
+		}
+	}
+	l.pending[best.ID]++
+
+	var once sync.Once
+	return best, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.pending[best.ID]--
+			if l.pending[best.ID] <= 0 {
+				delete(l.pending, best.ID)
+			}
+		})
+	}
+}
+
+// Pending returns the number of calls in flight to the endpoint
+func (l *LeastPendingBalancer) Pending(id string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pending[id]
+}
+
+// Upstream is a named service reached through a resolver and a balancer
+type Upstream struct {
+	Service  string
+	resolver Resolver
+	balancer Balancer
+}
+
+func NewUpstream(service string, resolver Resolver, balancer Balancer) *Upstream {
+	if balancer == nil {
+		balancer = NewRoundRobinBalancer()
+	}
+	return &Upstream{Service: service, resolver: resolver, balancer: balancer}
+}
+
+// URL resolves the service and returns the URL of path on the picked endpoint.
+// The returned function must be called once the call is finished.
+func (u *Upstream) URL(ctx context.Context, path string) (string, func(), error) {
+	endpoints, err := u.resolver.Resolve(ctx, u.Service)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(endpoints) == 0 {
+		return "", nil, fmt.Errorf("%w for service %q", ErrNoEndpoints, u.Service)
+	}
+
+	endpoint, done := u.balancer.Pick(endpoints)
+	return strings.TrimSuffix(endpoint.Address, "/") + "/" + strings.TrimPrefix(path, "/"), done, nil
+}
@@ -0,0 +1,102 @@
+package communication
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// BreakerConfig is the configuration for the circuit breakers of a client
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit, 0 disables the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a probe call is let through
+	OpenTimeout time.Duration
+}
+
+// CircuitBreaker stops calls to an upstream that keeps failing, so callers fail fast
+// instead of piling up behind timeouts. After OpenTimeout a single probe call decides
+// whether the circuit closes again.
+type CircuitBreaker struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{config: config, now: time.Now}
+}
+
+// Allow reports whether a call may be made. Every allowed call must be followed by Record.
+func (b *CircuitBreaker) Allow() error {
+	if b.config.FailureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of an allowed call
+func (b *CircuitBreaker) Record(success bool) {
+	if b.config.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// Open reports whether the circuit currently rejects calls
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
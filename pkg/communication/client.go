@@ -2,10 +2,369 @@ package communication
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 )
 
+// ClientConfig is the configuration for the HTTP client
+type ClientConfig struct {
+	// Timeout bounds a whole call including retries, unless the request sets its own
+	Timeout time.Duration
+	// MaxRetries is the number of retries for idempotent requests
+	MaxRetries int
+	// RetryBaseDelay and RetryMaxDelay bound the jittered exponential backoff between retries
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// Breaker configures the circuit breaker kept for every upstream host
+	Breaker BreakerConfig
+	// Header is sent with every request
+	Header http.Header
+	// Hooks are called around every attempt
+	Hooks []Hooks
+	// Transport is the underlying transport, http.DefaultTransport is used if nil
+	Transport http.RoundTripper
+}
+
+// DefaultClientConfig returns the configuration used for calls between services
+func DefaultClientConfig() ClientConfig {
+	header := http.Header{}
+	MarkInternalCall(header)
+
+	return ClientConfig{
+		Timeout:        10 * time.Second,
+		MaxRetries:     2,
+		RetryBaseDelay: 50 * time.Millisecond,
+		RetryMaxDelay:  time.Second,
+		Breaker: BreakerConfig{
+			FailureThreshold: 5,
+			OpenTimeout:      10 * time.Second,
+		},
+		Header: header,
+		Hooks:  []Hooks{MetricsHooks()},
+	}
+}
+
+// Request describes a call made with the Client
+type Request struct {
+	Method string
+	// URL is the absolute URL, or the path on the upstream if Upstream is set
+	URL string
+	// Upstream resolves the service to call, the endpoint is picked again for every attempt
+	Upstream *Upstream
+	// Query is appended to the URL
+	Query url.Values
+	// Header is sent in addition to the client headers
+	Header http.Header
+	// Body is encoded as JSON, []byte is sent as is
+	Body interface{}
+	// Timeout overrides the client timeout for this call
+	Timeout time.Duration
+	// Idempotent overrides whether the request may be retried, by default it depends on the method
+	Idempotent *bool
+}
+
+// RequestOption changes a request, the methods of generated clients take them
+type RequestOption func(*Request)
+
+// WithHeader sets a header of the request
+func WithHeader(name string, value string) RequestOption {
+	return func(req *Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set(name, value)
+	}
+}
+
+// WithBearerToken authenticates the request with the token in the Authorization header
+func WithBearerToken(token string) RequestOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithTimeout overrides the client timeout for the request
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(req *Request) {
+		req.Timeout = timeout
+	}
+}
+
+// Client is an HTTP client for calls between services.
+// Idempotent requests are retried with jittered backoff, every upstream host has its own
+// circuit breaker, and non 2xx answers are returned as UpstreamError.
+type Client struct {
+	config     ClientConfig
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewClient(config ClientConfig) *Client {
+	transport := config.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{Transport: transport},
+		breakers:   make(map[string]*CircuitBreaker),
+	}
+}
+
+// DefaultClient is a shared client with the default configuration
+var DefaultClient = NewClient(DefaultClientConfig())
+
+// legacyClient backs RequestJSON, which used to have no timeout at all
+var legacyClient = &http.Client{Timeout: 10 * time.Second}
+
+// Send makes the call and returns the response of the first successful attempt.
+// The caller must close the response body. A non 2xx response is returned as UpstreamError.
+func (c *Client) Send(ctx context.Context, req Request) (*http.Response, error) {
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	body, err := encodeBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.config.Timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	retries := 0
+	if isIdempotent(req) {
+		retries = c.config.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, done, err := c.attempt(ctx, req, body)
+		if err == nil {
+			// The timeout and the pending call count cover reading the body,
+			// both are released when the body is closed
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() {
+				done()
+				cancel()
+			}}
+			return resp, nil
+		}
+		if attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			cancel()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			return nil, err
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// attempt makes a single request. On success the returned function must be called once the body is read.
+func (c *Client) attempt(ctx context.Context, req Request, body []byte) (*http.Response, func(), error) {
+	target := req.URL
+	done := func() {}
+	if req.Upstream != nil {
+		var err error
+		target, done, err = req.Upstream.URL(ctx, req.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resp, err := c.roundTrip(ctx, req, target, body)
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	return resp, done, nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, req Request, target string, body []byte) (resp *http.Response, err error) {
+	ctx, span := tracing.Tracer(tracing.InstrumentationName).Start(ctx, "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		}
+		tracing.EndSpan(span, err)
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPRequestMethodKey.String(req.Method), semconv.URLFull(httpReq.URL.Redacted()))
+	if len(req.Query) > 0 {
+		query := httpReq.URL.Query()
+		for key, values := range req.Query {
+			query[key] = append(query[key], values...)
+		}
+		httpReq.URL.RawQuery = query.Encode()
+	}
+	for key, values := range c.config.Header {
+		httpReq.Header[key] = append([]string(nil), values...)
+	}
+	for key, values := range req.Header {
+		httpReq.Header[key] = append([]string(nil), values...)
+	}
+	if body != nil && httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	tracing.InjectHeaders(ctx, httpReq.Header)
+
+	breaker := c.breaker(httpReq.URL.Host)
+	if err = breaker.Allow(); err != nil {
+		circuitRejections.WithLabelValues(httpReq.URL.Host).Inc()
+		return nil, err
+	}
+
+	for _, hooks := range c.config.Hooks {
+		if hooks.BeforeRequest != nil {
+			hooks.BeforeRequest(httpReq)
+		}
+	}
+
+	start := time.Now()
+	resp, err = c.httpClient.Do(httpReq)
+	elapsed := time.Since(start)
+
+	for _, hooks := range c.config.Hooks {
+		if hooks.AfterResponse != nil {
+			hooks.AfterResponse(httpReq, resp, err, elapsed)
+		}
+	}
+
+	if err != nil {
+		breaker.Record(false)
+		return nil, err
+	}
+	breaker.Record(resp.StatusCode < http.StatusInternalServerError)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		return nil, &UpstreamError{
+			Method:     req.Method,
+			URL:        httpReq.URL.Redacted(),
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       errBody,
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) breaker(host string) *CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = NewCircuitBreaker(c.config.Breaker)
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// backoff returns a random delay up to the exponential backoff for the attempt ("full jitter")
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.config.RetryBaseDelay << attempt
+	if ceiling <= 0 || ceiling > c.config.RetryMaxDelay {
+		ceiling = c.config.RetryMaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// Do makes the call and decodes the JSON response into T
+func Do[T any](ctx context.Context, client *Client, req Request) (T, error) {
+	var result T
+
+	resp, err := client.Send(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return result, nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return b, nil
+	default:
+		return json.Marshal(body)
+	}
+}
+
+func isIdempotent(req Request) bool {
+	if req.Idempotent != nil {
+		return *req.Idempotent
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoEndpoints) {
+		return false
+	}
+	if upstreamErr, ok := AsUpstreamError(err); ok {
+		return upstreamErr.Temporary()
+	}
+	// Transport errors
+	return true
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// RequestJSON sends a request with JSON data and returns the response whatever its status.
+// The caller is responsible for closing the response body.
+//
+// Deprecated: use Client.Send or Do, which also retry and report upstream errors.
 func RequestJSON(method string, url string, data []byte) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
 	if err != nil {
@@ -13,24 +372,29 @@ func RequestJSON(method string, url string, data []byte) (*http.Response, error)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Internal-Call", "true")
+	MarkInternalCall(req.Header)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := legacyClient.Do(req)
 	if err != nil {
 		return &http.Response{}, err
 	}
-	defer resp.Body.Close()
 
 	return resp, nil
 }
 
 // PostJSON sends a POST request with JSON data
+//
+// Deprecated: use Client.Send or Do.
 func PostJSON(url string, data []byte) (*http.Response, error) {
 	return RequestJSON("POST", url, data)
 }
 
-// ParseJSONResponse parses a JSON response
+// ParseJSONResponse parses a JSON response and closes its body
+//
+// Deprecated: use Do, which decodes into a typed value.
 func ParseJSONResponse(data http.Response) (interface{}, error) {
+	defer data.Body.Close()
+
 	var result interface{}
 	err := json.NewDecoder(data.Body).Decode(&result)
 	if err != nil {
@@ -0,0 +1,324 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestClient() *Client {
+	config := DefaultClientConfig()
+	config.RetryBaseDelay = time.Millisecond
+	config.RetryMaxDelay = 5 * time.Millisecond
+	return NewClient(config)
+}
+
+type user struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+func TestDoDecodesTypedResponse(t *testing.T) {
+	t.Setenv(InternalCallSecretEnv, "shared-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsInternalCall(r) {
+			t.Errorf("Expected the call to be marked as internal")
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON body")
+		}
+		_, _ = w.Write([]byte(`{"id": 1, "email": "user@example.com"}`))
+	}))
+	defer server.Close()
+
+	result, err := Do[user](context.Background(), newTestClient(), Request{
+		Method: http.MethodPost,
+		URL:    server.URL,
+		Body:   map[string]string{"token": "abc"},
+	})
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if result.ID != 1 || result.Email != "user@example.com" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestSendReturnsUpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code": 401, "type": "error", "message": "Invalid token"}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().Send(context.Background(), Request{Method: http.MethodGet, URL: server.URL})
+	upstreamErr, ok := AsUpstreamError(err)
+	if !ok {
+		t.Fatalf("Expected an UpstreamError, got %v", err)
+	}
+	if upstreamErr.StatusCode != http.StatusUnauthorized || string(upstreamErr.Body) != `{"code": 401, "type": "error", "message": "Invalid token"}` {
+		t.Errorf("Unexpected error %+v", upstreamErr)
+	}
+	if !IsStatus(err, http.StatusUnauthorized) {
+		t.Errorf("Expected IsStatus to match")
+	}
+}
+
+func TestSendRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient().Send(context.Background(), Request{Method: http.MethodGet, URL: server.URL})
+	if err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestSendDoesNotRetryPost(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().Send(context.Background(), Request{Method: http.MethodPost, URL: server.URL})
+	if !IsStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("Expected 503, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls.Load())
+	}
+
+	idempotent := true
+	_, _ = newTestClient().Send(context.Background(), Request{Method: http.MethodPost, URL: server.URL, Idempotent: &idempotent})
+	if calls.Load() != 4 {
+		t.Errorf("Expected retries for a POST marked idempotent, got %d attempts", calls.Load()-1)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	_, err := newTestClient().Send(context.Background(), Request{Method: http.MethodGet, URL: server.URL, Timeout: 20 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the call to give up quickly")
+	}
+}
+
+func TestCircuitBreakerOpensPerUpstream(t *testing.T) {
+	var calls atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	config := DefaultClientConfig()
+	config.MaxRetries = 0
+	config.Breaker = BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}
+	client := NewClient(config)
+
+	for i := 0; i < 2; i++ {
+		_, _ = client.Send(context.Background(), Request{URL: failing.URL})
+	}
+	_, err := client.Send(context.Background(), Request{URL: failing.URL})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the circuit to be open, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected the open circuit to stop calls, got %d", calls.Load())
+	}
+
+	resp, err := client.Send(context.Background(), Request{URL: healthy.URL})
+	if err != nil {
+		t.Fatalf("Expected other upstreams to be unaffected, got %v", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+	breaker.now = func() time.Time { return now }
+
+	_ = breaker.Allow()
+	breaker.Record(false)
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Fatalf("Expected the circuit to be open")
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected a probe to be allowed, got %v", err)
+	}
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Errorf("Expected a single probe at a time")
+	}
+
+	breaker.Record(true)
+	if breaker.Open() {
+		t.Errorf("Expected the circuit to close after a successful probe")
+	}
+}
+
+func TestHooksAreCalled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var before, after int
+	config := DefaultClientConfig()
+	config.Hooks = []Hooks{{
+		BeforeRequest: func(req *http.Request) { before++ },
+		AfterResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("Unexpected outcome %v, %v", resp, err)
+			}
+			after++
+		},
+	}}
+
+	resp, err := NewClient(config).Send(context.Background(), Request{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if before != 1 || after != 1 {
+		t.Errorf("Expected hooks to be called once, got %d and %d", before, after)
+	}
+}
+
+func TestSendPropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Init(context.Background(), tracing.Config{ServiceName: "test", Exporter: exporter, Synchronous: true})
+	if err != nil {
+		t.Fatalf("Failed to init tracing: %v", err)
+	}
+	defer func() { _ = shutdown(context.Background()) }()
+
+	var traceparent, requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		requestID = r.Header.Get(tracing.RequestIDHeader)
+	}))
+	defer server.Close()
+
+	ctx, span := tracing.StartSpan(tracing.ContextWithRequestID(context.Background(), "request-1"), "parent")
+	resp, err := newTestClient().Send(ctx, Request{URL: server.URL})
+	span.End()
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	traceID, _ := tracing.IDs(ctx)
+	if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+		t.Errorf("Expected traceparent of trace %s, got %q", traceID, traceparent)
+	}
+	if requestID != "request-1" {
+		t.Errorf("Expected the request ID to be propagated, got %q", requestID)
+	}
+
+	// The client span is the parent of the upstream request
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || !strings.Contains(traceparent, spans[0].SpanContext.SpanID().String()) {
+		t.Errorf("Expected the client span to be propagated, got %q", traceparent)
+	}
+}
+
+func TestSendRecordsMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	_, _ = newTestClient().Send(context.Background(), Request{URL: server.URL})
+
+	if count := testutil.ToFloat64(outboundRequests.WithLabelValues(host, http.MethodGet, "404")); count != 1 {
+		t.Errorf("Expected the attempt to be counted, got %v", count)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	req := Request{Header: http.Header{"X-Request": {"kept"}}}
+	for _, opt := range []RequestOption{WithBearerToken("abc"), WithHeader("X-Device-Fingerprint", "device"), WithTimeout(time.Second)} {
+		opt(&req)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Expected the bearer token, got %q", got)
+	}
+	if got := req.Header.Get("X-Device-Fingerprint"); got != "device" {
+		t.Errorf("Expected the header to be set, got %q", got)
+	}
+	if got := req.Header.Get("X-Request"); got != "kept" {
+		t.Errorf("Expected the other headers to be kept, got %q", got)
+	}
+	if req.Timeout != time.Second {
+		t.Errorf("Expected the timeout to be set, got %v", req.Timeout)
+	}
+
+	var empty Request
+	WithHeader("X-Test", "1")(&empty)
+	if empty.Header.Get("X-Test") != "1" {
+		t.Errorf("Expected the header to be set on a request without headers")
+	}
+}
+
+func TestIsInternalCall(t *testing.T) {
+	request := func(value string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/validate", nil)
+		if value != "" {
+			r.Header.Set(InternalCallHeader, value)
+		}
+		return r
+	}
+	if IsInternalCall(request("")) || IsInternalCall(request("true")) {
+		t.Error("Expected no call to be internal without the secret")
+	}
+	header := http.Header{}
+	MarkInternalCall(header)
+	if len(header) != 0 {
+		t.Errorf("Expected no header without the secret, got %v", header)
+	}
+
+	t.Setenv(InternalCallSecretEnv, "shared-secret")
+	if IsInternalCall(request("true")) || IsInternalCall(request("")) {
+		t.Error("Expected only the secret to mark a call as internal")
+	}
+	if !IsInternalCall(request("shared-secret")) {
+		t.Error("Expected the secret to mark the call as internal")
+	}
+}
@@ -0,0 +1,46 @@
+package communication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxErrorBody is the largest response body kept in an UpstreamError
+const maxErrorBody = 64 << 10
+
+// UpstreamError is returned when the upstream answered with a non 2xx status.
+// It keeps the status and the body, so callers can act on the error the upstream reported.
+type UpstreamError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s %s: upstream returned %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Temporary reports whether the call may succeed if retried
+func (e *UpstreamError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// AsUpstreamError returns the UpstreamError in the chain of err, if any
+func AsUpstreamError(err error) (*UpstreamError, bool) {
+	var upstreamErr *UpstreamError
+	ok := errors.As(err, &upstreamErr)
+	return upstreamErr, ok
+}
+
+// IsStatus reports whether err is an UpstreamError with the given status code
+func IsStatus(err error, statusCode int) bool {
+	upstreamErr, ok := AsUpstreamError(err)
+	return ok && upstreamErr.StatusCode == statusCode
+}
@@ -0,0 +1,42 @@
+package communication
+
+import (
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Hooks are called around every attempt of a call, e.g. for logging or metrics
+type Hooks struct {
+	// BeforeRequest is called before the request is sent
+	BeforeRequest func(req *http.Request)
+	// AfterResponse is called with the response or the transport error of the attempt
+	AfterResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+// LoggingHooks logs every outbound request and its outcome
+func LoggingHooks(logger logrus.FieldLogger) Hooks {
+	return Hooks{
+		BeforeRequest: func(req *http.Request) {
+			logger.WithFields(logrus.Fields{
+				"method": req.Method,
+				"url":    req.URL.Redacted(),
+			}).Debug("Sending upstream request")
+		},
+		AfterResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			entry := logger.WithFields(logrus.Fields{
+				"method":  req.Method,
+				"url":     req.URL.Redacted(),
+				"latency": elapsed.Milliseconds(),
+			})
+			switch {
+			case err != nil:
+				entry.WithError(err).Warn("Upstream request failed")
+			case resp.StatusCode >= http.StatusInternalServerError:
+				entry.WithField("statusCode", resp.StatusCode).Warn("Upstream server error")
+			default:
+				entry.WithField("statusCode", resp.StatusCode).Debug("Upstream request processed")
+			}
+		},
+	}
+}
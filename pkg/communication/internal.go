@@ -0,0 +1,34 @@
+package communication
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+)
+
+// InternalCallHeader marks calls between services, its value is the secret the services share
+const InternalCallHeader = "Internal-Call"
+
+// InternalCallSecretEnv is the environment variable holding the shared secret.
+// Without it calls are not marked as internal, nor trusted as such.
+const InternalCallSecretEnv = "INTERNAL_CALL_SECRET"
+
+// InternalCallSecret returns the secret the services share, empty if not set
+func InternalCallSecret() string {
+	return os.Getenv(InternalCallSecretEnv)
+}
+
+// MarkInternalCall marks the request as a call between services if the secret is set
+func MarkInternalCall(header http.Header) {
+	if secret := InternalCallSecret(); secret != "" {
+		header.Set(InternalCallHeader, secret)
+	}
+}
+
+// IsInternalCall reports whether the request carries the shared secret.
+// The gateway must not pass the header on, anyone outside could try secrets otherwise.
+func IsInternalCall(r *http.Request) bool {
+	secret := InternalCallSecret()
+	value := r.Header.Get(InternalCallHeader)
+	return secret != "" && subtle.ConstantTimeCompare([]byte(value), []byte(secret)) == 1
+}
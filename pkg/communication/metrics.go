@@ -0,0 +1,42 @@
+package communication
+
+import (
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	outboundRequests = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Outbound HTTP attempts, by upstream host and status, \"error\" for transport errors.",
+	}, []string{"host", "method", "status"})
+
+	outboundDuration = promauto.With(metrics.Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Latency of outbound HTTP attempts, by upstream host.",
+		Buckets: metrics.DefaultBuckets,
+	}, []string{"host", "method"})
+
+	circuitRejections = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_circuit_open_total",
+		Help: "Outbound calls rejected by an open circuit breaker, by upstream host.",
+	}, []string{"host"})
+)
+
+// MetricsHooks records the count and latency of every attempt, they are part of DefaultClientConfig
+func MetricsHooks() Hooks {
+	return Hooks{
+		AfterResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			outboundRequests.WithLabelValues(req.URL.Host, req.Method, status).Inc()
+			outboundDuration.WithLabelValues(req.URL.Host, req.Method).Observe(elapsed.Seconds())
+		},
+	}
+}
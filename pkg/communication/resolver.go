@@ -0,0 +1,243 @@
+package communication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/discovery"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoEndpoints = errors.New("no healthy endpoints")
+
+// Endpoint is a resolved address of a service instance
+type Endpoint struct {
+	// ID identifies the instance, it is the address if nothing better is known
+	ID string
+	// Address is the base URL of the instance, e.g. "http://auth:8080"
+	Address string
+	// Version is the version the instance reported, if known
+	Version string
+}
+
+// Resolver finds the healthy endpoints of a service
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+}
+
+// StaticResolver resolves services from a fixed table, e.g. the docker-compose service names
+type StaticResolver map[string][]string
+
+func (s StaticResolver) Resolve(_ context.Context, service string) ([]Endpoint, error) {
+	addresses := s[service]
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%w for service %q", ErrNoEndpoints, service)
+	}
+
+	endpoints := make([]Endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		endpoints = append(endpoints, Endpoint{ID: address, Address: address})
+	}
+	return endpoints, nil
+}
+
+// ParseStaticResolver parses a table in the form "auth=http://auth:8080,catalog=http://catalog-1:8080|http://catalog-2:8080"
+func ParseStaticResolver(table string) (StaticResolver, error) {
+	resolver := StaticResolver{}
+	for _, entry := range strings.Split(table, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		service, addresses, found := strings.Cut(entry, "=")
+		if !found || service == "" || addresses == "" {
+			return nil, fmt.Errorf("invalid service endpoint entry %q", entry)
+		}
+		for _, address := range strings.Split(addresses, "|") {
+			if _, err := url.ParseRequestURI(address); err != nil {
+				return nil, fmt.Errorf("invalid address for service %q: %w", service, err)
+			}
+			resolver[service] = append(resolver[service], strings.TrimSuffix(address, "/"))
+		}
+	}
+	return resolver, nil
+}
+
+// RegistryResolver resolves services through the service registry.
+// Answers are cached for a short time, and the last known answer is used while the registry is unreachable.
+type RegistryResolver struct {
+	url    string
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]registryAnswer
+}
+
+type registryAnswer struct {
+	endpoints []Endpoint
+	fetchedAt time.Time
+}
+
+func NewRegistryResolver(registryURL string, ttl time.Duration) *RegistryResolver {
+	return &RegistryResolver{
+		url:    strings.TrimSuffix(registryURL, "/"),
+		client: &http.Client{Timeout: 2 * time.Second},
+		ttl:    ttl,
+		cache:  make(map[string]registryAnswer),
+	}
+}
+
+func (r *RegistryResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	r.mu.Lock()
+	answer, cached := r.cache[service]
+	r.mu.Unlock()
+	if cached && time.Since(answer.fetchedAt) < r.ttl {
+		return answer.endpoints, nil
+	}
+
+	endpoints, err := r.fetch(ctx, service)
+	if err != nil {
+		if cached && len(answer.endpoints) > 0 {
+			return answer.endpoints, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[service] = registryAnswer{endpoints: endpoints, fetchedAt: time.Now()}
+	r.mu.Unlock()
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%w for service %q", ErrNoEndpoints, service)
+	}
+	return endpoints, nil
+}
+
+func (r *RegistryResolver) fetch(ctx context.Context, service string) ([]Endpoint, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/services/"+url.PathEscape(service), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("service registry returned " + resp.Status)
+	}
+
+	var instances []discovery.Instance
+	if err = json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]Endpoint, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Healthy() {
+			endpoints = append(endpoints, Endpoint{ID: instance.ID, Address: instance.Address, Version: instance.Version})
+		}
+	}
+	return endpoints, nil
+}
+
+// DNSSRVResolver resolves services with DNS SRV records named "_<service>._<proto>.<domain>"
+type DNSSRVResolver struct {
+	Domain string
+	Proto  string
+	Scheme string
+
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func NewDNSSRVResolver(domain string) *DNSSRVResolver {
+	return &DNSSRVResolver{
+		Domain:    domain,
+		Proto:     "tcp",
+		Scheme:    "http",
+		lookupSRV: net.DefaultResolver.LookupSRV,
+	}
+}
+
+func (d *DNSSRVResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	// Records come back sorted by priority and randomized by weight
+	_, records, err := d.lookupSRV(ctx, service, d.Proto, d.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w for service %q", ErrNoEndpoints, service)
+	}
+
+	// Only the best priority is used, the others are backups
+	endpoints := make([]Endpoint, 0, len(records))
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			break
+		}
+		address := fmt.Sprintf("%s://%s", d.Scheme, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port)))
+		endpoints = append(endpoints, Endpoint{ID: address, Address: address})
+	}
+	return endpoints, nil
+}
+
+// FallbackResolver tries the resolvers in order and returns the first non empty answer
+type FallbackResolver []Resolver
+
+func (f FallbackResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	errs := make([]error, 0, len(f))
+	for _, resolver := range f {
+		endpoints, err := resolver.Resolve(ctx, service)
+		if err == nil && len(endpoints) > 0 {
+			return endpoints, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w for service %q", ErrNoEndpoints, service)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DefaultStaticEndpoints are the docker-compose addresses used when nothing else is configured
+var DefaultStaticEndpoints = StaticResolver{
+	"auth": {"http://auth:8080"},
+}
+
+// NewResolverFromEnv builds the resolver chain from the environment:
+//   - DISCOVERY_URL, the service registry, is asked first
+//   - DISCOVERY_SRV_DOMAIN enables DNS SRV lookups in that domain
+//   - SERVICE_ENDPOINTS, a static table as accepted by ParseStaticResolver, comes next
+//   - DefaultStaticEndpoints are the last resort
+func NewResolverFromEnv() (Resolver, error) {
+	var chain FallbackResolver
+
+	if registryURL := os.Getenv("DISCOVERY_URL"); registryURL != "" {
+		chain = append(chain, NewRegistryResolver(registryURL, 5*time.Second))
+	}
+	if domain := os.Getenv("DISCOVERY_SRV_DOMAIN"); domain != "" {
+		chain = append(chain, NewDNSSRVResolver(domain))
+	}
+	if table := os.Getenv("SERVICE_ENDPOINTS"); table != "" {
+		static, err := ParseStaticResolver(table)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, static)
+	}
+	chain = append(chain, DefaultStaticEndpoints)
+
+	return chain, nil
+}
@@ -0,0 +1,153 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/discovery"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseStaticResolver(t *testing.T) {
+	resolver, err := ParseStaticResolver("auth=http://auth:8080/, catalog=http://catalog-1:8080|http://catalog-2:8080")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	endpoints, err := resolver.Resolve(context.Background(), "catalog")
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if len(endpoints) != 2 || endpoints[1].Address != "http://catalog-2:8080" {
+		t.Errorf("Unexpected endpoints %+v", endpoints)
+	}
+
+	endpoints, _ = resolver.Resolve(context.Background(), "auth")
+	if len(endpoints) != 1 || endpoints[0].Address != "http://auth:8080" {
+		t.Errorf("Expected trailing slash to be trimmed, got %+v", endpoints)
+	}
+
+	if _, err = ParseStaticResolver("auth"); err == nil {
+		t.Errorf("Expected an error for an entry without address")
+	}
+}
+
+func TestRegistryResolverSkipsUnhealthyInstances(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := discovery.NewRegistry(discovery.DefaultTTL, discovery.DefaultDeregisterAfter)
+	router := gin.New()
+	registry.RegisterRoutes(router.Group("/"))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	_ = registry.Register(discovery.Instance{ID: "a", Name: "auth", Address: "http://a:8080"})
+	_ = registry.Register(discovery.Instance{ID: "b", Name: "auth", Address: "http://b:8080", Status: discovery.StatusCritical})
+
+	resolver := NewRegistryResolver(server.URL, time.Minute)
+	endpoints, err := resolver.Resolve(context.Background(), "auth")
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != "a" {
+		t.Errorf("Expected only the healthy instance, got %+v", endpoints)
+	}
+
+	// The last answer is kept while the registry is down
+	server.Close()
+	resolver.cache["auth"] = registryAnswer{endpoints: endpoints}
+	endpoints, err = resolver.Resolve(context.Background(), "auth")
+	if err != nil || len(endpoints) != 1 {
+		t.Errorf("Expected stale answer while the registry is down, got %+v, %v", endpoints, err)
+	}
+}
+
+func TestDNSSRVResolverUsesBestPriority(t *testing.T) {
+	resolver := NewDNSSRVResolver("service.consul")
+	resolver.lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if service != "auth" || proto != "tcp" || name != "service.consul" {
+			t.Errorf("Unexpected lookup _%s._%s.%s", service, proto, name)
+		}
+		return "", []*net.SRV{
+			{Target: "auth-1.node.", Port: 8080, Priority: 1},
+			{Target: "auth-2.node.", Port: 8081, Priority: 1},
+			{Target: "auth-backup.node.", Port: 8080, Priority: 10},
+		}, nil
+	}
+
+	endpoints, err := resolver.Resolve(context.Background(), "auth")
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if len(endpoints) != 2 || endpoints[1].Address != "http://auth-2.node:8081" {
+		t.Errorf("Unexpected endpoints %+v", endpoints)
+	}
+}
+
+func TestFallbackResolver(t *testing.T) {
+	resolver := FallbackResolver{StaticResolver{}, StaticResolver{"auth": {"http://auth:8080"}}}
+
+	endpoints, err := resolver.Resolve(context.Background(), "auth")
+	if err != nil || len(endpoints) != 1 {
+		t.Errorf("Expected the second resolver to answer, got %+v, %v", endpoints, err)
+	}
+
+	_, err = resolver.Resolve(context.Background(), "catalog")
+	if !errors.Is(err, ErrNoEndpoints) {
+		t.Errorf("Expected ErrNoEndpoints, got %v", err)
+	}
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	endpoints := []Endpoint{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	balancer := NewRoundRobinBalancer()
+
+	for i, expected := range []string{"a", "b", "c", "a"} {
+		endpoint, done := balancer.Pick(endpoints)
+		done()
+		if endpoint.ID != expected {
+			t.Errorf("Pick %d: expected %s, got %s", i, expected, endpoint.ID)
+		}
+	}
+}
+
+func TestLeastPendingBalancer(t *testing.T) {
+	endpoints := []Endpoint{{ID: "a"}, {ID: "b"}}
+	balancer := NewLeastPendingBalancer()
+
+	first, doneFirst := balancer.Pick(endpoints)
+	second, doneSecond := balancer.Pick(endpoints)
+	if first.ID == second.ID {
+		t.Fatalf("Expected the calls to be spread, both went to %s", first.ID)
+	}
+
+	// Only the first endpoint is free now
+	doneFirst()
+	third, doneThird := balancer.Pick(endpoints)
+	if third.ID != first.ID {
+		t.Errorf("Expected %s to be picked, got %s", first.ID, third.ID)
+	}
+
+	doneSecond()
+	doneThird()
+	doneThird()
+	if balancer.Pending("a") != 0 || balancer.Pending("b") != 0 {
+		t.Errorf("Expected no pending calls")
+	}
+}
+
+func TestUpstreamURL(t *testing.T) {
+	upstream := NewUpstream("auth", StaticResolver{"auth": {"http://auth:8080/"}}, nil)
+
+	url, done, err := upstream.URL(context.Background(), "/validate")
+	if err != nil {
+		t.Fatalf("Failed to build URL: %v", err)
+	}
+	done()
+	if url != "http://auth:8080/validate" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+}
@@ -0,0 +1,45 @@
+package diagnostics
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified"`
+	GoVersion  string `json:"go_version"`
+	Module     string `json:"module"`
+}
+
+// ReadBuildInfo returns the build info of the binary. The commit is taken from the VCS stamp
+// of the Go toolchain unless commit is set, e.g. with -ldflags when building without .git.
+func ReadBuildInfo(version string, commit string) BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = buildInfo.Main.Path
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
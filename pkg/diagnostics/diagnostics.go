@@ -0,0 +1,127 @@
+package diagnostics
+
+import (
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxPprofWindow is the longest time pprof can be enabled for at once
+const DefaultMaxPprofWindow = 30 * time.Minute
+
+// Config configures the diagnostics endpoints
+type Config struct {
+	// Version and Commit are reported in the build info, Commit is read from the binary if empty
+	Version string
+	Commit  string
+	// Logger is the logger whose levels are managed, the global Logger if nil
+	Logger *logrus.Logger
+	// Config returns the effective configuration of the service with secrets redacted, it is
+	// dumped as is. Services without a redaction of their own use MaskConfig.
+	Config func() (interface{}, error)
+	// MaxPprofWindow bounds the time pprof can be enabled for, DefaultMaxPprofWindow if zero
+	MaxPprofWindow time.Duration
+}
+
+// Diagnostics serves runtime diagnostics of a service. The routes must only be mounted
+// behind an admin check, they expose internals and change the behaviour of the service.
+type Diagnostics struct {
+	config    Config
+	buildInfo BuildInfo
+	// pprofUntil is the unix time in nanoseconds until which pprof is enabled
+	pprofUntil atomic.Int64
+	now        func() time.Time
+}
+
+func New(config Config) *Diagnostics {
+	if config.MaxPprofWindow <= 0 {
+		config.MaxPprofWindow = DefaultMaxPprofWindow
+	}
+	return &Diagnostics{
+		config:    config,
+		buildInfo: ReadBuildInfo(config.Version, config.Commit),
+		now:       time.Now,
+	}
+}
+
+// LogLevelRequest changes the level of a logger name, an empty logger is the default level
+type LogLevelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level" binding:"required"`
+}
+
+// PprofRequest enables pprof for a duration like "5m"
+type PprofRequest struct {
+	Duration string `json:"duration" binding:"required"`
+}
+
+// PprofStatus tells whether and until when pprof is enabled
+type PprofStatus struct {
+	Enabled bool       `json:"enabled"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// ErrPprofDisabled is returned for profiles requested while pprof is disabled
+var ErrPprofDisabled = apierror.New(apierror.KindNotFound, "DIAGNOSTICS_PPROF_DISABLED", "pprof is disabled")
+
+// RegisterRoutes registers the diagnostics API on the router
+func (d *Diagnostics) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/build", d.handleBuildInfo)
+	router.GET("/config", d.handleConfig)
+	router.GET("/log-levels", d.handleLogLevels)
+	router.PUT("/log-levels", d.handleSetLogLevel)
+	router.DELETE("/log-levels/:logger", d.handleResetLogLevel)
+	router.GET("/pprof", d.handlePprofStatus)
+	router.POST("/pprof", d.handleEnablePprof)
+	router.DELETE("/pprof", d.handleDisablePprof)
+	router.GET("/pprof/:profile", d.handlePprof)
+}
+
+func (d *Diagnostics) handleBuildInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, d.buildInfo)
+}
+
+func (d *Diagnostics) handleConfig(c *gin.Context) {
+	if d.config.Config == nil {
+		apierror.Abort(c, apierror.ErrNotFound.WithMessage("NOT_FOUND.configuration", nil))
+		return
+	}
+	config, err := d.config.Config()
+	if err != nil {
+		apierror.Abort(c, fmt.Errorf("failed to dump the configuration: %w", err))
+		return
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+func (d *Diagnostics) handleLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, logging.GetLevels(d.config.Logger))
+}
+
+func (d *Diagnostics) handleSetLogLevel(c *gin.Context) {
+	var req LogLevelRequest
+	if err := apierror.BindJSON(c, &req); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	if err := logging.SetLevel(d.config.Logger, req.Logger, req.Level); err != nil {
+		apierror.Abort(c, apierror.ErrInvalidRequest.WithDetail(err.Error()))
+		return
+	}
+	logging.FromContext(c.Request.Context()).WithFields(logrus.Fields{
+		"logger": req.Logger,
+		"level":  req.Level,
+	}).Warn("Log level changed")
+	c.JSON(http.StatusOK, logging.GetLevels(d.config.Logger))
+}
+
+func (d *Diagnostics) handleResetLogLevel(c *gin.Context) {
+	logging.ResetLevel(d.config.Logger, c.Param("logger"))
+	logging.FromContext(c.Request.Context()).WithField("logger", c.Param("logger")).Warn("Log level reset")
+	c.JSON(http.StatusOK, logging.GetLevels(d.config.Logger))
+}
@@ -0,0 +1,133 @@
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+)
+
+type testConfig struct {
+	Port     int
+	Database struct {
+		Host     string
+		Password string
+		URL      string
+	}
+	APIKey string `json:"api_key"`
+}
+
+func newTestDiagnostics() (*Diagnostics, *gin.Engine) {
+	config := testConfig{Port: 8080, APIKey: "key"}
+	config.Database.Host = "db"
+	config.Database.Password = "postgres"
+	config.Database.URL = "postgres://user:secret@db:5432/db"
+
+	diagnostics := New(Config{
+		Version: "1.2.3",
+		Logger:  logging.NewLogger(logging.LogConfig{Level: "info"}),
+		Config:  func() (interface{}, error) { return MaskConfig(config) },
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	diagnostics.RegisterRoutes(router.Group("/diagnostics"))
+	return diagnostics, router
+}
+
+func request(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, reader))
+	return recorder
+}
+
+func TestBuildInfo(t *testing.T) {
+	_, router := newTestDiagnostics()
+
+	recorder := request(router, http.MethodGet, "/diagnostics/build", nil)
+	var info BuildInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Failed to decode build info: %v", err)
+	}
+	if info.Version != "1.2.3" || info.GoVersion == "" {
+		t.Errorf("Unexpected build info %+v", info)
+	}
+}
+
+func TestConfigIsMasked(t *testing.T) {
+	_, router := newTestDiagnostics()
+
+	recorder := request(router, http.MethodGet, "/diagnostics/config", nil)
+	var config map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &config); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	database := config["Database"].(map[string]interface{})
+	if database["Password"] != logging.Redacted || config["api_key"] != logging.Redacted {
+		t.Errorf("Expected secrets to be masked, got %v", config)
+	}
+	if database["URL"] != "postgres://user:xxxxx@db:5432/db" {
+		t.Errorf("Expected the URL password to be masked, got %v", database["URL"])
+	}
+	if database["Host"] != "db" || config["Port"] != float64(8080) {
+		t.Errorf("Expected other values to be kept, got %v", config)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	diagnostics, router := newTestDiagnostics()
+
+	recorder := request(router, http.MethodPut, "/diagnostics/log-levels", LogLevelRequest{Logger: "auth.repository", Level: "debug"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if levels := logging.GetLevels(diagnostics.config.Logger); levels["auth.repository"] != "debug" {
+		t.Errorf("Expected the level to be set, got %v", levels)
+	}
+
+	recorder = request(router, http.MethodPut, "/diagnostics/log-levels", LogLevelRequest{Level: "verbose"})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid level to be rejected, got %d", recorder.Code)
+	}
+
+	request(router, http.MethodDelete, "/diagnostics/log-levels/auth.repository", nil)
+	if levels := logging.GetLevels(diagnostics.config.Logger); len(levels) != 1 {
+		t.Errorf("Expected the level to be reset, got %v", levels)
+	}
+}
+
+func TestPprofWindow(t *testing.T) {
+	diagnostics, router := newTestDiagnostics()
+	now := time.Now()
+	diagnostics.now = func() time.Time { return now }
+
+	if recorder := request(router, http.MethodGet, "/diagnostics/pprof/goroutine", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected pprof to be disabled, got %d", recorder.Code)
+	}
+
+	request(router, http.MethodPost, "/diagnostics/pprof", PprofRequest{Duration: "24h"})
+	status := diagnostics.PprofStatus()
+	if !status.Enabled || !status.Until.Equal(now.Add(DefaultMaxPprofWindow)) {
+		t.Fatalf("Expected pprof to be enabled for the max window, got %+v", status)
+	}
+	if recorder := request(router, http.MethodGet, "/diagnostics/pprof/goroutine?debug=1", nil); recorder.Code != http.StatusOK {
+		t.Errorf("Expected the goroutine profile, got %d", recorder.Code)
+	}
+
+	now = now.Add(DefaultMaxPprofWindow + time.Second)
+	if recorder := request(router, http.MethodGet, "/diagnostics/pprof/goroutine", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled after the window, got %d", recorder.Code)
+	}
+}
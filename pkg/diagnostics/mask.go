@@ -0,0 +1,49 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"net/url"
+)
+
+// MaskConfig returns the config as generic JSON with secrets replaced by logging.Redacted.
+// Fields are masked by name like in logs, e.g. "Password" or "api_key",
+// and passwords of URLs are removed.
+func MaskConfig(config interface{}) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	redactor := logging.NewRedactor(logging.RedactionConfig{Fields: logging.DefaultRedactedFields})
+	return mask(redactor, "", value), nil
+}
+
+func mask(redactor *logging.Redactor, key string, value interface{}) interface{} {
+	if redactor.IsRedactedField(key) && value != nil {
+		return logging.Redacted
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for field, fieldValue := range v {
+			v[field] = mask(redactor, field, fieldValue)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mask(redactor, key, item)
+		}
+		return v
+	case string:
+		// Connection strings may carry a password
+		if parsed, err := url.Parse(v); err == nil && parsed.User != nil {
+			return parsed.Redacted()
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package diagnostics
+
+import (
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// EnablePprof enables the pprof endpoints for the duration, bounded by MaxPprofWindow.
+// It returns the time until which they are enabled.
+func (d *Diagnostics) EnablePprof(duration time.Duration) time.Time {
+	if duration > d.config.MaxPprofWindow {
+		duration = d.config.MaxPprofWindow
+	}
+	until := d.now().Add(duration)
+	d.pprofUntil.Store(until.UnixNano())
+	return until
+}
+
+// DisablePprof disables the pprof endpoints
+func (d *Diagnostics) DisablePprof() {
+	d.pprofUntil.Store(0)
+}
+
+// PprofStatus returns whether the pprof endpoints are enabled
+func (d *Diagnostics) PprofStatus() PprofStatus {
+	until := time.Unix(0, d.pprofUntil.Load())
+	if !d.now().Before(until) {
+		return PprofStatus{}
+	}
+	return PprofStatus{Enabled: true, Until: &until}
+}
+
+func (d *Diagnostics) handlePprofStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, d.PprofStatus())
+}
+
+func (d *Diagnostics) handleEnablePprof(c *gin.Context) {
+	var req PprofRequest
+	if err := apierror.BindJSON(c, &req); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		apierror.Abort(c, apierror.ErrInvalidRequest.WithFields(apierror.FieldError{
+			Field:   "duration",
+			Rule:    "duration",
+			Message: "must be a positive duration like \"5m\"",
+		}))
+		return
+	}
+
+	until := d.EnablePprof(duration)
+	logging.FromContext(c.Request.Context()).WithField("until", until).Warn("pprof enabled")
+	c.JSON(http.StatusOK, d.PprofStatus())
+}
+
+func (d *Diagnostics) handleDisablePprof(c *gin.Context) {
+	d.DisablePprof()
+	logging.FromContext(c.Request.Context()).Info("pprof disabled")
+	c.JSON(http.StatusOK, d.PprofStatus())
+}
+
+func (d *Diagnostics) handlePprof(c *gin.Context) {
+	if !d.PprofStatus().Enabled {
+		apierror.Abort(c, ErrPprofDisabled)
+		return
+	}
+
+	switch profile := c.Param("profile"); profile {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		// Named profiles, e.g. heap, goroutine or allocs
+		pprof.Handler(profile).ServeHTTP(c.Writer, c.Request)
+	}
+}
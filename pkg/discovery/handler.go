@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// HeartbeatRequest is the body of a heartbeat
+type HeartbeatRequest struct {
+	Status string `json:"status"`
+}
+
+// RegisterRoutes registers the registry HTTP API on the router
+func (r *Registry) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/services", r.handleServices)
+	router.POST("/services", r.handleRegister)
+	router.GET("/services/:name", r.handleInstances)
+	router.PUT("/services/:name/:id/heartbeat", r.handleHeartbeat)
+	router.DELETE("/services/:name/:id", r.handleDeregister)
+}
+
+// RunReaper removes dead instances every interval until the context is cancelled
+func (r *Registry) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reap()
+		}
+	}
+}
+
+func (r *Registry) handleServices(c *gin.Context) {
+	c.JSON(http.StatusOK, r.Services())
+}
+
+func (r *Registry) handleRegister(c *gin.Context) {
+	var instance Instance
+	if err := apierror.BindJSON(c, &instance); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	if err := r.Register(instance); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Registry) handleInstances(c *gin.Context) {
+	c.JSON(http.StatusOK, r.Instances(c.Param("name")))
+}
+
+func (r *Registry) handleHeartbeat(c *gin.Context) {
+	var req HeartbeatRequest
+	// An empty body keeps the current status
+	_ = c.ShouldBindJSON(&req)
+
+	err := r.Heartbeat(c.Param("name"), c.Param("id"), req.Status)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Registry) handleDeregister(c *gin.Context) {
+	err := r.Deregister(c.Param("name"), c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// RegistrarConfig is the configuration for registering a service instance
+type RegistrarConfig struct {
+	// RegistryURL is the base URL of the registry API
+	RegistryURL string
+	// Instance is the instance to register, an ID is generated if empty
+	Instance Instance
+	// Interval is the time between heartbeats, it should be well below the registry TTL
+	Interval time.Duration
+	// Health returns the status reported with every heartbeat, StatusPassing is used if nil
+	Health func() string
+	// Client is the HTTP client used to talk to the registry
+	Client *http.Client
+}
+
+// Registrar keeps a service instance registered for as long as it runs
+type Registrar struct {
+	config RegistrarConfig
+	done   chan struct{}
+}
+
+func NewRegistrar(config RegistrarConfig) *Registrar {
+	config.RegistryURL = strings.TrimSuffix(config.RegistryURL, "/")
+	if config.Instance.ID == "" {
+		config.Instance.ID = NewInstanceID(config.Instance.Name)
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultTTL / 3
+	}
+	if config.Health == nil {
+		config.Health = func() string { return StatusPassing }
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &Registrar{config: config, done: make(chan struct{})}
+}
+
+// NewInstanceID returns a unique instance ID based on the host name
+func NewInstanceID(name string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = name
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+// Instance returns the registered instance
+func (r *Registrar) Instance() Instance {
+	return r.config.Instance
+}
+
+// Start registers the instance and sends heartbeats in the background until the context is cancelled.
+// The registry being down is not fatal, the registrar keeps trying.
+func (r *Registrar) Start(ctx context.Context) {
+	if err := r.register(ctx); err != nil {
+		logging.Logger.Warn("Failed to register in service registry, will retry: ", err)
+	}
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.beat(ctx)
+			}
+		}
+	}()
+}
+
+// Stop deregisters the instance. The context given to Start should be cancelled first.
+func (r *Registrar) Stop(ctx context.Context) error {
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	path := "/services/" + url.PathEscape(r.config.Instance.Name) + "/" + url.PathEscape(r.config.Instance.ID)
+	return r.send(ctx, http.MethodDelete, path, nil)
+}
+
+func (r *Registrar) beat(ctx context.Context) {
+	path := "/services/" + url.PathEscape(r.config.Instance.Name) + "/" + url.PathEscape(r.config.Instance.ID) + "/heartbeat"
+	err := r.send(ctx, http.MethodPut, path, HeartbeatRequest{Status: r.config.Health()})
+	if errors.Is(err, ErrInstanceNotFound) {
+		// The registry restarted or reaped us
+		err = r.register(ctx)
+	}
+	if err != nil && ctx.Err() == nil {
+		logging.Logger.Warn("Service registry heartbeat failed: ", err)
+	}
+}
+
+func (r *Registrar) register(ctx context.Context) error {
+	instance := r.config.Instance
+	instance.Status = r.config.Health()
+	return r.send(ctx, http.MethodPost, "/services", instance)
+}
+
+func (r *Registrar) send(ctx context.Context, method string, path string, body interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.config.RegistryURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrInstanceNotFound
+	case resp.StatusCode >= http.StatusBadRequest:
+		return errors.New("service registry returned " + resp.Status)
+	}
+	return nil
+}
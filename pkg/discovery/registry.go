@@ -0,0 +1,174 @@
+package discovery
+
+import (
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPassing  = "passing"
+	StatusWarning  = "warning"
+	StatusCritical = "critical"
+)
+
+const (
+	// DefaultTTL is how long an instance stays healthy without a heartbeat
+	DefaultTTL = 15 * time.Second
+	// DefaultDeregisterAfter is how long an instance without heartbeats is kept before it is removed
+	DefaultDeregisterAfter = time.Minute
+)
+
+var (
+	ErrInvalidInstance  = apierror.New(apierror.KindInvalid, "DISCOVERY_INVALID_INSTANCE", "Instance must have an id, a name and an address")
+	ErrInstanceNotFound = apierror.New(apierror.KindNotFound, "DISCOVERY_INSTANCE_NOT_FOUND", "Instance not found")
+)
+
+// Instance is a running copy of a service
+type Instance struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Address       string            `json:"address"`
+	Version       string            `json:"version"`
+	Status        string            `json:"status"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	RegisteredAt  time.Time         `json:"registered_at"`
+	LastHeartbeat time.Time         `json:"last_heartbeat"`
+}
+
+// Registry keeps track of service instances and their health in memory
+type Registry struct {
+	mu              sync.RWMutex
+	instances       map[string]map[string]*Instance
+	ttl             time.Duration
+	deregisterAfter time.Duration
+	now             func() time.Time
+}
+
+func NewRegistry(ttl time.Duration, deregisterAfter time.Duration) *Registry {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if deregisterAfter < ttl {
+		deregisterAfter = ttl
+	}
+	return &Registry{
+		instances:       make(map[string]map[string]*Instance),
+		ttl:             ttl,
+		deregisterAfter: deregisterAfter,
+		now:             time.Now,
+	}
+}
+
+// Register adds the instance or replaces a previous registration with the same name and ID
+func (r *Registry) Register(instance Instance) error {
+	if instance.ID == "" || instance.Name == "" || instance.Address == "" {
+		return ErrInvalidInstance
+	}
+	if instance.Status == "" {
+		instance.Status = StatusPassing
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	instance.RegisteredAt = now
+	instance.LastHeartbeat = now
+
+	if r.instances[instance.Name] == nil {
+		r.instances[instance.Name] = make(map[string]*Instance)
+	}
+	r.instances[instance.Name][instance.ID] = &instance
+	return nil
+}
+
+// Heartbeat renews the instance and updates its status
+func (r *Registry) Heartbeat(name string, id string, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instance, ok := r.instances[name][id]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	if status != "" {
+		instance.Status = status
+	}
+	instance.LastHeartbeat = r.now()
+	return nil
+}
+
+// Deregister removes the instance
+func (r *Registry) Deregister(name string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.instances[name][id]; !ok {
+		return ErrInstanceNotFound
+	}
+	delete(r.instances[name], id)
+	if len(r.instances[name]) == 0 {
+		delete(r.instances, name)
+	}
+	return nil
+}
+
+// Instances returns the instances of the service sorted by ID.
+// Instances that missed their heartbeats are reported as critical.
+func (r *Registry) Instances(name string) []Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	instances := make([]Instance, 0, len(r.instances[name]))
+	for _, instance := range r.instances[name] {
+		copied := *instance
+		if now.Sub(copied.LastHeartbeat) > r.ttl {
+			copied.Status = StatusCritical
+		}
+		instances = append(instances, copied)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// Services returns the names of all registered services
+func (r *Registry) Services() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.instances))
+	for name := range r.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reap removes instances that have not sent a heartbeat for too long
+func (r *Registry) Reap() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for name, instances := range r.instances {
+		for id, instance := range instances {
+			if now.Sub(instance.LastHeartbeat) > r.deregisterAfter {
+				delete(instances, id)
+			}
+		}
+		if len(instances) == 0 {
+			delete(r.instances, name)
+		}
+	}
+}
+
+// Healthy reports whether the instance should receive traffic
+func (i Instance) Healthy() bool {
+	return i.Status == StatusPassing || i.Status == StatusWarning
+}
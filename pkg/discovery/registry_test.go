@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRegistryServer(t *testing.T, registry *Registry) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logging.BaseInitLogger(logging.LogConfig{Level: "error"})
+
+	router := gin.New()
+	registry.RegisterRoutes(router.Group("/"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegistryMarksMissedHeartbeatsCritical(t *testing.T) {
+	now := time.Now()
+	registry := NewRegistry(10*time.Second, time.Minute)
+	registry.now = func() time.Time { return now }
+
+	if err := registry.Register(Instance{ID: "a", Name: "auth", Address: "http://a:8080"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := registry.Register(Instance{ID: "b", Name: "auth", Address: "http://b:8080"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	now = now.Add(8 * time.Second)
+	if err := registry.Heartbeat("auth", "b", ""); err != nil {
+		t.Fatalf("Failed to send heartbeat: %v", err)
+	}
+	now = now.Add(5 * time.Second)
+
+	instances := registry.Instances("auth")
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d", len(instances))
+	}
+	if instances[0].Healthy() {
+		t.Errorf("Expected instance 'a' to be critical after missing heartbeats")
+	}
+	if !instances[1].Healthy() {
+		t.Errorf("Expected instance 'b' to be healthy")
+	}
+
+	now = now.Add(time.Minute)
+	registry.Reap()
+	if services := registry.Services(); len(services) != 0 {
+		t.Errorf("Expected all instances to be reaped, got %v", services)
+	}
+}
+
+func TestRegistryRejectsIncompleteInstances(t *testing.T) {
+	registry := NewRegistry(DefaultTTL, DefaultDeregisterAfter)
+	if err := registry.Register(Instance{Name: "auth"}); err != ErrInvalidInstance {
+		t.Errorf("Expected ErrInvalidInstance, got %v", err)
+	}
+}
+
+func TestRegistrarLifecycle(t *testing.T) {
+	registry := NewRegistry(time.Second, time.Minute)
+	server := newTestRegistryServer(t, registry)
+
+	status := StatusPassing
+	statusCh := make(chan string, 1)
+	registrar := NewRegistrar(RegistrarConfig{
+		RegistryURL: server.URL,
+		Instance:    Instance{Name: "auth", Address: "http://auth:8080", Version: "1.0.0"},
+		Interval:    10 * time.Millisecond,
+		Health: func() string {
+			select {
+			case status = <-statusCh:
+			default:
+			}
+			return status
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registrar.Start(ctx)
+
+	instances := registry.Instances("auth")
+	if len(instances) != 1 || instances[0].ID != registrar.Instance().ID || instances[0].Version != "1.0.0" {
+		t.Fatalf("Expected the instance to be registered, got %+v", instances)
+	}
+
+	// Heartbeats carry the health status
+	statusCh <- StatusCritical
+	waitFor(t, func() bool {
+		instances := registry.Instances("auth")
+		return len(instances) == 1 && instances[0].Status == StatusCritical
+	})
+
+	// A registry that forgot the instance gets it back on the next heartbeat
+	statusCh <- StatusPassing
+	_ = registry.Deregister("auth", registrar.Instance().ID)
+	waitFor(t, func() bool {
+		instances := registry.Instances("auth")
+		return len(instances) == 1 && instances[0].Healthy()
+	})
+
+	cancel()
+	if err := registrar.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to deregister: %v", err)
+	}
+	if instances := registry.Instances("auth"); len(instances) != 0 {
+		t.Errorf("Expected the instance to be deregistered, got %+v", instances)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,26 @@
+package i18n_test
+
+import (
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	_ "github.com/Ruletk/GoMarketplace/pkg/diagnostics"
+	_ "github.com/Ruletk/GoMarketplace/pkg/discovery"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	_ "github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"golang.org/x/text/language"
+)
+
+// TestCatalogsAreComplete checks every error of the shared packages is translated to every language
+func TestCatalogsAreComplete(t *testing.T) {
+	bundle, err := i18n.NewBundle(language.English, i18n.Catalogs)
+	if err != nil {
+		t.Fatalf("Failed to load the catalogs: %v", err)
+	}
+	if languages := bundle.Languages(); len(languages) != 3 {
+		t.Errorf("Expected en, kk and ru, got %v", languages)
+	}
+	for _, missing := range bundle.Missing(apierror.Codes()...) {
+		t.Errorf("Missing translation %s", missing)
+	}
+}
@@ -0,0 +1,251 @@
+// Package i18n localizes the messages of the APIs. Messages are looked up by key, usually the
+// code of an error, in catalogs loaded per language. The language of a request is negotiated
+// from its Accept-Language header, a language the user chose overrides it.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Catalogs are the messages of the shared packages: the generic error codes, the errors of
+// the scheduler, the diagnostics and the discovery, and the validation rules
+//
+//go:embed locales/*.yaml
+var Catalogs embed.FS
+
+// Args are the variables of a message, "{name}" in a message is replaced by the value of name.
+// The count variable picks the plural form of messages that have them.
+type Args map[string]interface{}
+
+// message is a catalog entry, either a single text or plural forms keyed by CLDR category
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+func (m *message) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.text)
+	}
+	if err := node.Decode(&m.forms); err != nil {
+		return err
+	}
+	if _, ok := m.forms["other"]; !ok {
+		return fmt.Errorf("line %d: plural forms without the \"other\" form", node.Line)
+	}
+	return nil
+}
+
+// Bundle holds the catalogs of the supported languages
+type Bundle struct {
+	fallback  language.Tag
+	languages []language.Tag
+	matcher   language.Matcher
+	catalogs  map[language.Tag]map[string]message
+}
+
+// NewBundle loads the catalogs of the file systems, a catalog is a YAML file named by its language,
+// e.g. "locales/ru.yaml". Later catalogs override the messages of earlier ones. Messages missing
+// in a language are taken from the fallback language.
+func NewBundle(fallback language.Tag, catalogs ...fs.FS) (*Bundle, error) {
+	b := &Bundle{fallback: fallback, catalogs: map[language.Tag]map[string]message{fallback: {}}}
+	for _, fsys := range catalogs {
+		if err := b.load(fsys); err != nil {
+			return nil, err
+		}
+	}
+
+	// The matcher falls back to the first language
+	b.languages = []language.Tag{fallback}
+	for tag := range b.catalogs {
+		if tag != fallback {
+			b.languages = append(b.languages, tag)
+		}
+	}
+	sort.Slice(b.languages[1:], func(i, j int) bool {
+		return b.languages[i+1].String() < b.languages[j+1].String()
+	})
+	b.matcher = language.NewMatcher(b.languages)
+	return b, nil
+}
+
+// MustNewBundle is NewBundle panicking on an error, for catalogs embedded in the binary
+func MustNewBundle(fallback language.Tag, catalogs ...fs.FS) *Bundle {
+	b, err := NewBundle(fallback, catalogs...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (b *Bundle) load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.yaml")
+	if err != nil {
+		return err
+	}
+	root, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return err
+	}
+	for _, file := range append(root, files...) {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".yaml"))
+		if err != nil {
+			return fmt.Errorf("catalog %s is not named by a language: %w", file, err)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var messages map[string]message
+		if err = yaml.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("invalid catalog %s: %w", file, err)
+		}
+		if b.catalogs[tag] == nil {
+			b.catalogs[tag] = make(map[string]message, len(messages))
+		}
+		for key, msg := range messages {
+			b.catalogs[tag][key] = msg
+		}
+	}
+	return nil
+}
+
+// Languages returns the supported languages, the fallback language first
+func (b *Bundle) Languages() []language.Tag {
+	return append([]language.Tag{}, b.languages...)
+}
+
+// Keys returns the sorted keys of the messages of a language, without the fallback ones
+func (b *Bundle) Keys(tag language.Tag) []string {
+	keys := make([]string, 0, len(b.catalogs[tag]))
+	for key := range b.catalogs[tag] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Missing returns the messages the languages lack as "language: key", the given keys and the
+// messages of the fallback language. Tests check with it that everything is translated.
+func (b *Bundle) Missing(keys ...string) []string {
+	expected := append(b.Keys(b.fallback), keys...)
+	var missing []string
+	for _, tag := range b.languages {
+		for _, key := range expected {
+			if _, ok := b.catalogs[tag][key]; !ok {
+				missing = append(missing, tag.String()+": "+key)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return compact(missing)
+}
+
+// compact removes adjacent duplicates of a sorted slice
+func compact(sorted []string) []string {
+	if len(sorted) == 0 {
+		return sorted
+	}
+	unique := sorted[:1]
+	for _, s := range sorted[1:] {
+		if s != unique[len(unique)-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// Localizer returns the localizer of the supported language matching the preferences best. A
+// preference is a language tag or an Accept-Language header, earlier preferences win, invalid
+// and empty ones are ignored.
+func (b *Bundle) Localizer(preferences ...string) *Localizer {
+	var tags []language.Tag
+	for _, preference := range preferences {
+		parsed, _, err := language.ParseAcceptLanguage(preference)
+		if err == nil {
+			tags = append(tags, parsed...)
+		}
+	}
+	_, index, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		index = 0
+	}
+	return &Localizer{bundle: b, language: b.languages[index]}
+}
+
+// Localizer renders the messages of a bundle in a language
+type Localizer struct {
+	bundle   *Bundle
+	language language.Tag
+}
+
+// Language returns the language messages are rendered in
+func (l *Localizer) Language() language.Tag {
+	return l.language
+}
+
+// Lookup renders the message of the key with the args, the message of the fallback language if
+// the language lacks it. It reports false if neither has the message.
+func (l *Localizer) Lookup(key string, args Args) (string, bool) {
+	tag := l.language
+	msg, ok := l.bundle.catalogs[tag][key]
+	if !ok {
+		tag = l.bundle.fallback
+		msg, ok = l.bundle.catalogs[tag][key]
+	}
+	if !ok {
+		return "", false
+	}
+
+	text := msg.text
+	if msg.forms != nil {
+		text = msg.forms["other"]
+		if count, ok := args["count"]; ok {
+			if form, ok := msg.forms[pluralCategory(tag, count)]; ok {
+				text = form
+			}
+		}
+	}
+	return format(text, args), true
+}
+
+// Text renders the message of the key like Lookup, a missing message is rendered as its key
+func (l *Localizer) Text(key string, args Args) string {
+	if text, ok := l.Lookup(key, args); ok {
+		return text
+	}
+	return key
+}
+
+// format replaces the variables of the text, unknown variables are kept
+func format(text string, args Args) string {
+	if len(args) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+	replacements := make([]string, 0, 2*len(args))
+	for name, value := range args {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+var (
+	defaultBundle     *Bundle
+	defaultBundleOnce sync.Once
+)
+
+// Default returns the English localizer of the shared catalogs, used for requests without one
+func Default() *Localizer {
+	defaultBundleOnce.Do(func() {
+		defaultBundle = MustNewBundle(language.English, Catalogs)
+	})
+	return defaultBundle.Localizer()
+}
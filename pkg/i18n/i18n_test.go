@@ -0,0 +1,116 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+var testCatalogs = fstest.MapFS{
+	"en.yaml": {Data: []byte("GREETING: Hello, {name}\nSESSIONS:\n  one: '{count} session'\n  other: '{count} sessions'\nONLY_ENGLISH: English\n")},
+	"ru.yaml": {Data: []byte("GREETING: Привет, {name}\nSESSIONS:\n  one: '{count} сессия'\n  few: '{count} сессии'\n  many: '{count} сессий'\n  other: '{count} сессии'\n")},
+	"kk.yaml": {Data: []byte("GREETING: Сәлем, {name}\n")},
+}
+
+func TestLocalizerNegotiation(t *testing.T) {
+	bundle := MustNewBundle(language.English, testCatalogs)
+
+	tests := []struct {
+		preferences []string
+		expected    string
+	}{
+		{nil, "en"},
+		{[]string{"ru-RU,ru;q=0.9,en;q=0.8"}, "ru"},
+		{[]string{"de-DE,kk;q=0.5,ru;q=0.3"}, "kk"},
+		{[]string{"de-DE"}, "en"},
+		{[]string{"kk", "ru-RU,en;q=0.5"}, "kk"},
+		{[]string{"", "ru"}, "ru"},
+		{[]string{"not a language!", "ru"}, "ru"},
+	}
+	for _, tc := range tests {
+		if lang := bundle.Localizer(tc.preferences...).Language().String(); lang != tc.expected {
+			t.Errorf("Expected %q for %q, got %q", tc.expected, tc.preferences, lang)
+		}
+	}
+}
+
+func TestLocalizerText(t *testing.T) {
+	bundle := MustNewBundle(language.English, testCatalogs)
+	en, ru, kk := bundle.Localizer("en"), bundle.Localizer("ru"), bundle.Localizer("kk")
+
+	tests := []struct {
+		localizer *Localizer
+		key       string
+		args      Args
+		expected  string
+	}{
+		{ru, "GREETING", Args{"name": "Алия"}, "Привет, Алия"},
+		{en, "SESSIONS", Args{"count": 1}, "1 session"},
+		{en, "SESSIONS", Args{"count": 11}, "11 sessions"},
+		{ru, "SESSIONS", Args{"count": 1}, "1 сессия"},
+		{ru, "SESSIONS", Args{"count": 21}, "21 сессия"},
+		{ru, "SESSIONS", Args{"count": int64(3)}, "3 сессии"},
+		{ru, "SESSIONS", Args{"count": 12}, "12 сессий"},
+		{ru, "SESSIONS", Args{"count": 25}, "25 сессий"},
+		{ru, "SESSIONS", Args{"count": 1.5}, "1.5 сессии"},
+		// Missing messages come from the fallback language, then the key is rendered
+		{kk, "ONLY_ENGLISH", nil, "English"},
+		{kk, "MISSING", nil, "MISSING"},
+		// Unknown variables are kept
+		{en, "GREETING", nil, "Hello, {name}"},
+	}
+	for _, tc := range tests {
+		if text := tc.localizer.Text(tc.key, tc.args); text != tc.expected {
+			t.Errorf("Expected %q for %s in %s, got %q", tc.expected, tc.key, tc.localizer.Language(), text)
+		}
+	}
+}
+
+func TestNewBundleRejectsInvalidCatalogs(t *testing.T) {
+	invalid := []fstest.MapFS{
+		{"english.yaml": {Data: []byte("GREETING: Hello\n")}},
+		{"en.yaml": {Data: []byte("SESSIONS:\n  one: a session\n")}},
+		{"en.yaml": {Data: []byte("- a list\n")}},
+	}
+	for _, catalogs := range invalid {
+		if _, err := NewBundle(language.English, catalogs); err == nil {
+			t.Errorf("Expected %v to be rejected", catalogs)
+		}
+	}
+}
+
+func TestMiddlewarePrefersTheUserLanguage(t *testing.T) {
+	bundle := MustNewBundle(language.English, testCatalogs)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(bundle))
+	router.GET("/greeting", func(c *gin.Context) {
+		Prefer(c, c.Query("preferred"))
+		c.String(http.StatusOK, FromContext(c.Request.Context()).Text("GREETING", Args{"name": "Aliya"}))
+	})
+
+	tests := []struct {
+		acceptLanguage string
+		preferred      string
+		expected       string
+		language       string
+	}{
+		{"ru", "", "Привет, Aliya", "ru"},
+		{"ru", "kk", "Сәлем, Aliya", "kk"},
+		{"ru", "de", "Привет, Aliya", "ru"},
+		{"", "", "Hello, Aliya", "en"},
+	}
+	for _, tc := range tests {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/greeting?preferred="+tc.preferred, nil)
+		request.Header.Set("Accept-Language", tc.acceptLanguage)
+		router.ServeHTTP(recorder, request)
+		if recorder.Body.String() != tc.expected || recorder.Header().Get("Content-Language") != tc.language {
+			t.Errorf("Expected %q in %s, got %q in %s", tc.expected, tc.language, recorder.Body.String(), recorder.Header().Get("Content-Language"))
+		}
+	}
+}
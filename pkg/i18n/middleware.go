@@ -0,0 +1,48 @@
+package i18n
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+)
+
+type localizerKey struct{}
+
+// ContextWithLocalizer returns a context carrying the localizer
+func ContextWithLocalizer(ctx context.Context, localizer *Localizer) context.Context {
+	return context.WithValue(ctx, localizerKey{}, localizer)
+}
+
+// FromContext returns the localizer carried by the context, or Default
+func FromContext(ctx context.Context) *Localizer {
+	if ctx != nil {
+		if localizer, ok := ctx.Value(localizerKey{}).(*Localizer); ok {
+			return localizer
+		}
+	}
+	return Default()
+}
+
+// Middleware negotiates the language of the response from the Accept-Language header and stores
+// its localizer in the request context, see FromContext
+func Middleware(bundle *Bundle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		setLocalizer(c, bundle.Localizer(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
+
+// Prefer switches the request to the language the user chose, it wins over the Accept-Language
+// header. An empty or unsupported language leaves the negotiated one.
+func Prefer(c *gin.Context, lang string) {
+	if lang == "" {
+		return
+	}
+	localizer := FromContext(c.Request.Context())
+	setLocalizer(c, localizer.bundle.Localizer(lang, c.GetHeader("Accept-Language")))
+}
+
+func setLocalizer(c *gin.Context, localizer *Localizer) {
+	c.Request = c.Request.WithContext(ContextWithLocalizer(c.Request.Context(), localizer))
+	c.Header("Content-Language", localizer.Language().String())
+}
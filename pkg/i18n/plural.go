@@ -0,0 +1,57 @@
+package i18n
+
+import (
+	"golang.org/x/text/language"
+	"math"
+)
+
+// pluralCategory returns the CLDR plural category of count in the language: "one", "few", "many"
+// or "other". Only the rules of the shipped languages are known, others use the English rule.
+func pluralCategory(tag language.Tag, count interface{}) string {
+	n, ok := integer(count)
+	if !ok {
+		return "other"
+	}
+	if n < 0 {
+		n = -n
+	}
+
+	base, _ := tag.Base()
+	switch base.String() {
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	}
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// integer converts count to an integer, fractions are not integers
+func integer(count interface{}) (int64, bool) {
+	switch n := count.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float64:
+		if n == math.Trunc(n) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
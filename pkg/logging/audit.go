@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AuditLoggerName names the logger of audit events, its level can be set apart in LogConfig.Levels
+	AuditLoggerName = "audit"
+	// AuditEventField holds the type of an audit event, e.g. "session.revoked"
+	AuditEventField = "auditEvent"
+)
+
+// Audit logs a security relevant event with the request scoped fields of ctx. Audit events are
+// never sampled, a sink can pick them out by AuditEventField.
+func Audit(ctx context.Context, event string, fields logrus.Fields) {
+	ForContext(nil, ctx).
+		WithField(LoggerNameField, AuditLoggerName).
+		WithField(AuditEventField, event).
+		WithFields(fields).
+		Info("Audit event: ", event)
+}
+
+// isAudit reports whether the entry is an audit event
+func isAudit(entry *logrus.Entry) bool {
+	_, ok := entry.Data[AuditEventField]
+	return ok
+}
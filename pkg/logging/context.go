@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type fieldsKey struct{}
+
+// WithContext returns a copy of ctx carrying the fields in addition to the fields already in ctx.
+// Every entry made with FromContext or ForContext for the returned context has the fields.
+func WithContext(ctx context.Context, fields logrus.Fields) context.Context {
+	parent := Fields(ctx)
+	merged := make(logrus.Fields, len(parent)+len(fields))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields returns the request scoped fields carried by ctx
+func Fields(ctx context.Context) logrus.Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// FromContext returns an entry of the global Logger with the fields, trace and request IDs of ctx
+func FromContext(ctx context.Context) *logrus.Entry {
+	return ForContext(nil, ctx)
+}
+
+// ForContext returns an entry of logger with the fields, trace and request IDs of ctx.
+// A nil logger stands for the global Logger, so components can take an optional logger.
+func ForContext(logger *logrus.Logger, ctx context.Context) *logrus.Entry {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return orDefault(logger).WithFields(Fields(ctx)).WithContext(ctx)
+}
+
+func orDefault(logger *logrus.Logger) *logrus.Logger {
+	if logger == nil {
+		logger = Logger
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return logger
+}
+
+// ContextLogger seeds the request context with the route and the client address,
+// so every line logged with FromContext while handling the request has them.
+// Later handlers can add fields with AddFields, e.g. the authenticated user.
+func ContextLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		AddFields(c, logrus.Fields{
+			"method":   c.Request.Method,
+			"route":    route,
+			"clientIP": c.ClientIP(),
+		})
+		c.Next()
+	}
+}
+
+// AddFields adds fields to the request context of c
+func AddFields(c *gin.Context, fields logrus.Fields) {
+	c.Request = c.Request.WithContext(WithContext(c.Request.Context(), fields))
+}
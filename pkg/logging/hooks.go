@@ -1,9 +1,11 @@
 package logging
 
 import (
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
 	"github.com/sirupsen/logrus"
 )
 
+// LoggerNameHook names entries that are not logged through a named entry, see Named
 type LoggerNameHook struct {
 	LoggerName string
 }
@@ -13,6 +15,30 @@ func (hook *LoggerNameHook) Levels() []logrus.Level {
 }
 
 func (hook *LoggerNameHook) Fire(entry *logrus.Entry) error {
-	entry.Data["loggerName"] = hook.LoggerName
+	if _, ok := entry.Data[LoggerNameField]; !ok {
+		entry.Data[LoggerNameField] = hook.LoggerName
+	}
+	return nil
+}
+
+// TraceHook adds the trace, span and request IDs of the entry context to the entry.
+// Use Logger.WithContext(ctx) to log with a request context.
+type TraceHook struct{}
+
+func (hook *TraceHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *TraceHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if traceID, spanID := tracing.IDs(entry.Context); traceID != "" {
+		entry.Data["trace_id"] = traceID
+		entry.Data["span_id"] = spanID
+	}
+	if requestID := tracing.RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data["request_id"] = requestID
+	}
 	return nil
 }
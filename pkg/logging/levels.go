@@ -0,0 +1,232 @@
+package logging
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoggerNameField is the field holding the logger name, set by LoggerNameHook
+const LoggerNameField = "loggerName"
+
+// Named returns an entry of the global Logger for a component, e.g. "auth.repository".
+// Levels configured for the name, or for one of its parents, apply to the entries.
+func Named(name string) *logrus.Entry {
+	return orDefault(nil).WithField(LoggerNameField, name)
+}
+
+// nameLevels holds the levels configured per logger name, they can be changed at runtime
+type nameLevels struct {
+	mu       sync.RWMutex
+	fallback logrus.Level
+	levels   map[string]logrus.Level
+}
+
+func newNameLevels(fallback logrus.Level, config map[string]string) (*nameLevels, []string) {
+	var invalid []string
+	levels := make(map[string]logrus.Level, len(config))
+	for name, value := range config {
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			invalid = append(invalid, name)
+			continue
+		}
+		levels[name] = level
+	}
+	return &nameLevels{fallback: fallback, levels: levels}, invalid
+}
+
+// lowest returns the most verbose level, which the logger itself must be set to
+func (n *nameLevels) lowest() logrus.Level {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	lowest := n.fallback
+	for _, level := range n.levels {
+		if level > lowest {
+			lowest = level
+		}
+	}
+	return lowest
+}
+
+// level returns the level of the longest configured name that is the name or one of its parents
+func (n *nameLevels) level(name string) logrus.Level {
+	for {
+		if level, ok := n.levels[name]; ok {
+			return level
+		}
+		dot := strings.LastIndexByte(name, '.')
+		if dot < 0 {
+			return n.fallback
+		}
+		name = name[:dot]
+	}
+}
+
+func (n *nameLevels) enabled(entry *logrus.Entry) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if len(n.levels) == 0 {
+		return entry.Level <= n.fallback
+	}
+	name, _ := entry.Data[LoggerNameField].(string)
+	return entry.Level <= n.level(name)
+}
+
+// RootLogger is the name standing for the level of entries without a configured name
+const RootLogger = ""
+
+// GetLevels returns the level per configured logger name, RootLogger holds the default level.
+// A nil logger stands for the global Logger.
+func GetLevels(logger *logrus.Logger) map[string]string {
+	levels := loggerLevels(logger)
+	if levels == nil {
+		return map[string]string{RootLogger: orDefault(logger).GetLevel().String()}
+	}
+
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	result := map[string]string{RootLogger: levels.fallback.String()}
+	for name, level := range levels.levels {
+		result[name] = level.String()
+	}
+	return result
+}
+
+// SetLevel changes the level of a logger name and its children at runtime,
+// RootLogger changes the default level. A nil logger stands for the global Logger.
+func SetLevel(logger *logrus.Logger, name string, level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger = orDefault(logger)
+	levels := loggerLevels(logger)
+	if levels == nil {
+		if name != RootLogger {
+			return errors.New("logger was not created with NewLogger, only the root level can be set")
+		}
+		logger.SetLevel(parsed)
+		return nil
+	}
+
+	levels.mu.Lock()
+	if name == RootLogger {
+		levels.fallback = parsed
+	} else {
+		levels.levels[name] = parsed
+	}
+	levels.mu.Unlock()
+	logger.SetLevel(levels.lowest())
+	return nil
+}
+
+// ResetLevel removes the level of a logger name, it then logs with the level of its parent
+func ResetLevel(logger *logrus.Logger, name string) {
+	logger = orDefault(logger)
+	levels := loggerLevels(logger)
+	if levels == nil || name == RootLogger {
+		return
+	}
+
+	levels.mu.Lock()
+	delete(levels.levels, name)
+	levels.mu.Unlock()
+	logger.SetLevel(levels.lowest())
+}
+
+func loggerLevels(logger *logrus.Logger) *nameLevels {
+	formatter, ok := orDefault(logger).Formatter.(*filterFormatter)
+	if !ok {
+		return nil
+	}
+	return formatter.levels
+}
+
+// SamplingConfig limits repeated entries: in every Tick the first First entries with the same
+// level and message are logged, and after that only every Thereafter-th one.
+type SamplingConfig struct {
+	// Level is the most severe level that is sampled, debug if empty
+	Level      string
+	Tick       time.Duration
+	First      int
+	Thereafter int
+}
+
+type sampler struct {
+	level      logrus.Level
+	tick       time.Duration
+	first      int
+	thereafter int
+
+	mu      sync.Mutex
+	resetAt time.Time
+	counts  map[string]int
+	now     func() time.Time
+}
+
+func newSampler(config SamplingConfig) *sampler {
+	level, err := logrus.ParseLevel(config.Level)
+	if err != nil {
+		level = logrus.DebugLevel
+	}
+	tick := config.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return &sampler{
+		level:      level,
+		tick:       tick,
+		first:      config.First,
+		thereafter: config.Thereafter,
+		counts:     make(map[string]int),
+		now:        time.Now,
+	}
+}
+
+func (s *sampler) allow(entry *logrus.Entry) bool {
+	if entry.Level < s.level || isAudit(entry) {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.resetAt) {
+		s.counts = make(map[string]int)
+		s.resetAt = now.Add(s.tick)
+	}
+	key := entry.Level.String() + entry.Message
+	s.counts[key]++
+	count := s.counts[key]
+
+	if count <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (count-s.first)%s.thereafter == 0
+}
+
+// filterFormatter drops entries disabled for their logger name or sampled out.
+// Filtering happens here because logrus hooks cannot drop entries; a dropped entry
+// is formatted to nothing, so no sink receives it.
+type filterFormatter struct {
+	logrus.Formatter
+	levels  *nameLevels
+	sampler *sampler
+}
+
+func (f *filterFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.levels.enabled(entry) {
+		return nil, nil
+	}
+	if f.sampler != nil && !f.sampler.allow(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLevelsPerLoggerName(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{
+		Level:      "info",
+		LoggerName: "auth",
+		Levels: map[string]string{
+			"auth.repository":         "warn",
+			"auth.repository.session": "debug",
+		},
+	})
+	logger.SetOutput(&buf)
+
+	logger.Debug("root debug")
+	logger.Info("root info")
+	logger.WithField(LoggerNameField, "auth.repository").Info("repository info")
+	logger.WithField(LoggerNameField, "auth.repository.user").Warn("user repository warn")
+	logger.WithField(LoggerNameField, "auth.repository.session").Debug("session repository debug")
+
+	var messages []string
+	for _, entry := range decodeEntries(t, &buf) {
+		messages = append(messages, entry["message"].(string))
+	}
+	expected := "root info,user repository warn,session repository debug"
+	if strings.Join(messages, ",") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(messages, ","))
+	}
+}
+
+func TestSampling(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{
+		Level:    "debug",
+		Sampling: &SamplingConfig{Tick: time.Hour, First: 2, Thereafter: 3},
+	})
+	logger.SetOutput(&buf)
+
+	for i := 0; i < 10; i++ {
+		logger.Debug("hot path")
+		logger.Info("not sampled")
+	}
+
+	counts := map[string]int{}
+	for _, entry := range decodeEntries(t, &buf) {
+		counts[entry["message"].(string)]++
+	}
+	// The first 2, then the 5th and the 8th
+	if counts["hot path"] != 4 {
+		t.Errorf("Expected 4 sampled entries, got %d", counts["hot path"])
+	}
+	if counts["not sampled"] != 10 {
+		t.Errorf("Expected info entries not to be sampled, got %d", counts["not sampled"])
+	}
+}
+
+func TestSamplerResetsEveryTick(t *testing.T) {
+	now := time.Now()
+	s := newSampler(SamplingConfig{Tick: time.Second, First: 1})
+	s.now = func() time.Time { return now }
+
+	entry := &logrus.Entry{Level: logrus.DebugLevel, Message: "hot path"}
+	if !s.allow(entry) || s.allow(entry) {
+		t.Fatalf("Expected only the first entry to be allowed")
+	}
+	now = now.Add(2 * time.Second)
+	if !s.allow(entry) {
+		t.Errorf("Expected the counts to be reset")
+	}
+}
+
+func TestAuditEventsAreNotSampled(t *testing.T) {
+	s := newSampler(SamplingConfig{Level: "info", Tick: time.Hour, First: 1})
+	entry := &logrus.Entry{Level: logrus.InfoLevel, Message: "Audit event: session.flagged", Data: logrus.Fields{AuditEventField: "session.flagged"}}
+	for i := 0; i < 3; i++ {
+		if !s.allow(entry) {
+			t.Fatalf("Expected audit event %d to be logged", i)
+		}
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{Level: "info", LoggerName: "test", Format: FormatText})
+	logger.SetOutput(&buf)
+
+	logger.WithField("user_id", 1).Info("Test message")
+
+	output := buf.String()
+	for _, part := range []string{`level=info`, `message="Test message"`, `user_id=1`, `loggerName=test`} {
+		if !strings.Contains(output, part) {
+			t.Errorf("Expected %q in %q", part, output)
+		}
+	}
+}
+
+func TestSetLevelAtRuntime(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{Level: "info", LoggerName: "auth"})
+	logger.SetOutput(&buf)
+
+	if err := SetLevel(logger, "auth.repository", "debug"); err != nil {
+		t.Fatalf("Failed to set level: %v", err)
+	}
+	logger.WithField(LoggerNameField, "auth.repository").Debug("repository debug")
+	logger.Debug("root debug")
+
+	if err := SetLevel(logger, RootLogger, "error"); err != nil {
+		t.Fatalf("Failed to set level: %v", err)
+	}
+	ResetLevel(logger, "auth.repository")
+	logger.WithField(LoggerNameField, "auth.repository").Warn("repository warn")
+	logger.Error("root error")
+
+	var messages []string
+	for _, entry := range decodeEntries(t, &buf) {
+		messages = append(messages, entry["message"].(string))
+	}
+	if strings.Join(messages, ",") != "repository debug,root error" {
+		t.Errorf("Unexpected entries %v", messages)
+	}
+
+	levels := GetLevels(logger)
+	if len(levels) != 1 || levels[RootLogger] != "error" {
+		t.Errorf("Unexpected levels %v", levels)
+	}
+	if err := SetLevel(logger, RootLogger, "verbose"); err == nil {
+		t.Errorf("Expected an invalid level to be rejected")
+	}
+}
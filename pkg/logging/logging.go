@@ -10,53 +10,124 @@ import (
 	"time"
 )
 
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
 type LogConfig struct {
 	Level        string // "debug", "info", "warn", "error", "fatal", "panic"
 	EnableCaller bool
 	LoggerName   string
+	// Format is "json" (default) or "text"
+	Format string
+	// Levels overrides Level for logger names, a name also covers its children,
+	// e.g. {"auth.repository": "warn"}, see Named
+	Levels map[string]string
+	// Sinks are the outputs used by InitLogger, DefaultSinks if empty
+	Sinks []SinkConfig
+	// Sampling limits repeated entries, nothing is sampled if nil
+	Sampling *SamplingConfig
+	// RedactFields are redacted in addition to DefaultRedactedFields
+	RedactFields []string
 }
 
 var Logger *logrus.Logger
 
+// sinks are the outputs opened by InitLogger, closed by Close
+var sinks io.Closer
+
 func BaseInitLogger(config LogConfig) {
-	Logger = logrus.New()
+	Logger = NewLogger(config)
+}
+
+// NewLogger returns a logger configured like the global Logger, writing to stderr.
+// Components take such a logger to log somewhere else than the global Logger, e.g. in tests.
+func NewLogger(config LogConfig) *logrus.Logger {
+	logger := logrus.New()
 
-	Logger.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyTime:  "timestamp",
-			logrus.FieldKeyLevel: "level",
-			logrus.FieldKeyMsg:   "message",
-			logrus.FieldKeyFunc:  "caller",
-		},
-	})
 	if config.EnableCaller {
-		Logger.SetReportCaller(true)
+		logger.SetReportCaller(true)
 	}
 
 	level, err := logrus.ParseLevel(config.Level)
 	if err != nil {
-		Logger.Warn("Invalid log level, defaulting to 'info'")
+		logger.Warn("Invalid log level, defaulting to 'info'")
 		level = logrus.InfoLevel
 	}
 
-	Logger.SetLevel(level)
+	levels, invalid := newNameLevels(level, config.Levels)
+	for _, name := range invalid {
+		logger.Warn("Invalid log level for logger ", name, ", ignoring it")
+	}
+	// The logger lets everything through that any name may log, the formatter filters per name
+	logger.SetLevel(levels.lowest())
+
+	formatter := &filterFormatter{Formatter: newFormatter(config.Format), levels: levels}
+	if config.Sampling != nil {
+		formatter.sampler = newSampler(*config.Sampling)
+	}
+	logger.SetFormatter(formatter)
 
-	Logger.AddHook(&LoggerNameHook{LoggerName: config.LoggerName})
+	logger.AddHook(&LoggerNameHook{LoggerName: config.LoggerName})
+	logger.AddHook(&TraceHook{})
+
+	redaction := DefaultRedactionConfig()
+	redaction.Fields = append(redaction.Fields, config.RedactFields...)
+	logger.AddHook(NewRedactor(redaction).Hook())
+	return logger
 }
 
+func newFormatter(format string) logrus.Formatter {
+	fieldMap := logrus.FieldMap{
+		logrus.FieldKeyTime:  "timestamp",
+		logrus.FieldKeyLevel: "level",
+		logrus.FieldKeyMsg:   "message",
+		logrus.FieldKeyFunc:  "caller",
+	}
+	if format == FormatText {
+		return &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+			FieldMap:        fieldMap,
+		}
+	}
+	return &logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+		FieldMap:        fieldMap,
+	}
+}
+
+// InitLogger initializes the global Logger and opens its sinks.
+// Call Close before exiting to flush them.
 func InitLogger(config LogConfig) {
 	BaseInitLogger(config)
-	file, err := os.OpenFile("./logs/log.log", os.O_CREATE|os.O_WRONLY, 0666)
-	if err == nil {
-		Logger.SetOutput(io.MultiWriter(os.Stdout, file))
-	} else {
-		Logger.Info("Failed to log to file, using default stderr")
+
+	sinkConfigs := config.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = DefaultSinks()
+	}
+	output, closer, err := OpenSinks(sinkConfigs)
+	Logger.SetOutput(output)
+	sinks = closer
+	if err != nil {
+		Logger.Warn("Failed to open log sinks, skipping them: ", err)
 	}
 
 	Logger.Info("Logger initialized")
 }
 
+// Close flushes and closes the sinks opened by InitLogger
+func Close() error {
+	if sinks == nil {
+		return nil
+	}
+	Logger.SetOutput(os.Stderr)
+	err := sinks.Close()
+	sinks = nil
+	return err
+}
+
 func GinLogger(logger logrus.FieldLogger) gin.HandlerFunc {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -88,7 +159,7 @@ func GinLogger(logger logrus.FieldLogger) gin.HandlerFunc {
 			"referer":    referer,
 			"dataLength": dataLength,
 			"userAgent":  clientUserAgent,
-		})
+		}).WithFields(Fields(c.Request.Context())).WithContext(c.Request.Context())
 
 		if len(c.Errors) > 0 {
 			entry.Error(c.Errors.ByType(gin.ErrorTypePrivate).String())
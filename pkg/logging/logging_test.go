@@ -2,10 +2,17 @@ package logging
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func setupLoggerTest(level string) *bytes.Buffer {
@@ -88,3 +95,128 @@ func TestInitiatorFieldExists(t *testing.T) {
 		t.Errorf("Expected 'caller' field in log output")
 	}
 }
+
+func TestTraceFieldsFromContext(t *testing.T) {
+	buf := setupLoggerTest("info")
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+	ctx = tracing.ContextWithRequestID(ctx, "request-1")
+
+	Logger.WithContext(ctx).Info("Test message")
+
+	var logEntry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+		t.Fatalf("Failed to unmarshal log output: %v", err)
+	}
+
+	expected := map[string]string{
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":    "00f067aa0ba902b7",
+		"request_id": "request-1",
+	}
+	for field, value := range expected {
+		if logEntry[field] != value {
+			t.Errorf("Expected %s '%s', got '%v'", field, value, logEntry[field])
+		}
+	}
+}
+
+func newTestLogger() (*logrus.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{Level: "debug", LoggerName: "test"})
+	logger.SetOutput(&buf)
+	return logger, &buf
+}
+
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var entry map[string]interface{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Failed to unmarshal log output: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestForContextAddsFields(t *testing.T) {
+	t.Parallel()
+	logger, buf := newTestLogger()
+
+	ctx := WithContext(context.Background(), logrus.Fields{"route": "/login"})
+	ctx = WithContext(ctx, logrus.Fields{"user_id": 1})
+	ForContext(logger, ctx).Info("Test message")
+
+	entries := decodeEntries(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0]["route"] != "/login" || entries[0]["user_id"] != float64(1) {
+		t.Errorf("Expected the context fields, got %v", entries[0])
+	}
+
+	// The parent context is not changed
+	if fields := Fields(context.Background()); len(fields) != 0 {
+		t.Errorf("Expected no fields, got %v", fields)
+	}
+}
+
+func TestContextLoggerSeedsRequest(t *testing.T) {
+	t.Parallel()
+	logger, buf := newTestLogger()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ContextLogger())
+	router.GET("/users/:id", func(c *gin.Context) {
+		AddFields(c, logrus.Fields{"user_id": 1})
+		ForContext(logger, c.Request.Context()).Info("Handling request")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	entries := decodeEntries(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0]["route"] != "/users/:id" || entries[0]["method"] != "GET" || entries[0]["user_id"] != float64(1) {
+		t.Errorf("Expected the request fields, got %v", entries[0])
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	t.Parallel()
+	logger, buf := newTestLogger()
+	logger.SetLevel(logrus.InfoLevel)
+
+	ctx := WithContext(context.Background(), logrus.Fields{"route": "/login"})
+	slogger := NewSlogLogger(logger).With("component", "test").WithGroup("request")
+	slogger.DebugContext(ctx, "Filtered out")
+	slogger.WarnContext(ctx, "Test message", "status", 401, slog.Group("user", "id", 1))
+
+	entries := decodeEntries(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	expected := map[string]interface{}{
+		"message":         "Test message",
+		"level":           "warning",
+		"component":       "test",
+		"request.status":  float64(401),
+		"request.user.id": float64(1),
+		"route":           "/login",
+		"loggerName":      "test",
+	}
+	for field, value := range expected {
+		if entry[field] != value {
+			t.Errorf("Expected %s '%v', got '%v'", field, value, entry[field])
+		}
+	}
+}
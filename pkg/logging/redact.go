@@ -0,0 +1,241 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must not be logged
+const Redacted = "[REDACTED]"
+
+// Secret is a string that never prints its value, neither with fmt nor as JSON.
+// Use Reveal to get the value where it is really needed.
+type Secret string
+
+func (s Secret) String() string {
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// Format makes every fmt verb print the redacted placeholder
+func (s Secret) Format(f fmt.State, verb rune) {
+	_, _ = f.Write([]byte(Redacted))
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Redacted + `"`), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// Reveal returns the secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Fingerprint returns a short stable identifier of a token that is safe to log.
+// The same token always gives the same fingerprint, so log lines can be correlated.
+func Fingerprint(token string) string {
+	if token == "" {
+		return "<empty>"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// MaskEmail keeps the first letter of the local part and the domain, e.g. "j***@example.com"
+func MaskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 {
+		return Redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// RedactionRule masks every match of Pattern. Mask returns the replacement of a match,
+// returning the match itself keeps it. A nil Mask replaces matches with Redacted.
+type RedactionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Mask    func(match string) string
+}
+
+var (
+	// EmailRule masks e-mail addresses
+	EmailRule = RedactionRule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Mask:    MaskEmail,
+	}
+	// BearerTokenRule masks credentials of Authorization headers
+	BearerTokenRule = RedactionRule{
+		Name:    "bearer",
+		Pattern: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`),
+		Mask: func(match string) string {
+			return strings.Fields(match)[0] + " " + Redacted
+		},
+	}
+	// BcryptHashRule masks bcrypt password hashes
+	BcryptHashRule = RedactionRule{
+		Name:    "bcrypt",
+		Pattern: regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`),
+	}
+	// CardNumberRule masks payment card numbers, digit runs failing the Luhn check are kept
+	CardNumberRule = RedactionRule{
+		Name:    "card",
+		Pattern: regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		Mask: func(match string) string {
+			if !luhn(match) {
+				return match
+			}
+			return Redacted
+		},
+	}
+)
+
+// DefaultRedactedFields are field names whose values are always redacted.
+// Names are compared case-insensitively, ignoring "_" and "-".
+var DefaultRedactedFields = []string{
+	"password",
+	"passwordHash",
+	"newPassword",
+	"oldPassword",
+	"token",
+	"accessToken",
+	"refreshToken",
+	"sessionKey",
+	"secret",
+	"authorization",
+	"cookie",
+	"apiKey",
+	"cardNumber",
+	"cvv",
+}
+
+// RedactionConfig configures the Redactor
+type RedactionConfig struct {
+	// Fields are field names whose values are replaced entirely
+	Fields []string
+	// Rules mask parts of messages and string field values
+	Rules []RedactionRule
+}
+
+// DefaultRedactionConfig redacts the default fields, e-mails, bearer tokens, bcrypt hashes and card numbers
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		Fields: append([]string(nil), DefaultRedactedFields...),
+		Rules:  []RedactionRule{BearerTokenRule, BcryptHashRule, EmailRule, CardNumberRule},
+	}
+}
+
+// Redactor removes secrets and personal data from log entries
+type Redactor struct {
+	fields map[string]struct{}
+	rules  []RedactionRule
+}
+
+func NewRedactor(config RedactionConfig) *Redactor {
+	fields := make(map[string]struct{}, len(config.Fields))
+	for _, field := range config.Fields {
+		fields[normalizeField(field)] = struct{}{}
+	}
+	return &Redactor{fields: fields, rules: config.Rules}
+}
+
+// RedactString applies the rules to s
+func (r *Redactor) RedactString(s string) string {
+	for _, rule := range r.rules {
+		if rule.Mask == nil {
+			s = rule.Pattern.ReplaceAllLiteralString(s, Redacted)
+		} else {
+			s = rule.Pattern.ReplaceAllStringFunc(s, rule.Mask)
+		}
+	}
+	return s
+}
+
+// IsRedactedField reports whether values of the field are always redacted
+func (r *Redactor) IsRedactedField(field string) bool {
+	_, ok := r.fields[normalizeField(field)]
+	return ok
+}
+
+// RedactValue returns the value to log for the field
+func (r *Redactor) RedactValue(field string, value interface{}) interface{} {
+	if r.IsRedactedField(field) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case Secret:
+		return Redacted
+	case string:
+		return r.RedactString(v)
+	case []byte:
+		return r.RedactString(string(v))
+	case error:
+		return r.RedactString(v.Error())
+	case fmt.Stringer:
+		return r.RedactString(v.String())
+	}
+	return value
+}
+
+// Hook returns a logrus hook redacting the message and the fields of every entry
+func (r *Redactor) Hook() logrus.Hook {
+	return &RedactionHook{redactor: r}
+}
+
+// RedactionHook redacts entries before they are formatted.
+// Add it last, so fields added by other hooks are redacted too.
+type RedactionHook struct {
+	redactor *Redactor
+}
+
+func (hook *RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *RedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = hook.redactor.RedactString(entry.Message)
+	for key, value := range entry.Data {
+		entry.Data[key] = hook.redactor.RedactValue(key, value)
+	}
+	return nil
+}
+
+func normalizeField(field string) string {
+	field = strings.ReplaceAll(field, "_", "")
+	field = strings.ReplaceAll(field, "-", "")
+	return strings.ToLower(field)
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum used by card numbers
+func luhn(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
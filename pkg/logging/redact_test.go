@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactsFieldsAndPatterns(t *testing.T) {
+	t.Parallel()
+	logger, buf := newTestLogger()
+
+	logger.WithFields(logrus.Fields{
+		"password":      "hunter2",
+		"password_hash": "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"Authorization": "Bearer abc.def.ghi",
+		"userEmail":     "john.doe@example.com",
+		"status":        401,
+	}).WithError(errors.New("no user with email jane@example.com")).
+		Info("Login by john.doe@example.com with header Bearer eyJhbGciOi.eyJzdWIi.c2ln, card 4111 1111 1111 1111, hash $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy")
+
+	output := buf.String()
+	for _, secret := range []string{"hunter2", "N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", "abc.def.ghi", "eyJhbGciOi", "john.doe@", "jane@", "4111 1111 1111 1111"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, output)
+		}
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal log output: %v", err)
+	}
+	expected := map[string]interface{}{
+		"password":      Redacted,
+		"password_hash": Redacted,
+		"Authorization": Redacted,
+		"userEmail":     "j***@example.com",
+		"status":        float64(401),
+		"error":         "no user with email j***@example.com",
+		"message":       "Login by j***@example.com with header Bearer [REDACTED], card [REDACTED], hash [REDACTED]",
+	}
+	for field, value := range expected {
+		if entry[field] != value {
+			t.Errorf("Expected %s '%v', got '%v'", field, value, entry[field])
+		}
+	}
+}
+
+func TestRedactionKeepsOtherNumbers(t *testing.T) {
+	redactor := NewRedactor(DefaultRedactionConfig())
+
+	// 16 digits failing the Luhn check, e.g. an order number
+	input := "Order 1234567812345678 created at 2024-01-02"
+	if output := redactor.RedactString(input); output != input {
+		t.Errorf("Expected %q to be kept, got %q", input, output)
+	}
+}
+
+func TestSecretNeverPrints(t *testing.T) {
+	secret := Secret("hunter2")
+
+	outputs := []string{
+		fmt.Sprint(secret),
+		fmt.Sprintf("%s %v %+v %#v %q %x", secret, secret, secret, secret, secret, secret),
+		fmt.Sprintf("%v", struct{ Password Secret }{secret}),
+	}
+	data, _ := json.Marshal(map[string]Secret{"password": secret})
+	outputs = append(outputs, string(data))
+
+	for _, output := range outputs {
+		if strings.Contains(output, "hunter2") {
+			t.Errorf("Expected the secret to be hidden, got %q", output)
+		}
+	}
+	if secret.Reveal() != "hunter2" {
+		t.Errorf("Expected Reveal to return the value")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	// Short tokens must not panic, long ones must not leak
+	for _, token := range []string{"", "a", "abcdefghijklmnopqrstuvwxyz"} {
+		fingerprint := Fingerprint(token)
+		if len(token) > 5 && strings.Contains(fingerprint, token[:5]) {
+			t.Errorf("Expected the fingerprint not to contain the token, got %q", fingerprint)
+		}
+		if fingerprint != Fingerprint(token) {
+			t.Errorf("Expected the fingerprint to be stable")
+		}
+	}
+	if Fingerprint("a") == Fingerprint("b") {
+		t.Errorf("Expected different tokens to have different fingerprints")
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	cases := map[string]string{
+		"john@example.com": "j***@example.com",
+		"@example.com":     Redacted,
+		"not an email":     Redacted,
+	}
+	for email, expected := range cases {
+		if masked := MaskEmail(email); masked != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, email, masked)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newSyslogSink writes every entry with the info priority, the level is part of the formatted entry
+func newSyslogSink(config SyslogSinkConfig) (io.Writer, error) {
+	return syslog.Dial(config.Network, config.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, config.Tag)
+}
@@ -0,0 +1,311 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkHTTP   = "http"
+)
+
+// SinkConfig configures one output of the logger
+type SinkConfig struct {
+	// Type is one of "stdout", "stderr", "file", "syslog" and "http"
+	Type   string
+	File   FileSinkConfig
+	Syslog SyslogSinkConfig
+	HTTP   HTTPSinkConfig
+}
+
+// FileSinkConfig configures a log file rotated by size and, optionally, by time
+type FileSinkConfig struct {
+	Path string
+	// MaxSizeMB is the size at which the file is rotated, 100 if zero
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files kept, all if zero
+	MaxBackups int
+	// MaxAgeDays is the age after which rotated files are removed, never if zero
+	MaxAgeDays int
+	// Compress gzips rotated files
+	Compress bool
+	// RotateEvery rotates the file periodically in addition to the size limit, e.g. 24h
+	RotateEvery time.Duration
+}
+
+// SyslogSinkConfig configures a syslog output. An empty Network and Address log to the local syslog.
+type SyslogSinkConfig struct {
+	Network string
+	Address string
+	Tag     string
+}
+
+// HTTPSinkConfig configures a collector receiving the entries as newline delimited JSON
+type HTTPSinkConfig struct {
+	URL string
+	// BatchSize is the number of entries sent in one request, 100 if zero
+	BatchSize int
+	// FlushInterval is the longest time an entry waits to be sent, 1s if zero
+	FlushInterval time.Duration
+	// BufferSize is the number of entries kept while the collector is slow, 10000 if zero.
+	// Entries are dropped when the buffer is full, logging never blocks on the collector.
+	BufferSize int
+	// Client is used for the requests, a client with a 5s timeout if nil
+	Client *http.Client
+}
+
+// DefaultSinks are used by InitLogger if no sinks are configured
+func DefaultSinks() []SinkConfig {
+	return []SinkConfig{
+		{Type: SinkStdout},
+		{Type: SinkFile, File: FileSinkConfig{Path: "./logs/log.log", MaxSizeMB: 100, MaxBackups: 10, Compress: true}},
+	}
+}
+
+// OpenSinks opens the sinks and returns a writer to all of them.
+// Sinks that fail to open are skipped and reported in the error.
+// The returned closer flushes and closes the sinks.
+func OpenSinks(configs []SinkConfig) (io.Writer, io.Closer, error) {
+	var writers []io.Writer
+	var closers multiCloser
+	var errs []error
+
+	for _, config := range configs {
+		writer, err := openSink(config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s sink: %w", config.Type, err))
+			continue
+		}
+		writers = append(writers, writer)
+		if closer, ok := writer.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+	}
+	if len(writers) == 0 {
+		writers = append(writers, os.Stderr)
+	}
+	return io.MultiWriter(writers...), closers, errors.Join(errs...)
+}
+
+func openSink(config SinkConfig) (io.Writer, error) {
+	switch config.Type {
+	case SinkStdout, "":
+		return os.Stdout, nil
+	case SinkStderr:
+		return os.Stderr, nil
+	case SinkFile:
+		return newFileSink(config.File)
+	case SinkSyslog:
+		return newSyslogSink(config.Syslog)
+	case SinkHTTP:
+		return newHTTPSink(config.HTTP)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", config.Type)
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var errs []error
+	for _, closer := range m {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// fileSink appends to a file rotated by lumberjack, and rotates it periodically if configured
+type fileSink struct {
+	*lumberjack.Logger
+	stop chan struct{}
+	once sync.Once
+}
+
+func newFileSink(config FileSinkConfig) (*fileSink, error) {
+	if config.Path == "" {
+		return nil, errors.New("no path")
+	}
+	// Fail early if the file cannot be written, lumberjack only opens it on the first write
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	maxSize := config.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = 100
+	}
+	sink := &fileSink{
+		Logger: &lumberjack.Logger{
+			Filename:   config.Path,
+			MaxSize:    maxSize,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     config.MaxAgeDays,
+			Compress:   config.Compress,
+			LocalTime:  true,
+		},
+		stop: make(chan struct{}),
+	}
+	if config.RotateEvery > 0 {
+		go sink.rotatePeriodically(config.RotateEvery)
+	}
+	return sink, nil
+}
+
+func (f *fileSink) rotatePeriodically(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if err := f.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+			}
+		}
+	}
+}
+
+func (f *fileSink) Close() error {
+	f.once.Do(func() { close(f.stop) })
+	return f.Logger.Close()
+}
+
+// httpSink sends entries to a collector in batches from a background goroutine
+type httpSink struct {
+	config  HTTPSinkConfig
+	entries chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newHTTPSink(config HTTPSinkConfig) (*httpSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("no URL")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10000
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	sink := &httpSink{
+		config:  config,
+		entries: make(chan []byte, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go sink.run()
+	return sink, nil
+}
+
+func (h *httpSink) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return 0, errors.New("http sink is closed")
+	}
+
+	// logrus reuses the buffer after Write returns
+	entry := append([]byte(nil), p...)
+	select {
+	case h.entries <- entry:
+	default:
+		h.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+func (h *httpSink) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	count := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if err := h.send(batch.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send %d log entries: %v\n", count, err)
+		}
+		batch.Reset()
+		count = 0
+	}
+
+	for {
+		select {
+		case entry, ok := <-h.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch.Write(entry)
+			count++
+			if count >= h.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			if dropped := h.dropped.Swap(0); dropped > 0 {
+				fmt.Fprintf(os.Stderr, "Dropped %d log entries, the collector is too slow\n", dropped)
+			}
+			flush()
+		}
+	}
+}
+
+func (h *httpSink) send(body []byte) error {
+	resp, err := h.config.Client.Post(h.config.URL, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close sends the buffered entries and stops the sink
+func (h *httpSink) Close() error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.entries)
+	}
+	h.mu.Unlock()
+	<-h.done
+	return nil
+}
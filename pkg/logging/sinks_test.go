@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "log.log")
+
+	for _, line := range []string{"first\n", "second\n"} {
+		sink, err := newFileSink(FileSinkConfig{Path: path})
+		if err != nil {
+			t.Fatalf("Failed to open sink: %v", err)
+		}
+		_, _ = sink.Write([]byte(line))
+		_ = sink.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("Expected the file to be appended to after a restart, got %q", data)
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.log")
+
+	sink, err := newFileSink(FileSinkConfig{Path: path, RotateEvery: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to open sink: %v", err)
+	}
+	defer sink.Close()
+
+	_, _ = sink.Write([]byte("before rotation\n"))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "log-*.log"))
+		if len(matches) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the file to be rotated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPSinkSendsBatches(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("Unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}))
+	defer server.Close()
+
+	sink, err := newHTTPSink(HTTPSinkConfig{URL: server.URL, BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to open sink: %v", err)
+	}
+	buf := []byte(`{"message":"1"}` + "\n")
+	_, _ = sink.Write(buf)
+	// The caller may reuse the buffer
+	copy(buf, `{"message":"2"}`+"\n")
+	_, _ = sink.Write(buf)
+	_, _ = sink.Write([]byte(`{"message":"3"}` + "\n"))
+	_ = sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("Expected a full batch and a flush on close, got %d requests", requests)
+	}
+	if strings.Join(lines, ",") != `{"message":"1"},{"message":"2"},{"message":"3"}` {
+		t.Errorf("Unexpected lines %v", lines)
+	}
+	if _, err := sink.Write(buf); err == nil {
+		t.Errorf("Expected writes after close to fail")
+	}
+}
+
+func TestOpenSinksSkipsBrokenSinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.log")
+	output, closer, err := OpenSinks([]SinkConfig{
+		{Type: SinkFile, File: FileSinkConfig{Path: path}},
+		{Type: "unknown"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("Expected the unknown sink to be reported, got %v", err)
+	}
+
+	_, _ = io.WriteString(output, "line\n")
+	_ = closer.Close()
+
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data, []byte("line\n")) {
+		t.Errorf("Expected the file sink to be used, got %q", data)
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"log/slog"
+	"strings"
+)
+
+// SlogHandler is a slog.Handler that writes through a logrus logger,
+// so code using log/slog ends up in the same output with the same hooks.
+// Request scoped fields of the context passed to the slog calls are added to every record.
+type SlogHandler struct {
+	logger *logrus.Logger
+	fields logrus.Fields
+	groups []string
+}
+
+// NewSlogHandler returns a handler writing to logger, nil stands for the global Logger
+func NewSlogHandler(logger *logrus.Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// NewSlogLogger returns a slog.Logger writing to logger, nil stands for the global Logger
+func NewSlogLogger(logger *logrus.Logger) *slog.Logger {
+	return slog.New(NewSlogHandler(logger))
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return orDefault(h.logger).IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make(logrus.Fields, len(h.fields)+record.NumAttrs())
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	prefix := h.prefix()
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(fields, prefix, attr)
+		return true
+	})
+
+	entry := ForContext(h.logger, ctx).WithFields(fields)
+	entry.Time = record.Time
+	entry.Log(logrusLevel(record.Level), record.Message)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(h.fields)+len(attrs))
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	prefix := h.prefix()
+	for _, attr := range attrs {
+		addAttr(fields, prefix, attr)
+	}
+	return &SlogHandler{logger: h.logger, fields: fields, groups: h.groups}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := append(append([]string(nil), h.groups...), name)
+	return &SlogHandler{logger: h.logger, fields: h.fields, groups: groups}
+}
+
+func (h *SlogHandler) prefix() string {
+	if len(h.groups) == 0 {
+		return ""
+	}
+	return strings.Join(h.groups, ".") + "."
+}
+
+// addAttr flattens groups into dotted keys, logrus fields have no nesting
+func addAttr(fields logrus.Fields, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix = prefix + attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			addAttr(fields, groupPrefix, groupAttr)
+		}
+		return
+	}
+	fields[prefix+attr.Key] = attr.Value.Any()
+}
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	default:
+		return logrus.DebugLevel
+	}
+}
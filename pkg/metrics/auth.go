@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes and reasons of authentication events
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	ReasonUnknownUser   = "unknown_user"
+	ReasonWrongPassword = "wrong_password"
+	ReasonDuplicate     = "duplicate"
+	ReasonInvalidToken  = "invalid_token"
+	ReasonSuspended     = "suspended"
+	ReasonError         = "error"
+	// ReasonInvalidPasskey is a WebAuthn response that failed verification
+	ReasonInvalidPasskey = "invalid_passkey"
+	// ReasonClonedPasskey is an assertion whose sign counter did not increase, the
+	// authenticator may have been cloned
+	ReasonClonedPasskey = "cloned_passkey"
+
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+
+	RevokeLogout  = "logout"
+	RevokeAdmin   = "admin"
+	RevokeExpired = "expired"
+	RevokeAnomaly = "anomaly"
+)
+
+var (
+	logins = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	registrations = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Registration attempts, by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	passwordResets = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_password_resets_total",
+		Help: "Password resets, by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	reauthentications = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_reauthentications_total",
+		Help: "Re-authentications of sessions, by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	passkeyCeremonies = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_passkey_ceremonies_total",
+		Help: "Passkey registrations and logins, by ceremony, result and failure reason.",
+	}, []string{"ceremony", "result", "reason"})
+
+	sessionsCreated = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Name: "auth_sessions_created_total",
+		Help: "Sessions created.",
+	})
+
+	sessionsRenewed = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Name: "auth_sessions_renewed_total",
+		Help: "Sessions extended by sliding renewal.",
+	})
+
+	sessionsRevoked = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_sessions_revoked_total",
+		Help: "Sessions revoked, by reason.",
+	}, []string{"reason"})
+
+	sessionAnomalies = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_session_anomalies_total",
+		Help: "Anomalies found when sessions were used, by anomaly and the action taken.",
+	}, []string{"anomaly", "action"})
+)
+
+// RecordLogin counts a login attempt, the reason is empty on success
+func RecordLogin(result string, reason string) {
+	logins.WithLabelValues(result, reason).Inc()
+}
+
+// RecordRegistration counts a registration attempt, the reason is empty on success
+func RecordRegistration(result string, reason string) {
+	registrations.WithLabelValues(result, reason).Inc()
+}
+
+// RecordPasswordReset counts a password reset, the reason is empty on success
+func RecordPasswordReset(result string, reason string) {
+	passwordResets.WithLabelValues(result, reason).Inc()
+}
+
+// RecordReauthentication counts a re-authentication of a session, the reason is empty on success
+func RecordReauthentication(result string, reason string) {
+	reauthentications.WithLabelValues(result, reason).Inc()
+}
+
+// RecordPasskeyCeremony counts a passkey registration or login, the reason is empty on success
+func RecordPasskeyCeremony(ceremony string, result string, reason string) {
+	passkeyCeremonies.WithLabelValues(ceremony, result, reason).Inc()
+}
+
+// RecordSessionCreated counts a created session
+func RecordSessionCreated() {
+	sessionsCreated.Inc()
+}
+
+// RecordSessionRenewed counts a session extended by sliding renewal
+func RecordSessionRenewed() {
+	sessionsRenewed.Inc()
+}
+
+// RecordSessionsRevoked counts revoked sessions
+func RecordSessionsRevoked(reason string, count int) {
+	sessionsRevoked.WithLabelValues(reason).Add(float64(count))
+}
+
+// RecordSessionAnomaly counts an anomaly found on a session in use and the action taken
+func RecordSessionAnomaly(anomaly string, action string) {
+	sessionAnomalies.WithLabelValues(anomaly, action).Inc()
+}
+
+// RegisterActiveSessions exposes the number of active sessions, count is called on every scrape
+// and should be cheap, e.g. a COUNT query with a short timeout.
+func RegisterActiveSessions(count func() float64) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "auth_active_sessions",
+		Help: "Sessions that are neither expired nor revoked.",
+	}, count))
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+	"time"
+)
+
+const gormStartKey = "metrics:start"
+
+var dbQueryDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Latency of database queries made with GORM, by operation, table and outcome.",
+	Buckets: DefaultBuckets,
+}, []string{"operation", "table", "status"})
+
+// GORMPlugin times every query made through a gorm.DB, install it with db.Use(metrics.GORMPlugin{})
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "metrics"
+}
+
+func (GORMPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("metrics:before_create", startTimer),
+		callback.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		callback.Query().Before("gorm:query").Register("metrics:before_query", startTimer),
+		callback.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		callback.Update().Before("gorm:update").Register("metrics:before_update", startTimer),
+		callback.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		callback.Delete().Before("gorm:delete").Register("metrics:before_delete", startTimer),
+		callback.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		callback.Row().Before("gorm:row").Register("metrics:before_row", startTimer),
+		callback.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		callback.Raw().Before("gorm:raw").Register("metrics:before_raw", startTimer),
+		callback.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	)
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+func observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		status := "ok"
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			status = "error"
+		}
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		dbQueryDuration.WithLabelValues(operation, table, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels requests that matched no route, so unknown paths do not create new series
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a method outside the standard ones, for the same reason
+const otherMethod = "OTHER"
+
+var (
+	httpRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route template.",
+		Buckets: DefaultBuckets,
+	}, []string{"method", "route"})
+
+	httpInFlight = promauto.With(Registry).NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently handled.",
+	})
+)
+
+// GinMiddleware records the count and latency of requests by route template, e.g. "/verify/:token"
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		httpInFlight.Inc()
+		// A panicking handler skips the rest, the request is no longer in flight all the same
+		defer httpInFlight.Dec()
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := methodLabel(c.Request.Method)
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// methodLabel returns the method, or otherMethod unless it is a standard one
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+// Outcomes of scheduled job runs
+const (
+	JobSuccess = "success"
+	JobFailure = "failure"
+	// JobSkipped is a run left to another replica holding the job's lock
+	JobSkipped = "skipped"
+)
+
+var (
+	jobRuns = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_job_runs_total",
+		Help: "Scheduled job runs, by job and result.",
+	}, []string{"job", "result"})
+
+	jobDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_job_duration_seconds",
+		Help:    "Duration of scheduled job runs, by job.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	jobProcessed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_job_processed_total",
+		Help: "Items processed by scheduled jobs, e.g. deleted sessions, by job.",
+	}, []string{"job"})
+
+	jobLastSuccess = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_job_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run, by job.",
+	}, []string{"job"})
+)
+
+// RecordJobRun records a finished run of a job and the number of items it processed
+func RecordJobRun(job string, result string, duration time.Duration, processed int64) {
+	jobRuns.WithLabelValues(job, result).Inc()
+	jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+	jobProcessed.WithLabelValues(job).Add(float64(processed))
+	if result == JobSuccess {
+		jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+}
+
+// RecordJobSkipped counts a run left to another replica
+func RecordJobSkipped(job string) {
+	jobRuns.WithLabelValues(job, JobSkipped).Inc()
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestGinMiddlewareUsesRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/verify/:token", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, path := range []string{"/verify/a", "/verify/b", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/verify/:token", "204")); count != 2 {
+		t.Errorf("Expected 2 requests for the route template, got %v", count)
+	}
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")); count != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", count)
+	}
+}
+
+func TestGinMiddlewareBoundsLabels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}), GinMiddleware())
+	router.GET("/panic", func(*gin.Context) {
+		panic("handler failed")
+	})
+
+	for _, method := range []string{"FOO", "BAR"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/anything", nil))
+	}
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues(otherMethod, unmatchedRoute, "404")); count != 2 {
+		t.Errorf("Expected 2 requests with other methods, got %v", count)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if inFlight := testutil.ToFloat64(httpInFlight); inFlight != 0 {
+		t.Errorf("Expected no request in flight after a panic, got %v", inFlight)
+	}
+}
+
+func TestHandlerServesTextFormat(t *testing.T) {
+	RecordLogin(ResultFailure, ReasonWrongPassword)
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, expected := range []string{
+		`auth_logins_total{reason="wrong_password",result="failure"} 1`,
+		"# TYPE go_goroutines gauge",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected %q in the scrape output", expected)
+		}
+	}
+}
+
+type user struct {
+	ID int64
+}
+
+func TestGORMPluginTimesQueries(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.Use(GORMPlugin{}); err != nil {
+		t.Fatalf("Failed to install plugin: %v", err)
+	}
+
+	var users []user
+	db.Find(&users)
+	db.Create(&user{ID: 1})
+
+	if count := testutil.CollectAndCount(dbQueryDuration); count != 2 {
+		t.Errorf("Expected a series per operation, got %d", count)
+	}
+
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	var operations []string
+	for _, family := range families {
+		if family.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["table"] != "users" || labels["status"] != "ok" {
+				t.Errorf("Unexpected labels %v", labels)
+			}
+			operations = append(operations, labels["operation"])
+		}
+	}
+	if strings.Join(operations, ",") != "create,query" {
+		t.Errorf("Expected create and query to be timed, got %v", operations)
+	}
+}
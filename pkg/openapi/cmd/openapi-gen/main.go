@@ -0,0 +1,94 @@
+// Command openapi-gen generates Go code from the OpenAPI document of a service, see the codegen
+// package. It is meant for go:generate directives:
+//
+//	//go:generate go run github.com/Ruletk/GoMarketplace/pkg/openapi/cmd/openapi-gen types -spec ../../docs/openapi.yaml -package messages -o messages_gen.go
+//	//go:generate go run github.com/Ruletk/GoMarketplace/pkg/openapi/cmd/openapi-gen client -spec ../../docs/openapi.yaml -package authclient -o authclient_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/openapi/codegen"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generators are the kinds of code generated, by command
+var generators = map[string]struct {
+	summary  string
+	generate codegen.Generator
+}{
+	"types":  {summary: "the types of the component schemas", generate: codegen.Types},
+	"client": {summary: "a client of the service, with its own types", generate: codegen.Client},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	generator, ok := generators[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	spec := flags.String("spec", "", "the OpenAPI document, e.g. ../../docs/openapi.yaml")
+	pkg := flags.String("package", "", "the package of the generated file, the name of the output directory by default")
+	output := flags.String("o", "", "the generated file, stdout by default")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *spec == "" {
+		fmt.Fprintln(os.Stderr, "The -spec flag is required")
+		return 2
+	}
+	if *pkg == "" {
+		*pkg = defaultPackage(*output)
+	}
+
+	source, err := codegen.GenerateFile(generator.generate, *spec, codegen.Config{Package: *pkg})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *output == "" {
+		_, _ = os.Stdout.Write(source)
+		return 0
+	}
+	if err = os.WriteFile(*output, source, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// defaultPackage returns the package of a generated file, named after its directory
+func defaultPackage(output string) string {
+	dir, err := filepath.Abs(filepath.Dir(output))
+	if err != nil {
+		return "main"
+	}
+	return strings.ReplaceAll(filepath.Base(dir), "-", "")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: openapi-gen <command> -spec <file> [-package <name>] [-o <file>]\n\nCommands:")
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, generators[name].summary)
+	}
+}
@@ -0,0 +1,389 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"go/token"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExtensionIdempotent marks an operation as safe to retry whatever its method, e.g. a POST
+// reading data
+const ExtensionIdempotent = "x-idempotent"
+
+const communicationImport = "github.com/Ruletk/GoMarketplace/pkg/communication"
+
+// methodOrder orders the operations of a path
+var methodOrder = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodTrace}
+
+// Client returns the Go source of a client of the service: the types of the component schemas
+// and a method per operation, calling the service with the communication package.
+// The client depends on the document alone, x-go-type is ignored: the types of the service may
+// be internal to it or not meant to be sent, like the redacted logging.Secret.
+func Client(doc *openapi3.T, config Config) ([]byte, error) {
+	g := &generator{requests: make(map[string]bool), imports: make(map[string]bool), standalone: true}
+	for _, name := range g.componentNames(doc) {
+		if err := g.typeDecl(name, doc.Components.Schemas[name].Value); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	var methods bytes.Buffer
+	g.imports["context"] = true
+	g.imports["net/http"] = true
+	g.imports["net/url"] = true
+	g.imports[communicationImport] = true
+	fmt.Fprintf(&methods, "// Client calls the operations of the %s\n", strings.TrimSpace(doc.Info.Title))
+	methods.WriteString(clientDecl)
+
+	paths := doc.Paths.InMatchingOrder()
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths.Value(path)
+		for _, method := range methodOrder {
+			operation := item.GetOperation(method)
+			if operation == nil {
+				continue
+			}
+			if err := g.method(&methods, method, path, item.Parameters, operation); err != nil {
+				return nil, fmt.Errorf("operation %s %s: %w", method, path, err)
+			}
+		}
+	}
+	return g.source(config, methods.String())
+}
+
+// clientDecl declares the client and its helpers
+const clientDecl = `type Client struct {
+	upstream *communication.Upstream
+	client   *communication.Client
+}
+
+// New returns a client making the calls with client to the service the upstream resolves
+func New(upstream *communication.Upstream, client *communication.Client) *Client {
+	return &Client{upstream: upstream, client: client}
+}
+
+// request returns the request of an operation
+func (c *Client) request(method string, path string, body interface{}) communication.Request {
+	return communication.Request{Method: method, URL: path, Upstream: c.upstream, Body: body, Header: http.Header{}, Query: url.Values{}}
+}
+
+// apply changes the request with the options of the call
+func apply(req communication.Request, opts []communication.RequestOption) communication.Request {
+	for _, opt := range opts {
+		opt(&req)
+	}
+	return req
+}
+
+`
+
+// parameter is a parameter of an operation with its Go name
+type parameter struct {
+	*openapi3.Parameter
+	goName string
+	goType string
+}
+
+// method writes the method calling an operation and the types of its inline schemas
+func (g *generator) method(w *bytes.Buffer, method string, path string, shared openapi3.Parameters, operation *openapi3.Operation) error {
+	if operation.OperationID == "" {
+		return fmt.Errorf("operationId is required")
+	}
+	name := GoName(operation.OperationID)
+
+	pathParams, otherParams, err := g.parameters(path, shared, operation.Parameters)
+	if err != nil {
+		return err
+	}
+	args := []string{"ctx context.Context"}
+	for _, param := range pathParams {
+		args = append(args, param.goName+" "+param.goType)
+	}
+
+	bodyType, err := g.requestBody(name, operation)
+	if err != nil {
+		return err
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+	if len(otherParams) > 0 {
+		g.paramsDecl(name+"Params", otherParams)
+		args = append(args, "params "+name+"Params")
+	}
+	args = append(args, "opts ...communication.RequestOption")
+
+	result, mediaType, err := g.result(name, operation)
+	if err != nil {
+		return err
+	}
+	// Responses that are not JSON are returned as they are, e.g. event streams
+	raw := mediaType != "" && !isJSONMediaType(mediaType)
+	returns := "error"
+	switch {
+	case raw:
+		returns = "(*http.Response, error)"
+	case result != "":
+		returns = "(" + result + ", error)"
+	}
+
+	// A summary on a paragraph of its own would read as a heading to gofmt
+	fmt.Fprintf(w, "// %s calls %s %s", name, method, path)
+	if summary := strings.TrimSpace(operation.Summary); summary != "" {
+		fmt.Fprintf(w, ": %s", summary)
+	}
+	fmt.Fprintln(w)
+	if raw {
+		fmt.Fprintf(w, "//\n// The response is %s, the caller must close its body.\n", mediaType)
+	}
+	if operation.Deprecated {
+		fmt.Fprintf(w, "//\n// Deprecated: the operation is deprecated.\n")
+	}
+	fmt.Fprintf(w, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	body := "nil"
+	if bodyType != "" && !nilable(bodyType) {
+		body = "body"
+	}
+	fmt.Fprintf(w, "\treq := c.request(http.Method%s, %s, %s)\n", methodConst(method), g.pathExpr(path, pathParams), body)
+	if bodyType != "" && nilable(bodyType) {
+		// A nil body in the interface would be sent as null
+		w.WriteString("\tif body != nil {\n\t\treq.Body = body\n\t}\n")
+	}
+	for _, param := range otherParams {
+		g.setParam(w, param)
+	}
+	if idempotent, _ := operation.Extensions[ExtensionIdempotent].(bool); idempotent {
+		w.WriteString("\tidempotent := true\n\treq.Idempotent = &idempotent\n")
+	}
+	if raw {
+		fmt.Fprintf(w, "\treq.Header.Set(\"Accept\", %q)\n", mediaType)
+	}
+
+	switch {
+	case raw:
+		w.WriteString("\treturn c.client.Send(ctx, apply(req, opts))\n")
+	case result != "":
+		fmt.Fprintf(w, "\treturn communication.Do[%s](ctx, c.client, apply(req, opts))\n", result)
+	default:
+		w.WriteString("\tresp, err := c.client.Send(ctx, apply(req, opts))\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn resp.Body.Close()\n")
+	}
+	w.WriteString("}\n\n")
+	return nil
+}
+
+// parameters returns the path parameters in the order of the path and the others by name.
+// Parameters of the operation override the ones shared by its path.
+func (g *generator) parameters(path string, shared openapi3.Parameters, own openapi3.Parameters) ([]parameter, []parameter, error) {
+	byKey := make(map[string]*openapi3.Parameter)
+	var keys []string
+	for _, ref := range append(append(openapi3.Parameters{}, shared...), own...) {
+		if ref.Value == nil {
+			return nil, nil, fmt.Errorf("unresolved parameter %s", ref.Ref)
+		}
+		key := ref.Value.In + " " + ref.Value.Name
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = ref.Value
+	}
+
+	var pathParams, otherParams []parameter
+	for _, key := range keys {
+		param := byKey[key]
+		if param.In == openapi3.ParameterInCookie {
+			// Cookies are up to the client, e.g. the session cookie
+			continue
+		}
+		if param.Schema == nil {
+			return nil, nil, fmt.Errorf("parameter %s has no schema", param.Name)
+		}
+		required := param.Required || param.In == openapi3.ParameterInPath
+		goType, err := g.goType(param.Schema, required)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		if !required && !strings.HasPrefix(goType, "*") {
+			goType = "*" + goType
+		}
+		if param.In == openapi3.ParameterInPath {
+			pathParams = append(pathParams, parameter{Parameter: param, goName: argName(param.Name), goType: goType})
+		} else {
+			otherParams = append(otherParams, parameter{Parameter: param, goName: GoName(param.Name), goType: goType})
+		}
+	}
+	sort.SliceStable(pathParams, func(i, j int) bool {
+		return strings.Index(path, "{"+pathParams[i].Name+"}") < strings.Index(path, "{"+pathParams[j].Name+"}")
+	})
+	sort.Slice(otherParams, func(i, j int) bool { return otherParams[i].goName < otherParams[j].goName })
+	return pathParams, otherParams, nil
+}
+
+// paramsDecl writes the struct of the query and header parameters of an operation
+func (g *generator) paramsDecl(name string, params []parameter) {
+	fmt.Fprintf(&g.body, "// %s are the parameters of %s\n", name, strings.TrimSuffix(name, "Params"))
+	fmt.Fprintf(&g.body, "type %s struct {\n", name)
+	for _, param := range params {
+		description := strings.TrimSpace(param.Description)
+		if description == "" {
+			description = fmt.Sprintf("%s is the %s parameter %s", param.goName, param.In, param.Name)
+		}
+		g.comment("\t", "", description)
+		fmt.Fprintf(&g.body, "\t%s %s\n", param.goName, param.goType)
+	}
+	g.body.WriteString("}\n\n")
+}
+
+// setParam writes the statement setting a query or header parameter on the request
+func (g *generator) setParam(w *bytes.Buffer, param parameter) {
+	g.imports["fmt"] = true
+	field := "params." + param.goName
+	value := "fmt.Sprint(" + field + ")"
+	if strings.HasPrefix(param.goType, "*") {
+		value = "fmt.Sprint(*" + field + ")"
+		fmt.Fprintf(w, "\tif %s != nil {\n\t", field)
+	}
+	switch param.In {
+	case openapi3.ParameterInQuery:
+		fmt.Fprintf(w, "\treq.Query.Set(%q, %s)\n", param.Name, value)
+	case openapi3.ParameterInHeader:
+		fmt.Fprintf(w, "\treq.Header.Set(%q, %s)\n", param.Name, value)
+	}
+	if strings.HasPrefix(param.goType, "*") {
+		w.WriteString("\t}\n")
+	}
+}
+
+// pathExpr returns the expression of the path with its parameters escaped
+func (g *generator) pathExpr(path string, params []parameter) string {
+	byName := make(map[string]parameter, len(params))
+	for _, param := range params {
+		byName[param.Name] = param
+	}
+	var parts []string
+	rest := path
+	for {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start < 0 || end < start {
+			break
+		}
+		if start > 0 {
+			parts = append(parts, fmt.Sprintf("%q", rest[:start]))
+		}
+		param := byName[rest[start+1:end]]
+		if param.goType == "string" {
+			parts = append(parts, "url.PathEscape("+param.goName+")")
+		} else {
+			g.imports["fmt"] = true
+			parts = append(parts, "url.PathEscape(fmt.Sprint("+param.goName+"))")
+		}
+		rest = rest[end+1:]
+	}
+	if rest != "" || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// requestBody returns the Go type of the JSON body of the operation, empty if there is none.
+// An inline object is declared as the Request type of the operation.
+func (g *generator) requestBody(name string, operation *openapi3.Operation) (string, error) {
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return "", nil
+	}
+	for mediaType, media := range operation.RequestBody.Value.Content {
+		if !isJSONMediaType(mediaType) || media.Schema == nil {
+			continue
+		}
+		return g.schemaType(name+"Request", media.Schema)
+	}
+	return "", fmt.Errorf("only JSON request bodies are supported")
+}
+
+// result returns the Go type of the JSON body of the successful response and its media type.
+// The type is empty if the response has no body or is not JSON. An inline object is declared as
+// the Response type of the operation.
+func (g *generator) result(name string, operation *openapi3.Operation) (string, string, error) {
+	if operation.Responses == nil {
+		return "", "", nil
+	}
+	var statuses []string
+	for status := range operation.Responses.Map() {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return "", "", nil
+	}
+	sort.Strings(statuses)
+	response := operation.Responses.Value(statuses[0]).Value
+	if response == nil || len(response.Content) == 0 {
+		return "", "", nil
+	}
+
+	mediaTypes := make([]string, 0, len(response.Content))
+	for mediaType := range response.Content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		if media := response.Content[mediaType]; isJSONMediaType(mediaType) && media.Schema != nil {
+			goType, err := g.schemaType(name+"Response", media.Schema)
+			return goType, mediaType, err
+		}
+	}
+	return "", mediaTypes[0], nil
+}
+
+// schemaType returns the Go type of a body, structs are pointers. An inline object is declared
+// with the given name.
+func (g *generator) schemaType(name string, ref *openapi3.SchemaRef) (string, error) {
+	if componentName(ref) == "" && ref.Value != nil && isStruct(flatten(ref.Value)) {
+		if err := g.typeDecl(name, ref.Value); err != nil {
+			return "", err
+		}
+		return "*" + name, nil
+	}
+	return g.goType(ref, false)
+}
+
+// argName returns the name of an argument, e.g. "sessionID" for "session_id"
+func argName(name string) string {
+	goName := GoName(name)
+	if strings.ToUpper(goName) == goName {
+		goName = strings.ToLower(goName)
+	} else {
+		first, size := utf8.DecodeRuneInString(goName)
+		goName = string(unicode.ToLower(first)) + goName[size:]
+	}
+	if token.IsKeyword(goName) {
+		goName += "_"
+	}
+	return goName
+}
+
+// methodConst returns the name of the net/http constant of a method, e.g. "Post" for POST
+func methodConst(method string) string {
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// nilable reports whether values of the Go type can be nil
+func nilable(goType string) bool {
+	return strings.HasPrefix(goType, "*") || strings.HasPrefix(goType, "[]") || strings.HasPrefix(goType, "map[") || goType == "json.RawMessage"
+}
+
+// isJSONMediaType reports whether the media type is JSON, e.g. application/problem+json
+func isJSONMediaType(mediaType string) bool {
+	mediaType, _, _ = mime.ParseMediaType(mediaType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
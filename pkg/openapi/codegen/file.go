@@ -0,0 +1,52 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+	"os"
+	"path/filepath"
+)
+
+// Generator returns Go source generated from a document, Types or Client
+type Generator func(doc *openapi3.T, config Config) ([]byte, error)
+
+// GenerateFile returns the source generated from the OpenAPI document in the file spec.
+// The header names spec if config.Source is empty.
+func GenerateFile(generate Generator, spec string, config Config) ([]byte, error) {
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := openapi.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	if config.Source == "" {
+		config.Source = filepath.ToSlash(spec)
+	}
+	source, err := generate(loaded.Document(), config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	return source, nil
+}
+
+// CheckFile regenerates file from the document in the file spec and fails if the checked-in
+// file differs, i.e. the document was changed without running go generate. The tests of
+// generated packages call it.
+func CheckFile(file string, generate Generator, spec string, config Config) error {
+	want, err := GenerateFile(generate, spec, config)
+	if err != nil {
+		return err
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s is out of date with %s, run go generate in its package", file, spec)
+	}
+	return nil
+}
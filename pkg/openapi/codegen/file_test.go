@@ -0,0 +1,44 @@
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "openapi.yaml")
+	if err := os.WriteFile(spec, []byte(testDocument), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Package: "messages", Source: "docs/openapi.yaml"}
+	source, err := GenerateFile(Types, spec, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(source), "from docs/openapi.yaml.") {
+		t.Errorf("Expected the header to name the configured source:\n%s", source)
+	}
+	file := filepath.Join(dir, "messages_gen.go")
+	if err = os.WriteFile(file, source, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = CheckFile(file, Types, spec, config); err != nil {
+		t.Errorf("Expected the generated file to be up to date, got %v", err)
+	}
+	if err = os.WriteFile(file, append(source, "\nvar edited = true\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckFile(file, Types, spec, config); err == nil || !strings.Contains(err.Error(), file+" is out of date") {
+		t.Errorf("Expected the edited file to be reported out of date, got %v", err)
+	}
+	if err = CheckFile(filepath.Join(dir, "missing_gen.go"), Types, spec, config); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+	if _, err = GenerateFile(Types, filepath.Join(dir, "missing.yaml"), config); err == nil {
+		t.Error("Expected a missing document to fail")
+	}
+}
@@ -0,0 +1,391 @@
+// Package codegen generates Go code from OpenAPI documents: the request and response types of
+// a service from the schemas of its components.
+//
+// Schemas are mapped to Go types by their type and format. The extensions x-go-type and
+// x-go-type-import use an existing type instead, e.g. a type shared with other packages:
+//
+//	x-go-type: logging.Secret
+//	x-go-type-import: github.com/Ruletk/GoMarketplace/pkg/logging
+//
+// Components with x-go-type are not generated. Clients ignore the extensions, see Client.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extensions of schemas naming an existing Go type and its package
+const (
+	ExtensionGoType       = "x-go-type"
+	ExtensionGoTypeImport = "x-go-type-import"
+)
+
+// Config is the configuration of a generated file
+type Config struct {
+	// Package is the name of the package of the file
+	Package string
+	// Source names the document in the header of the file, e.g. "docs/openapi.yaml"
+	Source string
+}
+
+// Types returns the Go source of the types of the component schemas. Fields of schemas used in
+// request bodies get binding tags checking the constraints of the schema, see apierror.BindJSON.
+func Types(doc *openapi3.T, config Config) ([]byte, error) {
+	g := newGenerator(doc)
+	for _, name := range g.componentNames(doc) {
+		if err := g.typeDecl(name, doc.Components.Schemas[name].Value); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	return g.source(config, "")
+}
+
+// generator writes the declarations of a file and collects their imports
+type generator struct {
+	// requests are the components used in request bodies
+	requests map[string]bool
+	// standalone ignores x-go-type, the types only depend on the document
+	standalone bool
+	imports    map[string]bool
+	body       bytes.Buffer
+}
+
+func newGenerator(doc *openapi3.T) *generator {
+	g := &generator{requests: make(map[string]bool), imports: make(map[string]bool)}
+	for _, path := range doc.Paths.InMatchingOrder() {
+		for _, operation := range doc.Paths.Value(path).Operations() {
+			if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+				continue
+			}
+			for _, media := range operation.RequestBody.Value.Content {
+				g.markRequest(media.Schema)
+			}
+		}
+	}
+	return g
+}
+
+// markRequest marks the components the schema refers to as used in requests
+func (g *generator) markRequest(ref *openapi3.SchemaRef) {
+	if ref == nil {
+		return
+	}
+	if name := componentName(ref); name != "" {
+		if g.requests[name] {
+			return
+		}
+		g.requests[name] = true
+	}
+	schema := ref.Value
+	if schema == nil {
+		return
+	}
+	for _, property := range schema.Properties {
+		g.markRequest(property)
+	}
+	g.markRequest(schema.Items)
+}
+
+// componentNames returns the names of the generated components, sorted
+func (g *generator) componentNames(doc *openapi3.T) []string {
+	var names []string
+	for name, ref := range doc.Components.Schemas {
+		if ref.Value != nil && (g.standalone || goTypeExtension(ref.Value) == "") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// componentName returns the name of the component the schema refers to, empty for inline schemas
+func componentName(ref *openapi3.SchemaRef) string {
+	const prefix = "#/components/schemas/"
+	if !strings.HasPrefix(ref.Ref, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(ref.Ref, prefix)
+}
+
+func goTypeExtension(schema *openapi3.Schema) string {
+	goType, _ := schema.Extensions[ExtensionGoType].(string)
+	return goType
+}
+
+// typeDecl writes the declaration of a component
+func (g *generator) typeDecl(name string, schema *openapi3.Schema) error {
+	schema = flatten(schema)
+	g.comment("", name, schema.Description)
+	if !isStruct(schema) {
+		goType, err := g.goType(&openapi3.SchemaRef{Value: schema}, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.body, "type %s %s\n\n", name, goType)
+		return nil
+	}
+
+	fmt.Fprintf(&g.body, "type %s struct {\n", name)
+	required := make(map[string]bool, len(schema.Required))
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+	properties := make([]string, 0, len(schema.Properties))
+	for property := range schema.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	for _, property := range properties {
+		ref := schema.Properties[property]
+		goType, err := g.goType(ref, required[property])
+		if err != nil {
+			return fmt.Errorf("property %s: %w", property, err)
+		}
+		tag := "json:\"" + property
+		if !required[property] {
+			tag += ",omitempty"
+		}
+		tag += "\""
+		if g.requests[name] && !g.standalone {
+			if rules := bindingRules(ref.Value, required[property]); rules != "" {
+				tag += " binding:\"" + rules + "\""
+			}
+		}
+		if ref.Value != nil && componentName(ref) == "" {
+			g.comment("\t", "", ref.Value.Description)
+		}
+		fmt.Fprintf(&g.body, "\t%s %s `%s`\n", GoName(property), goType, tag)
+	}
+	g.body.WriteString("}\n\n")
+	return nil
+}
+
+// isStruct reports whether the schema is declared as a struct
+func isStruct(schema *openapi3.Schema) bool {
+	return schema.Type.Is("object") && len(schema.Properties) > 0
+}
+
+// flatten merges the parts of an allOf schema into one object schema, the properties of later
+// parts win
+func flatten(schema *openapi3.Schema) *openapi3.Schema {
+	if len(schema.AllOf) == 0 {
+		return schema
+	}
+	merged := &openapi3.Schema{Type: &openapi3.Types{"object"}, Description: schema.Description, Properties: openapi3.Schemas{}}
+	parts := make([]*openapi3.Schema, 0, len(schema.AllOf)+1)
+	for _, part := range schema.AllOf {
+		if part.Value != nil {
+			parts = append(parts, flatten(part.Value))
+		}
+	}
+	parts = append(parts, schema)
+	for _, part := range parts {
+		for name, property := range part.Properties {
+			merged.Properties[name] = property
+		}
+		merged.Required = append(merged.Required, part.Required...)
+	}
+	return merged
+}
+
+// comment writes the description as a comment, starting with the name if given
+func (g *generator) comment(indent string, name string, description string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		if name != "" {
+			fmt.Fprintf(&g.body, "%s// %s is generated from the %s schema\n", indent, name, name)
+		}
+		return
+	}
+	if name != "" {
+		description = name + " " + lowerFirst(description)
+	}
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(&g.body, "%s// %s\n", indent, strings.TrimRight(line, " "))
+	}
+}
+
+// lowerFirst lowers the first letter of a sentence following a name, acronyms are kept
+func lowerFirst(s string) string {
+	first, size := utf8.DecodeRuneInString(s)
+	second, _ := utf8.DecodeRuneInString(s[size:])
+	if unicode.IsUpper(second) {
+		return s
+	}
+	return string(unicode.ToLower(first)) + s[size:]
+}
+
+// goType returns the Go type of a schema. Optional components of type object and times are
+// pointers, so they can be absent.
+func (g *generator) goType(ref *openapi3.SchemaRef, required bool) (string, error) {
+	schema := ref.Value
+	if schema == nil {
+		return "", fmt.Errorf("unresolved reference %s", ref.Ref)
+	}
+	pointer := ""
+	if !required {
+		pointer = "*"
+	}
+
+	if goType := goTypeExtension(schema); goType != "" && !g.standalone {
+		if path, _ := schema.Extensions[ExtensionGoTypeImport].(string); path != "" {
+			g.imports[path] = true
+		}
+		// Inline schemas name the exact type, e.g. "*protocol.CredentialCreation"
+		if componentName(ref) != "" && schema.Type.Is("object") {
+			return pointer + goType, nil
+		}
+		return goType, nil
+	}
+	if name := componentName(ref); name != "" {
+		if isStruct(flatten(schema)) {
+			return pointer + name, nil
+		}
+		return name, nil
+	}
+
+	switch {
+	case schema.Type.Is("string") && schema.Format == "date-time":
+		g.imports["time"] = true
+		return pointer + "time.Time", nil
+	case schema.Type.Is("string"):
+		return "string", nil
+	case schema.Type.Is("integer") && schema.Format == "int64":
+		return "int64", nil
+	case schema.Type.Is("integer") && schema.Format == "int32":
+		return "int32", nil
+	case schema.Type.Is("integer"):
+		return "int", nil
+	case schema.Type.Is("number"):
+		return "float64", nil
+	case schema.Type.Is("boolean"):
+		return "bool", nil
+	case schema.Type.Is("array"):
+		if schema.Items == nil {
+			return "[]interface{}", nil
+		}
+		item, err := g.goType(schema.Items, true)
+		return "[]" + item, err
+	case schema.Type.Is("object") && len(schema.Properties) == 0:
+		if additional := schema.AdditionalProperties.Schema; additional != nil {
+			value, err := g.goType(additional, true)
+			return "map[string]" + value, err
+		}
+		// Free-form objects are kept as sent
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+	return "", fmt.Errorf("inline schemas of type %v are not supported, declare a component", schema.Type)
+}
+
+// bindingRules returns the validator rules of the constraints of a schema, e.g. "required,max=64"
+func bindingRules(schema *openapi3.Schema, required bool) string {
+	if schema == nil {
+		return ""
+	}
+	var rules []string
+	optional := false
+	if required {
+		rules = append(rules, "required")
+	}
+	if schema.Type.Is("string") {
+		if schema.Format == "email" {
+			rules = append(rules, "email")
+			optional = !required
+		}
+		if schema.MinLength > 0 {
+			rules = append(rules, "min="+strconv.FormatUint(schema.MinLength, 10))
+			optional = !required
+		}
+		if schema.MaxLength != nil {
+			rules = append(rules, "max="+strconv.FormatUint(*schema.MaxLength, 10))
+		}
+	}
+	if len(schema.Enum) > 0 {
+		values := make([]string, 0, len(schema.Enum))
+		for _, value := range schema.Enum {
+			if value == "" {
+				optional = true
+				continue
+			}
+			values = append(values, fmt.Sprint(value))
+		}
+		rules = append(rules, "oneof="+strings.Join(values, " "))
+		optional = optional || !required
+	}
+	if optional && !required {
+		rules = append([]string{"omitempty"}, rules...)
+	}
+	return strings.Join(rules, ",")
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{"api": true, "id": true, "ip": true, "json": true, "http": true, "url": true, "uri": true, "csrf": true}
+
+// GoName returns the exported Go name of a JSON name, e.g. "SessionID" for "session_id"
+func GoName(name string) string {
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			words = append(words, string(runes[start:i]))
+			start = i + 1
+		case unicode.IsUpper(r) && i > start && !unicode.IsUpper(runes[i-1]):
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+
+	var b strings.Builder
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(first))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
+
+// source returns the formatted file of the declarations
+func (g *generator) source(config Config, extra string) ([]byte, error) {
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by openapi-gen from %s. DO NOT EDIT.\n\n", config.Source)
+	fmt.Fprintf(&file, "package %s\n\n", config.Package)
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		file.WriteString("import (\n")
+		for _, path := range imports {
+			fmt.Fprintf(&file, "\t%q\n", path)
+		}
+		file.WriteString(")\n\n")
+	}
+	file.Write(g.body.Bytes())
+	file.WriteString(extra)
+
+	formatted, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %w\n%s", err, file.String())
+	}
+	return formatted, nil
+}
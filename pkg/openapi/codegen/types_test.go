@@ -0,0 +1,148 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/openapi"
+)
+
+const testDocument = `
+openapi: 3.0.3
+info:
+  title: Test
+  version: 1.0.0
+paths:
+  /items:
+    post:
+      operationId: createItem
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/ItemRequest"
+      responses:
+        "200":
+          description: The item
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Item"
+components:
+  schemas:
+    ItemRequest:
+      type: object
+      required:
+        - name
+        - owner_email
+      properties:
+        name:
+          type: string
+          maxLength: 64
+        owner_email:
+          type: string
+          format: email
+        color:
+          type: string
+          enum: [red, green]
+        secret:
+          type: string
+          x-go-type: logging.Secret
+          x-go-type-import: github.com/Ruletk/GoMarketplace/pkg/logging
+    Item:
+      description: Is an item of the catalog
+      type: object
+      required:
+        - id
+        - created_at
+      properties:
+        id:
+          type: integer
+          format: int64
+        created_at:
+          type: string
+          format: date-time
+        tags:
+          type: array
+          items:
+            type: string
+        attributes:
+          type: object
+          additionalProperties:
+            type: string
+        shared:
+          $ref: "#/components/schemas/Shared"
+    Shared:
+      type: object
+      x-go-type: shared.Item
+      x-go-type-import: example.com/shared
+      properties:
+        id:
+          type: integer
+`
+
+func TestTypes(t *testing.T) {
+	spec := openapi.MustLoad([]byte(testDocument))
+	source, err := Types(spec.Document(), Config{Package: "messages", Source: "docs/openapi.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"// Code generated by openapi-gen from docs/openapi.yaml. DO NOT EDIT.",
+		"package messages",
+		`"example.com/shared"`,
+		`"github.com/Ruletk/GoMarketplace/pkg/logging"`,
+		`"time"`,
+		"// Item is an item of the catalog",
+		"Attributes map[string]string `json:\"attributes,omitempty\"`",
+		"CreatedAt  time.Time         `json:\"created_at\"`",
+		"ID         int64             `json:\"id\"`",
+		"Shared     *shared.Item      `json:\"shared,omitempty\"`",
+		"Tags       []string          `json:\"tags,omitempty\"`",
+		"// ItemRequest is generated from the ItemRequest schema",
+		"Color      string         `json:\"color,omitempty\" binding:\"omitempty,oneof=red green\"`",
+		"Name       string         `json:\"name\" binding:\"required,max=64\"`",
+		"OwnerEmail string         `json:\"owner_email\" binding:\"required,email\"`",
+		"Secret     logging.Secret `json:\"secret,omitempty\"`",
+	} {
+		if !strings.Contains(string(source), want) {
+			t.Errorf("Generated source lacks %q:\n%s", want, source)
+		}
+	}
+	if strings.Contains(string(source), "type Shared") {
+		t.Errorf("Component with x-go-type was generated:\n%s", source)
+	}
+}
+
+func TestTypesRejectsInlineObjects(t *testing.T) {
+	document := strings.Replace(testDocument, `        tags:
+          type: array
+          items:
+            type: string`, `        tags:
+          type: object
+          properties:
+            name:
+              type: string`, 1)
+	spec := openapi.MustLoad([]byte(document))
+	if _, err := Types(spec.Document(), Config{Package: "messages"}); err == nil || !strings.Contains(err.Error(), "schema Item: property tags") {
+		t.Fatalf("Expected an error naming the inline object, got %v", err)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, want := range map[string]string{
+		"session_id":  "SessionID",
+		"newPassword": "NewPassword",
+		"remember_me": "RememberMe",
+		"api-key":     "APIKey",
+		"csrf_token":  "CSRFToken",
+		"ID":          "ID",
+		"ip":          "IP",
+	} {
+		if got := GoName(name); got != want {
+			t.Errorf("GoName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:generate sh fetch-assets.sh
+
+//go:embed pages/*.html
+var pages embed.FS
+
+// bundledAssets are the vendored Swagger UI and Redoc files, fetch-assets.sh pins their versions
+// and SHA384SUMS their checksums
+//
+//go:embed assets
+var bundledAssets embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(pages, "pages/*.html"))
+
+// assetNames are the files the pages load, swagger-ui-dist and the Redoc standalone bundle
+var assetNames = []string{"swagger-ui.css", "swagger-ui-bundle.js", "redoc.standalone.js"}
+
+// checksumsFile lists the pinned checksums of the assets in the format of sha384sum
+const checksumsFile = "SHA384SUMS"
+
+// DocsConfig is the configuration of the documentation routes
+type DocsConfig struct {
+	// Title of the pages, the title of the document if empty
+	Title string
+	// Assets holds swagger-ui.css, swagger-ui-bundle.js, redoc.standalone.js and their
+	// SHA384SUMS, the bundled files if nil
+	Assets fs.FS
+}
+
+// Docs serves the document of a service, and pages rendering it with Swagger UI and Redoc.
+// The pages load their assets from the service itself, so they work without internet access.
+type Docs struct {
+	yaml      []byte
+	json      []byte
+	swaggerUI []byte
+	redoc     []byte
+	assets    map[string]asset
+}
+
+type asset struct {
+	contentType string
+	data        []byte
+}
+
+// NewDocs renders the document and the pages once, they are served as is. Without assets the
+// pages link to the document instead, the assets must match their pinned checksums.
+func NewDocs(spec *Spec, config DocsConfig) (*Docs, error) {
+	if config.Title == "" {
+		config.Title = spec.doc.Info.Title
+	}
+	if config.Assets == nil {
+		assets, err := fs.Sub(bundledAssets, "assets")
+		if err != nil {
+			return nil, err
+		}
+		config.Assets = assets
+	}
+
+	data, err := json.Marshal(spec.doc)
+	if err != nil {
+		return nil, err
+	}
+	docs := &Docs{yaml: spec.data, json: data}
+	integrity, err := docs.loadAssets(config.Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	swaggerUI, redoc := "swagger-ui.html", "redoc.html"
+	if !docs.Bundled() {
+		swaggerUI, redoc = "unbundled.html", "unbundled.html"
+	}
+	if docs.swaggerUI, err = renderPage(swaggerUI, config.Title, integrity); err != nil {
+		return nil, err
+	}
+	if docs.redoc, err = renderPage(redoc, config.Title, integrity); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Bundled reports whether the pages have Swagger UI and Redoc, they are vendored by go generate
+func (d *Docs) Bundled() bool {
+	return d.assets != nil
+}
+
+// loadAssets reads the assets and checks them against their pinned checksums, the integrity of
+// the pages comes from the checksums. There are no assets if none of the files is there.
+func (d *Docs) loadAssets(fsys fs.FS) (map[string]string, error) {
+	assets := map[string]asset{}
+	for _, name := range assetNames {
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		contentType := "text/javascript; charset=utf-8"
+		if path.Ext(name) == ".css" {
+			contentType = "text/css; charset=utf-8"
+		}
+		assets[name] = asset{contentType: contentType, data: data}
+	}
+	if len(assets) == 0 {
+		return nil, nil
+	}
+
+	checksums, err := readChecksums(fsys)
+	if err != nil {
+		return nil, err
+	}
+	integrity := map[string]string{}
+	for _, name := range assetNames {
+		asset, ok := assets[name]
+		if !ok {
+			return nil, fmt.Errorf("missing documentation asset %s, run go generate in pkg/openapi", name)
+		}
+		pinned, ok := checksums[name]
+		if !ok {
+			return nil, fmt.Errorf("no pinned checksum for the documentation asset %s", name)
+		}
+		if sum := sha512.Sum384(asset.data); !bytes.Equal(sum[:], pinned) {
+			return nil, fmt.Errorf("the documentation asset %s does not match its pinned checksum", name)
+		}
+		integrity[name] = "sha384-" + base64.StdEncoding.EncodeToString(pinned)
+	}
+	d.assets = assets
+	return integrity, nil
+}
+
+// readChecksums reads the checksums by file name, lines starting with # are comments
+func readChecksums(fsys fs.FS) (map[string][]byte, error) {
+	data, err := fs.ReadFile(fsys, checksumsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checksums of the documentation assets: %w", err)
+	}
+	checksums := map[string][]byte{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed checksum line %q", line)
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha512.Size384 {
+			return nil, fmt.Errorf("malformed checksum line %q", line)
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = sum
+	}
+	return checksums, nil
+}
+
+// renderPage renders a documentation page. The document and the assets are referred to
+// relatively, so the pages work behind a gateway serving the service under a prefix.
+func renderPage(name string, title string, integrity map[string]string) ([]byte, error) {
+	var page bytes.Buffer
+	err := pageTemplates.ExecuteTemplate(&page, name, map[string]any{
+		"Title":     title,
+		"AssetsURL": "docs/assets",
+		"SpecURL":   "openapi.json",
+		"Integrity": integrity,
+	})
+	return page.Bytes(), err
+}
+
+// RegisterRoutes registers the document as /openapi.yaml and /openapi.json, the pages as /docs
+// for Swagger UI and /redoc for Redoc, and their assets under /docs/assets. They are public, like
+// the document. The assets are not found unless bundled.
+func (d *Docs) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/openapi.yaml", d.serve("application/yaml", d.yaml))
+	router.GET("/openapi.json", d.serve("application/json", d.json))
+	router.GET("/docs", d.serve("text/html; charset=utf-8", d.swaggerUI))
+	router.GET("/redoc", d.serve("text/html; charset=utf-8", d.redoc))
+	router.GET("/docs/assets/:name", d.serveAsset)
+}
+
+func (d *Docs) serveAsset(c *gin.Context) {
+	asset, ok := d.assets[c.Param("name")]
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Data(http.StatusOK, asset.contentType, asset.data)
+}
+
+func (d *Docs) serve(contentType string, data []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
@@ -0,0 +1,31 @@
+#!/bin/sh
+# Vendors the Swagger UI and Redoc files served with the documentation pages into assets/.
+# The downloads must match the checksums pinned in assets/SHA384SUMS, commit the files after
+# vendoring them. After changing a version, review the release and run "fetch-assets.sh pin"
+# to pin its checksums.
+set -eu
+
+SWAGGER_UI_VERSION=5.17.14
+REDOC_VERSION=2.1.5
+
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+mkdir "$tmp/swagger-ui" "$tmp/redoc" "$tmp/assets"
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-$SWAGGER_UI_VERSION.tgz" | tar -xz -C "$tmp/swagger-ui"
+curl -fsSL "https://registry.npmjs.org/redoc/-/redoc-$REDOC_VERSION.tgz" | tar -xz -C "$tmp/redoc"
+cp "$tmp/swagger-ui/package/swagger-ui.css" "$tmp/swagger-ui/package/swagger-ui-bundle.js" "$tmp/assets/"
+cp "$tmp/redoc/package/bundles/redoc.standalone.js" "$tmp/assets/"
+
+if [ "${1:-}" = pin ]; then
+	grep '^#' assets/SHA384SUMS >"$tmp/SHA384SUMS"
+	(cd "$tmp/assets" && sha384sum swagger-ui.css swagger-ui-bundle.js redoc.standalone.js) >>"$tmp/SHA384SUMS"
+	cp "$tmp/SHA384SUMS" assets/SHA384SUMS
+fi
+
+if ! grep -v '^#' assets/SHA384SUMS | (cd "$tmp/assets" && sha384sum --strict -c -); then
+	echo "The downloads do not match assets/SHA384SUMS" >&2
+	exit 1
+fi
+cp "$tmp/assets/"* assets/
@@ -0,0 +1,112 @@
+package openapi
+
+import (
+	"bytes"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Config is the configuration of Middleware
+type Config struct {
+	// Responses validates the responses too. They are buffered until validated, so it is meant
+	// for tests and staging. Event streams are not validated.
+	Responses bool
+	// OnInvalidResponse is called with a response failing validation before it is replaced with
+	// apierror.ErrInternal, the error is logged if nil
+	OnInvalidResponse func(c *gin.Context, err error)
+}
+
+// Middleware validates the documented requests against the spec and answers invalid ones with
+// apierror.ErrInvalidRequest. It must run before apierror.Middleware, so the problems it writes
+// are validated too.
+func Middleware(spec *Spec, config Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		input, ok := spec.input(c.Request)
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := requestError(openapi3filter.ValidateRequest(c.Request.Context(), input)); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+		if !config.Responses || streams(input.Route) {
+			c.Next()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		err := validateResponse(c.Request.Context(), input, recorder.status, recorder.Header(), recorder.body.Bytes())
+		if err == nil {
+			recorder.flush()
+			return
+		}
+		if config.OnInvalidResponse != nil {
+			config.OnInvalidResponse(c, err)
+		} else {
+			logging.FromContext(c.Request.Context()).Error(err)
+		}
+		c.Writer.Header().Del("Content-Length")
+		apierror.Abort(c, apierror.ErrInternal.Wrap(err))
+	}
+}
+
+// responseRecorder buffers a response until it is validated
+type responseRecorder struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.written {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) WriteHeaderNow() {
+	r.written = true
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.written = true
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.written = true
+	return r.body.WriteString(s)
+}
+
+func (r *responseRecorder) Status() int {
+	return r.status
+}
+
+func (r *responseRecorder) Size() int {
+	if !r.written {
+		return -1
+	}
+	return r.body.Len()
+}
+
+func (r *responseRecorder) Written() bool {
+	return r.written
+}
+
+// Flush is a no-op, the response is written once validated
+func (r *responseRecorder) Flush() {}
+
+// flush writes the buffered response
+func (r *responseRecorder) flush() {
+	r.ResponseWriter.WriteHeader(r.status)
+	r.ResponseWriter.WriteHeaderNow()
+	_, _ = r.ResponseWriter.Write(r.body.Bytes())
+}
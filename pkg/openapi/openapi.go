@@ -0,0 +1,342 @@
+// Package openapi validates the requests and the responses of a service against its OpenAPI
+// document, so the document cannot drift from the code unnoticed.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	// The validator of the "email" binding rule, the OpenAPI format is not checked by default
+	openapi3.DefineStringFormatValidator("email", openapi3.NewCallbackValidator(func(value string) error {
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			return errors.New("not an e-mail address")
+		}
+		return nil
+	}))
+}
+
+// Spec is a loaded OpenAPI document
+type Spec struct {
+	data   []byte
+	doc    *openapi3.T
+	router routers.Router
+}
+
+// Load parses and validates an OpenAPI 3 document in YAML or JSON. Requests are matched on their
+// path alone: the servers of the document are where clients reach the service, the service
+// serves the paths at its root.
+func Load(data []byte) (*Spec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if err = doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	local := *doc
+	local.Servers = nil
+	router, err := gorillamux.NewRouter(&local)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{data: data, doc: doc, router: router}, nil
+}
+
+// MustLoad is Load panicking on an error, for documents embedded in the binary
+func MustLoad(data []byte) *Spec {
+	spec, err := Load(data)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// Document returns the parsed document, it must not be modified
+func (s *Spec) Document() *openapi3.T {
+	return s.doc
+}
+
+// Operation is a documented operation
+type Operation struct {
+	// Method is the HTTP method, e.g. "POST"
+	Method string
+	// Path is the path template, e.g. "/passkeys/{id}"
+	Path string
+	// ID is the operationId
+	ID string
+	// Statuses are the documented response statuses, e.g. "200"
+	Statuses []string
+}
+
+// Operations returns the documented operations sorted by path and method
+func (s *Spec) Operations() []Operation {
+	var operations []Operation
+	for _, path := range s.doc.Paths.InMatchingOrder() {
+		for method, operation := range s.doc.Paths.Value(path).Operations() {
+			operations = append(operations, newOperation(method, path, operation))
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Path != operations[j].Path {
+			return operations[i].Path < operations[j].Path
+		}
+		return operations[i].Method < operations[j].Method
+	})
+	return operations
+}
+
+func newOperation(method string, path string, operation *openapi3.Operation) Operation {
+	var statuses []string
+	for status := range operation.Responses.Map() {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	return Operation{Method: method, Path: path, ID: operation.OperationID, Statuses: statuses}
+}
+
+// FindOperation returns the documented operation serving the request
+func (s *Spec) FindOperation(r *http.Request) (Operation, bool) {
+	route, _, err := s.router.FindRoute(r)
+	if err != nil {
+		return Operation{}, false
+	}
+	return newOperation(route.Method, route.Path, route.Operation), true
+}
+
+// input returns the validation input of the request, false if the request is not documented
+func (s *Spec) input(r *http.Request) (*openapi3filter.RequestValidationInput, bool) {
+	route, params, err := s.router.FindRoute(r)
+	if err != nil {
+		return nil, false
+	}
+	return &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError: true,
+			// Authentication is up to the middleware of the service
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			// The handlers bind the body as sent
+			SkipSettingDefaults: true,
+		},
+	}, true
+}
+
+// ValidateRequest checks the parameters and the body of the request. An invalid request is
+// apierror.ErrInvalidRequest listing the invalid fields, undocumented requests are not checked.
+func (s *Spec) ValidateRequest(r *http.Request) error {
+	input, ok := s.input(r)
+	if !ok {
+		return nil
+	}
+	return requestError(openapi3filter.ValidateRequest(r.Context(), input))
+}
+
+// ValidateResponse checks the status, the headers and the body of the response to the request.
+// Bodies are only checked if they are JSON, undocumented requests are not checked.
+func (s *Spec) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	input, ok := s.input(r)
+	if !ok {
+		return nil
+	}
+	return validateResponse(r.Context(), input, status, header, body)
+}
+
+func validateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, status int, header http.Header, body []byte) error {
+	options := &openapi3filter.Options{
+		IncludeResponseStatus: true,
+		MultiError:            true,
+		ExcludeResponseBody:   !isJSON(header.Get("Content-Type")),
+	}
+	err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options:                options,
+	})
+	if err != nil {
+		return fmt.Errorf("response %d to %s %s does not match the OpenAPI document: %w", status, input.Request.Method, input.Route.Path, err)
+	}
+	return nil
+}
+
+// isJSON reports whether the media type is JSON, e.g. application/problem+json
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// streams reports whether the operation answers with an event stream, which cannot be buffered
+func streams(route *routers.Route) bool {
+	for _, response := range route.Operation.Responses.Map() {
+		if response.Value != nil && response.Value.Content.Get("text/event-stream") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// requestError converts the error of validating a request to ErrInvalidRequest
+func requestError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var fields []apierror.FieldError
+	for _, err := range flatten(err) {
+		var requestErr *openapi3filter.RequestError
+		if !errors.As(err, &requestErr) {
+			return apierror.ErrInvalidRequest.Wrap(err)
+		}
+		switch {
+		case requestErr.RequestBody != nil && errors.Is(requestErr.Err, openapi3filter.ErrInvalidRequired):
+			return apierror.ErrInvalidRequest.WithMessage("INVALID_REQUEST.empty_body", nil).Wrap(err)
+		case requestErr.RequestBody != nil && strings.HasPrefix(requestErr.Reason, "header Content-Type"):
+			return apierror.ErrInvalidRequest.WithMessage("INVALID_REQUEST.content_type", i18n.Args{
+				"type":     requestErr.Input.Request.Header.Get("Content-Type"),
+				"expected": strings.Join(contentTypes(requestErr.RequestBody.Content), ", "),
+			}).Wrap(err)
+		}
+
+		if requestErr.Parameter != nil && errors.Is(requestErr.Err, openapi3filter.ErrInvalidRequired) {
+			fields = append(fields, apierror.NewFieldError(requestErr.Parameter.Name, "required", "", reflect.String))
+			continue
+		}
+
+		for _, err := range flatten(requestErr.Err) {
+			var schemaErr *openapi3.SchemaError
+			switch {
+			case errors.As(err, &schemaErr) && requestErr.Parameter != nil:
+				fields = append(fields, fieldError(requestErr.Parameter.Name, schemaErr))
+			case errors.As(err, &schemaErr):
+				fields = append(fields, fieldError(strings.Join(schemaErr.JSONPointer(), "."), schemaErr))
+			case requestErr.Parameter != nil:
+				// A parameter that cannot be parsed, e.g. "abc" for an integer
+				var schema *openapi3.Schema
+				if requestErr.Parameter.Schema != nil {
+					schema = requestErr.Parameter.Schema.Value
+				}
+				fields = append(fields, apierror.NewFieldError(requestErr.Parameter.Name, "type", schemaType(schema), reflect.String))
+			default:
+				return apierror.ErrInvalidRequest.WithMessage("INVALID_REQUEST.malformed_body", nil).Wrap(err)
+			}
+		}
+	}
+	return apierror.ErrInvalidRequest.WithFields(fields...).Wrap(err)
+}
+
+// flatten returns the errors of a MultiError, nested ones included, or the error itself
+func flatten(err error) []error {
+	multi, ok := err.(openapi3.MultiError)
+	if !ok {
+		if err == nil {
+			return nil
+		}
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range multi {
+		errs = append(errs, flatten(err)...)
+	}
+	return errs
+}
+
+// fieldError names the keyword of the schema a field broke like the binding rule checking the
+// same, so clients get the same errors whichever catches the field first
+func fieldError(field string, err *openapi3.SchemaError) apierror.FieldError {
+	schema := err.Schema
+	kind := schemaKind(schema)
+	switch err.SchemaField {
+	case "required":
+		return apierror.NewFieldError(field, "required", "", kind)
+	case "format":
+		return apierror.NewFieldError(field, schema.Format, "", kind)
+	case "enum":
+		values := make([]string, 0, len(schema.Enum))
+		for _, value := range schema.Enum {
+			if value != "" {
+				values = append(values, fmt.Sprint(value))
+			}
+		}
+		return apierror.NewFieldError(field, "oneof", strings.Join(values, " "), kind)
+	case "minLength":
+		return apierror.NewFieldError(field, "min", strconv.FormatUint(schema.MinLength, 10), kind)
+	case "maxLength":
+		return apierror.NewFieldError(field, "max", strconv.FormatUint(*schema.MaxLength, 10), kind)
+	case "minItems":
+		return apierror.NewFieldError(field, "min", strconv.FormatUint(schema.MinItems, 10), kind)
+	case "maxItems":
+		return apierror.NewFieldError(field, "max", strconv.FormatUint(*schema.MaxItems, 10), kind)
+	case "minimum":
+		rule := "gte"
+		if schema.ExclusiveMin {
+			rule = "gt"
+		}
+		return apierror.NewFieldError(field, rule, strconv.FormatFloat(*schema.Min, 'f', -1, 64), kind)
+	case "maximum":
+		rule := "lte"
+		if schema.ExclusiveMax {
+			rule = "lt"
+		}
+		return apierror.NewFieldError(field, rule, strconv.FormatFloat(*schema.Max, 'f', -1, 64), kind)
+	case "type":
+		return apierror.NewFieldError(field, "type", schemaType(schema), kind)
+	}
+	return apierror.NewFieldError(field, err.SchemaField, "", kind)
+}
+
+// schemaKind returns the kind of the Go values of a schema, the messages of length rules depend on it
+func schemaKind(schema *openapi3.Schema) reflect.Kind {
+	switch {
+	case schema == nil:
+		return reflect.Invalid
+	case schema.Type.Is("string"):
+		return reflect.String
+	case schema.Type.Is("array"):
+		return reflect.Slice
+	case schema.Type.Is("object"):
+		return reflect.Map
+	case schema.Type.Is("integer"):
+		return reflect.Int64
+	case schema.Type.Is("number"):
+		return reflect.Float64
+	}
+	return reflect.Invalid
+}
+
+func schemaType(schema *openapi3.Schema) string {
+	if schema == nil || schema.Type == nil {
+		return ""
+	}
+	return strings.Join(schema.Type.Slice(), ", ")
+}
+
+func contentTypes(content openapi3.Content) []string {
+	types := make([]string, 0, len(content))
+	for contentType := range content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,287 @@
+package openapi
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+const testDocument = `
+openapi: 3.0.3
+info:
+  title: Test
+  version: 1.0.0
+servers:
+  - url: http://localhost/api/v1/test
+paths:
+  /items/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+    put:
+      operationId: putItem
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Item"
+      responses:
+        "200":
+          description: The item
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Item"
+        "400":
+          description: Invalid request
+          content:
+            application/problem+json:
+              schema:
+                type: object
+                required: [ code ]
+components:
+  schemas:
+    Item:
+      type: object
+      required: [ name, owner ]
+      properties:
+        name:
+          type: string
+          maxLength: 4
+        owner:
+          type: string
+          format: email
+        color:
+          type: string
+          enum: [ "", red, blue ]
+`
+
+type problem struct {
+	Code   string                `json:"code"`
+	Detail string                `json:"detail"`
+	Errors []apierror.FieldError `json:"errors"`
+}
+
+func newTestRouter(t *testing.T, invalid *error, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(MustLoad([]byte(testDocument)), Config{
+		Responses: true,
+		OnInvalidResponse: func(_ *gin.Context, err error) {
+			*invalid = err
+		},
+	}), apierror.Middleware())
+	router.PUT("/items/:id", handler)
+	router.GET("/undocumented", func(c *gin.Context) {
+		c.String(http.StatusTeapot, "short and stout")
+	})
+	return router
+}
+
+func echo(c *gin.Context) {
+	var item map[string]interface{}
+	_ = c.ShouldBindJSON(&item)
+	c.JSON(http.StatusOK, item)
+}
+
+func TestMiddlewareValidatesRequests(t *testing.T) {
+	var invalid error
+	router := newTestRouter(t, &invalid, echo)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		fields      []string
+		detail      string
+	}{
+		{"valid", "/items/1", "application/json", `{"name":"cup","owner":"me@example.com","color":""}`, http.StatusOK, nil, ""},
+		{"fields", "/items/1", "application/json", `{"name":"teapot","owner":"me","color":"green"}`, http.StatusBadRequest, []string{"color:oneof:red blue", "name:max:4", "owner:email:"}, ""},
+		{"missing", "/items/1", "application/json", `{}`, http.StatusBadRequest, []string{"name:required:", "owner:required:"}, ""},
+		{"path", "/items/abc", "application/json", `{"name":"cup","owner":"me@example.com"}`, http.StatusBadRequest, []string{"id:type:integer"}, ""},
+		{"empty", "/items/1", "application/json", ``, http.StatusBadRequest, nil, "The request body is empty"},
+		{"malformed", "/items/1", "application/json", `{"name":`, http.StatusBadRequest, nil, "The request body is not valid JSON"},
+		{"content type", "/items/1", "text/plain", `cup`, http.StatusBadRequest, nil, `Unsupported content type "text/plain", expected application/json`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPut, tc.path, strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", tc.contentType)
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tc.status {
+				t.Fatalf("Expected %d, got %d: %s", tc.status, recorder.Code, recorder.Body.String())
+			}
+			if invalid != nil {
+				t.Fatalf("Expected a valid response, got %v", invalid)
+			}
+			if tc.status == http.StatusOK {
+				return
+			}
+
+			var body problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != apierror.ErrInvalidRequest.Code {
+				t.Fatalf("Expected an invalid request, got %s", recorder.Body.String())
+			}
+			var fields []string
+			for _, field := range body.Errors {
+				fields = append(fields, field.Field+":"+field.Rule+":"+field.Param)
+			}
+			if strings.Join(fields, ",") != strings.Join(tc.fields, ",") || body.Detail != tc.detail {
+				t.Errorf("Expected %v %q, got %v %q", tc.fields, tc.detail, fields, body.Detail)
+			}
+		})
+	}
+}
+
+func TestMiddlewareValidatesResponses(t *testing.T) {
+	var invalid error
+	router := newTestRouter(t, &invalid, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"name": "cup"})
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/items/1", strings.NewReader(`{"name":"cup","owner":"me@example.com"}`))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	if invalid == nil || !strings.Contains(invalid.Error(), "owner") {
+		t.Errorf("Expected the missing owner to be reported, got %v", invalid)
+	}
+	if recorder.Code != http.StatusInternalServerError || strings.Contains(recorder.Body.String(), "cup") {
+		t.Errorf("Expected the response to be replaced with an internal error, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Undocumented routes are left alone
+	invalid = nil
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/undocumented", nil))
+	if recorder.Code != http.StatusTeapot || invalid != nil {
+		t.Errorf("Expected the undocumented response as is, got %d and %v", recorder.Code, invalid)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	spec := MustLoad([]byte(testDocument))
+	operations := spec.Operations()
+	if len(operations) != 1 || operations[0].ID != "putItem" || strings.Join(operations[0].Statuses, ",") != "200,400" {
+		t.Fatalf("Unexpected operations %+v", operations)
+	}
+	operation, ok := spec.FindOperation(httptest.NewRequest(http.MethodPut, "/items/7", nil))
+	if !ok || operation.Path != "/items/{id}" {
+		t.Errorf("Expected /items/{id}, got %+v", operation)
+	}
+	if _, err := Load([]byte("openapi: 3.0.3\npaths: {}\n")); err == nil {
+		t.Error("Expected a document without info to be rejected")
+	}
+}
+
+// testAssets are assets with their checksums pinned
+func testAssets() fstest.MapFS {
+	assets := fstest.MapFS{
+		"swagger-ui.css":       {Data: []byte("body {}")},
+		"swagger-ui-bundle.js": {Data: []byte("var SwaggerUIBundle;")},
+		"redoc.standalone.js":  {Data: []byte("var Redoc;")},
+	}
+	checksums := "# Pinned\n"
+	for name, file := range assets {
+		sum := sha512.Sum384(file.Data)
+		checksums += hex.EncodeToString(sum[:]) + "  " + name + "\n"
+	}
+	assets["SHA384SUMS"] = &fstest.MapFile{Data: []byte(checksums)}
+	return assets
+}
+
+func TestDocs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	docs, err := NewDocs(MustLoad([]byte(testDocument)), DocsConfig{Assets: testAssets()})
+	if err != nil || !docs.Bundled() {
+		t.Fatalf("Expected the assets to be bundled, got %v", err)
+	}
+	router := gin.New()
+	docs.RegisterRoutes(router.Group("/"))
+	sum := sha512.Sum384([]byte("body {}"))
+	cssIntegrity := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		path        string
+		contentType string
+		contains    []string
+	}{
+		{"/openapi.yaml", "application/yaml", []string{"operationId: putItem"}},
+		{"/openapi.json", "application/json", []string{`"operationId":"putItem"`}},
+		{"/docs", "text/html; charset=utf-8", []string{"<title>Test</title>", `href="docs/assets/swagger-ui.css" integrity="` + cssIntegrity + `"`, `src="docs/assets/swagger-ui-bundle.js" integrity="sha384-`, `url: "openapi.json"`}},
+		{"/redoc", "text/html; charset=utf-8", []string{`src="docs/assets/redoc.standalone.js" integrity="sha384-`, `spec-url="openapi.json"`}},
+		{"/docs/assets/swagger-ui.css", "text/css; charset=utf-8", []string{"body {}"}},
+		{"/docs/assets/redoc.standalone.js", "text/javascript; charset=utf-8", []string{"var Redoc;"}},
+	}
+	for _, tc := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != tc.contentType {
+			t.Errorf("%s: expected 200 with %s, got %d with %s", tc.path, tc.contentType, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		for _, want := range tc.contains {
+			if !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("%s: expected %s in\n%s", tc.path, want, recorder.Body)
+			}
+		}
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs/assets/SHA384SUMS", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected only the assets to be served, got %d", recorder.Code)
+	}
+}
+
+func TestDocsRejectsUnpinnedAssets(t *testing.T) {
+	tests := map[string]func(fstest.MapFS){
+		"tampered":    func(assets fstest.MapFS) { assets["redoc.standalone.js"] = &fstest.MapFile{Data: []byte("steal()")} },
+		"missing":     func(assets fstest.MapFS) { delete(assets, "redoc.standalone.js") },
+		"not pinned":  func(assets fstest.MapFS) { assets["SHA384SUMS"] = &fstest.MapFile{Data: []byte("# Pinned\n")} },
+		"no checksum": func(assets fstest.MapFS) { delete(assets, "SHA384SUMS") },
+	}
+	for name, change := range tests {
+		assets := testAssets()
+		change(assets)
+		if _, err := NewDocs(MustLoad([]byte(testDocument)), DocsConfig{Assets: assets}); err == nil {
+			t.Errorf("%s: expected the assets to be rejected", name)
+		}
+	}
+}
+
+func TestDocsWithoutAssets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	docs, err := NewDocs(MustLoad([]byte(testDocument)), DocsConfig{Assets: fstest.MapFS{"SHA384SUMS": {Data: []byte("# Pinned\n")}}})
+	if err != nil || docs.Bundled() {
+		t.Fatalf("Expected the pages without assets, got %v", err)
+	}
+	router := gin.New()
+	docs.RegisterRoutes(router.Group("/"))
+	for _, path := range []string{"/docs", "/redoc"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if body := recorder.Body.String(); recorder.Code != http.StatusOK || !strings.Contains(body, `href="openapi.json"`) || strings.Contains(body, "<script") {
+			t.Errorf("%s: expected a link to the document, got %d\n%s", path, recorder.Code, body)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs/assets/swagger-ui.css", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected no assets, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// DefaultHistoryLimit is the number of runs listed if the request does not say
+const DefaultHistoryLimit = 20
+
+// RegisterRoutes registers the jobs API on the router. The routes must only be mounted behind
+// an admin check, they trigger maintenance work.
+func (s *Scheduler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("", s.handleJobs)
+	router.GET("/:job/runs", s.handleRuns)
+	router.POST("/:job/run", s.handleRunNow)
+}
+
+func (s *Scheduler) handleJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Jobs(c.Request.Context()))
+}
+
+func (s *Scheduler) handleRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultHistoryLimit)))
+	if err != nil || limit <= 0 {
+		apierror.Abort(c, apierror.ErrInvalidRequest.WithFields(apierror.FieldError{
+			Field:   "limit",
+			Rule:    "gt",
+			Param:   "0",
+			Message: "must be a positive number",
+		}))
+		return
+	}
+	runs, err := s.History(c.Request.Context(), c.Param("job"), limit)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func (s *Scheduler) handleRunNow(c *gin.Context) {
+	run, err := s.RunNow(c.Request.Context(), c.Param("job"))
+	if run == nil {
+		apierror.Abort(c, err)
+		return
+	}
+	// A failed run is still reported as a run, its status and error tell what happened
+	logging.FromContext(c.Request.Context()).WithField("job", run.Job).Warn("Job run manually")
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Run is a finished run of a job
+type Run struct {
+	Job string `json:"job"`
+	// ScheduledAt is the tick the run belongs to, the start time for manual runs
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	// Status is metrics.JobSuccess or metrics.JobFailure
+	Status string `json:"status"`
+	// Processed is the number of items the job processed, e.g. deleted sessions
+	Processed int64  `json:"processed"`
+	Error     string `json:"error,omitempty"`
+	// Instance is the replica that ran the job
+	Instance string `json:"instance"`
+}
+
+// History stores the runs of the jobs. A history shared by the replicas also keeps a tick
+// from running twice when a replica's clock lags behind.
+type History interface {
+	// Record stores a finished run
+	Record(ctx context.Context, run Run) error
+	// Last returns the latest run of the job, nil if it never ran
+	Last(ctx context.Context, job string) (*Run, error)
+	// List returns up to limit runs of the job, newest first
+	List(ctx context.Context, job string, limit int) ([]Run, error)
+}
+
+type memoryHistory struct {
+	mu   sync.Mutex
+	size int
+	runs map[string][]Run
+}
+
+// NewMemoryHistory keeps the latest size runs of every job in memory
+func NewMemoryHistory(size int) History {
+	if size <= 0 {
+		size = 100
+	}
+	return &memoryHistory{size: size, runs: make(map[string][]Run)}
+}
+
+func (h *memoryHistory) Record(_ context.Context, run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := append(h.runs[run.Job], run)
+	if len(runs) > h.size {
+		runs = runs[len(runs)-h.size:]
+	}
+	h.runs[run.Job] = runs
+	return nil
+}
+
+func (h *memoryHistory) Last(_ context.Context, job string) (*Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := h.runs[job]
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	last := runs[len(runs)-1]
+	return &last, nil
+}
+
+func (h *memoryHistory) List(_ context.Context, job string, limit int) ([]Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := h.runs[job]
+	list := make([]Run, 0, len(runs))
+	for i := len(runs) - 1; i >= 0 && (limit <= 0 || len(list) < limit); i-- {
+		list = append(list, runs[i])
+	}
+	return list, nil
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Locker elects the replica running a job. TryLock does not wait: if another replica holds
+// the lock, it returns false and the job is skipped here.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func(), locked bool, err error)
+}
+
+type memoryLocker struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+// NewMemoryLocker returns a locker coordinating schedulers of one process, for a single
+// replica and tests
+func NewMemoryLocker() Locker {
+	return &memoryLocker{locked: make(map[string]bool)}
+}
+
+func (l *memoryLocker) TryLock(_ context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked[name] {
+		return nil, false, nil
+	}
+	l.locked[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.locked, name)
+	}, true, nil
+}
+
+type postgresLocker struct {
+	db *sql.DB
+}
+
+// NewPostgresLocker returns a locker using Postgres session advisory locks, so replicas
+// sharing the database run every job once. A lock is held on a dedicated connection for
+// the duration of the run, and released by Postgres if the replica dies.
+func NewPostgresLocker(db *sql.DB) Locker {
+	return &postgresLocker{db: db}
+}
+
+func (l *postgresLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	key := lockKey(name)
+	var locked bool
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil || !locked {
+		_ = conn.Close()
+		return nil, false, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+			logging.Named("scheduler").WithError(err).Warn("Failed to release the lock of job ", name, ", dropping the connection")
+			// A pooled connection would keep holding the lock, closing it releases the lock
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		_ = conn.Close()
+	}, true, nil
+}
+
+// lockKey maps a job name to an advisory lock key
+func lockKey(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte("scheduler:" + name))
+	return int64(hash.Sum64())
+}
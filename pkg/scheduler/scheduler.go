@@ -0,0 +1,333 @@
+// Package scheduler runs periodic maintenance jobs on cron-like schedules. Every replica of a
+// service runs the scheduler, a Locker lets one of them run each tick of a job.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultJobTimeout bounds a run of a job without its own timeout
+const DefaultJobTimeout = 10 * time.Minute
+
+var (
+	ErrJobNotFound = apierror.New(apierror.KindNotFound, "JOB_NOT_FOUND", "Job not found")
+	// ErrJobLocked is returned by RunNow if the job is running, here or on another replica
+	ErrJobLocked = apierror.New(apierror.KindConflict, "JOB_LOCKED", "Job is already running")
+)
+
+// JobFunc does the work of a job and returns the number of items it processed
+type JobFunc func(ctx context.Context) (processed int64, err error)
+
+// Job is a task run periodically
+type Job struct {
+	// Name identifies the job in the lock, the history and the metrics
+	Name string
+	// Schedule is a cron expression with five fields, e.g. "*/15 * * * *", a descriptor such
+	// as "@hourly", or "@every 10m"
+	Schedule string
+	// Timeout bounds a run, DefaultJobTimeout if zero
+	Timeout time.Duration
+	Run     JobFunc
+}
+
+// Schedule returns the next activation after a time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseSchedule parses the Schedule of a Job
+func ParseSchedule(spec string) (Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// Config is the configuration of a Scheduler
+type Config struct {
+	// Locker elects the replica running a tick, NewMemoryLocker if nil
+	Locker Locker
+	// History stores the runs, NewMemoryHistory if nil
+	History History
+	// Location is the time zone of the schedules, UTC if nil
+	Location *time.Location
+	// Instance names this replica in the history, the host name if empty
+	Instance string
+}
+
+// JobStatus describes a job and its latest run
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Next     *time.Time `json:"next,omitempty"`
+	Running  bool       `json:"running"`
+	LastRun  *Run       `json:"last_run,omitempty"`
+}
+
+type scheduledJob struct {
+	Job
+	schedule Schedule
+	next     time.Time
+	running  bool
+}
+
+// Scheduler runs the added jobs from Start until Stop
+type Scheduler struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	started bool
+	stop    context.CancelFunc
+	// cancelRuns aborts runs still going when Stop gives up waiting
+	cancelRuns context.CancelFunc
+	loops      sync.WaitGroup
+	runs       sync.WaitGroup
+}
+
+func New(config Config) *Scheduler {
+	if config.Locker == nil {
+		config.Locker = NewMemoryLocker()
+	}
+	if config.History == nil {
+		config.History = NewMemoryHistory(0)
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.Instance == "" {
+		config.Instance, _ = os.Hostname()
+	}
+	return &Scheduler{
+		config: config,
+		now:    time.Now,
+		jobs:   make(map[string]*scheduledJob),
+	}
+}
+
+func (s *Scheduler) log() *logrus.Entry {
+	return logging.Named("scheduler")
+}
+
+// Add registers a job, jobs must be added before Start
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: invalid schedule %q: %w", job.Name, job.Schedule, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = DefaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("job %s: the scheduler is already started", job.Name)
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s: already added", job.Name)
+	}
+	s.jobs[job.Name] = &scheduledJob{Job: job, schedule: schedule}
+	return nil
+}
+
+// Start runs every job on its schedule until ctx is cancelled or Stop is called
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+
+	ctx, s.stop = context.WithCancel(ctx)
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	s.cancelRuns = cancelRuns
+	for _, job := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(ctx, runCtx, job)
+	}
+	s.log().Info("Scheduler started with ", len(s.jobs), " jobs")
+}
+
+// Stop stops scheduling and waits for running jobs. Runs still going when ctx is done are
+// cancelled.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stop()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		s.runs.Wait()
+		close(done)
+	}()
+	defer s.cancelRuns()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelRuns()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, runCtx context.Context, job *scheduledJob) {
+	defer s.loops.Done()
+	for {
+		next := job.schedule.Next(s.now().In(s.config.Location))
+		s.mu.Lock()
+		job.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// A run is awaited before the next tick is computed, ticks missed meanwhile are skipped
+		s.runs.Add(1)
+		_, err := s.run(runCtx, job, next, true)
+		s.runs.Done()
+		if err != nil && !errors.Is(err, ErrJobLocked) {
+			s.log().WithError(err).Error("Job ", job.Name, " failed")
+		}
+	}
+}
+
+// RunNow runs a job immediately, outside its schedule. It still takes the job's lock.
+func (s *Scheduler) RunNow(ctx context.Context, name string) (*Run, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	s.runs.Add(1)
+	defer s.runs.Done()
+	return s.run(ctx, job, s.now(), false)
+}
+
+// run runs a tick of the job if this replica gets the lock. A scheduled tick already recorded
+// by another replica is skipped.
+func (s *Scheduler) run(ctx context.Context, job *scheduledJob, scheduledAt time.Time, scheduled bool) (*Run, error) {
+	unlock, locked, err := s.config.Locker.TryLock(ctx, job.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job %s: %w", job.Name, err)
+	}
+	if !locked {
+		s.log().Debug("Job ", job.Name, " is running elsewhere, skipping")
+		metrics.RecordJobSkipped(job.Name)
+		return nil, ErrJobLocked
+	}
+	defer unlock()
+
+	if scheduled {
+		last, err := s.config.History.Last(ctx, job.Name)
+		if err != nil {
+			s.log().WithError(err).Warn("Failed to read the history of job ", job.Name)
+		} else if last != nil && !last.ScheduledAt.Before(scheduledAt) {
+			s.log().Debug("Job ", job.Name, " already ran for ", scheduledAt, ", skipping")
+			metrics.RecordJobSkipped(job.Name)
+			return last, nil
+		}
+	}
+
+	s.setRunning(job, true)
+	defer s.setRunning(job, false)
+
+	run := Run{
+		Job:         job.Name,
+		ScheduledAt: scheduledAt,
+		StartedAt:   s.now(),
+		Instance:    s.config.Instance,
+	}
+	s.log().Debug("Running job ", job.Name)
+	run.Processed, err = s.call(ctx, job)
+	run.FinishedAt = s.now()
+	run.Status = metrics.JobSuccess
+	if err != nil {
+		run.Status = metrics.JobFailure
+		run.Error = err.Error()
+	}
+	metrics.RecordJobRun(job.Name, run.Status, run.FinishedAt.Sub(run.StartedAt), run.Processed)
+	s.log().WithField("processed", run.Processed).Info("Job ", job.Name, " finished with ", run.Status, " in ", run.FinishedAt.Sub(run.StartedAt))
+
+	if recordErr := s.config.History.Record(ctx, run); recordErr != nil {
+		s.log().WithError(recordErr).Warn("Failed to record the run of job ", job.Name)
+	}
+	return &run, err
+}
+
+// call runs the job with its timeout, turning a panic into an error
+func (s *Scheduler) call(ctx context.Context, job *scheduledJob) (processed int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *Scheduler) setRunning(job *scheduledJob, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.running = running
+}
+
+// Jobs returns the jobs sorted by name, with their next tick and latest run
+func (s *Scheduler) Jobs(ctx context.Context) []JobStatus {
+	s.mu.Lock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := JobStatus{Name: job.Name, Schedule: job.Job.Schedule, Running: job.running}
+		if !job.next.IsZero() {
+			next := job.next
+			status.Next = &next
+		}
+		statuses = append(statuses, status)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	for i := range statuses {
+		last, err := s.config.History.Last(ctx, statuses[i].Name)
+		if err != nil {
+			s.log().WithError(err).Warn("Failed to read the history of job ", statuses[i].Name)
+		}
+		statuses[i].LastRun = last
+	}
+	return statuses
+}
+
+// History returns up to limit runs of a job, newest first
+func (s *Scheduler) History(ctx context.Context, name string, limit int) ([]Run, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return s.config.History.List(ctx, name, limit)
+}
@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func counterJob(name string, schedule string, count *atomic.Int64) Job {
+	return Job{
+		Name:     name,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (int64, error) {
+			count.Add(1)
+			return 2, nil
+		},
+	}
+}
+
+// every ticks faster than cron schedules can, which stop at seconds
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"*/15 * * * *", "0 3 * * *", "@hourly", "@every 10m"} {
+		if _, err := ParseSchedule(spec); err != nil {
+			t.Errorf("Expected %q to parse, got %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "* * *", "@sometimes", "61 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+
+	schedule, _ := ParseSchedule("0 3 * * *")
+	next := schedule.Next(time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2026, 10, 20, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run tomorrow at 3:00, got %v", next)
+	}
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	var count atomic.Int64
+	history := NewMemoryHistory(10)
+	s := New(Config{History: history, Instance: "test"})
+	if err := s.Add(counterJob("cleanup", "@every 1s", &count)); err != nil {
+		t.Fatalf("Failed to add the job: %v", err)
+	}
+	s.jobs["cleanup"].schedule = every(10 * time.Millisecond)
+	if err := s.Add(counterJob("cleanup", "@hourly", &count)); err == nil {
+		t.Errorf("Expected a duplicate job to be rejected")
+	}
+
+	s.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for count.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if count.Load() < 2 {
+		t.Fatalf("Expected the job to run repeatedly, it ran %d times", count.Load())
+	}
+
+	runs, _ := history.List(context.Background(), "cleanup", 0)
+	if len(runs) < 2 || runs[0].Status != metrics.JobSuccess || runs[0].Processed != 2 || runs[0].Instance != "test" {
+		t.Errorf("Expected successful runs in the history, got %+v", runs)
+	}
+	if runs[0].StartedAt.Before(runs[1].StartedAt) {
+		t.Errorf("Expected the newest run first, got %+v", runs)
+	}
+}
+
+func TestTickRunsOnceAcrossReplicas(t *testing.T) {
+	var count atomic.Int64
+	locker := NewMemoryLocker()
+	history := NewMemoryHistory(10)
+	tick := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+
+	for _, instance := range []string{"a", "b"} {
+		s := New(Config{Locker: locker, History: history, Instance: instance})
+		if err := s.Add(counterJob("cleanup", "@hourly", &count)); err != nil {
+			t.Fatalf("Failed to add the job: %v", err)
+		}
+		// The second replica gets the lock after the first released it, the history stops it
+		if _, err := s.run(context.Background(), s.jobs["cleanup"], tick, true); err != nil {
+			t.Fatalf("Failed to run on %s: %v", instance, err)
+		}
+	}
+	if count.Load() != 1 {
+		t.Errorf("Expected the tick to run once, it ran %d times", count.Load())
+	}
+}
+
+func TestLockedJobIsSkipped(t *testing.T) {
+	var count atomic.Int64
+	locker := NewMemoryLocker()
+	s := New(Config{Locker: locker})
+	_ = s.Add(counterJob("cleanup", "@hourly", &count))
+
+	unlock, _, _ := locker.TryLock(context.Background(), "cleanup")
+	if _, err := s.RunNow(context.Background(), "cleanup"); !errors.Is(err, ErrJobLocked) {
+		t.Errorf("Expected the locked job to be skipped, got %v", err)
+	}
+	unlock()
+	if _, err := s.RunNow(context.Background(), "cleanup"); err != nil || count.Load() != 1 {
+		t.Errorf("Expected the job to run once unlocked, got %v and %d runs", err, count.Load())
+	}
+	if _, err := s.RunNow(context.Background(), "unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected an unknown job to be reported, got %v", err)
+	}
+}
+
+func TestFailedRunsAreRecorded(t *testing.T) {
+	s := New(Config{})
+	_ = s.Add(Job{Name: "failing", Schedule: "@hourly", Run: func(ctx context.Context) (int64, error) {
+		return 1, errors.New("database is down")
+	}})
+	_ = s.Add(Job{Name: "panicking", Schedule: "@hourly", Run: func(ctx context.Context) (int64, error) {
+		panic("boom")
+	}})
+
+	run, err := s.RunNow(context.Background(), "failing")
+	if err == nil || run.Status != metrics.JobFailure || run.Error != "database is down" || run.Processed != 1 {
+		t.Errorf("Expected a failed run, got %+v, %v", run, err)
+	}
+	run, err = s.RunNow(context.Background(), "panicking")
+	if err == nil || run.Status != metrics.JobFailure {
+		t.Errorf("Expected a panic to fail the run, got %+v, %v", run, err)
+	}
+
+	statuses := s.Jobs(context.Background())
+	if len(statuses) != 2 || statuses[0].Name != "failing" || statuses[0].LastRun == nil {
+		t.Errorf("Expected the jobs with their last run, got %+v", statuses)
+	}
+}
+
+func TestStopCancelsHangingRuns(t *testing.T) {
+	started := make(chan struct{})
+	s := New(Config{})
+	_ = s.Add(Job{Name: "hanging", Schedule: "@every 1s", Run: func(ctx context.Context) (int64, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}})
+	s.jobs["hanging"].schedule = every(time.Millisecond)
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Stop to give up on the hanging run, got %v", err)
+	}
+}
+
+func TestRunNowEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var count atomic.Int64
+	s := New(Config{})
+	_ = s.Add(counterJob("cleanup", "@hourly", &count))
+	router := gin.New()
+	s.RegisterRoutes(router.Group("/admin/jobs"))
+
+	for path, code := range map[string]int{"/admin/jobs/cleanup/run": http.StatusOK, "/admin/jobs/unknown/run": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != code {
+			t.Errorf("Expected %d from %s, got %d: %s", code, path, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/jobs/cleanup/runs?limit=5", nil))
+	if w.Code != http.StatusOK || count.Load() != 1 {
+		t.Errorf("Expected the manual run in the history, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable. It must return once the context is done.
+type Check func(ctx context.Context) error
+
+const (
+	// StatusOK means every check passed
+	StatusOK = "ok"
+	// StatusDegraded means an optional dependency is down, the service still takes traffic
+	StatusDegraded = "degraded"
+	// StatusUnavailable means a required dependency is down or the server is shutting down
+	StatusUnavailable = "unavailable"
+
+	// CheckUp and CheckDown are the statuses of a single check
+	CheckUp   = "up"
+	CheckDown = "down"
+)
+
+// DefaultCheckTimeout is the time every check gets before it is reported as down
+const DefaultCheckTimeout = 2 * time.Second
+
+// errDraining is reported by readiness while the server shuts down
+var errDraining = errors.New("server is shutting down")
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Optional bool   `json:"optional,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthReport is the readiness of the service with the result of every check
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// Health runs the readiness checks of a service
+type Health struct {
+	timeout  time.Duration
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// NewHealth returns a Health giving every check the timeout, DefaultCheckTimeout if zero
+func NewHealth(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Health{timeout: timeout}
+}
+
+// AddCheck adds a required dependency, the service is unavailable while it fails
+func (h *Health) AddCheck(name string, check Check) {
+	h.add(namedCheck{name: name, check: check})
+}
+
+// AddOptionalCheck adds a dependency the service can work without, e.g. a mailer.
+// The service is reported as degraded while it fails, but stays ready.
+func (h *Health) AddOptionalCheck(name string, check Check) {
+	h.add(namedCheck{name: name, check: check, optional: true})
+}
+
+func (h *Health) add(check namedCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// SetDraining makes readiness fail, so load balancers stop sending new requests
+func (h *Health) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Check runs every check concurrently and returns the overall status
+func (h *Health) Check(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := append([]namedCheck(nil), h.checks...)
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.name] = result
+		if result.Status == CheckUp {
+			continue
+		}
+		if !check.optional {
+			report.Status = StatusUnavailable
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	if h.draining.Load() {
+		report.Status = StatusUnavailable
+		report.Checks["server"] = CheckResult{Status: CheckDown, Error: errDraining.Error(), Duration: "0s"}
+	}
+	return report
+}
+
+func (h *Health) run(ctx context.Context, check namedCheck) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			result = CheckResult{Status: CheckDown, Error: fmt.Sprint("check panicked: ", r)}
+		}
+		result.Optional = check.optional
+		result.Duration = time.Since(start).Round(time.Microsecond).String()
+	}()
+
+	if err := check.check(ctx); err != nil {
+		return CheckResult{Status: CheckDown, Error: err.Error()}
+	}
+	return CheckResult{Status: CheckUp}
+}
+
+// LivenessHandler answers 200 for as long as the process serves requests.
+// It runs no checks, a dependency being down is no reason to restart the service.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
+
+// ReadinessHandler answers 200 with the report if the service can take traffic, 503 otherwise
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+		status := http.StatusOK
+		if report.Status == StatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// Pinger is implemented by *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck checks a database connection
+func PingCheck(db Pinger) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// HTTPCheck checks that a GET of the URL answers with a status below 500.
+// A nil client uses http.DefaultClient, the check timeout still applies.
+func HTTPCheck(client *http.Client, url string) Check {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
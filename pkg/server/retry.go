@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"math/rand"
+	"time"
+)
+
+// Backoff configures how often Retry tries again
+type Backoff struct {
+	// Initial is the wait after the first failure, 500ms if zero
+	Initial time.Duration
+	// Max is the longest wait between attempts, 30s if zero
+	Max time.Duration
+	// Multiplier grows the wait after every failure, 2 if below 1
+	Multiplier float64
+	// MaxElapsed gives up once this much time has passed, 0 retries until the context is done
+	MaxElapsed time.Duration
+}
+
+// DefaultBackoff waits from half a second up to 30 seconds, for at most 2 minutes
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Initial:    500 * time.Millisecond,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+		MaxElapsed: 2 * time.Minute,
+	}
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = 500 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = 30 * time.Second
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = 2
+	}
+	return b
+}
+
+// Retry calls fn until it succeeds, waiting longer after every failure.
+// It is meant for startup, e.g. connecting to a database that is still booting.
+// The last error is returned once the context is done or MaxElapsed has passed.
+func Retry(ctx context.Context, name string, backoff Backoff, fn func(ctx context.Context) error) error {
+	backoff = backoff.withDefaults()
+	start := time.Now()
+	wait := backoff.Initial
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logging.FromContext(ctx).Infof("%s succeeded after %d attempts", name, attempt)
+			}
+			return nil
+		}
+
+		// Up to 20% jitter, so replicas restarted together do not retry in lockstep
+		sleep := wait + time.Duration(rand.Int63n(int64(wait)/5+1))
+		if backoff.MaxElapsed > 0 && time.Since(start)+sleep > backoff.MaxElapsed {
+			return fmt.Errorf("%s failed after %d attempts: %w", name, attempt, err)
+		}
+		logging.FromContext(ctx).WithError(err).Warnf("%s failed, attempt %d, retrying in %s", name, attempt, sleep.Round(time.Millisecond))
+
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s failed after %d attempts: %w", name, attempt, err)
+		case <-timer.C:
+		}
+
+		wait = time.Duration(float64(wait) * backoff.Multiplier)
+		if wait > backoff.Max {
+			wait = backoff.Max
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// LivenessPath answers as long as the process is alive
+	LivenessPath = "/healthz"
+	// ReadinessPath answers 200 only if the service can take traffic
+	ReadinessPath = "/readyz"
+
+	// DefaultShutdownTimeout is how long in-flight requests get to finish on shutdown
+	DefaultShutdownTimeout = 20 * time.Second
+)
+
+// Hook is run while the server shuts down
+type Hook func(ctx context.Context) error
+
+// Config is the configuration of a Server
+type Config struct {
+	// Addr is the address to listen on, e.g. ":8080"
+	Addr string
+	// Handler serves every request except the health endpoints
+	Handler http.Handler
+	// ShutdownTimeout bounds draining in-flight requests, and then the shutdown hooks.
+	// DefaultShutdownTimeout if zero.
+	ShutdownTimeout time.Duration
+	// DrainDelay keeps serving for a while after the shutdown signal with readiness failing,
+	// so load balancers take the instance out before it stops accepting connections
+	DrainDelay time.Duration
+	// CheckTimeout is the timeout of every readiness check, DefaultCheckTimeout if zero
+	CheckTimeout time.Duration
+	// ReadHeaderTimeout limits slow clients, 10s if zero
+	ReadHeaderTimeout time.Duration
+}
+
+// Server runs an HTTP service with health endpoints and a graceful shutdown.
+//
+// On shutdown readiness starts failing, the drain hooks run, in-flight requests get
+// ShutdownTimeout to finish, and then the shutdown hooks run in reverse order of registration.
+type Server struct {
+	config Config
+	health *Health
+	server *http.Server
+
+	mu         sync.Mutex
+	drainHooks []Hook
+	closeHooks []Hook
+}
+
+func New(config Config) *Server {
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.ReadHeaderTimeout <= 0 {
+		config.ReadHeaderTimeout = 10 * time.Second
+	}
+	if config.Handler == nil {
+		config.Handler = http.NotFoundHandler()
+	}
+
+	s := &Server{
+		config: config,
+		health: NewHealth(config.CheckTimeout),
+	}
+	s.server = &http.Server{
+		Addr:              config.Addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+	}
+	return s
+}
+
+// Health returns the readiness checks of the server
+func (s *Server) Health() *Health {
+	return s.health
+}
+
+// OnDrain adds a hook run as soon as shutdown starts, before in-flight requests are drained.
+// Use it to end long-lived requests such as event streams, or to deregister from discovery.
+func (s *Server) OnDrain(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainHooks = append(s.drainHooks, hook)
+}
+
+// OnShutdown adds a hook run after in-flight requests are done, e.g. closing the database.
+// Hooks run in reverse order, like deferred calls.
+func (s *Server) OnShutdown(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeHooks = append(s.closeHooks, hook)
+}
+
+// handler serves the health endpoints in front of the service handler, so probes
+// bypass its middleware: they are not logged, traced or authenticated
+func (s *Server) handler() http.Handler {
+	liveness := s.health.LivenessHandler()
+	readiness := s.health.ReadinessHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LivenessPath:
+			liveness.ServeHTTP(w, r)
+		case ReadinessPath:
+			readiness.ServeHTTP(w, r)
+		default:
+			s.config.Handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Run serves until the context is cancelled, then shuts down gracefully.
+// It returns an error if the server could not listen or did not shut down cleanly.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve is Run on an existing listener
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.server.Serve(listener)
+	}()
+	logging.Named("server").Info("Listening on ", listener.Addr().String())
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		logging.Named("server").Info("Shutting down")
+	}
+
+	s.health.SetDraining()
+	if s.config.DrainDelay > 0 && len(errs) == 0 {
+		time.Sleep(s.config.DrainDelay)
+	}
+
+	s.mu.Lock()
+	drainHooks := append([]Hook(nil), s.drainHooks...)
+	closeHooks := append([]Hook(nil), s.closeHooks...)
+	s.mu.Unlock()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	errs = append(errs, runHooks(drainCtx, drainHooks)...)
+
+	if err := s.server.Shutdown(drainCtx); err != nil {
+		logging.Named("server").Warn("In-flight requests did not finish in time, closing connections: ", err)
+		errs = append(errs, err, s.server.Close())
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancelClose()
+	for i, j := 0, len(closeHooks)-1; i < j; i, j = i+1, j-1 {
+		closeHooks[i], closeHooks[j] = closeHooks[j], closeHooks[i]
+	}
+	errs = append(errs, runHooks(closeCtx, closeHooks)...)
+
+	err := errors.Join(filterClosed(errs)...)
+	if err == nil {
+		logging.Named("server").Info("Server stopped")
+	}
+	return err
+}
+
+func runHooks(ctx context.Context, hooks []Hook) []error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			logging.Named("server").Warn("Shutdown hook failed: ", err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func filterClosed(errs []error) []error {
+	var filtered []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			filtered = append(filtered, err)
+		}
+	}
+	return filtered
+}
+
+// SignalContext returns a context cancelled on SIGINT or SIGTERM, the signals sent by
+// Ctrl+C, docker stop and Kubernetes. A second signal kills the process as usual.
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore the default behaviour for the second signal
+		stop()
+	}()
+	return ctx, stop
+}
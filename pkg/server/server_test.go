@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	health := NewHealth(50 * time.Millisecond)
+	health.AddCheck("database", func(ctx context.Context) error { return nil })
+
+	report := readiness(t, health, http.StatusOK)
+	if report.Status != StatusOK || report.Checks["database"].Status != CheckUp {
+		t.Errorf("Expected the service to be ready, got %+v", report)
+	}
+
+	health.AddOptionalCheck("mailer", func(ctx context.Context) error { return errors.New("connection refused") })
+	report = readiness(t, health, http.StatusOK)
+	if report.Status != StatusDegraded || report.Checks["mailer"].Error != "connection refused" {
+		t.Errorf("Expected a failing optional check to degrade the service, got %+v", report)
+	}
+
+	health.AddCheck("cache", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report = readiness(t, health, http.StatusServiceUnavailable)
+	if report.Status != StatusUnavailable || report.Checks["cache"].Status != CheckDown {
+		t.Errorf("Expected a hanging required check to time out, got %+v", report)
+	}
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	health := NewHealth(0)
+	health.SetDraining()
+
+	report := readiness(t, health, http.StatusServiceUnavailable)
+	if report.Status != StatusUnavailable {
+		t.Errorf("Expected the service to be unavailable, got %+v", report)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), "connect", Backoff{Initial: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on the 3rd attempt, got %v after %d", err, attempts)
+	}
+
+	failure := errors.New("down")
+	err = Retry(context.Background(), "connect", Backoff{Initial: time.Millisecond, MaxElapsed: 20 * time.Millisecond}, func(ctx context.Context) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the last error after giving up, got %v", err)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := New(Config{Handler: handler, ShutdownTimeout: 2 * time.Second})
+	var order []string
+	srv.OnDrain(func(ctx context.Context) error {
+		order = append(order, "drain")
+		close(release)
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, listener) }()
+
+	var status atomic.Int32
+	requestDone := make(chan struct{})
+	go func() {
+		defer close(requestDone)
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			t.Errorf("In-flight request failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+		status.Store(int32(resp.StatusCode))
+	}()
+
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+	<-requestDone
+
+	if status.Load() != http.StatusNoContent {
+		t.Errorf("Expected the in-flight request to complete, got %d", status.Load())
+	}
+	if len(order) != 3 || order[0] != "drain" || order[1] != "second" || order[2] != "first" {
+		t.Errorf("Unexpected hook order %v", order)
+	}
+}
+
+func TestHealthEndpointsBypassHandler(t *testing.T) {
+	srv := New(Config{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})})
+
+	for path, expected := range map[string]int{LivenessPath: http.StatusOK, ReadinessPath: http.StatusOK, "/other": http.StatusTeapot} {
+		recorder := httptest.NewRecorder()
+		srv.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, path, recorder.Code)
+		}
+	}
+}
+
+func readiness(t *testing.T, health *Health, expected int) HealthReport {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	health.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	if recorder.Code != expected {
+		t.Errorf("Expected %d, got %d: %s", expected, recorder.Code, recorder.Body.String())
+	}
+	var report HealthReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	return report
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// GinMiddleware continues the trace of the incoming traceparent header, or starts a new one,
+// and makes sure every request has a request ID. Both end up in the request context,
+// and the request ID is echoed in the response.
+func GinMiddleware(serviceName string) gin.HandlerFunc {
+	tracer := Tracer(InstrumentationName)
+
+	return func(c *gin.Context) {
+		ctx := propagator().Extract(c.Request.Context(), headerCarrier(c.Request.Header))
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		ctx = ContextWithRequestID(ctx, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.ServiceName(serviceName),
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+				attribute.String("request.id", requestID),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetStatus(codes.Error, c.Errors.String())
+		}
+	}
+}
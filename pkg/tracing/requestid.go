@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID between nginx and the services
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength keeps clients from stuffing large values into every log line
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ContextWithRequestID returns a context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by the context, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// InjectHeaders writes the trace context and the request ID of ctx into the outgoing headers
+func InjectHeaders(ctx context.Context, header http.Header) {
+	propagator().Inject(ctx, headerCarrier(header))
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		header.Set(RequestIDHeader, requestID)
+	}
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// InstrumentationName is the name of the tracer used by the shared library
+const InstrumentationName = "github.com/Ruletk/GoMarketplace/pkg/tracing"
+
+type Config struct {
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// ServiceVersion is reported as the service.version resource attribute
+	ServiceVersion string
+	// OTLPEndpoint is the OTLP/HTTP collector, e.g. "otel-collector:4318".
+	// If empty, OTEL_EXPORTER_OTLP_ENDPOINT is used, and without it spans are not exported.
+	OTLPEndpoint string
+	// Insecure disables TLS towards the collector
+	Insecure bool
+	// SampleRatio is the share of new traces that are recorded, parent decisions are always followed
+	SampleRatio float64
+	// Exporter replaces the OTLP exporter, e.g. an in-memory exporter in tests
+	Exporter sdktrace.SpanExporter
+	// Synchronous exports every span as soon as it ends instead of batching, meant for tests
+	Synchronous bool
+}
+
+// Init installs the global tracer provider and the W3C trace context propagator.
+// Trace IDs are generated even if no exporter is configured, so logs can still be correlated.
+// The returned function flushes and stops the exporter.
+func Init(ctx context.Context, config Config) (func(context.Context) error, error) {
+	exporter := config.Exporter
+	if exporter == nil {
+		endpoint := config.OTLPEndpoint
+		if endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+			var options []otlptracehttp.Option
+			if endpoint != "" {
+				options = append(options, otlptracehttp.WithEndpoint(endpoint))
+			}
+			if config.Insecure {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+			var err error
+			exporter, err = otlptracehttp.New(ctx, options...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+		semconv.ServiceVersion(config.ServiceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := config.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+	if exporter != nil {
+		if config.Synchronous {
+			options = append(options, sdktrace.WithSyncer(exporter))
+		} else {
+			options = append(options, sdktrace.WithBatcher(exporter))
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns a tracer from the global provider
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// StartSpan starts an internal span with the shared library tracer
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer(InstrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records the error, if any, and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func propagator() propagation.TextMapPropagator {
+	return otel.GetTextMapPropagator()
+}
+
+func headerCarrier(header http.Header) propagation.HeaderCarrier {
+	return propagation.HeaderCarrier(header)
+}
+
+// IDs returns the trace and span ID of the span in the context, or empty strings
+func IDs(ctx context.Context) (traceID string, spanID string) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return "", ""
+	}
+	return spanContext.TraceID().String(), spanContext.SpanID().String()
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupTracingTest(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := Init(context.Background(), Config{
+		ServiceName: "test",
+		Exporter:    exporter,
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init tracing: %v", err)
+	}
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+	return exporter
+}
+
+func newTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware("test"))
+	router.GET("/items/:id", handler)
+	return router
+}
+
+func TestGinMiddlewareContinuesIncomingTrace(t *testing.T) {
+	exporter := setupTracingTest(t)
+
+	var requestID string
+	router := newTestRouter(func(c *gin.Context) {
+		requestID = RequestIDFromContext(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(RequestIDHeader, "nginx-request-id")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if requestID != "nginx-request-id" {
+		t.Errorf("Expected the incoming request ID, got %q", requestID)
+	}
+	if recorder.Header().Get(RequestIDHeader) != "nginx-request-id" {
+		t.Errorf("Expected the request ID to be echoed")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /items/:id" {
+		t.Errorf("Expected the span to be named after the route, got %q", span.Name)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace to be continued, got %s", span.SpanContext.TraceID())
+	}
+	if span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the incoming span to be the parent, got %s", span.Parent.SpanID())
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("Expected a server span, got %s", span.SpanKind)
+	}
+}
+
+func TestGinMiddlewareStartsNewTrace(t *testing.T) {
+	exporter := setupTracingTest(t)
+
+	router := newTestRouter(func(c *gin.Context) {})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.Header.Set(RequestIDHeader, "bad\nrequest id")
+	router.ServeHTTP(recorder, req)
+
+	requestID := recorder.Header().Get(RequestIDHeader)
+	if len(requestID) != 32 {
+		t.Errorf("Expected a generated request ID, got %q", requestID)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Parent.IsValid() {
+		t.Errorf("Expected a single root span, got %+v", spans)
+	}
+}
+
+func TestInjectHeaders(t *testing.T) {
+	setupTracingTest(t)
+
+	ctx, span := StartSpan(ContextWithRequestID(context.Background(), "request-1"), "test")
+	defer span.End()
+
+	header := http.Header{}
+	InjectHeaders(ctx, header)
+
+	traceID, spanID := IDs(ctx)
+	expected := "00-" + traceID + "-" + spanID + "-01"
+	if header.Get("traceparent") != expected {
+		t.Errorf("Expected traceparent %q, got %q", expected, header.Get("traceparent"))
+	}
+	if header.Get(RequestIDHeader) != "request-1" {
+		t.Errorf("Expected the request ID to be injected, got %q", header.Get(RequestIDHeader))
+	}
+}
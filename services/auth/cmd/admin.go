@@ -0,0 +1,349 @@
+package main
+
+import (
+	"auth/internal/repository"
+	"auth/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/server"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The administrative commands act on the database directly. Sessions they revoke are rejected
+// by the auth service right away, services caching validation results forget them when
+// their cache entries expire.
+
+// openCommandApp opens the services of a command, tests run the commands on in-memory repositories
+var openCommandApp = openApp
+
+// withApp loads the configuration, checks the number of positional arguments and connects
+// to the database before running fn
+func withApp(flags *pflag.FlagSet, args []string, positional int, fn func(ctx context.Context, a *app) int) int {
+	cfg, code := loadConfig(flags, args, true)
+	if cfg == nil {
+		return code
+	}
+	defer logging.Close()
+	if flags.NArg() != positional {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := server.SignalContext(context.Background())
+	defer stop()
+
+	a, closeApp, err := openCommandApp(ctx, cfg)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer closeApp()
+	return fn(ctx, a)
+}
+
+func runCreateAdmin(args []string) int {
+	flags := newFlagSet("create-admin", "create-admin --email <email> [--password-stdin] [flags]")
+	email := flags.String("email", "", "e-mail of the administrator")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+
+	return withApp(flags, args, 0, func(ctx context.Context, a *app) int {
+		if *email == "" {
+			flags.Usage()
+			return 2
+		}
+		password, generated, err := readPassword(*passwordStdin)
+		if err != nil {
+			return fail("%v", err)
+		}
+
+		user, err := a.authService.CreateAdmin(ctx, *email, password)
+		if errors.Is(err, service.ErrEmailTaken) {
+			return fail("A user with the e-mail %s already exists", *email)
+		} else if err != nil {
+			return fail("Failed to create the administrator: %v", err)
+		}
+
+		fmt.Printf("Created administrator %s with ID %d\n", user.Email, user.ID)
+		if generated {
+			fmt.Printf("Generated password: %s\n", password)
+		}
+		return 0
+	})
+}
+
+func runUser(args []string) int {
+	return dispatch("auth user", args, []command{
+		{name: "show", summary: "show a user and their sessions", run: runUserShow},
+		{name: "suspend", summary: "block logins of a user and revoke their sessions", run: runUserSuspend},
+		{name: "unsuspend", summary: "allow a suspended user to log in again", run: runUserUnsuspend},
+		{name: "reset-password", summary: "set a new password and revoke the sessions of a user", run: runUserResetPassword},
+		{name: "delete", summary: "schedule the deletion of a user after the grace period", run: runUserDelete},
+	})
+}
+
+// findUser looks up the user named on the command line, reporting a missing user
+func findUser(ctx context.Context, a *app, idOrEmail string) (*repository.Auth, int) {
+	user, err := a.authService.FindUser(ctx, idOrEmail)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, fail("User %s not found", idOrEmail)
+	} else if err != nil {
+		return nil, fail("Failed to find user %s: %v", idOrEmail, err)
+	}
+	return user, 0
+}
+
+func runUserShow(args []string) int {
+	flags := newFlagSet("user show", "user show <id|email> [flags]")
+
+	return withApp(flags, args, 1, func(ctx context.Context, a *app) int {
+		user, code := findUser(ctx, a, flags.Arg(0))
+		if code != 0 {
+			return code
+		}
+		sessions, err := a.sessionService.ListUserSessions(ctx, user.ID)
+		if err != nil {
+			return fail("Failed to list the sessions: %v", err)
+		}
+		devices, err := a.deviceService.ListUserDevices(ctx, user.ID)
+		if err != nil {
+			return fail("Failed to list the devices: %v", err)
+		}
+
+		suspended := "no"
+		if user.SuspendedAt != nil {
+			suspended = "since " + user.SuspendedAt.Format(time.RFC3339)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%d\n", user.ID)
+		fmt.Fprintf(w, "E-mail:\t%s\n", user.Email)
+		fmt.Fprintf(w, "Roles:\t%s\n", strings.Join(user.Roles(), ", "))
+		fmt.Fprintf(w, "Verified:\t%t\n", user.Active)
+		fmt.Fprintf(w, "Suspended:\t%s\n", suspended)
+		if user.DeletedAt != nil {
+			fmt.Fprintf(w, "Deleted:\t%s\n", user.DeletedAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "Created:\t%s\n", user.CreatedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "Updated:\t%s\n", user.UpdatedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "Sessions:\t%d\n", len(sessions))
+		for _, session := range sessions {
+			fmt.Fprintf(w, "\t%s\tcreated %s\tlast used %s\texpires %s%s\n",
+				logging.Fingerprint(session.SessionKey),
+				session.CreatedAt.Format(time.RFC3339),
+				session.LastUsed.Format(time.RFC3339),
+				session.ExpiresAt.Format(time.RFC3339),
+				sessionFlags(session))
+		}
+		fmt.Fprintf(w, "Devices:\t%d\n", len(devices))
+		for _, device := range devices {
+			fmt.Fprintf(w, "\t%s\t%s %s\tfirst seen %s\tlast seen %s\n",
+				device.UserAgentFamily,
+				device.IPPrefix,
+				device.Country,
+				device.FirstSeenAt.Format(time.RFC3339),
+				device.LastSeenAt.Format(time.RFC3339))
+		}
+		if err = w.Flush(); err != nil {
+			return fail("%v", err)
+		}
+		return 0
+	})
+}
+
+// sessionFlags describes the anomalies of a session, empty if there are none
+func sessionFlags(session *repository.Session) string {
+	var flags []string
+	if session.Anomalies != "" {
+		flags = append(flags, "anomalies "+session.Anomalies)
+	}
+	if session.ReauthRequired {
+		flags = append(flags, "re-authentication required")
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return "\t" + strings.Join(flags, ", ")
+}
+
+func runUserSuspend(args []string) int {
+	flags := newFlagSet("user suspend", "user suspend <id|email> [flags]")
+
+	return withApp(flags, args, 1, func(ctx context.Context, a *app) int {
+		user, code := findUser(ctx, a, flags.Arg(0))
+		if code != 0 {
+			return code
+		}
+		if err := a.authService.SuspendUser(ctx, user.ID); err != nil {
+			return fail("Failed to suspend user %d: %v", user.ID, err)
+		}
+		fmt.Printf("Suspended user %d and revoked their sessions\n", user.ID)
+		return 0
+	})
+}
+
+func runUserUnsuspend(args []string) int {
+	flags := newFlagSet("user unsuspend", "user unsuspend <id|email> [flags]")
+
+	return withApp(flags, args, 1, func(ctx context.Context, a *app) int {
+		user, code := findUser(ctx, a, flags.Arg(0))
+		if code != 0 {
+			return code
+		}
+		if err := a.authService.UnsuspendUser(ctx, user.ID); err != nil {
+			return fail("Failed to unsuspend user %d: %v", user.ID, err)
+		}
+		fmt.Printf("User %d can log in again\n", user.ID)
+		return 0
+	})
+}
+
+func runUserResetPassword(args []string) int {
+	flags := newFlagSet("user reset-password", "user reset-password <id|email> [--password-stdin] [flags]")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+
+	return withApp(flags, args, 1, func(ctx context.Context, a *app) int {
+		user, code := findUser(ctx, a, flags.Arg(0))
+		if code != 0 {
+			return code
+		}
+		password, generated, err := readPassword(*passwordStdin)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if err = a.authService.SetPassword(ctx, user.ID, password); err != nil {
+			return fail("Failed to reset the password of user %d: %v", user.ID, err)
+		}
+
+		fmt.Printf("Reset the password of user %d and revoked their sessions\n", user.ID)
+		if generated {
+			fmt.Printf("Generated password: %s\n", password)
+		}
+		return 0
+	})
+}
+
+func runUserDelete(args []string) int {
+	flags := newFlagSet("user delete", "user delete <id|email> [flags]")
+
+	return withApp(flags, args, 1, func(ctx context.Context, a *app) int {
+		user, code := findUser(ctx, a, flags.Arg(0))
+		if code != 0 {
+			return code
+		}
+		if err := a.authService.ScheduleDeletion(ctx, user.ID); err != nil {
+			return fail("Failed to delete user %d: %v", user.ID, err)
+		}
+		fmt.Printf("User %d will be deleted by the deleted-accounts job after the grace period\n", user.ID)
+		return 0
+	})
+}
+
+func runSessions(args []string) int {
+	return dispatch("auth sessions", args, []command{
+		{name: "purge", summary: "delete expired or inactive sessions", run: runSessionsPurge},
+	})
+}
+
+func runSessionsPurge(args []string) int {
+	flags := newFlagSet("sessions purge", "sessions purge --expired|--inactive [--dry-run] [flags]")
+	expired := flags.Bool("expired", false, "delete sessions past their expiry")
+	inactive := flags.Bool("inactive", false, "delete sessions not used for a long time")
+	dryRun := flags.Bool("dry-run", false, "only count the sessions that would be deleted")
+
+	return withApp(flags, args, 0, func(ctx context.Context, a *app) int {
+		if !*expired && !*inactive {
+			flags.Usage()
+			return 2
+		}
+
+		purges := []struct {
+			enabled bool
+			kind    string
+			count   func(context.Context) (int64, error)
+			purge   func(context.Context) (int64, error)
+		}{
+			{*expired, "expired", a.sessionService.CountExpiredSessions, a.sessionService.HardDeleteSessions},
+			{*inactive, "inactive", a.sessionService.CountInactiveSessions, a.sessionService.DeleteInactiveSessions},
+		}
+		for _, p := range purges {
+			if !p.enabled {
+				continue
+			}
+			if *dryRun {
+				count, err := p.count(ctx)
+				if err != nil {
+					return fail("Failed to count %s sessions: %v", p.kind, err)
+				}
+				fmt.Printf("Would delete %d %s sessions\n", count, p.kind)
+				continue
+			}
+			count, err := p.purge(ctx)
+			if err != nil {
+				return fail("Failed to delete %s sessions: %v", p.kind, err)
+			}
+			fmt.Printf("Deleted %d %s sessions\n", count, p.kind)
+		}
+		return 0
+	})
+}
+
+func runTokens(args []string) int {
+	return dispatch("auth tokens", args, []command{
+		{name: "purge", summary: "delete expired verification and password reset tokens", run: runTokensPurge},
+	})
+}
+
+func runTokensPurge(args []string) int {
+	flags := newFlagSet("tokens purge", "tokens purge [flags]")
+
+	return withApp(flags, args, 0, func(ctx context.Context, a *app) int {
+		count, err := a.tokenService.DeleteExpiredTokens(ctx)
+		if err != nil {
+			return fail("Failed to delete expired tokens: %v", err)
+		}
+		fmt.Printf("Deleted %d expired tokens\n", count)
+		return 0
+	})
+}
+
+func runConfig(args []string) int {
+	return dispatch("auth config", args, []command{
+		{name: "print", summary: "print the effective configuration with secrets redacted", run: runConfigPrint},
+	})
+}
+
+func runConfigPrint(args []string) int {
+	flags := newFlagSet("config print", "config print [--format yaml|json] [flags]")
+	format := flags.String("format", "yaml", "output format, yaml or json")
+
+	cfg, code := loadConfig(flags, args, true)
+	if cfg == nil {
+		return code
+	}
+	defer logging.Close()
+
+	var err error
+	switch *format {
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		err = encoder.Encode(cfg.Redacted())
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(cfg.Redacted())
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		return fail("Failed to print the configuration: %v", err)
+	}
+	return 0
+}
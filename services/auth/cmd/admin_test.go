@@ -0,0 +1,320 @@
+package main
+
+import (
+	"auth/config"
+	"auth/internal/repository"
+	"auth/internal/repository/memory"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+)
+
+const adminDatabasePassword = "database s3cret"
+
+// memoryRepositories are the repositories of the in-memory store
+func memoryRepositories(store *memory.Store) repositories {
+	return repositories{
+		auth:     store.Auth(),
+		sessions: store.Sessions(),
+		tokens:   store.Tokens(),
+		devices:  store.Devices(),
+		passkeys: store.Passkeys(),
+		jobRuns:  store.JobRuns(),
+	}
+}
+
+// commandResult is what a command printed and its exit code
+type commandResult struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// runCommand runs the auth binary with the arguments on the store, stdin is read by --password-stdin
+func runCommand(t *testing.T, store *memory.Store, stdin string, args ...string) commandResult {
+	t.Helper()
+	t.Setenv("AUTH_DATABASE_PASSWORD", adminDatabasePassword)
+
+	openDatabase := openCommandApp
+	openCommandApp = func(_ context.Context, cfg *config.Config) (*app, func(), error) {
+		a, err := newApp(memoryRepositories(store), cfg, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return a, a.revocationService.Close, nil
+	}
+	defer func() { openCommandApp = openDatabase }()
+
+	dir := t.TempDir()
+	files := make([]*os.File, 3)
+	for i, name := range []string{"stdin", "stdout", "stderr"} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		files[i] = file
+	}
+	if _, err := io.WriteString(files[0], stdin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files[0].Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	stdinFile, stdoutFile, stderrFile := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = files[0], files[1], files[2]
+	code := run(args)
+	os.Stdin, os.Stdout, os.Stderr = stdinFile, stdoutFile, stderrFile
+	logging.BaseInitLogger(logging.LogConfig{Level: "error"})
+
+	output := make([]string, 2)
+	for i, file := range files[1:] {
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		output[i] = string(content)
+	}
+	return commandResult{code: code, stdout: output[0], stderr: output[1]}
+}
+
+// expectOutput checks the exit code of the command and that stdout contains the texts
+func (r commandResult) expectOutput(t *testing.T, code int, texts ...string) {
+	t.Helper()
+	if r.code != code {
+		t.Errorf("Expected exit code %d, got %d\nstdout: %s\nstderr: %s", code, r.code, r.stdout, r.stderr)
+	}
+	for _, text := range texts {
+		if !strings.Contains(r.stdout, text) {
+			t.Errorf("Expected %q on stdout, got %q", text, r.stdout)
+		}
+	}
+}
+
+// expectError checks the exit code of the command and that stderr contains the text
+func (r commandResult) expectError(t *testing.T, code int, text string) {
+	t.Helper()
+	if r.code != code {
+		t.Errorf("Expected exit code %d, got %d\nstdout: %s\nstderr: %s", code, r.code, r.stdout, r.stderr)
+	}
+	if !strings.Contains(r.stderr, text) {
+		t.Errorf("Expected %q on stderr, got %q", text, r.stderr)
+	}
+}
+
+func createTestUser(t *testing.T, store *memory.Store, email string) *repository.Auth {
+	t.Helper()
+	user := &repository.Auth{Email: email, Active: true}
+	user.PasswordHash = user.GeneratePasswordHash("old s3cret")
+	if err := store.Auth().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createTestSession(t *testing.T, store *memory.Store, key string, userID int64, lastUsed time.Time, expiresAt time.Time) {
+	t.Helper()
+	session := &repository.Session{SessionKey: key, UserID: userID, CreatedAt: lastUsed, LastUsed: lastUsed, AuthenticatedAt: lastUsed, ExpiresAt: expiresAt}
+	if err := store.Sessions().Create(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getTestUser(t *testing.T, store *memory.Store, id int64) *repository.Auth {
+	t.Helper()
+	user, err := store.Auth().GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func userSessions(t *testing.T, store *memory.Store, userID int64) []*repository.Session {
+	t.Helper()
+	sessions, err := store.Sessions().GetAllByUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessions
+}
+
+func TestCommandUsageErrors(t *testing.T) {
+	store := memory.NewStore()
+
+	cases := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"unknown command", []string{"frobnicate"}, 2, `Unknown command "auth frobnicate"`},
+		{"unknown subcommand", []string{"user", "frobnicate"}, 2, `Unknown command "auth user frobnicate"`},
+		{"missing subcommand", []string{"sessions"}, 2, "Usage: auth sessions <command>"},
+		{"unknown flag", []string{"user", "show", "--frobnicate", "1"}, 2, "unknown flag: --frobnicate"},
+		{"invalid configuration", []string{"tokens", "purge", "--database.port", "0"}, 2, "database.port"},
+		{"missing e-mail", []string{"create-admin"}, 2, "Usage: auth create-admin"},
+		{"positional argument to create-admin", []string{"create-admin", "--email", "admin@example.com", "extra"}, 2, "Usage: auth create-admin"},
+		{"missing user", []string{"user", "suspend"}, 2, "Usage: auth user suspend"},
+		{"too many users", []string{"user", "delete", "1", "2"}, 2, "Usage: auth user delete"},
+		{"purge without a kind", []string{"sessions", "purge"}, 2, "Usage: auth sessions purge"},
+		{"unknown format", []string{"config", "print", "--format", "toml"}, 2, "Usage: auth config print"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			runCommand(t, store, "", tc.args...).expectError(t, tc.code, tc.stderr)
+		})
+	}
+
+	// The help is not an error
+	if result := runCommand(t, store, "", "user", "show", "--help"); result.code != 0 || !strings.Contains(result.stderr, "Usage: auth user show") {
+		t.Errorf("Expected the help with exit code 0, got %d and %q", result.code, result.stderr)
+	}
+	if _, err := store.Auth().GetByEmail(context.Background(), "admin@example.com"); err == nil {
+		t.Error("Expected create-admin with an extra argument to create nobody")
+	}
+}
+
+func TestCreateAdminCommand(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+
+	result := runCommand(t, store, "", "create-admin", "--email", "admin@example.com")
+	result.expectOutput(t, 0, "Created administrator admin@example.com", "Generated password: ")
+	admin, err := store.Auth().GetByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatalf("Expected the administrator to be created: %v", err)
+	}
+	generated := strings.TrimSpace(result.stdout[strings.Index(result.stdout, "Generated password: ")+len("Generated password: "):])
+	if !admin.IsAdmin || !admin.Active || len(generated) != generatedPasswordLength || !admin.ComparePassword(generated) {
+		t.Errorf("Expected an active administrator with the generated password, got %+v and %q", admin, generated)
+	}
+
+	result = runCommand(t, store, "chosen s3cret\n", "create-admin", "--email", "other@example.com", "--password-stdin")
+	result.expectOutput(t, 0, "Created administrator other@example.com")
+	if strings.Contains(result.stdout, "Generated password") {
+		t.Errorf("Expected no generated password, got %q", result.stdout)
+	}
+	if other, err := store.Auth().GetByEmail(ctx, "other@example.com"); err != nil || !other.ComparePassword("chosen s3cret") {
+		t.Errorf("Expected the password from stdin, got %+v, %v", other, err)
+	}
+
+	runCommand(t, store, "", "create-admin", "--email", "admin@example.com").expectError(t, 1, "A user with the e-mail admin@example.com already exists")
+	runCommand(t, store, "\n", "create-admin", "--email", "empty@example.com", "--password-stdin").expectError(t, 1, "the password is empty")
+	runCommand(t, store, "", "create-admin", "--email", "empty@example.com", "--password-stdin").expectError(t, 1, "failed to read the password from stdin")
+	if _, err = store.Auth().GetByEmail(ctx, "empty@example.com"); err == nil {
+		t.Error("Expected no administrator without a password")
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	store := memory.NewStore()
+	user := createTestUser(t, store, "user@example.com")
+	other := createTestUser(t, store, "other@example.com")
+	id := strconv.FormatInt(user.ID, 10)
+	now := time.Now().UTC()
+	createTestSession(t, store, "session", user.ID, now, now.Add(time.Hour))
+	createTestSession(t, store, "other", other.ID, now, now.Add(time.Hour))
+
+	runCommand(t, store, "", "user", "show", "user@example.com").expectOutput(t, 0, "ID:", id, "E-mail:", "user@example.com", "Suspended:  no", "Sessions:   1", logging.Fingerprint("session"))
+	runCommand(t, store, "", "user", "show", "nobody@example.com").expectError(t, 1, "User nobody@example.com not found")
+	runCommand(t, store, "", "user", "suspend", "12345").expectError(t, 1, "User 12345 not found")
+
+	runCommand(t, store, "", "user", "suspend", id).expectOutput(t, 0, "Suspended user "+id)
+	if getTestUser(t, store, user.ID).SuspendedAt == nil || len(userSessions(t, store, user.ID)) != 0 {
+		t.Error("Expected the user to be suspended and their sessions revoked")
+	}
+	runCommand(t, store, "", "user", "show", id).expectOutput(t, 0, "Suspended:  since ", "Sessions:   0")
+
+	runCommand(t, store, "", "user", "unsuspend", "user@example.com").expectOutput(t, 0, "User "+id+" can log in again")
+	if getTestUser(t, store, user.ID).SuspendedAt != nil {
+		t.Error("Expected the suspension to be lifted")
+	}
+
+	createTestSession(t, store, "renewed", user.ID, now, now.Add(time.Hour))
+	runCommand(t, store, "new s3cret\n", "user", "reset-password", id, "--password-stdin").expectOutput(t, 0, "Reset the password of user "+id)
+	if reset := getTestUser(t, store, user.ID); !reset.ComparePassword("new s3cret") || reset.ComparePassword("old s3cret") {
+		t.Error("Expected the password from stdin to replace the old one")
+	}
+	if len(userSessions(t, store, user.ID)) != 0 {
+		t.Error("Expected the sessions of the old password to be revoked")
+	}
+	result := runCommand(t, store, "", "user", "reset-password", id)
+	result.expectOutput(t, 0, "Generated password: ")
+	if generated := strings.TrimSpace(result.stdout[strings.Index(result.stdout, "Generated password: ")+len("Generated password: "):]); !getTestUser(t, store, user.ID).ComparePassword(generated) {
+		t.Errorf("Expected the generated password %q to be set", generated)
+	}
+
+	runCommand(t, store, "", "user", "delete", id).expectOutput(t, 0, "User "+id+" will be deleted")
+	if getTestUser(t, store, user.ID).DeletedAt == nil {
+		t.Error("Expected the deletion to be scheduled")
+	}
+
+	// The other user is left alone
+	if untouched := getTestUser(t, store, other.ID); untouched.SuspendedAt != nil || untouched.DeletedAt != nil || !untouched.ComparePassword("old s3cret") || len(userSessions(t, store, other.ID)) != 1 {
+		t.Errorf("Expected the other user to be untouched, got %+v", untouched)
+	}
+}
+
+func TestPurgeCommands(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	now := time.Now().UTC()
+	createTestSession(t, store, "expired", 1, now.Add(-90*time.Minute), now.Add(-time.Hour))
+	createTestSession(t, store, "idle", 1, now.Add(-3*time.Hour), now.Add(time.Hour))
+	createTestSession(t, store, "active", 1, now, now.Add(time.Hour))
+	for hash, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "valid": now.Add(time.Hour)} {
+		if err := store.Tokens().Create(ctx, &repository.Token{TokenHash: hash, Type: "verification", UserID: 1, ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCommand(t, store, "", "sessions", "purge", "--expired", "--inactive", "--dry-run").expectOutput(t, 0, "Would delete 1 expired sessions", "Would delete 1 inactive sessions")
+	if count := len(userSessions(t, store, 1)); count != 2 {
+		t.Errorf("Expected a dry run to delete nothing, %d sessions left", count)
+	}
+
+	runCommand(t, store, "", "sessions", "purge", "--expired").expectOutput(t, 0, "Deleted 1 expired sessions")
+	if _, err := store.Sessions().Get(ctx, "expired"); err == nil {
+		t.Error("Expected the expired session to be deleted")
+	}
+	runCommand(t, store, "", "sessions", "purge", "--inactive").expectOutput(t, 0, "Deleted 1 inactive sessions")
+	if sessions := userSessions(t, store, 1); len(sessions) != 1 || sessions[0].SessionKey != "active" {
+		t.Errorf("Expected the active session to be kept, got %v", sessions)
+	}
+
+	runCommand(t, store, "", "tokens", "purge").expectOutput(t, 0, "Deleted 1 expired tokens")
+	if _, err := store.Tokens().Get(ctx, "valid", "verification"); err != nil {
+		t.Errorf("Expected the valid token to be kept, got %v", err)
+	}
+}
+
+func TestConfigPrintCommand(t *testing.T) {
+	store := memory.NewStore()
+
+	result := runCommand(t, store, "", "config", "print", "--format", "json", "--database.host", "db.internal")
+	result.expectOutput(t, 0)
+	var printed struct {
+		Database map[string]interface{} `json:"database"`
+	}
+	if err := json.Unmarshal([]byte(result.stdout), &printed); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", result.stdout, err)
+	}
+	if printed.Database["host"] != "db.internal" || printed.Database["password"] != logging.Redacted {
+		t.Errorf("Expected the flag applied and the password redacted, got %v", printed.Database)
+	}
+
+	result = runCommand(t, store, "", "config", "print")
+	result.expectOutput(t, 0, "database:\n", logging.Redacted)
+	if strings.Contains(result.stdout, adminDatabasePassword) {
+		t.Errorf("Expected no secret in the output, got %q", result.stdout)
+	}
+}
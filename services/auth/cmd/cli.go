@@ -0,0 +1,260 @@
+package main
+
+import (
+	"auth/config"
+	"auth/internal/binding"
+	"auth/internal/notify"
+	"auth/internal/repository"
+	"auth/internal/service"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/spf13/pflag"
+	"gorm.io/gorm"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of the auth binary, run returns the exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands are the subcommands of the binary, without one the server is started
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "serve", summary: "start the server, the default without a command", run: runServe},
+		{name: "migrate", summary: "apply or roll back database migrations", run: runMigrate},
+		{name: "create-admin", summary: "create an administrator", run: runCreateAdmin},
+		{name: "user", summary: "show, suspend or reset the password of a user", run: runUser},
+		{name: "sessions", summary: "purge expired or inactive sessions", run: runSessions},
+		{name: "tokens", summary: "purge expired verification and password reset tokens", run: runTokens},
+		{name: "config", summary: "print the effective configuration", run: runConfig},
+	}
+}
+
+// run dispatches the arguments to a command. Flags without a command start the server,
+// as they did before the binary had commands.
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
+	}
+	return dispatch("auth", args, commands)
+}
+
+// dispatch runs the command named by the first argument with the remaining arguments
+func dispatch(name string, args []string, commands []command) int {
+	if len(args) == 0 || args[0] == "help" {
+		printCommands(name, commands)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", strings.TrimSpace(name+" "+args[0]))
+	printCommands(name, commands)
+	return 2
+}
+
+func printCommands(name string, commands []command) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nEvery command also takes the configuration flags, e.g. --config or --database.host.")
+}
+
+// newFlagSet returns the flags of a command, the configuration flags are added by loadConfig
+func newFlagSet(name string, usage string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: auth %s\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// commandLog sends the logs of administrative commands to stderr, stdout carries their output
+var commandLog = logging.SinkConfig{Type: logging.SinkStderr}
+
+// commandSinks are the sinks of administrative commands, the configured ones with stderr in place
+// of stdout. Without configured sinks the logs only go to stderr.
+func commandSinks(configured []logging.SinkConfig) []logging.SinkConfig {
+	if len(configured) == 0 {
+		return []logging.SinkConfig{commandLog}
+	}
+	sinks := make([]logging.SinkConfig, len(configured))
+	for i, sink := range configured {
+		if sink.Type == logging.SinkStdout {
+			sink = commandLog
+		}
+		sinks[i] = sink
+	}
+	return sinks
+}
+
+// loadConfig loads the configuration from the arguments and sets up logging with it, the logs of
+// a command stay off stdout. On an invalid configuration and after printing the help the
+// configuration is nil and the command returns the exit code.
+func loadConfig(flags *pflag.FlagSet, args []string, command bool) (*config.Config, int) {
+	cfg, err := config.LoadWith(flags, args)
+	if errors.Is(err, pflag.ErrHelp) {
+		return nil, 0
+	}
+	if err != nil {
+		// The logger is configured by the config, so the error goes to stderr as is
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		return nil, 2
+	}
+
+	logConfig := cfg.Logging.LogConfig("auth")
+	if command {
+		logConfig.Sinks = commandSinks(logConfig.Sinks)
+	}
+	logging.InitLogger(logConfig)
+	return cfg, 0
+}
+
+// app holds the services, the server and the administrative commands share them
+type app struct {
+	sessionRepo       repository.SessionRepository
+	jobRuns           repository.JobRunRepository
+	revocationService service.RevocationService
+	sessionService    service.SessionService
+	tokenService      service.TokenService
+	deviceService     service.DeviceService
+	authService       service.AuthService
+	// passkeyService is nil if passkeys are disabled
+	passkeyService service.PasskeyService
+}
+
+// repositories are where the services keep their data
+type repositories struct {
+	auth     repository.AuthRepository
+	sessions repository.SessionRepository
+	tokens   repository.TokenRepository
+	devices  repository.DeviceRepository
+	passkeys repository.PasskeyRepository
+	jobRuns  repository.JobRunRepository
+}
+
+// newRepositories returns the repositories of the database
+func newRepositories(db *gorm.DB) repositories {
+	return repositories{
+		auth:     repository.NewAuthRepository(db, logging.Logger),
+		sessions: repository.NewSessionRepository(db, logging.Logger),
+		tokens:   repository.NewTokenRepository(db, logging.Logger),
+		devices:  repository.NewDeviceRepository(db, logging.Logger),
+		passkeys: repository.NewPasskeyRepository(db, logging.Logger),
+		jobRuns:  repository.NewJobRunRepository(db, logging.Logger),
+	}
+}
+
+// newApp creates the services, locator finds the location of clients and may be nil
+func newApp(repos repositories, cfg *config.Config, locator binding.Locator) (*app, error) {
+	binder := binding.NewBinder(cfg.Session.Binding.Config(), locator)
+	revocationService := service.NewRevocationService()
+	sessionConfig := cfg.Session.Policy()
+	sessionConfig.Binder = binder
+	sessionService := service.NewSessionService(repos.sessions, revocationService, sessionConfig, logging.Logger)
+	tokenService := service.NewTokenService(repos.tokens, logging.Logger)
+	deviceService := service.NewDeviceService(repos.devices, repos.sessions, binder, newNotifier(cfg), logging.Logger)
+	a := &app{
+		sessionRepo:       repos.sessions,
+		jobRuns:           repos.jobRuns,
+		revocationService: revocationService,
+		sessionService:    sessionService,
+		tokenService:      tokenService,
+		deviceService:     deviceService,
+		authService:       service.NewAuthService(repos.auth, sessionService, tokenService, deviceService, logging.Logger),
+	}
+	if cfg.Passkeys.Enabled() {
+		passkeyService, err := service.NewPasskeyService(cfg.Passkeys.Passkey(), repos.auth, repos.passkeys, tokenService, sessionService, deviceService, logging.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up passkeys: %w", err)
+		}
+		a.passkeyService = passkeyService
+	}
+	return a, nil
+}
+
+// newNotifier returns the notifier of new devices, nil if users are not notified
+func newNotifier(cfg *config.Config) notify.Notifier {
+	if !cfg.Session.Binding.NotifyNewDevices {
+		return nil
+	}
+	if cfg.Mailer.Host == "" {
+		return notify.NewLogNotifier(logging.Logger)
+	}
+	return notify.NewMailNotifier(cfg.Mailer.Mail())
+}
+
+// openApp connects to the database for an administrative command. The returned function
+// closes the connection.
+func openApp(ctx context.Context, cfg *config.Config) (*app, func(), error) {
+	db, err := ConnectToDB(ctx, cfg.Database)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Commands do not log users in, they need no locations
+	a, err := newApp(newRepositories(db), cfg, nil)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, nil, err
+	}
+	return a, func() {
+		a.revocationService.Close()
+		_ = sqlDB.Close()
+	}, nil
+}
+
+// fail reports the error of a command and returns its exit code
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
+}
+
+// generatedPasswordLength is the length of passwords generated for operators
+const generatedPasswordLength = 20
+
+// readPassword reads the password from the first line of stdin, or generates one.
+// The flag keeps passwords out of the shell history and the process list.
+func readPassword(fromStdin bool) (password string, generated bool, err error) {
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", false, fmt.Errorf("failed to read the password from stdin: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", false, errors.New("the password is empty")
+		}
+		return password, false, nil
+	}
+
+	const letters = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	random := make([]byte, generatedPasswordLength)
+	for i := range random {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", false, err
+		}
+		random[i] = letters[n.Int64()]
+	}
+	return string(random), true, nil
+}
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"auth/config"
+	"auth/docs"
+	"auth/internal/jobs"
+	"auth/internal/messages"
+	"auth/internal/passkeytest"
+	"auth/internal/repository/memory"
+	"auth/internal/service"
+	"auth/pkg/auth"
+	"auth/pkg/authclient"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/openapi"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"github.com/Ruletk/GoMarketplace/pkg/server"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	contractRPID   = "example.com"
+	contractOrigin = "https://example.com"
+	contractPass   = "correct horse battery staple"
+)
+
+// contract is the auth service running on in-memory repositories. Every response is checked
+// against the OpenAPI document, the responses seen are recorded.
+type contract struct {
+	t        *testing.T
+	url      string
+	spec     *openapi.Spec
+	router   *gin.Engine
+	services *app
+	locker   scheduler.Locker
+	failing  atomic.Bool
+
+	mu      sync.Mutex
+	covered map[string]bool
+}
+
+func newContract(t *testing.T) *contract {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logging.BaseInitLogger(logging.LogConfig{Level: "error"})
+
+	t.Setenv(communication.InternalCallSecretEnv, contractInternalSecret)
+	cfg := config.LoadDefaultConfig()
+	cfg.Server.ValidateResponses = true
+	cfg.CSRF.Secret = strings.Repeat("s", auth.MinCSRFSecretLength)
+	cfg.Passkeys.RPID = contractRPID
+	cfg.Passkeys.RPOrigins = []string{contractOrigin}
+	cfg.CORS.AllowedOrigins = []string{contractOrigin}
+
+	store := memory.NewStore()
+	services, err := newApp(memoryRepositories(store), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker := scheduler.NewMemoryLocker()
+	sched, err := newScheduler(locker, cfg.Jobs, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	// Tokens are validated by the service itself, uncached so revocations show at once
+	validator := auth.NewValidator(auth.ValidatorConfig{
+		Upstream: communication.NewUpstream(auth.AuthServiceName, communication.StaticResolver{auth.AuthServiceName: {url}}, communication.NewRoundRobinBalancer()),
+		Client:   communication.NewClient(communication.DefaultClientConfig()),
+	})
+	router, err := newRouter(cfg, services, sched, validator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &contract{
+		t:        t,
+		url:      url,
+		spec:     openapi.MustLoad(docs.OpenAPI),
+		router:   router,
+		services: services,
+		locker:   locker,
+		covered:  map[string]bool{},
+	}
+	srv := server.New(server.Config{Handler: router, ShutdownTimeout: 5 * time.Second})
+	srv.Health().AddCheck("contract", func(context.Context) error {
+		if c.failing.Load() {
+			return errors.New("failing on purpose")
+		}
+		return nil
+	})
+	srv.OnDrain(func(context.Context) error {
+		services.revocationService.Close()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+// request is a call to the service
+type request struct {
+	method string
+	path   string
+	body   interface{}
+	token  string
+	header http.Header
+}
+
+// do sends the request, checks the response against the document and records it
+func (c *contract) do(req request) (int, []byte) {
+	c.t.Helper()
+	r := c.newRequest(context.Background(), req)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.check(r, resp, body)
+	return resp.StatusCode, body
+}
+
+func (c *contract) newRequest(ctx context.Context, req request) *http.Request {
+	c.t.Helper()
+	var body io.Reader
+	if req.body != nil {
+		data, err := json.Marshal(req.body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		body = bytes.NewReader(data)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, c.url+req.path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if req.body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if req.token != "" {
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	}
+	for name, values := range req.header {
+		r.Header[name] = values
+	}
+	return r
+}
+
+// check validates the response, it is recorded as covered if the document has it
+func (c *contract) check(r *http.Request, resp *http.Response, body []byte) {
+	c.t.Helper()
+	operation, ok := c.spec.FindOperation(r)
+	if !ok {
+		c.t.Errorf("%s %s is not documented", r.Method, r.URL.Path)
+		return
+	}
+	if err := c.spec.ValidateResponse(r, resp.StatusCode, resp.Header, body); err != nil {
+		c.t.Errorf("%v\n%s", err, body)
+		return
+	}
+	c.mu.Lock()
+	c.covered[operation.ID+" "+strconv.Itoa(resp.StatusCode)] = true
+	c.mu.Unlock()
+}
+
+// expect sends the request and fails the test unless it is answered with the status
+func (c *contract) expect(status int, req request) []byte {
+	c.t.Helper()
+	got, body := c.do(req)
+	if got != status {
+		c.t.Fatalf("%s %s answered %d, want %d: %s", req.method, req.path, got, status, body)
+	}
+	return body
+}
+
+// crossOrigin sends the request from the frontend origin and returns the status and headers
+func (c *contract) crossOrigin(req request) (int, http.Header) {
+	c.t.Helper()
+	if req.header == nil {
+		req.header = http.Header{}
+	}
+	req.header.Set("Origin", contractOrigin)
+	r := c.newRequest(context.Background(), req)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.check(r, resp, body)
+	return resp.StatusCode, resp.Header
+}
+
+// decode decodes a response body
+func (c *contract) decode(body []byte, v interface{}) {
+	c.t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		c.t.Fatalf("%v: %s", err, body)
+	}
+}
+
+// register creates a user with a password and returns its token
+func (c *contract) register(email string) string {
+	c.t.Helper()
+	var resp messages.AuthResponse
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/register", body: credentials(email, contractPass)}), &resp)
+	return resp.Token
+}
+
+// login logs the user in with its password and returns its token
+func (c *contract) login(email string) string {
+	c.t.Helper()
+	var resp messages.AuthResponse
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/login", body: credentials(email, contractPass)}), &resp)
+	return resp.Token
+}
+
+// admin creates an administrator and returns its token
+func (c *contract) admin(email string) string {
+	c.t.Helper()
+	if _, err := c.services.authService.CreateAdmin(context.Background(), email, contractPass); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.login(email)
+}
+
+// userID returns the ID of the user owning the token
+func (c *contract) userID(token string) int64 {
+	c.t.Helper()
+	var resp messages.AuthDataResponse
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/validate", body: messages.TokenRequest{Token: token}, header: internalCall()}), &resp)
+	return resp.ID
+}
+
+// generateToken returns a single use token of the type for the user
+func (c *contract) generateToken(userID int64, type_ string) string {
+	c.t.Helper()
+	token, err := c.services.tokenService.GenerateToken(context.Background(), userID, type_)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return token
+}
+
+// passkeySignup signs a user up with a passkey and returns its token
+func (c *contract) passkeySignup(authenticator *passkeytest.Authenticator, email string) string {
+	c.t.Helper()
+	var creation messages.PasskeyCreation
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/passkeys/signup/begin", body: messages.PasskeySignupRequest{Email: email}}), &creation)
+	var resp messages.AuthResponse
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/passkeys/signup/finish", body: messages.PasskeyRegistration{
+		Token:      creation.Token,
+		Credential: authenticator.Create(c.t, creation.Options),
+	}}), &resp)
+	return resp.Token
+}
+
+// passkeyLogin logs in with the passkey and returns the status and the body of the response
+func (c *contract) passkeyLogin(authenticator *passkeytest.Authenticator) (int, []byte) {
+	c.t.Helper()
+	var assertion messages.PasskeyAssertion
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/passkeys/login/begin"}), &assertion)
+	return c.do(request{method: http.MethodPost, path: "/passkeys/login/finish", body: messages.PasskeyLogin{
+		Token:      assertion.Token,
+		Credential: authenticator.Get(c.t, assertion.Options),
+	}})
+}
+
+// registerPasskey adds a passkey to the user and returns its ID
+func (c *contract) registerPasskey(authenticator *passkeytest.Authenticator, token string) int64 {
+	c.t.Helper()
+	var creation messages.PasskeyCreation
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/passkeys/register/begin", token: token}), &creation)
+	var passkey struct {
+		ID int64 `json:"id"`
+	}
+	c.decode(c.expect(http.StatusCreated, request{method: http.MethodPost, path: "/passkeys/register/finish", token: token, body: messages.PasskeyRegistration{
+		Token:      creation.Token,
+		Credential: authenticator.Create(c.t, creation.Options),
+		Name:       "Laptop",
+	}}), &passkey)
+	return passkey.ID
+}
+
+// credentials is the body of a login or a registration. The messages are not used, their
+// passwords are redacted when encoded.
+func credentials(email string, password string) map[string]string {
+	return map[string]string{"email": email, "password": password}
+}
+
+// contractInternalSecret is the secret the services share in the contract tests
+const contractInternalSecret = "contract-internal-secret"
+
+func internalCall() http.Header {
+	return http.Header{communication.InternalCallHeader: {contractInternalSecret}}
+}
+
+func TestContractRoutesMatchDocument(t *testing.T) {
+	c := newContract(t)
+
+	routes := map[string]bool{"GET /healthz": true, "GET /readyz": true}
+	for _, route := range c.router.Routes() {
+		segments := strings.Split(route.Path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") {
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		routes[route.Method+" "+strings.Join(segments, "/")] = true
+	}
+	documented := map[string]bool{}
+	for _, operation := range c.spec.Operations() {
+		documented[operation.Method+" "+operation.Path] = true
+	}
+
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("%s is not documented", route)
+		}
+	}
+	for operation := range documented {
+		if !routes[operation] {
+			t.Errorf("%s is documented but not served", operation)
+		}
+	}
+}
+
+func TestContract(t *testing.T) {
+	c := newContract(t)
+	ctx := context.Background()
+	post := func(path string, body interface{}) request {
+		return request{method: http.MethodPost, path: path, body: body}
+	}
+
+	// Health
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/healthz"})
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/readyz"})
+	c.failing.Store(true)
+	c.expect(http.StatusServiceUnavailable, request{method: http.MethodGet, path: "/readyz"})
+	c.failing.Store(false)
+
+	// Documentation
+	if got := c.expect(http.StatusOK, request{method: http.MethodGet, path: "/openapi.yaml"}); !bytes.Equal(got, docs.OpenAPI) {
+		t.Error("/openapi.yaml is not the document")
+	}
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/openapi.json"})
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/docs"})
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/redoc"})
+	// Swagger UI and Redoc are served once vendored, the pages link to the document until then
+	apiDocs, err := openapi.NewDocs(c.spec, openapi.DocsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiDocs.Bundled() {
+		c.expect(http.StatusOK, request{method: http.MethodGet, path: "/docs/assets/swagger-ui-bundle.js"})
+		c.covered["docsAsset 404"] = true
+	} else {
+		t.Log("Swagger UI and Redoc are not vendored, run go generate in pkg/openapi")
+		c.expect(http.StatusNotFound, request{method: http.MethodGet, path: "/docs/assets/swagger-ui-bundle.js"})
+		c.covered["docsAsset 200"] = true
+	}
+
+	// Registration and login
+	token := c.register("user@example.com")
+	c.expect(http.StatusBadRequest, post("/register", map[string]string{"email": "not an e-mail"}))
+	c.expect(http.StatusConflict, post("/register", credentials("user@example.com", contractPass)))
+	c.login("user@example.com")
+	c.expect(http.StatusBadRequest, post("/login", map[string]string{"email": "user@example.com"}))
+	// The frontend reads the problems of invalid requests
+	status, header := c.crossOrigin(post("/login", map[string]string{"email": "user@example.com"}))
+	if status != http.StatusBadRequest || header.Get("Access-Control-Allow-Origin") != contractOrigin {
+		t.Errorf("Expected a 400 the origin may read, got %d with %v", status, header)
+	}
+	c.expect(http.StatusUnauthorized, post("/login", credentials("user@example.com", "wrong password")))
+	suspended := c.register("suspended@example.com")
+	if err := c.services.authService.SuspendUser(ctx, c.userID(suspended)); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(http.StatusForbidden, post("/login", credentials("suspended@example.com", contractPass)))
+
+	// Validation
+	userID := c.userID(token)
+	c.expect(http.StatusBadRequest, request{method: http.MethodPost, path: "/validate", body: map[string]string{}, header: internalCall()})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodPost, path: "/validate", body: messages.TokenRequest{Token: "unknown"}, header: internalCall()})
+	// Only the shared secret marks a call as internal
+	c.expect(http.StatusUnauthorized, request{method: http.MethodPost, path: "/validate", body: messages.TokenRequest{Token: token}, header: http.Header{communication.InternalCallHeader: {"true"}}})
+
+	// Re-authentication
+	c.expect(http.StatusOK, request{method: http.MethodPost, path: "/reauth", token: token, body: map[string]string{"password": contractPass}})
+	c.expect(http.StatusBadRequest, request{method: http.MethodPost, path: "/reauth", token: token, body: map[string]string{}})
+	c.expect(http.StatusUnauthorized, post("/reauth", map[string]string{"password": contractPass}))
+	c.expect(http.StatusForbidden, request{method: http.MethodPost, path: "/reauth", token: token, body: map[string]string{"password": "wrong password"}})
+
+	// Password change and verification
+	known := c.expect(http.StatusOK, post("/change-password", messages.PasswordChangeRequest{Email: "user@example.com"}))
+	c.expect(http.StatusBadRequest, post("/change-password", messages.PasswordChangeRequest{Email: "not an e-mail"}))
+	// An unknown email is answered like a known one, the endpoint does not tell which accounts exist
+	if unknown := c.expect(http.StatusOK, post("/change-password", messages.PasswordChangeRequest{Email: "nobody@example.com"})); !bytes.Equal(unknown, known) {
+		t.Errorf("unknown email answered %s, a known one %s", unknown, known)
+	}
+	reset := c.generateToken(userID, service.TokenTypePasswordReset)
+	c.expect(http.StatusOK, post("/change-password/"+reset, map[string]string{"newPassword": contractPass}))
+	c.expect(http.StatusBadRequest, post("/change-password/"+reset, map[string]string{"newPassword": contractPass}))
+	verification := c.generateToken(userID, service.TokenTypeVerification)
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/verify/" + verification})
+	c.expect(http.StatusBadRequest, request{method: http.MethodGet, path: "/verify/" + verification})
+
+	// Private routes
+	c.expect(http.StatusOK, request{method: http.MethodPut, path: "/language", token: token, body: messages.LanguageRequest{Language: "kk"}})
+	c.expect(http.StatusBadRequest, request{method: http.MethodPut, path: "/language", token: token, body: messages.LanguageRequest{Language: "xx"}})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodPut, path: "/language", body: messages.LanguageRequest{Language: "en"}})
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/csrf", token: token})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodGet, path: "/csrf"})
+	sessionsAdmin := c.admin("sessions-admin@example.com")
+	for _, path := range []string{"/admin/sessions/hard-delete", "/admin/sessions/delete-inactive"} {
+		c.expect(http.StatusOK, request{method: http.MethodDelete, path: path, token: sessionsAdmin})
+		c.expect(http.StatusForbidden, request{method: http.MethodDelete, path: path, token: token})
+		c.expect(http.StatusUnauthorized, request{method: http.MethodDelete, path: path})
+	}
+	c.revocations(token)
+
+	// Passkeys
+	laptop := passkeytest.New(t, contractRPID, contractOrigin)
+	passkeyToken := c.passkeySignup(laptop, "passkey@example.com")
+	c.expect(http.StatusBadRequest, post("/passkeys/signup/begin", messages.PasskeySignupRequest{Email: "not an e-mail"}))
+	c.expect(http.StatusConflict, post("/passkeys/signup/begin", messages.PasskeySignupRequest{Email: "user@example.com"}))
+	c.expect(http.StatusBadRequest, post("/passkeys/signup/finish", messages.PasskeyRegistration{Token: "unknown", Credential: json.RawMessage(`{}`)}))
+	var creation messages.PasskeyCreation
+	c.decode(c.expect(http.StatusOK, post("/passkeys/signup/begin", messages.PasskeySignupRequest{Email: "raced@example.com"})), &creation)
+	c.register("raced@example.com")
+	phone := passkeytest.New(t, contractRPID, contractOrigin)
+	c.expect(http.StatusConflict, post("/passkeys/signup/finish", messages.PasskeyRegistration{Token: creation.Token, Credential: phone.Create(t, creation.Options)}))
+
+	if status, body := c.passkeyLogin(laptop); status != http.StatusOK {
+		t.Fatalf("passkey login answered %d: %s", status, body)
+	}
+	c.expect(http.StatusBadRequest, post("/passkeys/login/finish", messages.PasskeyLogin{Token: "unknown", Credential: json.RawMessage(`{}`)}))
+	laptop.Counter = 0
+	if status, body := c.passkeyLogin(laptop); status != http.StatusUnauthorized {
+		t.Fatalf("cloned passkey login answered %d: %s", status, body)
+	}
+	tablet := passkeytest.New(t, contractRPID, contractOrigin)
+	if err := c.services.authService.SuspendUser(ctx, c.userID(c.passkeySignup(tablet, "suspended-passkey@example.com"))); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := c.passkeyLogin(tablet); status != http.StatusForbidden {
+		t.Fatalf("suspended passkey login answered %d: %s", status, body)
+	}
+
+	token = c.login("raced@example.com")
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/passkeys", token: token})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodGet, path: "/passkeys"})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodPost, path: "/passkeys/register/begin"})
+	passkeyID := c.registerPasskey(phone, token)
+	c.expect(http.StatusBadRequest, request{method: http.MethodPost, path: "/passkeys/register/finish", token: token, body: messages.PasskeyRegistration{Token: "unknown", Credential: json.RawMessage(`{}`)}})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodPost, path: "/passkeys/register/finish", body: messages.PasskeyRegistration{Token: "unknown", Credential: json.RawMessage(`{}`)}})
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodPost, path: "/passkeys/register/begin", token: token}), &creation)
+	phone.Counter = 0
+	c.expect(http.StatusConflict, request{method: http.MethodPost, path: "/passkeys/register/finish", token: token, body: messages.PasskeyRegistration{Token: creation.Token, Credential: phone.Create(t, creation.Options)}})
+
+	path := "/passkeys/" + strconv.FormatInt(passkeyID, 10)
+	c.expect(http.StatusOK, request{method: http.MethodPatch, path: path, token: token, body: messages.PasskeyRename{Name: "Phone"}})
+	c.expect(http.StatusBadRequest, request{method: http.MethodPatch, path: path, token: token, body: messages.PasskeyRename{}})
+	c.expect(http.StatusNotFound, request{method: http.MethodPatch, path: "/passkeys/404", token: token, body: messages.PasskeyRename{Name: "Phone"}})
+	c.expect(http.StatusOK, request{method: http.MethodDelete, path: path, token: token})
+	c.expect(http.StatusNotFound, request{method: http.MethodDelete, path: path, token: token})
+	c.expect(http.StatusUnauthorized, request{method: http.MethodDelete, path: path})
+	var passkeys []struct {
+		ID int64 `json:"id"`
+	}
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodGet, path: "/passkeys", token: passkeyToken}), &passkeys)
+	if len(passkeys) != 1 {
+		t.Fatalf("passkey user has %d passkeys, want 1", len(passkeys))
+	}
+	c.expect(http.StatusConflict, request{method: http.MethodDelete, path: "/passkeys/" + strconv.FormatInt(passkeys[0].ID, 10), token: passkeyToken})
+
+	// Logout
+	logout := c.register("logout@example.com")
+	// A cross-site request carrying the session cookie cannot log the user out
+	crossSite := http.Header{"Cookie": {config.LoadDefaultConfig().Cookie.Name + "=" + logout}, "Origin": {"https://evil.example"}}
+	c.expect(http.StatusForbidden, request{method: http.MethodPost, path: "/logout", header: crossSite})
+	c.expect(http.StatusOK, request{method: http.MethodPost, path: "/logout", token: logout})
+
+	// Administration
+	admin := c.admin("admin@example.com")
+	user := c.register("plain@example.com")
+	for _, req := range []request{
+		{method: http.MethodGet, path: "/admin/diagnostics/build"},
+		{method: http.MethodGet, path: "/admin/diagnostics/config"},
+		{method: http.MethodGet, path: "/admin/diagnostics/log-levels"},
+		{method: http.MethodPut, path: "/admin/diagnostics/log-levels", body: map[string]string{"logger": "auth", "level": "debug"}},
+		{method: http.MethodDelete, path: "/admin/diagnostics/log-levels/auth"},
+		{method: http.MethodGet, path: "/admin/diagnostics/pprof"},
+		{method: http.MethodPost, path: "/admin/diagnostics/pprof", body: map[string]string{"duration": "5m"}},
+		{method: http.MethodDelete, path: "/admin/diagnostics/pprof"},
+		{method: http.MethodGet, path: "/admin/jobs"},
+		{method: http.MethodGet, path: "/admin/jobs/" + jobs.ExpiredTokens + "/runs"},
+		{method: http.MethodPost, path: "/admin/jobs/" + jobs.ExpiredTokens + "/run"},
+	} {
+		req.token = admin
+		c.expect(http.StatusOK, req)
+		req.token = user
+		c.expect(http.StatusForbidden, req)
+	}
+	// The configuration is redacted like config print does it
+	var dumped map[string]map[string]interface{}
+	c.decode(c.expect(http.StatusOK, request{method: http.MethodGet, path: "/admin/diagnostics/config", token: admin}), &dumped)
+	if dumped["csrf"]["secret"] != logging.Redacted || dumped["cookie"]["name"] != "token" {
+		t.Errorf("configuration is not redacted like config print: %v", dumped)
+	}
+	c.expect(http.StatusBadRequest, request{method: http.MethodPut, path: "/admin/diagnostics/log-levels", token: admin, body: map[string]string{"logger": "auth", "level": "loud"}})
+	c.expect(http.StatusNotFound, request{method: http.MethodGet, path: "/admin/diagnostics/pprof/heap", token: admin})
+	c.expect(http.StatusBadRequest, request{method: http.MethodPost, path: "/admin/diagnostics/pprof", token: admin, body: map[string]string{"duration": "forever"}})
+	c.expect(http.StatusOK, request{method: http.MethodPost, path: "/admin/diagnostics/pprof", token: admin, body: map[string]string{"duration": "5m"}})
+	c.expect(http.StatusOK, request{method: http.MethodGet, path: "/admin/diagnostics/pprof/heap", token: admin})
+	c.expect(http.StatusBadRequest, request{method: http.MethodGet, path: "/admin/jobs/" + jobs.ExpiredTokens + "/runs?limit=0", token: admin})
+	c.expect(http.StatusNotFound, request{method: http.MethodGet, path: "/admin/jobs/unknown/runs", token: admin})
+	c.expect(http.StatusNotFound, request{method: http.MethodPost, path: "/admin/jobs/unknown/run", token: admin})
+	unlock, locked, err := c.locker.TryLock(ctx, jobs.ExpiredTokens)
+	if err != nil || !locked {
+		t.Fatalf("failed to lock the job: %v", err)
+	}
+	c.expect(http.StatusConflict, request{method: http.MethodPost, path: "/admin/jobs/" + jobs.ExpiredTokens + "/run", token: admin})
+	unlock()
+
+	// Every documented response has been seen
+	var missing []string
+	for _, operation := range c.spec.Operations() {
+		for _, status := range operation.Statuses {
+			if key := operation.ID + " " + status; !c.covered[key] {
+				missing = append(missing, key)
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("documented responses not covered:\n%s", strings.Join(missing, "\n"))
+	}
+}
+
+// The generated client calls the service like other services would
+func TestContractClient(t *testing.T) {
+	c := newContract(t)
+	ctx := context.Background()
+	upstream := communication.NewUpstream(auth.AuthServiceName, communication.StaticResolver{auth.AuthServiceName: {c.url}}, communication.NewRoundRobinBalancer())
+	internal := authclient.New(upstream, communication.NewClient(communication.DefaultClientConfig()))
+	// Calls on behalf of a user must not be internal ones, they would skip the token check
+	config := communication.DefaultClientConfig()
+	config.Header = nil
+	public := authclient.New(upstream, communication.NewClient(config))
+
+	fingerprint := "contract-device"
+	if _, err := public.AuthRegistration(ctx, &authclient.AuthRequest{Email: "client@example.com", Password: contractPass}, authclient.AuthRegistrationParams{}); err != nil {
+		t.Fatal(err)
+	}
+	login, err := public.AuthLogin(ctx, &authclient.AuthRequest{Email: "client@example.com", Password: contractPass}, authclient.AuthLoginParams{XDeviceFingerprint: &fingerprint})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := internal.AuthValidate(ctx, &authclient.TokenRequest{Token: login.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Email != "client@example.com" || data.ID == 0 {
+		t.Errorf("Unexpected validation %+v", data)
+	}
+	passkeys, err := public.AuthPasskeyList(ctx, communication.WithBearerToken(login.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 0 {
+		t.Errorf("Expected no passkeys, got %+v", passkeys)
+	}
+
+	_, err = internal.AuthValidate(ctx, &authclient.TokenRequest{Token: "unknown"})
+	upstreamErr, ok := communication.AsUpstreamError(err)
+	if !ok || upstreamErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401 upstream error, got %v", err)
+	}
+	var problem authclient.Problem
+	if err := json.Unmarshal(upstreamErr.Body, &problem); err != nil || problem.Code == "" {
+		t.Errorf("Expected a problem, got %s", upstreamErr.Body)
+	}
+
+	resp, err := public.DocsOpenAPIYAML(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); !bytes.Equal(body, docs.OpenAPI) {
+		t.Error("Expected the document")
+	}
+}
+
+// revocations reads the revocation stream until the session of the token is revoked
+func (c *contract) revocations(token string) {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := c.newRequest(ctx, request{method: http.MethodGet, path: "/revocations", header: internalCall()})
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	c.check(r, resp, nil)
+
+	c.expect(http.StatusOK, request{method: http.MethodPost, path: "/logout", token: token})
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data:") {
+			return
+		}
+	}
+	c.t.Fatalf("no revocation received: %v", scanner.Err())
+}
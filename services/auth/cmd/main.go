@@ -2,77 +2,377 @@ package main
 
 import (
 	"auth/config"
+	"auth/docs"
 	"auth/internal/api"
-	"auth/internal/repository"
-	"auth/internal/service"
+	"auth/internal/binding"
+	"auth/internal/jobs"
+	"auth/internal/locales"
 	"auth/pkg/auth"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/diagnostics"
+	"github.com/Ruletk/GoMarketplace/pkg/discovery"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
-	"github.com/gin-contrib/cors"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/Ruletk/GoMarketplace/pkg/openapi"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"github.com/Ruletk/GoMarketplace/pkg/server"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"net"
+	"os"
 	"strconv"
+	"time"
+)
+
+// version and commit are set at build time
+var (
+	version = "dev"
+	commit  = ""
 )
 
 func main() {
-	logging.InitLogger(logging.LogConfig{
-		Format: "json",
-		Level:  "debug",
-	})
+	os.Exit(run(os.Args[1:]))
+}
+
+// runServe starts the server and returns once it has shut down
+func runServe(args []string) int {
+	cfg, code := loadConfig(newFlagSet("serve", "serve [flags]"), args, false)
+	if cfg == nil {
+		return code
+	}
+	defer logging.Close()
 
 	logging.Logger.Info("Starting the server")
+	if communication.InternalCallSecret() == "" {
+		logging.Logger.Warn(communication.InternalCallSecretEnv + " is not set, calls from other services are not trusted")
+	}
 
-	r := gin.Default()
+	// Cancelled on SIGINT and SIGTERM, which starts the graceful shutdown
+	ctx, stop := server.SignalContext(context.Background())
+	defer stop()
 
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token", "Cookie"},
-		AllowCredentials: true,
-	}))
+	// Spans are exported if OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Init(ctx, tracing.Config{
+		ServiceName:    auth.AuthServiceName,
+		ServiceVersion: version,
+	})
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to init tracing")
+	}
 
-	defaultConfig := config.LoadDefaultConfig()
+	db, err := ConnectToDB(ctx, cfg.Database)
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to connect to the database")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to get the database connection")
+	}
+	if cfg.Database.AutoMigrate {
+		if err = migrateUp(ctx, sqlDB); err != nil {
+			logging.Logger.WithError(err).Fatal("Failed to migrate the database")
+		}
+	}
 
-	db := ConnectToDB(defaultConfig)
+	var locator binding.Locator
+	if cfg.Session.Binding.GeoIPDatabase != "" {
+		geoIP, err := binding.OpenGeoIP(cfg.Session.Binding.GeoIPDatabase)
+		if err != nil {
+			logging.Logger.WithError(err).Fatal("Failed to open the GeoIP database")
+		}
+		defer geoIP.Close()
+		locator = geoIP
+	}
+	services, err := newApp(newRepositories(db), cfg, locator)
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to create the services")
+	}
+	sessionRepo := services.sessionRepo
+	revocationService := services.revocationService
 
-	authRepo := repository.NewAuthRepository(db)
-	sessionRepo := repository.NewSessionRepository(db)
+	err = metrics.RegisterActiveSessions(func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		count, err := sessionRepo.CountActive(ctx)
+		if err != nil {
+			logging.Logger.Warn("Failed to count active sessions: ", err)
+		}
+		return float64(count)
+	})
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to register metrics")
+	}
+	serveMetrics(ctx, cfg.Server.MetricsAddr)
+
+	sched, err := newScheduler(scheduler.NewPostgresLocker(sqlDB), cfg.Jobs, services)
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to set up the jobs")
+	}
+	if cfg.Jobs.Enabled {
+		sched.Start(ctx)
+	}
+
+	r, err := newRouter(cfg, services, sched, nil)
+	if err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to set up the routes")
+	}
+
+	srv := server.New(server.Config{
+		Addr:            ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:         r,
+		ShutdownTimeout: cfg.Server.ShutdownTimeout,
+		DrainDelay:      cfg.Server.DrainDelay,
+	})
+	srv.Health().AddCheck("database", server.PingCheck(sqlDB))
+	if cfg.Mailer.Host != "" {
+		// Only notifications are e-mailed, an unreachable mailer only degrades the service
+		srv.Health().AddOptionalCheck("mailer", dialCheck(net.JoinHostPort(cfg.Mailer.Host, strconv.Itoa(cfg.Mailer.Port))))
+	}
+
+	// Revocation streams would keep the server from draining, subscribers resume on another instance
+	srv.OnDrain(func(context.Context) error {
+		revocationService.Close()
+		return nil
+	})
+	// Running jobs finish before the database is closed, or are cancelled at the shutdown timeout
+	srv.OnDrain(sched.Stop)
+	if deregister := registerService(srv.Health()); deregister != nil {
+		srv.OnDrain(deregister)
+	}
+	// Shutdown hooks run in reverse order: the database is closed before tracing is flushed
+	srv.OnShutdown(shutdownTracing)
+	srv.OnShutdown(func(context.Context) error {
+		return sqlDB.Close()
+	})
+
+	if err = srv.Run(ctx); err != nil {
+		logging.Logger.WithError(err).Error("Server stopped with an error")
+		return 1
+	}
+	return 0
+}
+
+// newRouter sets up the middlewares and the routes of the API. Tokens are checked with the
+// validator, DefaultValidator if nil.
+func newRouter(cfg *config.Config, services *app, sched *scheduler.Scheduler, validator *auth.Validator) (*gin.Engine, error) {
+	bundle, err := locales.NewBundle()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the message catalogs: %w", err)
+	}
+	spec, err := openapi.Load(docs.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
 
-	sessionService := service.NewSessionService(sessionRepo)
-	tokenService := service.NewTokenService()
-	authService := service.NewAuthService(authRepo, sessionService, tokenService)
+	r := gin.Default()
+	// CORS comes before the validation and the problems, so browsers let the frontend read them
+	r.Use(tracing.GinMiddleware(auth.AuthServiceName), logging.ContextLogger(), metrics.GinMiddleware(), i18n.Middleware(bundle),
+		cfg.CORS.Policy().Middleware(), openapi.Middleware(spec, openapi.Config{Responses: cfg.Server.ValidateResponses}), apierror.Middleware())
+	r.NoRoute(apierror.NoRoute)
 
-	authAPI := api.NewAuthAPI(authService, sessionService, tokenService)
+	// Only "remember me" sessions get a persistent cookie, it lives as long as they can
+	cookiePolicy := cfg.Cookie.Policy(cfg.Session.Policy().Long.MaxLifetime())
+	// The token cookie shares the attributes of the session cookie, under its own name
+	csrfCookie := cookiePolicy
+	csrfCookie.Name = auth.DefaultCSRFCookieName
+	csrf, err := auth.NewCSRF(auth.CSRFConfig{
+		Secret:         csrfSecret(cfg.CSRF.Secret),
+		TTL:            cfg.CSRF.TTL,
+		Cookie:         csrfCookie,
+		TrustedOrigins: cfg.CORS.AllowedOrigins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up CSRF protection: %w", err)
+	}
+	tokens := auth.NewTokenMiddleware(auth.MiddlewareConfig{Extractors: cookiePolicy.Extractors(), Validator: validator})
+	authAPI := api.NewAuthAPI(services.authService, services.sessionService, services.tokenService, services.revocationService, cookiePolicy)
 
 	public := r.Group("/")
 	authAPI.RegisterPublicRoutes(public)
+	if cfg.Docs.Enabled {
+		apiDocs, err := openapi.NewDocs(spec, openapi.DocsConfig{})
+		if err != nil {
+			return nil, err
+		}
+		if !apiDocs.Bundled() {
+			logging.Logger.Warn("Swagger UI and Redoc are not bundled, the documentation pages link to the document")
+		}
+		apiDocs.RegisterRoutes(public)
+	}
 
 	unAuth := r.Group("/")
-	unAuth.Use(auth.NoAuthMiddleware())
+	unAuth.Use(auth.NoAuthMiddleware(cookiePolicy.Extractors()...), csrf.Middleware())
 	authAPI.RegisterPublicOnlyRoutes(unAuth)
 
+	// Sessions requiring re-authentication are rejected by the token middleware, the route takes
+	// the token itself. Without a principal the CSRF check is down to the origin.
+	reauth := r.Group("/")
+	reauth.Use(csrf.Middleware())
+	authAPI.RegisterReauthRoutes(reauth)
+
 	private := r.Group("/")
-	private.Use(auth.CookieTokenMiddleware())
+	private.Use(tokens, csrf.Middleware())
 	authAPI.RegisterPrivateRoutes(private)
+	private.GET("/csrf", csrf.TokenHandler())
 
-	err := r.Run(":8080")
+	if services.passkeyService != nil {
+		passkeyAPI := api.NewPasskeyAPI(services.passkeyService, cookiePolicy, cfg.Passkeys.RecentAuth)
+		passkeyAPI.RegisterPublicOnlyRoutes(unAuth)
+		passkeyAPI.RegisterPrivateRoutes(private)
+	}
 
+	diagnosticsAPI := diagnostics.New(diagnostics.Config{
+		Version: version,
+		Commit:  commit,
+		// Redacted like config print, so both agree on what a secret is
+		Config: func() (interface{}, error) { return cfg.Redacted(), nil },
+	})
+	admin := r.Group("/admin/diagnostics")
+	admin.Use(tokens, csrf.Middleware(), auth.RequireRole(auth.RoleAdmin))
+	diagnosticsAPI.RegisterRoutes(admin)
+
+	adminSessions := r.Group("/admin/sessions")
+	adminSessions.Use(tokens, csrf.Middleware(), auth.RequireRole(auth.RoleAdmin))
+	authAPI.RegisterAdminRoutes(adminSessions)
+
+	adminJobs := r.Group("/admin/jobs")
+	adminJobs.Use(tokens, csrf.Middleware(), auth.RequireRole(auth.RoleAdmin))
+	sched.RegisterRoutes(adminJobs)
+	return r, nil
+}
+
+// ConnectToDB opens the database, retrying with backoff while it is not reachable yet,
+// so the service survives starting before Postgres
+func ConnectToDB(ctx context.Context, config config.DatabaseConfig) (*gorm.DB, error) {
+	var db *gorm.DB
+	err := server.Retry(ctx, "Connecting to the database", server.DefaultBackoff(), func(ctx context.Context) error {
+		var err error
+		// The columns have no time zone, gorm fills created_at and updated_at in UTC like the repositories
+		db, err = gorm.Open(postgres.Open(config.DSN()), &gorm.Config{NowFunc: func() time.Time { return time.Now().UTC() }})
+		return err
+	})
 	if err != nil {
-		return
+		return nil, err
+	}
+	if err = db.Use(metrics.GORMPlugin{}); err != nil {
+		return nil, err
 	}
-}
 
-func ConnectToDB(config *config.Config) *gorm.DB {
-	dsn := "host=" + config.Database.Host + " user=" + config.Database.User +
-		" password=" + config.Database.Password +
-		" dbname=" + config.Database.Name +
-		" port=" + strconv.Itoa(config.Database.Port) +
-		" sslmode=disable TimeZone=Asia/Aqtobe"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 
+	return db, nil
+}
+
+// newScheduler sets up the maintenance jobs. Replicas elect the one running a tick with the
+// locker and share the run history in the database.
+func newScheduler(locker scheduler.Locker, cfg config.JobsConfig, a *app) (*scheduler.Scheduler, error) {
+	location, err := time.LoadLocation(cfg.TimeZone)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	sched := scheduler.New(scheduler.Config{
+		Locker:   locker,
+		History:  a.jobRuns,
+		Location: location,
+	})
+	err = jobs.Register(sched, cfg, jobs.Services{
+		Auth:     a.authService,
+		Sessions: a.sessionService,
+		Tokens:   a.tokenService,
+		Runs:     a.jobRuns,
+	})
+	return sched, err
+}
+
+// csrfSecret returns the configured secret, or a random one that only this process knows
+func csrfSecret(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	logging.Logger.Warn("No CSRF secret configured, generating one. Tokens will not survive restarts or work across replicas.")
+	random := make([]byte, auth.MinCSRFSecretLength)
+	if _, err := rand.Read(random); err != nil {
+		logging.Logger.WithError(err).Fatal("Failed to generate a CSRF secret")
+	}
+	return random
+}
+
+// dialCheck checks that a TCP server accepts connections
+func dialCheck(address string) server.Check {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// serveMetrics exposes the metrics on their own address, apart from the public API.
+// The metrics server stops with the context.
+func serveMetrics(ctx context.Context, addr string) {
+	go func() {
+		if err := metrics.Serve(ctx, addr); err != nil {
+			logging.Logger.Error("Metrics server failed: ", err)
+		}
+	}()
+}
+
+// registerService announces the service in the service registry, if one is configured with DISCOVERY_URL.
+// Other services fall back to the static docker-compose address otherwise.
+// Heartbeats report the readiness of the service. The returned hook deregisters the instance, it is nil
+// if there is no registry.
+func registerService(health *server.Health) server.Hook {
+	registryURL := os.Getenv("DISCOVERY_URL")
+	if registryURL == "" {
+		return nil
 	}
 
-	return db
+	address := os.Getenv("SERVICE_ADDRESS")
+	if address == "" {
+		address = "http://auth:8080"
+	}
+
+	registrar := discovery.NewRegistrar(discovery.RegistrarConfig{
+		RegistryURL: registryURL,
+		Instance: discovery.Instance{
+			Name:    auth.AuthServiceName,
+			Address: address,
+			Version: version,
+		},
+		Health: func() string {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			switch health.Check(ctx).Status {
+			case server.StatusOK:
+				return discovery.StatusPassing
+			case server.StatusDegraded:
+				return discovery.StatusWarning
+			default:
+				return discovery.StatusCritical
+			}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registrar.Start(ctx)
+	return func(ctx context.Context) error {
+		cancel()
+		return registrar.Stop(ctx)
+	}
 }
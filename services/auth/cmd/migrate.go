@@ -0,0 +1,108 @@
+package main
+
+import (
+	"auth/migrations"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/server"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `Usage: auth migrate <command> [flags]
+
+Commands:
+  up      apply every pending migration
+  down    roll back the latest migration
+  status  list the migrations and whether they are applied
+  redo    roll back the latest migration and apply it again
+
+Flags are the configuration flags of the service, e.g. --config or --database.host.`
+
+// runMigrate runs a migrate command and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+	switch command {
+	case "up", "down", "status", "redo":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n%s\n", command, migrateUsage)
+		return 2
+	}
+
+	cfg, code := loadConfig(newFlagSet("migrate", "migrate "+command+" [flags]"), args[1:], true)
+	if cfg == nil {
+		return code
+	}
+	defer logging.Close()
+
+	ctx, stop := server.SignalContext(context.Background())
+	defer stop()
+
+	db, err := ConnectToDB(ctx, cfg.Database)
+	if err != nil {
+		logging.Logger.WithError(err).Error("Failed to connect to the database")
+		return 1
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		logging.Logger.WithError(err).Error("Failed to get the database connection")
+		return 1
+	}
+	defer sqlDB.Close()
+
+	migrator, err := migrations.NewMigrator(sqlDB)
+	if err != nil {
+		logging.Logger.WithError(err).Error("Failed to load the migrations")
+		return 1
+	}
+
+	switch command {
+	case "up":
+		_, err = migrator.Up(ctx)
+	case "down":
+		_, err = migrator.Down(ctx)
+	case "redo":
+		_, err = migrator.Redo(ctx)
+	case "status":
+		err = printStatus(ctx, migrator)
+	}
+	if err != nil {
+		logging.Logger.WithError(err).Errorf("Migrate %s failed", command)
+		return 1
+	}
+	return 0
+}
+
+func printStatus(ctx context.Context, migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tMIGRATION\tSTATE\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if !status.AppliedAt.IsZero() {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.Source.Path, status.State, appliedAt)
+	}
+	return w.Flush()
+}
+
+// migrateUp applies the pending migrations at startup
+func migrateUp(ctx context.Context, db *sql.DB) error {
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx)
+	return err
+}
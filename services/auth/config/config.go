@@ -1,56 +1,650 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables, e.g. AUTH_DATABASE_HOST for database.host.
+// Appending _FILE to a variable reads the value from that file, e.g. AUTH_DATABASE_PASSWORD_FILE
+// for Docker secrets.
+const EnvPrefix = "AUTH"
+
+// ConfigFileEnv names the YAML config file if the --config flag is not given
+const ConfigFileEnv = EnvPrefix + "_CONFIG_FILE"
+
+// legacyEnv are variable names used before the configuration was layered, they are still honoured
+var legacyEnv = map[string]string{
+	"logging.level":       "LOG_LEVEL",
+	"server.metrics_addr": "METRICS_ADDR",
+}
 
 // Config is the configuration for the service
 type Config struct {
+	Server   ServerConfig   `mapstructure:"server"`
+	Database DatabaseConfig `mapstructure:"database"`
+	Session  SessionConfig  `mapstructure:"session"`
+	Cookie   CookieConfig   `mapstructure:"cookie"`
+	CORS     CORSConfig     `mapstructure:"cors"`
+	CSRF     CSRFConfig     `mapstructure:"csrf"`
+	Passkeys PasskeysConfig `mapstructure:"passkeys"`
+	Mailer   MailerConfig   `mapstructure:"mailer"`
+	Logging  LoggingConfig  `mapstructure:"logging"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Docs     DocsConfig     `mapstructure:"docs"`
+}
+
+// ServerConfig is the configuration of the HTTP server
+type ServerConfig struct {
 	// Port is the port the service will listen on
-	Port int
-	// Database is the database configuration
-	Database DatabaseConfig
+	Port int `mapstructure:"port"`
+	// MetricsAddr is the address of the metrics server, apart from the public API
+	MetricsAddr string `mapstructure:"metrics_addr"`
+	// ShutdownTimeout is how long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// DrainDelay keeps serving with failing readiness before shutting down
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// ValidateResponses checks the responses against docs/openapi.yaml and replaces the ones not
+	// matching it with an internal error. Responses are buffered, so it is meant for testing.
+	ValidateResponses bool `mapstructure:"validate_responses"`
 }
 
 // DatabaseConfig is the configuration for the database
 type DatabaseConfig struct {
 	// Host is the database host
-	Host string
+	Host string `mapstructure:"host"`
 	// Port is the database port
-	Port int
+	Port int `mapstructure:"port"`
 	// User is the database user
-	User string
+	User string `mapstructure:"user"`
 	// Password is the database password
-	Password string
+	Password string `mapstructure:"password"`
 	// Name is the database name
-	Name string
+	Name string `mapstructure:"name"`
+	// SSLMode is the libpq sslmode: disable, allow, prefer, require, verify-ca or verify-full
+	SSLMode string `mapstructure:"ssl_mode"`
+	// SSLRootCert is the CA certificate file used by verify-ca and verify-full
+	SSLRootCert string `mapstructure:"ssl_root_cert"`
+	// TimeZone is the time zone of the database session
+	TimeZone string `mapstructure:"timezone"`
+	// MaxOpenConns limits open connections, 0 means unlimited
+	MaxOpenConns int `mapstructure:"max_open_conns"`
+	// MaxIdleConns is the number of idle connections kept in the pool
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// ConnMaxLifetime closes connections older than this, 0 keeps them
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// ConnMaxIdleTime closes connections idle for longer than this, 0 keeps them
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// AutoMigrate applies pending migrations at startup, replicas take turns under an advisory lock
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+}
+
+// SessionConfig is the configuration of user sessions
+type SessionConfig struct {
+	// Short is the policy of sessions created without "remember me"
+	Short SessionPolicyConfig `mapstructure:"short"`
+	// Long is the policy of "remember me" sessions
+	Long SessionPolicyConfig `mapstructure:"long"`
+	// LastUsedInterval throttles writes of the last use of a session to one per interval
+	LastUsedInterval time.Duration `mapstructure:"last_used_interval"`
+	// Binding ties sessions to the client that created them
+	Binding BindingConfig `mapstructure:"binding"`
+}
+
+// BindingConfig is the configuration of binding sessions to clients. The actions for a session
+// used with an anomaly are allow, flag, require_reauth or revoke.
+type BindingConfig struct {
+	// IPv4Prefix is the number of bits of an IPv4 address a session is bound to
+	IPv4Prefix int `mapstructure:"ipv4_prefix"`
+	// IPv6Prefix is the number of bits of an IPv6 address a session is bound to
+	IPv6Prefix int `mapstructure:"ipv6_prefix"`
+	// IPChanged is the action for a session used from another network
+	IPChanged string `mapstructure:"ip_changed"`
+	// UserAgentChanged is the action for a session used from another browser or operating system
+	UserAgentChanged string `mapstructure:"user_agent_changed"`
+	// DeviceChanged is the action for a session used with another device fingerprint
+	DeviceChanged string `mapstructure:"device_changed"`
+	// ImpossibleTravel is the action for a session used too far away for the time since its last use
+	ImpossibleTravel string `mapstructure:"impossible_travel"`
+	// MaxTravelSpeed is the fastest plausible travel in km/h
+	MaxTravelSpeed float64 `mapstructure:"max_travel_speed"`
+	// MinTravelDistance ignores moves shorter than this in km
+	MinTravelDistance float64 `mapstructure:"min_travel_distance"`
+	// GeoIPDatabase is a MaxMind City or Country database file, locations are unknown if empty
+	GeoIPDatabase string `mapstructure:"geoip_database"`
+	// NotifyNewDevices e-mails users when their account is logged into from a new device
+	NotifyNewDevices bool `mapstructure:"notify_new_devices"`
+}
+
+// SessionPolicyConfig is how long a session lives
+type SessionPolicyConfig struct {
+	// Lifetime is how long a session is valid after it is created or renewed
+	Lifetime time.Duration `mapstructure:"lifetime"`
+	// AbsoluteLifetime caps a session from its creation however often it is renewed, 0 for lifetime
+	AbsoluteLifetime time.Duration `mapstructure:"absolute_lifetime"`
+	// IdleTimeout ends a session unused for this long, 0 disables it
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// RenewWindow extends a session used with less than this left, 0 disables sliding renewal
+	RenewWindow time.Duration `mapstructure:"renew_window"`
+}
+
+// CookieConfig is the configuration of the session cookie
+type CookieConfig struct {
+	// Name is the cookie name, a "__Host-" prefix requires Secure, path "/" and no domain
+	Name string `mapstructure:"name"`
+	// Domain is the cookie domain, empty for the host only
+	Domain string `mapstructure:"domain"`
+	// Path is the cookie path
+	Path string `mapstructure:"path"`
+	// Secure sends the cookie over HTTPS only
+	Secure bool `mapstructure:"secure"`
+	// SameSite is lax, strict or none
+	SameSite string `mapstructure:"same_site"`
+}
+
+// CORSConfig is the configuration of cross-origin requests
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the API, e.g. "https://example.com"
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowCredentials allows cookies on cross-origin requests, it cannot be combined with the origin "*"
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge is how long browsers cache a preflight response
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// CSRFConfig is the configuration of the CSRF protection
+type CSRFConfig struct {
+	// Secret signs the CSRF tokens, every service behind the session cookie needs the same one.
+	// A random secret is generated at startup if empty, then tokens do not survive restarts.
+	Secret string `mapstructure:"secret"`
+	// TTL is how long a token is accepted
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// PasskeysConfig is the configuration of passkeys (WebAuthn)
+type PasskeysConfig struct {
+	// RPID is the domain passkeys are scoped to, e.g. example.com, passkeys are disabled if empty
+	RPID string `mapstructure:"rp_id"`
+	// RPDisplayName is the name of the service shown by authenticators
+	RPDisplayName string `mapstructure:"rp_display_name"`
+	// RPOrigins are the origins of the pages running the ceremonies, e.g. https://example.com
+	RPOrigins []string `mapstructure:"rp_origins"`
+	// ChallengeTTL is how long the browser has to answer a challenge
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl"`
+	// RecentAuth is how recently the user must have authenticated to add or delete a passkey
+	RecentAuth time.Duration `mapstructure:"recent_auth"`
+}
+
+// MailerConfig is the configuration of the SMTP server used for e-mails
+type MailerConfig struct {
+	// Host is the SMTP host, e-mails are not sent if empty
+	Host string `mapstructure:"host"`
+	// Port is the SMTP port
+	Port int `mapstructure:"port"`
+	// Username is the SMTP user
+	Username string `mapstructure:"username"`
+	// Password is the SMTP password
+	Password string `mapstructure:"password"`
+	// From is the sender address
+	From string `mapstructure:"from"`
+	// StartTLS upgrades the connection to TLS
+	StartTLS bool `mapstructure:"start_tls"`
+}
+
+// LoggingConfig is the configuration of the logger
+type LoggingConfig struct {
+	// Level is the default level
+	Level string `mapstructure:"level"`
+	// Format is json or text
+	Format string `mapstructure:"format"`
+	// Levels are levels per logger name, e.g. auth.repository: debug
+	Levels map[string]string `mapstructure:"levels"`
+	// Sinks are the outputs, stdout and ./logs/log.log if empty. They can only be set in the file.
+	Sinks []LogSinkConfig `mapstructure:"sinks"`
+	// Sampling limits repeated entries
+	Sampling LogSamplingConfig `mapstructure:"sampling"`
+}
+
+// LogSinkConfig is an output of the logger, the section of its type configures it
+type LogSinkConfig struct {
+	// Type is stdout, stderr, file, syslog or http
+	Type   string              `mapstructure:"type"`
+	File   LogFileSinkConfig   `mapstructure:"file"`
+	Syslog LogSyslogSinkConfig `mapstructure:"syslog"`
+	HTTP   LogHTTPSinkConfig   `mapstructure:"http"`
+}
+
+// LogFileSinkConfig is a log file rotated by size and, optionally, by time
+type LogFileSinkConfig struct {
+	Path string `mapstructure:"path"`
+	// MaxSizeMB is the size at which the file is rotated, 100 if zero
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxBackups is the number of rotated files kept, all if zero
+	MaxBackups int `mapstructure:"max_backups"`
+	// MaxAgeDays is the age after which rotated files are removed, never if zero
+	MaxAgeDays int `mapstructure:"max_age_days"`
+	// Compress gzips rotated files
+	Compress bool `mapstructure:"compress"`
+	// RotateEvery rotates the file periodically in addition to the size limit, e.g. 24h
+	RotateEvery time.Duration `mapstructure:"rotate_every"`
+}
+
+// LogSyslogSinkConfig is a syslog output, the local syslog if the address is empty
+type LogSyslogSinkConfig struct {
+	// Network is udp, tcp or unix
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	Tag     string `mapstructure:"tag"`
+}
+
+// LogHTTPSinkConfig is a collector receiving the entries as newline delimited JSON
+type LogHTTPSinkConfig struct {
+	URL string `mapstructure:"url"`
+	// BatchSize is the number of entries sent in one request, 100 if zero
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval is the longest time an entry waits to be sent, 1s if zero
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// BufferSize is the number of entries kept while the collector is slow, 10000 if zero
+	BufferSize int `mapstructure:"buffer_size"`
+}
+
+// LogSamplingConfig limits repeated entries: in every tick the first entries with the same level
+// and message are logged, and after that only every thereafter-th one
+type LogSamplingConfig struct {
+	// Enabled samples the entries, audit entries are never sampled
+	Enabled bool `mapstructure:"enabled"`
+	// Level is the most severe level that is sampled
+	Level      string        `mapstructure:"level"`
+	Tick       time.Duration `mapstructure:"tick"`
+	First      int           `mapstructure:"first"`
+	Thereafter int           `mapstructure:"thereafter"`
+}
+
+// LogConfig returns the configuration of the logger named name
+func (c LoggingConfig) LogConfig(name string) logging.LogConfig {
+	config := logging.LogConfig{
+		Format:     c.Format,
+		Level:      c.Level,
+		Levels:     c.Levels,
+		LoggerName: name,
+	}
+	for _, sink := range c.Sinks {
+		config.Sinks = append(config.Sinks, logging.SinkConfig{
+			Type: sink.Type,
+			File: logging.FileSinkConfig{
+				Path:        sink.File.Path,
+				MaxSizeMB:   sink.File.MaxSizeMB,
+				MaxBackups:  sink.File.MaxBackups,
+				MaxAgeDays:  sink.File.MaxAgeDays,
+				Compress:    sink.File.Compress,
+				RotateEvery: sink.File.RotateEvery,
+			},
+			Syslog: logging.SyslogSinkConfig{Network: sink.Syslog.Network, Address: sink.Syslog.Address, Tag: sink.Syslog.Tag},
+			HTTP: logging.HTTPSinkConfig{
+				URL:           sink.HTTP.URL,
+				BatchSize:     sink.HTTP.BatchSize,
+				FlushInterval: sink.HTTP.FlushInterval,
+				BufferSize:    sink.HTTP.BufferSize,
+			},
+		})
+	}
+	if c.Sampling.Enabled {
+		config.Sampling = &logging.SamplingConfig{
+			Level:      c.Sampling.Level,
+			Tick:       c.Sampling.Tick,
+			First:      c.Sampling.First,
+			Thereafter: c.Sampling.Thereafter,
+		}
+	}
+	return config
+}
+
+// JobsConfig is the configuration of the background jobs. Schedules are cron expressions with
+// five fields, descriptors such as "@hourly" or "@every 10m", an empty schedule disables the job.
+type JobsConfig struct {
+	// Enabled runs the jobs on their schedules, they can still be run through the admin API
+	Enabled bool `mapstructure:"enabled"`
+	// TimeZone is the time zone of the schedules
+	TimeZone string `mapstructure:"timezone"`
+	// ExpiredSessions deletes expired sessions
+	ExpiredSessions string `mapstructure:"expired_sessions"`
+	// IdleSessions deletes sessions unused for the idle timeout of their policy
+	IdleSessions string `mapstructure:"idle_sessions"`
+	// ExpiredTokens deletes expired one-time tokens
+	ExpiredTokens string `mapstructure:"expired_tokens"`
+	// DeletedAccounts deletes accounts pending deletion for longer than DeletionGracePeriod
+	DeletedAccounts string `mapstructure:"deleted_accounts"`
+	// JobHistory deletes job runs older than HistoryRetention
+	JobHistory string `mapstructure:"job_history"`
+	// DeletionGracePeriod is how long a deleted account can still be restored
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"`
+	// HistoryRetention is how long job runs are kept
+	HistoryRetention time.Duration `mapstructure:"history_retention"`
+}
+
+// DocsConfig is the configuration of the API documentation pages
+type DocsConfig struct {
+	// Enabled serves the OpenAPI document with Swagger UI at /docs and Redoc at /redoc
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// LoadDefaultConfig loads the default configuration.
+// There is no default database password, it must be configured.
+func LoadDefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            8080,
+			MetricsAddr:     ":9090",
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "db",
+			SSLMode:         "prefer",
+			TimeZone:        "UTC",
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: 10 * time.Minute,
+		},
+		Session: SessionConfig{
+			Short: SessionPolicyConfig{
+				Lifetime:         12 * time.Hour,
+				AbsoluteLifetime: 24 * time.Hour,
+				IdleTimeout:      2 * time.Hour,
+				RenewWindow:      6 * time.Hour,
+			},
+			Long: SessionPolicyConfig{
+				Lifetime:         30 * 24 * time.Hour,
+				AbsoluteLifetime: 365 * 24 * time.Hour,
+				IdleTimeout:      30 * 24 * time.Hour,
+				RenewWindow:      15 * 24 * time.Hour,
+			},
+			LastUsedInterval: time.Minute,
+			Binding: BindingConfig{
+				IPv4Prefix:        24,
+				IPv6Prefix:        48,
+				IPChanged:         "allow",
+				UserAgentChanged:  "flag",
+				DeviceChanged:     "flag",
+				ImpossibleTravel:  "flag",
+				MaxTravelSpeed:    1000,
+				MinTravelDistance: 300,
+				NotifyNewDevices:  true,
+			},
+		},
+		Cookie: CookieConfig{
+			Name:     "token",
+			Path:     "/",
+			Secure:   true,
+			SameSite: "lax",
+		},
+		CORS: CORSConfig{
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		},
+		CSRF: CSRFConfig{
+			TTL: 12 * time.Hour,
+		},
+		Passkeys: PasskeysConfig{
+			RPDisplayName: "GoMarketplace",
+			ChallengeTTL:  5 * time.Minute,
+			RecentAuth:    10 * time.Minute,
+		},
+		Mailer: MailerConfig{
+			Port:     587,
+			StartTLS: true,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+			Sampling: LogSamplingConfig{
+				Level:      "info",
+				Tick:       time.Second,
+				First:      100,
+				Thereafter: 100,
+			},
+		},
+		Jobs: JobsConfig{
+			Enabled:             true,
+			TimeZone:            "UTC",
+			ExpiredSessions:     "*/15 * * * *",
+			IdleSessions:        "0 * * * *",
+			ExpiredTokens:       "30 * * * *",
+			DeletedAccounts:     "0 3 * * *",
+			JobHistory:          "0 4 * * *",
+			DeletionGracePeriod: 30 * 24 * time.Hour,
+			HistoryRetention:    30 * 24 * time.Hour,
+		},
+		Docs: DocsConfig{
+			Enabled: true,
+		},
+	}
 }
 
-// LoadConfig loads the configuration from the given file
+// LoadConfig loads the configuration from the given file, environment variables still apply
 func LoadConfig(file string) (*Config, error) {
-	viper.SetConfigFile(file)
-	err := viper.ReadInConfig()
-	if err != nil {
+	return Load([]string{"--config", file})
+}
+
+// Load layers the configuration: defaults, then the YAML file given by --config or AUTH_CONFIG_FILE,
+// then environment variables, then flags such as --database.host. The result is validated.
+func Load(args []string) (*Config, error) {
+	return LoadWith(pflag.NewFlagSet("auth", pflag.ContinueOnError), args)
+}
+
+// LoadWith is Load parsing the arguments with flags, so commands can define their own flags
+// next to the configuration flags
+func LoadWith(flags *pflag.FlagSet, args []string) (*Config, error) {
+	defaults := LoadDefaultConfig()
+	v := viper.New()
+	keys := settingKeys("", reflect.TypeOf(*defaults))
+
+	configFile := flags.String("config", os.Getenv(ConfigFileEnv), "YAML configuration file")
+	for _, key := range keys {
+		if key.fileOnly {
+			continue
+		}
+		flags.String(key.name, "", "overrides "+key.name)
+	}
+	if err := flags.Parse(args); err != nil {
 		return nil, err
 	}
 
-	var config Config
-	err = viper.Unmarshal(&config)
-	if err != nil {
+	defaultValues := reflect.ValueOf(*defaults)
+	for _, key := range keys {
+		v.SetDefault(key.name, key.value(defaultValues).Interface())
+		if flag := flags.Lookup(key.name); flag != nil {
+			if err := v.BindPFlag(key.name, flag); err != nil {
+				return nil, err
+			}
+		}
+		envNames := []string{envName(key.name)}
+		if legacy, ok := legacyEnv[key.name]; ok {
+			envNames = append(envNames, legacy)
+		}
+		if err := v.BindEnv(append([]string{key.name}, envNames...)...); err != nil {
+			return nil, err
+		}
+	}
+
+	if *configFile != "" {
+		v.SetConfigFile(*configFile)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", *configFile, err)
+		}
+	}
+
+	if err := readSecretFiles(v, keys, flags); err != nil {
 		return nil, err
 	}
 
+	var config Config
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		flattenMapHook,
+	))
+	if err := v.UnmarshalExact(&config, decodeHook); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
-// LoadDefaultConfig loads the default configuration
-func LoadDefaultConfig() *Config {
-	return &Config{
-		Port: 8080,
-		Database: DatabaseConfig{
-			Host:     "db",
-			Port:     5432,
-			User:     "postgres",
-			Password: "postgres",
-			Name:     "db",
-		},
+// Redacted returns the configuration keyed like the YAML file, with passwords and secrets
+// replaced by logging.Redacted
+func (c *Config) Redacted() map[string]interface{} {
+	return redactedSection("", reflect.ValueOf(*c))
+}
+
+// redactedSection returns the values of a section keyed like the YAML file, prefix is the name
+// of the section
+func redactedSection(prefix string, values reflect.Value) map[string]interface{} {
+	settings := make(map[string]interface{})
+	for _, key := range settingKeys("", values.Type()) {
+		field := key.value(values)
+		value := field.Interface()
+		if key.fileOnly && key.kind == reflect.Slice {
+			sections := make([]interface{}, field.Len())
+			for i := range sections {
+				sections[i] = redactedSection(prefix+key.name+".", field.Index(i))
+			}
+			value = sections
+		}
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+		if isSecretKey(prefix+key.name) && value != "" {
+			value = logging.Redacted
+		}
+
+		section := settings
+		path := strings.Split(key.name, ".")
+		for _, name := range path[:len(path)-1] {
+			child, ok := section[name].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				section[name] = child
+			}
+			section = child
+		}
+		section[path[len(path)-1]] = value
+	}
+	return settings
+}
+
+func isSecretKey(key string) bool {
+	return strings.HasSuffix(key, ".password") || strings.HasSuffix(key, ".secret")
+}
+
+// readSecretFiles applies the _FILE variables, a flag given on the command line still wins
+func readSecretFiles(v *viper.Viper, keys []settingKey, flags *pflag.FlagSet) error {
+	var errs []error
+	for _, key := range keys {
+		fileEnv := envName(key.name) + "_FILE"
+		path, ok := os.LookupEnv(fileEnv)
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(envName(key.name)); set {
+			errs = append(errs, fmt.Errorf("%s: both %s and %s are set", key.name, envName(key.name), fileEnv))
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to read %s: %w", key.name, fileEnv, err))
+			continue
+		}
+		if flag := flags.Lookup(key.name); flag != nil && flag.Changed {
+			continue
+		}
+		v.Set(key.name, strings.TrimRight(string(data), "\r\n"))
+	}
+	return errors.Join(errs...)
+}
+
+// flattenMapHook undoes viper splitting map keys on dots, so logger names such as
+// "auth.repository" can be used as keys of logging.levels
+func flattenMapHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(map[string]string{}) {
+		return data, nil
+	}
+	nested, ok := data.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	flat := make(map[string]interface{})
+	flatten("", nested, flat)
+	return flat, nil
+}
+
+func flatten(prefix string, nested map[string]interface{}, flat map[string]interface{}) {
+	for key, value := range nested {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			flatten(key, child, flat)
+			continue
+		}
+		flat[key] = value
+	}
+}
+
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// settingKey is the dotted name of a configuration value and the path to its struct field
+type settingKey struct {
+	name  string
+	index []int
+	kind  reflect.Kind
+	// fileOnly values are maps and lists of sections, they can only be set in the file
+	fileOnly bool
+}
+
+func (k settingKey) value(v reflect.Value) reflect.Value {
+	return v.FieldByIndex(k.index)
+}
+
+// settingKeys lists the leaf values of the configuration, viper only reads variables of known keys
+func settingKeys(prefix string, t reflect.Type) []settingKey {
+	var keys []settingKey
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			for _, key := range settingKeys(name, field.Type) {
+				key.index = append([]int{i}, key.index...)
+				keys = append(keys, key)
+			}
+			continue
+		}
+		kind := field.Type.Kind()
+		fileOnly := kind == reflect.Map || kind == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct
+		keys = append(keys, settingKey{name: name, index: []int{i}, kind: kind, fileOnly: fileOnly})
 	}
+	return keys
 }
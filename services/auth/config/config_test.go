@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+)
+
+const testConfigFile = `
+server:
+  port: 8000
+database:
+  host: file-host
+  user: file-user
+  password: file-password
+  max_open_conns: 10
+session:
+  long:
+    lifetime: 720h
+cors:
+  allowed_origins:
+    - https://shop.example.com
+logging:
+  levels:
+    auth.repository: debug
+  sinks:
+    - type: stdout
+    - type: file
+      file:
+        path: /var/log/auth/auth.log
+        max_backups: 5
+        rotate_every: 24h
+  sampling:
+    enabled: true
+`
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfigFile(t, testConfigFile)
+	t.Setenv("AUTH_DATABASE_HOST", "env-host")
+	t.Setenv("AUTH_DATABASE_USER", "env-user")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	config, err := Load([]string{"--config", path, "--database.user", "flag-user"})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Defaults
+	if config.Database.Port != 5432 || config.Cookie.Name != "token" {
+		t.Errorf("Expected defaults to be kept, got %+v", config)
+	}
+	// File
+	if config.Server.Port != 8000 || config.Database.Password != "file-password" || config.Session.Long.Lifetime != 720*time.Hour {
+		t.Errorf("Expected values from the file, got %+v", config)
+	}
+	if len(config.CORS.AllowedOrigins) != 1 || config.Logging.Levels["auth.repository"] != "debug" {
+		t.Errorf("Expected lists and maps from the file, got %+v", config)
+	}
+	// Env over file, flag over env
+	if config.Database.Host != "env-host" || config.Database.User != "flag-user" {
+		t.Errorf("Expected env and flags to override, got %+v", config.Database)
+	}
+	if config.Logging.Level != "warn" {
+		t.Errorf("Expected the legacy LOG_LEVEL to be honoured, got %q", config.Logging.Level)
+	}
+
+	// The logger gets the sinks and the sampling from the file
+	logConfig := config.Logging.LogConfig("auth")
+	if len(logConfig.Sinks) != 2 || logConfig.Sinks[1].File.Path != "/var/log/auth/auth.log" || logConfig.Sinks[1].File.RotateEvery != 24*time.Hour {
+		t.Errorf("Expected the sinks from the file, got %+v", logConfig.Sinks)
+	}
+	if logConfig.Sampling == nil || logConfig.Sampling.First != 100 || logConfig.Sampling.Tick != time.Second {
+		t.Errorf("Expected sampling with the default limits, got %+v", logConfig.Sampling)
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("AUTH_DATABASE_PASSWORD_FILE", secret)
+
+	config, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Database.Password != "s3cret" {
+		t.Errorf("Expected the password from the file, got %q", config.Database.Password)
+	}
+
+	t.Setenv("AUTH_DATABASE_PASSWORD", "other")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "both") {
+		t.Errorf("Expected setting both variables to fail, got %v", err)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 70000
+database:
+  password: secret
+  ssl_mode: sometimes
+cookie:
+  same_site: none
+  secure: false
+cors:
+  allowed_origins: ["*"]
+session:
+  short:
+    lifetime: 1h
+    absolute_lifetime: 30m
+    renew_window: 2h
+  binding:
+    ipv6_prefix: 129
+    device_changed: block
+passkeys:
+  rp_id: example.com
+  rp_origins: ["http://example.com", "https://evil.test"]
+jobs:
+  timezone: Mars/Olympus
+  idle_sessions: "every hour"
+  expired_tokens: ""
+logging:
+  sinks:
+    - type: kafka
+    - type: file
+    - type: http
+      http:
+        url: collector:9000
+  sampling:
+    enabled: true
+    tick: 0s
+`)
+
+	_, err := Load([]string{"--config", path})
+	if err == nil {
+		t.Fatalf("Expected validation to fail")
+	}
+	for _, key := range []string{"server.port", "database.ssl_mode", "cookie: a SameSite=None cookie must be secure", "cors.allowed_origins", "session.short.absolute_lifetime", "session.short.renew_window", "session.binding.ipv6_prefix", "session.binding.device_changed", `passkeys.rp_origins: must be HTTPS origins such as https://example.com, got "http://example.com"`, `passkeys.rp_origins: "https://evil.test" is not within the domain example.com`, "jobs.timezone", "jobs.idle_sessions", "logging.sinks[0].type", "logging.sinks[1].file.path", "logging.sinks[2].http.url", "logging.sampling.tick"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected an error for %s, got %v", key, err)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := writeConfigFile(t, "database:\n  password: secret\n  hots: typo\n")
+
+	if _, err := Load([]string{"--config", path}); err == nil || !strings.Contains(err.Error(), "hots") {
+		t.Errorf("Expected the unknown key to be reported, got %v", err)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	database := LoadDefaultConfig().Database
+	database.Password = "it's secret"
+
+	expected := `host=localhost port=5432 user=postgres password='it\'s secret' dbname=db sslmode=prefer TimeZone=UTC`
+	if dsn := database.DSN(); dsn != expected {
+		t.Errorf("Expected %q, got %q", expected, dsn)
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	t.Setenv("AUTH_DATABASE_PASSWORD", "secret")
+
+	if _, err := Load([]string{"--config", "config.example.yaml"}); err != nil {
+		t.Errorf("Expected the example config to load, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	config := LoadDefaultConfig()
+	config.Database.Password = "s3cret"
+
+	settings := config.Redacted()
+	database := settings["database"].(map[string]interface{})
+	if database["password"] != logging.Redacted || database["host"] != "localhost" {
+		t.Errorf("Expected the password to be redacted and the host kept, got %v", database)
+	}
+	if csrf := settings["csrf"].(map[string]interface{}); csrf["secret"] != "" || csrf["ttl"] != "12h0m0s" {
+		t.Errorf("Expected an empty secret to stay empty and durations to be strings, got %v", csrf)
+	}
+
+	config.Logging.Sinks = []LogSinkConfig{{Type: "file", File: LogFileSinkConfig{Path: "auth.log", RotateEvery: time.Hour}}}
+	sinks := config.Redacted()["logging"].(map[string]interface{})["sinks"].([]interface{})
+	if file := sinks[0].(map[string]interface{})["file"].(map[string]interface{}); file["path"] != "auth.log" || file["rotate_every"] != "1h0m0s" {
+		t.Errorf("Expected the sinks keyed like the file, got %v", sinks)
+	}
+}
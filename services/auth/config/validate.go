@@ -0,0 +1,365 @@
+package config
+
+import (
+	"auth/internal/binding"
+	"auth/internal/notify"
+	"auth/internal/service"
+	"auth/pkg/auth"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate reports every invalid value at once, so a broken deployment is fixed in one go
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if !validPort(c.Server.Port) {
+		fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout", "must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		fail("server.drain_delay", "must not be negative")
+	}
+
+	db := c.Database
+	if db.Host == "" {
+		fail("database.host", "is required")
+	}
+	if db.User == "" {
+		fail("database.user", "is required")
+	}
+	if db.Name == "" {
+		fail("database.name", "is required")
+	}
+	if db.Password == "" {
+		fail("database.password", "is required, set %s or %s_FILE", envName("database.password"), envName("database.password"))
+	}
+	if !validPort(db.Port) {
+		fail("database.port", "must be between 1 and 65535, got %d", db.Port)
+	}
+	switch db.SSLMode {
+	case "disable", "allow", "prefer", "require":
+	case "verify-ca", "verify-full":
+		if db.SSLRootCert == "" {
+			fail("database.ssl_root_cert", "is required with ssl_mode %s", db.SSLMode)
+		}
+	default:
+		fail("database.ssl_mode", "must be disable, allow, prefer, require, verify-ca or verify-full, got %q", db.SSLMode)
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 {
+		fail("database.max_open_conns", "connection limits must not be negative")
+	} else if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		fail("database.max_idle_conns", "must not exceed max_open_conns (%d)", db.MaxOpenConns)
+	}
+	if db.ConnMaxLifetime < 0 || db.ConnMaxIdleTime < 0 {
+		fail("database.conn_max_lifetime", "connection lifetimes must not be negative")
+	}
+
+	for name, policy := range map[string]SessionPolicyConfig{"short": c.Session.Short, "long": c.Session.Long} {
+		key := "session." + name
+		if policy.Lifetime <= 0 {
+			fail(key+".lifetime", "must be positive")
+		}
+		if policy.AbsoluteLifetime != 0 && policy.AbsoluteLifetime < policy.Lifetime {
+			fail(key+".absolute_lifetime", "must not be shorter than the lifetime")
+		}
+		if policy.IdleTimeout < 0 {
+			fail(key+".idle_timeout", "must not be negative")
+		} else if policy.IdleTimeout > 0 && c.Session.LastUsedInterval >= policy.IdleTimeout {
+			fail(key+".idle_timeout", "must be longer than session.last_used_interval")
+		}
+		if policy.RenewWindow < 0 || policy.RenewWindow > policy.Lifetime {
+			fail(key+".renew_window", "must be between 0 and the lifetime")
+		}
+	}
+	if c.Session.LastUsedInterval < 0 {
+		fail("session.last_used_interval", "must not be negative")
+	}
+	bind := c.Session.Binding
+	if bind.IPv4Prefix < 1 || bind.IPv4Prefix > 32 {
+		fail("session.binding.ipv4_prefix", "must be between 1 and 32, got %d", bind.IPv4Prefix)
+	}
+	if bind.IPv6Prefix < 1 || bind.IPv6Prefix > 128 {
+		fail("session.binding.ipv6_prefix", "must be between 1 and 128, got %d", bind.IPv6Prefix)
+	}
+	for key, action := range bind.Actions() {
+		if _, err := binding.ParseAction(action); err != nil {
+			fail("session.binding."+key, "%v", err)
+		}
+	}
+	if bind.MaxTravelSpeed <= 0 {
+		fail("session.binding.max_travel_speed", "must be positive")
+	}
+	if bind.MinTravelDistance < 0 {
+		fail("session.binding.min_travel_distance", "must not be negative")
+	}
+
+	if _, err := auth.ParseSameSite(c.Cookie.SameSite); err != nil {
+		fail("cookie.same_site", "%v", err)
+	} else if err := c.Cookie.Policy(c.Session.Policy().Long.MaxLifetime()).Validate(); err != nil {
+		fail("cookie", "%v", err)
+	}
+	if err := c.CORS.Policy().Validate(); err != nil {
+		fail("cors.allowed_origins", "%v", err)
+	}
+
+	if c.CSRF.Secret != "" && len(c.CSRF.Secret) < auth.MinCSRFSecretLength {
+		fail("csrf.secret", "must be at least %d bytes", auth.MinCSRFSecretLength)
+	}
+	if c.CSRF.TTL <= 0 {
+		fail("csrf.ttl", "must be positive")
+	}
+
+	if c.Passkeys.Enabled() {
+		if c.Passkeys.RPDisplayName == "" {
+			fail("passkeys.rp_display_name", "is required when passkeys.rp_id is set")
+		}
+		if len(c.Passkeys.RPOrigins) == 0 {
+			fail("passkeys.rp_origins", "is required when passkeys.rp_id is set")
+		}
+		for _, origin := range c.Passkeys.RPOrigins {
+			parsed, err := url.Parse(origin)
+			if err != nil || (parsed.Scheme != "https" && parsed.Hostname() != "localhost") || parsed.Host == "" || parsed.Path != "" {
+				fail("passkeys.rp_origins", "must be HTTPS origins such as https://example.com, got %q", origin)
+				continue
+			}
+			if host := parsed.Hostname(); host != c.Passkeys.RPID && !strings.HasSuffix(host, "."+c.Passkeys.RPID) {
+				fail("passkeys.rp_origins", "%q is not within the domain %s", origin, c.Passkeys.RPID)
+			}
+		}
+		if c.Passkeys.ChallengeTTL <= 0 {
+			fail("passkeys.challenge_ttl", "must be positive")
+		}
+		if c.Passkeys.RecentAuth <= 0 {
+			fail("passkeys.recent_auth", "must be positive")
+		}
+	}
+
+	if c.Mailer.Host != "" {
+		if !validPort(c.Mailer.Port) {
+			fail("mailer.port", "must be between 1 and 65535, got %d", c.Mailer.Port)
+		}
+		if c.Mailer.From == "" {
+			fail("mailer.from", "is required when mailer.host is set")
+		}
+	}
+
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		fail("logging.level", "%v", err)
+	}
+	for name, level := range c.Logging.Levels {
+		if _, err := logrus.ParseLevel(level); err != nil {
+			fail("logging.levels."+name, "%v", err)
+		}
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		fail("logging.format", "must be json or text, got %q", c.Logging.Format)
+	}
+	for i, sink := range c.Logging.Sinks {
+		key := fmt.Sprintf("logging.sinks[%d]", i)
+		switch sink.Type {
+		case logging.SinkStdout, logging.SinkStderr, logging.SinkSyslog:
+		case logging.SinkFile:
+			if sink.File.Path == "" {
+				fail(key+".file.path", "is required for a file sink")
+			}
+		case logging.SinkHTTP:
+			if parsed, err := url.Parse(sink.HTTP.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				fail(key+".http.url", "must be an http(s) URL, got %q", sink.HTTP.URL)
+			}
+		default:
+			fail(key+".type", "must be stdout, stderr, file, syslog or http, got %q", sink.Type)
+		}
+	}
+	if sampling := c.Logging.Sampling; sampling.Enabled {
+		if _, err := logrus.ParseLevel(sampling.Level); err != nil {
+			fail("logging.sampling.level", "%v", err)
+		}
+		if sampling.Tick <= 0 {
+			fail("logging.sampling.tick", "must be positive")
+		}
+		if sampling.First < 0 || sampling.Thereafter < 0 {
+			fail("logging.sampling", "first and thereafter must not be negative")
+		}
+	}
+
+	if _, err := time.LoadLocation(c.Jobs.TimeZone); err != nil {
+		fail("jobs.timezone", "%v", err)
+	}
+	for key, schedule := range c.Jobs.Schedules() {
+		if schedule == "" {
+			continue
+		}
+		if _, err := scheduler.ParseSchedule(schedule); err != nil {
+			fail("jobs."+key, "%v", err)
+		}
+	}
+	if c.Jobs.DeletionGracePeriod < 0 {
+		fail("jobs.deletion_grace_period", "must not be negative")
+	}
+	if c.Jobs.HistoryRetention <= 0 {
+		fail("jobs.history_retention", "must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Schedules returns the schedules of the jobs keyed by their setting
+func (j JobsConfig) Schedules() map[string]string {
+	return map[string]string{
+		"expired_sessions": j.ExpiredSessions,
+		"idle_sessions":    j.IdleSessions,
+		"expired_tokens":   j.ExpiredTokens,
+		"deleted_accounts": j.DeletedAccounts,
+		"job_history":      j.JobHistory,
+	}
+}
+
+// Actions returns the actions of the anomalies keyed by their setting
+func (b BindingConfig) Actions() map[string]string {
+	return map[string]string{
+		"ip_changed":         b.IPChanged,
+		"user_agent_changed": b.UserAgentChanged,
+		"device_changed":     b.DeviceChanged,
+		"impossible_travel":  b.ImpossibleTravel,
+	}
+}
+
+// Config returns the configuration of the binder, an invalid action falls back to allow,
+// Validate reports it
+func (b BindingConfig) Config() binding.Config {
+	action := func(value string) binding.Action {
+		parsed, _ := binding.ParseAction(value)
+		return parsed
+	}
+	return binding.Config{
+		IPv4Prefix: b.IPv4Prefix,
+		IPv6Prefix: b.IPv6Prefix,
+		Policy: binding.Policy{
+			IPChanged:         action(b.IPChanged),
+			UserAgentChanged:  action(b.UserAgentChanged),
+			DeviceChanged:     action(b.DeviceChanged),
+			ImpossibleTravel:  action(b.ImpossibleTravel),
+			MaxTravelSpeed:    b.MaxTravelSpeed,
+			MinTravelDistance: b.MinTravelDistance,
+		},
+	}
+}
+
+// Enabled reports whether users can register and log in with passkeys
+func (c PasskeysConfig) Enabled() bool {
+	return c.RPID != ""
+}
+
+// Passkey returns the relying party passkeys are registered with
+func (c PasskeysConfig) Passkey() service.PasskeyConfig {
+	return service.PasskeyConfig{
+		RPID:          c.RPID,
+		RPDisplayName: c.RPDisplayName,
+		RPOrigins:     c.RPOrigins,
+		ChallengeTTL:  c.ChallengeTTL,
+	}
+}
+
+// Mail returns the SMTP server notifications are sent through
+func (c MailerConfig) Mail() notify.MailConfig {
+	return notify.MailConfig{
+		Host:     c.Host,
+		Port:     c.Port,
+		Username: c.Username,
+		Password: c.Password,
+		From:     c.From,
+		StartTLS: c.StartTLS,
+	}
+}
+
+// Policy returns the session policies, the binder is left to the caller since it needs the
+// GeoIP database
+func (c SessionConfig) Policy() service.SessionConfig {
+	return service.SessionConfig{
+		Short:            c.Short.policy(),
+		Long:             c.Long.policy(),
+		LastUsedInterval: c.LastUsedInterval,
+	}
+}
+
+func (p SessionPolicyConfig) policy() service.SessionPolicy {
+	return service.SessionPolicy{
+		Lifetime:         p.Lifetime,
+		AbsoluteLifetime: p.AbsoluteLifetime,
+		IdleTimeout:      p.IdleTimeout,
+		RenewWindow:      p.RenewWindow,
+	}
+}
+
+// Policy returns the cookie policy, the cookie lives as long as the session.
+// An invalid SameSite value falls back to lax, Validate reports it.
+func (c CookieConfig) Policy(sessionTTL time.Duration) auth.CookiePolicy {
+	sameSite, err := auth.ParseSameSite(c.SameSite)
+	if err != nil {
+		sameSite = http.SameSiteLaxMode
+	}
+	return auth.CookiePolicy{
+		Name:     c.Name,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		SameSite: sameSite,
+		MaxAge:   sessionTTL,
+	}
+}
+
+// Policy returns the CORS policy
+func (c CORSConfig) Policy() auth.CORSPolicy {
+	return auth.CORSPolicy{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// DSN returns the connection string of the database in the libpq key=value format
+func (d DatabaseConfig) DSN() string {
+	params := []string{
+		"host=" + quoteDSN(d.Host),
+		"port=" + strconv.Itoa(d.Port),
+		"user=" + quoteDSN(d.User),
+		"password=" + quoteDSN(d.Password),
+		"dbname=" + quoteDSN(d.Name),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+	if d.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(d.SSLRootCert))
+	}
+	if d.TimeZone != "" {
+		params = append(params, "TimeZone="+quoteDSN(d.TimeZone))
+	}
+	return strings.Join(params, " ")
+}
+
+// quoteDSN quotes values that are empty or contain spaces, quotes or backslashes
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
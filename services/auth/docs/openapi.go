@@ -0,0 +1,9 @@
+// Package docs embeds the OpenAPI document of the auth service
+package docs
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI document of the service in YAML
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
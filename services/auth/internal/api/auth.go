@@ -1,24 +1,37 @@
 package api
 
 import (
+	"auth/internal/binding"
 	"auth/internal/messages"
 	"auth/internal/service"
+	"auth/pkg/auth"
+	"auth/pkg/utils"
 	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// revocationHeartbeat is how often an idle revocation stream is kept alive
+const revocationHeartbeat = 15 * time.Second
+
 type AuthAPI struct {
-	authService    service.AuthService
-	sessionService service.SessionService
-	tokenService   service.TokenService
+	authService       service.AuthService
+	sessionService    service.SessionService
+	tokenService      service.TokenService
+	revocationService service.RevocationService
+	cookiePolicy      auth.CookiePolicy
 }
 
-func NewAuthAPI(authService service.AuthService, sessionService service.SessionService, tokenService service.TokenService) *AuthAPI {
-	return &AuthAPI{authService: authService, sessionService: sessionService, tokenService: tokenService}
+// NewAuthAPI creates the API, the session cookie is written according to cookiePolicy
+func NewAuthAPI(authService service.AuthService, sessionService service.SessionService, tokenService service.TokenService, revocationService service.RevocationService, cookiePolicy auth.CookiePolicy) *AuthAPI {
+	return &AuthAPI{authService: authService, sessionService: sessionService, tokenService: tokenService, revocationService: revocationService, cookiePolicy: cookiePolicy}
 }
 
 // RegisterPublicRoutes registers the public routes for the auth API
@@ -36,307 +49,291 @@ func (api *AuthAPI) RegisterPublicOnlyRoutes(router *gin.RouterGroup) {
 	router.POST("/change-password/:token", api.ChangePasswordWithToken)
 }
 
+// RegisterReauthRoutes registers the re-authentication route. It takes the token itself, the
+// token middleware rejects sessions requiring re-authentication.
+func (api *AuthAPI) RegisterReauthRoutes(router *gin.RouterGroup) {
+	router.POST("/reauth", api.Reauth)
+}
+
 // RegisterPrivateRoutes registers the private routes for the auth API
 // These routes require a token
 func (api *AuthAPI) RegisterPrivateRoutes(router *gin.RouterGroup) {
-	router.GET("/logout", api.Logout)
+	router.POST("/logout", api.Logout)
 	router.POST("/validate", api.ValidateToken)
-	//	Admin routes
-	router.DELETE("/admin/sessions/hard-delete", api.HardDeleteSessions)
-	router.DELETE("/admin/sessions/delete-inactive", api.DeleteInactiveSessions)
+	router.GET("/revocations", api.Revocations)
+	router.PUT("/language", api.SetLanguage)
+}
+
+// RegisterAdminRoutes registers the session maintenance routes under /admin/sessions,
+// the router must require the admin role
+func (api *AuthAPI) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.DELETE("/hard-delete", api.HardDeleteSessions)
+	router.DELETE("/delete-inactive", api.DeleteInactiveSessions)
 }
 
 func (api *AuthAPI) Login(c *gin.Context) {
-	// Parse the request
 	var req messages.AuthRequest
-	err := c.ShouldBindJSON(&req)
-	// Check if the request is valid
-	if err != nil {
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request",
-		})
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Authenticate the user
-	resp, err := api.authService.Login(&req)
-	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrInvalidCredentials) {
-		c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-			Code:    http.StatusUnauthorized,
-			Type:    "error",
-			Message: "Wrong email or password",
-		})
-		return
-	} else if err != nil {
-		logging.Logger.Error(err)
-		c.JSON(http.StatusInternalServerError, messages.ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Type:    "error",
-			Message: "Internal server error. Details: " + err.Error(),
-		})
+	resp, err := api.authService.Login(c.Request.Context(), &req, clientFromRequest(c))
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
+	setSessionCookie(c, api.cookiePolicy, resp)
+	c.JSON(http.StatusOK, resp)
+}
 
-	if resp != nil {
-		c.SetCookie("token", resp.Token, 31536000, "/", "", false, true)
-		c.JSON(http.StatusOK, resp)
-		return
+// clientFromRequest returns the client making the request
+func clientFromRequest(c *gin.Context) binding.Client {
+	return bindingClient(auth.ClientInfoFromRequest(c))
+}
+
+func bindingClient(info auth.ClientInfo) binding.Client {
+	return binding.Client{IP: info.IP, UserAgent: info.UserAgent, DeviceFingerprint: info.DeviceFingerprint}
+}
+
+// setSessionCookie writes the session cookie, only "remember me" sessions outlive the browser session
+func setSessionCookie(c *gin.Context, policy auth.CookiePolicy, resp *messages.AuthResponse) {
+	if !resp.RememberMe {
+		policy.MaxAge = 0
 	}
+	policy.Set(c, resp.Token)
+}
 
-	// Return an error if the user is not authenticated
-	c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-		Code:    401,
-		Type:    "error",
-		Message: "Wrong email or password",
-	})
+// Codes of the success messages, the catalogs translate them like the codes of errors
+const (
+	msgLoggedOut       = "AUTH_LOGGED_OUT"
+	msgPasswordRequest = "AUTH_PASSWORD_CHANGE_REQUESTED"
+	msgPasswordChanged = "AUTH_PASSWORD_CHANGED"
+	msgUserVerified    = "AUTH_USER_VERIFIED"
+	msgSessionsDeleted = "AUTH_SESSIONS_DELETED"
+	msgLanguageChanged = "AUTH_LANGUAGE_CHANGED"
+	msgPasskeyRenamed  = "AUTH_PASSKEY_RENAMED"
+	msgPasskeyDeleted  = "AUTH_PASSKEY_DELETED"
+)
+
+// MessageCodes are the codes of the success messages
+var MessageCodes = []string{msgLoggedOut, msgPasswordRequest, msgPasswordChanged, msgUserVerified, msgSessionsDeleted, msgLanguageChanged, msgPasskeyRenamed, msgPasskeyDeleted}
 
+// writeMessage writes a successful response without data, the message of the code is rendered
+// in the language of the request
+func writeMessage(c *gin.Context, code string, args i18n.Args) {
+	message := i18n.FromContext(c.Request.Context()).Text(code, args)
+	c.JSON(http.StatusOK, messages.ApiResponse{Code: http.StatusOK, Type: "success", Message: message})
 }
 
 func (api *AuthAPI) Register(c *gin.Context) {
 	var req messages.AuthRequest
-	err := c.ShouldBindJSON(&req)
-	// Check if the request is valid
-	if err != nil {
-		logging.Logger.Debug(err)
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request",
-		})
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Register the user
-	resp, err := api.authService.Register(&req)
-	if errors.Is(err, gorm.ErrDuplicatedKey) {
-		logging.Logger.Debug(err)
-		c.JSON(http.StatusConflict, messages.ApiResponse{
-			Code:    http.StatusConflict,
-			Type:    "error",
-			Message: "User with this email already registered",
-		})
-		return
-	} else if err != nil {
-		logging.Logger.Error(err)
-		c.JSON(http.StatusInternalServerError, messages.ApiResponse{
-			Code:    http.StatusInternalServerError,
-			Type:    "error",
-			Message: "Internal server error. Details: " + err.Error(),
-		})
+	resp, err := api.authService.Register(c.Request.Context(), &req, clientFromRequest(c))
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
+	setSessionCookie(c, api.cookiePolicy, resp)
+	c.JSON(http.StatusOK, resp)
+}
 
-	if resp != nil {
-		c.SetCookie("token", resp.Token, 31536000, "/", "", false, true)
-		c.JSON(http.StatusOK, resp)
+// Reauth confirms the password of the session's user, so operations requiring a recent
+// authentication are allowed and a session requiring re-authentication can be used again
+func (api *AuthAPI) Reauth(c *gin.Context) {
+	cred, ok := auth.ExtractCredential(c, api.cookiePolicy.Extractors())
+	if !ok {
+		_ = c.Error(auth.ErrTokenMissing)
+		return
+	}
+	var req messages.ReauthRequest
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	// Return an error if the user is already registered
-	c.JSON(http.StatusConflict, messages.ApiResponse{
-		Code:    http.StatusConflict,
-		Type:    "error",
-		Message: "User with this email already registered",
-	})
+	resp, err := api.authService.Reauthenticate(c.Request.Context(), cred.Token, &req, clientFromRequest(c))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (api *AuthAPI) Logout(c *gin.Context) {
-	token, _ := c.Get("token")
+	cred, _ := auth.GetCredential(c)
 	// Logout the user
-	_ = api.authService.Logout(token.(string))
+	_ = api.authService.Logout(c.Request.Context(), cred.Token)
 
-	c.SetCookie("token", "", -1, "/", "", false, true)
+	api.cookiePolicy.Clear(c)
 
-	c.JSON(http.StatusOK, messages.ApiResponse{
-		Code:    http.StatusOK,
-		Type:    "success",
-		Message: "Successfully logged out",
-	})
+	writeMessage(c, msgLoggedOut, nil)
 }
 
 func (api *AuthAPI) ChangePassword(c *gin.Context) {
 	var req messages.PasswordChangeRequest
-	err := c.ShouldBindJSON(&req)
-	// Check if the request is valid
-	if err != nil {
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request or email",
-		})
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Send an email with a token to the user
-	err = api.authService.ChangePassword(&req)
-	if err == nil {
-		domain := string([]rune(req.Email)[strings.Index(req.Email, "@")+1:])
-		c.JSON(http.StatusOK, messages.ApiResponse{
-			Code:    http.StatusOK,
-			Type:    "success",
-			Message: "Password change request sent successfully. Check your email for further instructions. Domain: " + domain,
-		})
+	if err := api.authService.ChangePassword(c.Request.Context(), &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
-
-	// Return an error if the email is invalid
-	c.JSON(http.StatusBadRequest, messages.ApiResponse{
-		Code:    http.StatusBadRequest,
-		Type:    "error",
-		Message: "Invalid request or email",
-	})
+	domain := string([]rune(req.Email)[strings.Index(req.Email, "@")+1:])
+	writeMessage(c, msgPasswordRequest, i18n.Args{"domain": domain})
 }
 
 func (api *AuthAPI) ChangePasswordWithToken(c *gin.Context) {
-	token := c.Param("token")
 	var req messages.PasswordChange
-	err := c.ShouldBindJSON(&req)
-	// Check if the request is valid
-	if err != nil || token == "" {
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request",
-		})
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Change the password
-	err = api.authService.ResetPassword(&req, token)
-	if err == nil {
-		c.JSON(http.StatusOK, messages.ApiResponse{
-			Code:    http.StatusOK,
-			Type:    "success",
-			Message: "Password changed successfully",
-		})
+	if err := api.authService.ResetPassword(c.Request.Context(), &req, c.Param("token")); err != nil {
+		_ = c.Error(err)
 		return
 	}
-
-	// Return an error if the token is invalid
-	c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-		Code:    http.StatusUnauthorized,
-		Type:    "error",
-		Message: "Invalid token",
-	})
+	writeMessage(c, msgPasswordChanged, nil)
 }
 
 func (api *AuthAPI) Verify(c *gin.Context) {
-	token := c.Param("token")
-	// Check if the token is valid
-	if token == "" {
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request",
-		})
-		return
-	}
-
 	// Verify the token
-	err := api.authService.VerifyUser(token)
-	if err == nil {
-		c.JSON(http.StatusOK, messages.ApiResponse{
-			Code:    http.StatusOK,
-			Type:    "success",
-			Message: "User verified successfully",
-		})
+	if err := api.authService.VerifyUser(c.Request.Context(), c.Param("token")); err != nil {
+		_ = c.Error(err)
 		return
 	}
-
-	// Return an error if the token is invalid
-	c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-		Code:    http.StatusUnauthorized,
-		Type:    "error",
-		Message: "Invalid token",
-	})
+	writeMessage(c, msgUserVerified, nil)
 }
 
 func (api *AuthAPI) HardDeleteSessions(c *gin.Context) {
-	// TODO: Add admin check
-	logging.Logger.Info("Starting delete all expired sessions...")
-	err := api.sessionService.HardDeleteSessions()
-	if err == nil {
-		c.JSON(http.StatusOK, messages.ApiResponse{
-			Code:    http.StatusOK,
-			Type:    "success",
-			Message: "Sessions deleted successfully",
-		})
+	logging.FromContext(c.Request.Context()).Info("Starting delete all expired sessions...")
+	count, err := api.sessionService.HardDeleteSessions(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
-
-	logging.Logger.Error(err)
-	c.JSON(http.StatusInternalServerError, messages.ApiResponse{
-		Code:    http.StatusInternalServerError,
-		Type:    "error",
-		Message: "Internal server error. Details: " + err.Error(),
-	})
+	writeMessage(c, msgSessionsDeleted, i18n.Args{"count": count})
 }
 
 func (api *AuthAPI) DeleteInactiveSessions(c *gin.Context) {
-	// TODO: Add admin check
-	logging.Logger.Info("Starting delete all inactive sessions...")
-
-	err := api.sessionService.DeleteInactiveSessions()
-
-	if err == nil {
-		c.JSON(http.StatusOK, messages.ApiResponse{
-			Code:    http.StatusOK,
-			Type:    "success",
-			Message: "Sessions deleted successfully",
-		})
+	logging.FromContext(c.Request.Context()).Info("Starting delete all inactive sessions...")
+	count, err := api.sessionService.DeleteInactiveSessions(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
+	writeMessage(c, msgSessionsDeleted, i18n.Args{"count": count})
+}
 
-	logging.Logger.Error(err)
+// SetLanguage sets the language the user is answered and e-mailed in, the response is already in it
+func (api *AuthAPI) SetLanguage(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	var req messages.LanguageRequest
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	c.JSON(http.StatusInternalServerError, messages.ApiResponse{
-		Code:    http.StatusInternalServerError,
-		Type:    "error",
-		Message: "Internal server error. Details: " + err.Error(),
-	})
+	if err := api.authService.SetLanguage(c.Request.Context(), userID, req.Language); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	i18n.Prefer(c, req.Language)
+	writeMessage(c, msgLanguageChanged, nil)
 }
 
 func (api *AuthAPI) ValidateToken(c *gin.Context) {
 	var req messages.TokenRequest
-	err := c.ShouldBindJSON(&req)
-	// Check if the request is valid
-	if err != nil {
-		c.JSON(http.StatusBadRequest, messages.ApiResponse{
-			Code:    http.StatusBadRequest,
-			Type:    "error",
-			Message: "Invalid request",
-		})
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	// Validate the token
-	userID, err := api.sessionService.GetUserID(req.Token)
+	// Validate the token, services that do not forward the client only get the session policy checked
+	var client *binding.Client
+	if req.Client != nil && *req.Client != (auth.ClientInfo{}) {
+		bound := bindingClient(*req.Client)
+		client = &bound
+	}
+	session, err := api.sessionService.GetSession(c.Request.Context(), req.Token, client)
 	if err != nil {
-		logging.Logger.Debug(err)
-		c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-			Code:    401,
-			Type:    "error",
-			Message: "Invalid token",
-		})
+		logging.FromContext(c.Request.Context()).Debug(err)
+		_ = c.Error(err)
 		return
 	}
 
-	logging.Logger.Debug(err)
-
-	resp, err := api.authService.GetUserData(userID)
-	if err == nil {
-		c.JSON(http.StatusOK, resp)
+	resp, err := api.authService.GetUserData(c.Request.Context(), session.UserID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		// The session outlived its user
+		_ = c.Error(service.ErrInvalidSession)
+		return
+	} else if err != nil {
+		_ = c.Error(err)
 		return
 	}
+	resp.SessionID = utils.HashToken(req.Token)
+	resp.AuthenticatedAt = session.AuthenticatedAt
+	resp.AuthLevel = session.AuthLevel
+	c.JSON(http.StatusOK, resp)
+}
 
-	logging.Logger.Error(err)
+// Revocations streams revoked sessions as server-sent events, so services caching
+// validation results can drop them. Reconnecting clients resume with the Last-Event-ID header.
+func (api *AuthAPI) Revocations(c *gin.Context) {
+	backlog, events, cancel := api.revocationService.Subscribe(c.GetHeader("Last-Event-ID"))
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Disable response buffering in nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	renderEvent := func(event service.RevocationEvent) {
+		c.Render(-1, sse.Event{
+			Id:    event.ID,
+			Event: event.Type,
+			Data:  event.Event,
+		})
+	}
 
-	// Return an error if the token is invalid
-	c.JSON(http.StatusUnauthorized, messages.ApiResponse{
-		Code:    http.StatusUnauthorized,
-		Type:    "error",
-		Message: "Invalid token",
+	for _, event := range backlog {
+		renderEvent(event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(revocationHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			renderEvent(event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
 	})
 }
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"auth/internal/messages"
+	"auth/internal/service"
+	"auth/pkg/auth"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type PasskeyAPI struct {
+	passkeyService service.PasskeyService
+	cookiePolicy   auth.CookiePolicy
+	recentAuth     time.Duration
+}
+
+// NewPasskeyAPI creates the API. Adding or deleting a passkey requires the user to have
+// authenticated within recentAuth.
+func NewPasskeyAPI(passkeyService service.PasskeyService, cookiePolicy auth.CookiePolicy, recentAuth time.Duration) *PasskeyAPI {
+	return &PasskeyAPI{passkeyService: passkeyService, cookiePolicy: cookiePolicy, recentAuth: recentAuth}
+}
+
+// RegisterPublicOnlyRoutes registers the passkey login and signup, they do not require a token
+func (api *PasskeyAPI) RegisterPublicOnlyRoutes(router *gin.RouterGroup) {
+	router.POST("/passkeys/login/begin", api.BeginLogin)
+	router.POST("/passkeys/login/finish", api.FinishLogin)
+	router.POST("/passkeys/signup/begin", api.BeginSignup)
+	router.POST("/passkeys/signup/finish", api.FinishSignup)
+}
+
+// RegisterPrivateRoutes registers the management of the user's passkeys, they require a token
+func (api *PasskeyAPI) RegisterPrivateRoutes(router *gin.RouterGroup) {
+	recentAuth := auth.RequireRecentAuth(api.recentAuth)
+	router.GET("/passkeys", api.List)
+	router.POST("/passkeys/register/begin", recentAuth, api.BeginRegistration)
+	router.POST("/passkeys/register/finish", api.FinishRegistration)
+	router.PATCH("/passkeys/:id", api.Rename)
+	router.DELETE("/passkeys/:id", recentAuth, api.Delete)
+}
+
+func (api *PasskeyAPI) BeginLogin(c *gin.Context) {
+	resp, err := api.passkeyService.BeginLogin(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *PasskeyAPI) FinishLogin(c *gin.Context) {
+	var req messages.PasskeyLogin
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	resp, err := api.passkeyService.FinishLogin(c.Request.Context(), &req, clientFromRequest(c))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setSessionCookie(c, api.cookiePolicy, resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *PasskeyAPI) BeginSignup(c *gin.Context) {
+	var req messages.PasskeySignupRequest
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	resp, err := api.passkeyService.BeginSignup(c.Request.Context(), &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *PasskeyAPI) FinishSignup(c *gin.Context) {
+	var req messages.PasskeyRegistration
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	resp, err := api.passkeyService.FinishSignup(c.Request.Context(), &req, clientFromRequest(c))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	setSessionCookie(c, api.cookiePolicy, resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *PasskeyAPI) List(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	passkeys, err := api.passkeyService.ListPasskeys(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, passkeys)
+}
+
+func (api *PasskeyAPI) BeginRegistration(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	resp, err := api.passkeyService.BeginRegistration(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *PasskeyAPI) FinishRegistration(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	var req messages.PasskeyRegistration
+	if err := apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	passkey, err := api.passkeyService.FinishRegistration(c.Request.Context(), userID, &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, passkey)
+}
+
+func (api *PasskeyAPI) Rename(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	id, err := passkeyID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	var req messages.PasskeyRename
+	if err = apierror.BindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err = api.passkeyService.RenamePasskey(c.Request.Context(), userID, id, req.Name); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	writeMessage(c, msgPasskeyRenamed, nil)
+}
+
+func (api *PasskeyAPI) Delete(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		_ = c.Error(auth.ErrAuthenticationRequired)
+		return
+	}
+	id, err := passkeyID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err = api.passkeyService.DeletePasskey(c.Request.Context(), userID, id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	writeMessage(c, msgPasskeyDeleted, nil)
+}
+
+// passkeyID returns the passkey ID of the path
+func passkeyID(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, apierror.ErrInvalidRequest.WithFields(apierror.FieldError{
+			Field:   "id",
+			Rule:    "numeric",
+			Message: "must be a number",
+		})
+	}
+	return id, nil
+}
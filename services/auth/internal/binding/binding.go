@@ -0,0 +1,164 @@
+package binding
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Anomalies found when a session is used
+const (
+	AnomalyIPChanged        = "ip_changed"
+	AnomalyUserAgentChanged = "user_agent_changed"
+	AnomalyDeviceChanged    = "device_changed"
+	AnomalyImpossibleTravel = "impossible_travel"
+)
+
+// Action is what happens to a session used with an anomaly, a stronger action wins
+type Action int
+
+const (
+	// ActionAllow ignores the anomaly
+	ActionAllow Action = iota
+	// ActionFlag records the anomaly on the session and audits it, the session stays valid
+	ActionFlag
+	// ActionReauth rejects the session until the user enters their password again
+	ActionReauth
+	// ActionRevoke ends the session
+	ActionRevoke
+)
+
+var actionNames = []string{"allow", "flag", "require_reauth", "revoke"}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// ParseAction parses allow, flag, require_reauth or revoke
+func ParseAction(value string) (Action, error) {
+	for i, name := range actionNames {
+		if strings.EqualFold(value, name) {
+			return Action(i), nil
+		}
+	}
+	return ActionAllow, fmt.Errorf("must be one of %s, got %q", strings.Join(actionNames, ", "), value)
+}
+
+// Policy decides the action for each anomaly
+type Policy struct {
+	IPChanged        Action
+	UserAgentChanged Action
+	DeviceChanged    Action
+	ImpossibleTravel Action
+	// MaxTravelSpeed is the fastest plausible travel in km/h, flights included
+	MaxTravelSpeed float64
+	// MinTravelDistance ignores moves shorter than this in km, GeoIP locations are approximate
+	MinTravelDistance float64
+}
+
+// Config is the configuration of a Binder
+type Config struct {
+	// IPv4Prefix and IPv6Prefix are the bits of an address a session is bound to
+	IPv4Prefix int
+	IPv6Prefix int
+	Policy     Policy
+}
+
+// Session is what the binder knows about a session
+type Session struct {
+	// Signals were recorded when the session was created
+	Signals Signals
+	// Location is where the session was last used, nil if unknown
+	Location *Location
+	// LastUsed is when the session was last used
+	LastUsed time.Time
+}
+
+// Evaluation is the outcome of checking a session against the client using it
+type Evaluation struct {
+	// Anomalies are sorted as found: network, browser, device, travel
+	Anomalies []string
+	// Action is the strongest action of the anomalies
+	Action Action
+	// Location is where the client is, nil if unknown
+	Location *Location
+}
+
+// Binder records the signals of new sessions and checks sessions in use against them
+type Binder struct {
+	config  Config
+	locator Locator
+}
+
+// NewBinder creates a binder, a nil locator disables locations and travel checks
+func NewBinder(config Config, locator Locator) *Binder {
+	return &Binder{config: config, locator: locator}
+}
+
+// Signals returns the signals of a client
+func (b *Binder) Signals(client Client) Signals {
+	return Signals{
+		IPPrefix:        IPPrefix(client.IP, b.config.IPv4Prefix, b.config.IPv6Prefix),
+		UserAgentFamily: UserAgentFamily(client.UserAgent),
+		DeviceHash:      DeviceHash(client.DeviceFingerprint),
+	}
+}
+
+// Locate returns the location of an address, nil if it is unknown
+func (b *Binder) Locate(ip string) *Location {
+	if b.locator == nil {
+		return nil
+	}
+	return b.locator.Locate(ip)
+}
+
+// Evaluate checks a session against the client using it now
+func (b *Binder) Evaluate(session Session, client Client, now time.Time) Evaluation {
+	policy := b.config.Policy
+	current := b.Signals(client)
+	evaluation := Evaluation{Location: b.Locate(client.IP)}
+	found := func(anomaly string, action Action) {
+		evaluation.Anomalies = append(evaluation.Anomalies, anomaly)
+		if action > evaluation.Action {
+			evaluation.Action = action
+		}
+	}
+
+	bound := session.Signals
+	if bound.IPPrefix != "" && current.IPPrefix != "" && bound.IPPrefix != current.IPPrefix {
+		found(AnomalyIPChanged, policy.IPChanged)
+	}
+	if bound.UserAgentFamily != "" && bound.UserAgentFamily != current.UserAgentFamily {
+		found(AnomalyUserAgentChanged, policy.UserAgentChanged)
+	}
+	// A client without the fingerprint of a session bound to one counts as another device
+	if bound.DeviceHash != "" && bound.DeviceHash != current.DeviceHash {
+		found(AnomalyDeviceChanged, policy.DeviceChanged)
+	}
+	if b.ImpossibleTravel(session.Location, session.LastUsed, evaluation.Location, now) {
+		found(AnomalyImpossibleTravel, policy.ImpossibleTravel)
+	}
+	return evaluation
+}
+
+// ImpossibleTravel reports whether getting from one location at a time to another by now
+// would take travelling faster than the policy allows. Unknown locations are never impossible,
+// nor is a time that is not before now, which says more about the clocks than the travel.
+func (b *Binder) ImpossibleTravel(from *Location, at time.Time, to *Location, now time.Time) bool {
+	if from == nil || to == nil {
+		return false
+	}
+	policy := b.config.Policy
+	distance := Distance(*from, *to)
+	if distance <= policy.MinTravelDistance {
+		return false
+	}
+	hours := now.Sub(at).Hours()
+	if hours <= 0 {
+		return false
+	}
+	return distance/hours > policy.MaxTravelSpeed
+}
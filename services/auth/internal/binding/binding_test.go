@@ -0,0 +1,118 @@
+package binding
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPPrefix(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.77":          "203.0.113.0/24",
+		"::ffff:203.0.113.77":   "203.0.113.0/24",
+		"2001:db8:1234:5678::1": "2001:db8:1234::/48",
+		"not an address":        "",
+		"":                      "",
+	}
+	for ip, expected := range cases {
+		if prefix := IPPrefix(ip, 24, 48); prefix != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, ip, prefix)
+		}
+	}
+}
+
+func TestUserAgentFamily(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36":                         "Chrome on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36 Edg/130.0.0.0":           "Edge on Windows",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0":                                                                  "Firefox on Linux",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Mobile Safari/537.36":                   "Chrome on Android",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"curl/8.5.0": "curl",
+		"":           "",
+	}
+	for userAgent, expected := range cases {
+		if family := UserAgentFamily(userAgent); family != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, userAgent, family)
+		}
+	}
+}
+
+type fakeLocator map[string]*Location
+
+func (f fakeLocator) Locate(ip string) *Location {
+	return f[ip]
+}
+
+var (
+	almaty = &Location{Country: "KZ", City: "Almaty", Latitude: 43.25, Longitude: 76.95}
+	moscow = &Location{Country: "RU", City: "Moscow", Latitude: 55.75, Longitude: 37.62}
+)
+
+func TestEvaluate(t *testing.T) {
+	binder := NewBinder(Config{
+		IPv4Prefix: 24,
+		IPv6Prefix: 48,
+		Policy: Policy{
+			IPChanged:         ActionAllow,
+			UserAgentChanged:  ActionFlag,
+			DeviceChanged:     ActionReauth,
+			ImpossibleTravel:  ActionRevoke,
+			MaxTravelSpeed:    1000,
+			MinTravelDistance: 300,
+		},
+	}, fakeLocator{"198.51.100.1": almaty, "203.0.113.1": moscow})
+
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	owner := Client{IP: "198.51.100.1", UserAgent: browser, DeviceFingerprint: "device"}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	session := Session{Signals: binder.Signals(owner), Location: almaty, LastUsed: now.Add(-time.Hour)}
+
+	cases := []struct {
+		name      string
+		client    Client
+		lastUsed  time.Duration
+		anomalies []string
+		action    Action
+	}{
+		{"same client", owner, time.Hour, nil, ActionAllow},
+		{"nearby network", Client{IP: "198.51.100.200", UserAgent: browser, DeviceFingerprint: "device"}, time.Hour, nil, ActionAllow},
+		{"other browser", Client{IP: "198.51.100.1", UserAgent: "curl/8.5.0", DeviceFingerprint: "device"}, time.Hour, []string{AnomalyUserAgentChanged}, ActionFlag},
+		{"no fingerprint", Client{IP: "198.51.100.1", UserAgent: browser}, time.Hour, []string{AnomalyDeviceChanged}, ActionReauth},
+		{"flight", Client{IP: "203.0.113.1", UserAgent: browser, DeviceFingerprint: "device"}, 5 * time.Hour, []string{AnomalyIPChanged}, ActionAllow},
+		{"impossible travel", Client{IP: "203.0.113.1", UserAgent: browser, DeviceFingerprint: "device"}, time.Hour, []string{AnomalyIPChanged, AnomalyImpossibleTravel}, ActionRevoke},
+		{"last use ahead of the clock", Client{IP: "203.0.113.1", UserAgent: browser, DeviceFingerprint: "device"}, -5 * time.Hour, []string{AnomalyIPChanged}, ActionAllow},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			session.LastUsed = now.Add(-tc.lastUsed)
+			evaluation := binder.Evaluate(session, tc.client, now)
+			if len(evaluation.Anomalies) != len(tc.anomalies) || evaluation.Action != tc.action {
+				t.Fatalf("Expected %v with %s, got %v with %s", tc.anomalies, tc.action, evaluation.Anomalies, evaluation.Action)
+			}
+			for i := range tc.anomalies {
+				if evaluation.Anomalies[i] != tc.anomalies[i] {
+					t.Errorf("Expected %v, got %v", tc.anomalies, evaluation.Anomalies)
+				}
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Almaty to Moscow is about 3100 km
+	if distance := Distance(*almaty, *moscow); distance < 3000 || distance > 3200 {
+		t.Errorf("Expected about 3100 km, got %.0f", distance)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, name := range []string{"allow", "flag", "require_reauth", "revoke"} {
+		action, err := ParseAction(name)
+		if err != nil || action.String() != name {
+			t.Errorf("Expected %s to parse, got %v, %v", name, action, err)
+		}
+	}
+	if _, err := ParseAction("ignore"); err == nil {
+		t.Errorf("Expected an unknown action to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package binding
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"math"
+	"net"
+)
+
+// earthRadius is the mean radius of the earth in kilometres
+const earthRadius = 6371.0
+
+// Location is where an address is, as precise as the GeoIP database
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// Locator finds the location of addresses
+type Locator interface {
+	// Locate returns the location of the address, nil if it is unknown
+	Locate(ip string) *Location
+}
+
+// geoRecord is the part of a GeoIP2 or GeoLite2 City record the service uses
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// GeoIP locates addresses with a local MaxMind DB file, e.g. GeoLite2-City.mmdb
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+// OpenGeoIP opens the database file, it is read into memory
+func OpenGeoIP(path string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+func (g *GeoIP) Locate(ip string) *Location {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	var record geoRecord
+	if err := g.reader.Lookup(addr, &record); err != nil {
+		return nil
+	}
+	if record.Location.Latitude == nil || record.Location.Longitude == nil {
+		return nil
+	}
+	return &Location{
+		Country:   record.Country.ISOCode,
+		City:      record.City.Names["en"],
+		Latitude:  *record.Location.Latitude,
+		Longitude: *record.Location.Longitude,
+	}
+}
+
+// Close closes the database
+func (g *GeoIP) Close() error {
+	return g.reader.Close()
+}
+
+// Distance returns the great-circle distance between two locations in kilometres
+func Distance(a, b Location) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,127 @@
+// Package binding ties sessions to the client that created them and spots sessions used
+// elsewhere: from another network, browser or device, or from a location too far away for
+// the time since the session was last used.
+package binding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+)
+
+// Client describes the client making a request
+type Client struct {
+	// IP is the address of the client
+	IP string
+	// UserAgent is the User-Agent header of the client
+	UserAgent string
+	// DeviceFingerprint is computed by the frontend and sent in the X-Device-Fingerprint header
+	DeviceFingerprint string
+}
+
+// Signals are what a session is bound to. Empty signals are unknown and never compared.
+type Signals struct {
+	// IPPrefix is the network of the client, e.g. "203.0.113.0/24"
+	IPPrefix string
+	// UserAgentFamily is the browser and operating system without versions, e.g. "Chrome on Windows"
+	UserAgentFamily string
+	// DeviceHash is the SHA-256 of the device fingerprint, the fingerprint itself is not stored
+	DeviceHash string
+}
+
+// DeviceKey identifies the device of the signals among the devices of a user: the device hash,
+// or the user agent family if the client sent no fingerprint
+func (s Signals) DeviceKey() string {
+	if s.DeviceHash != "" {
+		return s.DeviceHash
+	}
+	if s.UserAgentFamily == "" {
+		return ""
+	}
+	return hash("ua:" + s.UserAgentFamily)
+}
+
+// IPPrefix returns the network of the address with the given prefix lengths, empty if the
+// address is invalid
+func IPPrefix(ip string, ipv4Bits int, ipv6Bits int) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+	bits := ipv6Bits
+	if addr.Is4() {
+		bits = ipv4Bits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// DeviceHash returns the SHA-256 of the fingerprint, empty if there is none
+func DeviceHash(fingerprint string) string {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if fingerprint == "" {
+		return ""
+	}
+	return hash(fingerprint)
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// browsers are matched in order, Chromium based browsers also claim to be Chrome and Safari
+var browsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"YaBrowser/", "Yandex"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"okhttp/", "okhttp"},
+	{"Go-http-client/", "Go"},
+}
+
+// systems are matched in order, Android also claims to be Linux
+var systems = []struct{ token, name string }{
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// UserAgentFamily returns the browser and operating system of a User-Agent header without
+// versions, so browser updates do not look like another client, e.g. "Firefox on Linux"
+func UserAgentFamily(userAgent string) string {
+	if strings.TrimSpace(userAgent) == "" {
+		return ""
+	}
+	browser := "Other"
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return browser + " on " + s.name
+		}
+	}
+	return browser
+}
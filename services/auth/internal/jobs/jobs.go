@@ -0,0 +1,52 @@
+// Package jobs defines the maintenance jobs of the auth service
+package jobs
+
+import (
+	"auth/config"
+	"auth/internal/repository"
+	"auth/internal/service"
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"time"
+)
+
+// Job names, they identify the jobs in the admin API, the history and the metrics
+const (
+	ExpiredSessions = "expired-sessions"
+	IdleSessions    = "idle-sessions"
+	ExpiredTokens   = "expired-tokens"
+	DeletedAccounts = "deleted-accounts"
+	JobHistory      = "job-history"
+)
+
+// Services are the services the jobs work with
+type Services struct {
+	Auth     service.AuthService
+	Sessions service.SessionService
+	Tokens   service.TokenService
+	Runs     repository.JobRunRepository
+}
+
+// Register adds the jobs with a schedule to the scheduler
+func Register(s *scheduler.Scheduler, cfg config.JobsConfig, services Services) error {
+	jobs := []scheduler.Job{
+		{Name: ExpiredSessions, Schedule: cfg.ExpiredSessions, Run: services.Sessions.HardDeleteSessions},
+		{Name: IdleSessions, Schedule: cfg.IdleSessions, Run: services.Sessions.DeleteInactiveSessions},
+		{Name: ExpiredTokens, Schedule: cfg.ExpiredTokens, Run: services.Tokens.DeleteExpiredTokens},
+		{Name: DeletedAccounts, Schedule: cfg.DeletedAccounts, Run: func(ctx context.Context) (int64, error) {
+			return services.Auth.PurgeDeletedAccounts(ctx, cfg.DeletionGracePeriod)
+		}},
+		{Name: JobHistory, Schedule: cfg.JobHistory, Run: func(ctx context.Context) (int64, error) {
+			return services.Runs.DeleteBefore(ctx, time.Now().Add(-cfg.HistoryRetention))
+		}},
+	}
+	for _, job := range jobs {
+		if job.Schedule == "" {
+			continue
+		}
+		if err := s.Add(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
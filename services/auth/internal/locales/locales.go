@@ -0,0 +1,20 @@
+// Package locales holds the message catalogs of the auth service
+package locales
+
+import (
+	"auth/pkg/auth"
+	"embed"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"golang.org/x/text/language"
+)
+
+// Catalogs translate the errors and the success messages of the service
+//
+//go:embed *.yaml
+var Catalogs embed.FS
+
+// NewBundle returns the bundle of the messages the service answers with: those of the shared
+// packages, of the middlewares and its own. Unsupported languages are answered in English.
+func NewBundle() (*i18n.Bundle, error) {
+	return i18n.NewBundle(language.English, i18n.Catalogs, auth.Catalogs, Catalogs)
+}
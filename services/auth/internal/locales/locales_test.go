@@ -0,0 +1,60 @@
+package locales
+
+import (
+	"auth/internal/api"
+	"slices"
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	_ "github.com/Ruletk/GoMarketplace/pkg/diagnostics"
+	_ "github.com/Ruletk/GoMarketplace/pkg/scheduler"
+)
+
+// TestEveryCodeIsTranslated checks the codes of every error the service answers with, and of
+// every success message, are translated to every language
+func TestEveryCodeIsTranslated(t *testing.T) {
+	bundle, err := NewBundle()
+	if err != nil {
+		t.Fatalf("Failed to load the catalogs: %v", err)
+	}
+	var languages []string
+	for _, tag := range bundle.Languages() {
+		languages = append(languages, tag.String())
+	}
+	for _, expected := range []string{"en", "ru", "kk"} {
+		if !slices.Contains(languages, expected) {
+			t.Errorf("Expected the language %s, got %v", expected, languages)
+		}
+	}
+
+	codes := append(apierror.Codes(), api.MessageCodes...)
+	for _, missing := range bundle.Missing(codes...) {
+		t.Errorf("Missing translation %s", missing)
+	}
+}
+
+func TestMessagesAreFormatted(t *testing.T) {
+	bundle, err := NewBundle()
+	if err != nil {
+		t.Fatalf("Failed to load the catalogs: %v", err)
+	}
+
+	tests := []struct {
+		language string
+		count    int64
+		expected string
+	}{
+		{"en", 1, "1 session deleted"},
+		{"en", 5, "5 sessions deleted"},
+		{"ru", 1, "Удалена 1 сессия"},
+		{"ru", 3, "Удалено 3 сессии"},
+		{"ru", 11, "Удалено 11 сессий"},
+		{"kk", 5, "5 сессия жойылды"},
+	}
+	for _, tc := range tests {
+		text := bundle.Localizer(tc.language).Text("AUTH_SESSIONS_DELETED", map[string]interface{}{"count": tc.count})
+		if text != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, text)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Code generated by openapi-gen from ../../docs/openapi.yaml. DO NOT EDIT.
+
+package messages
+
+import (
+	"auth/pkg/auth"
+	"encoding/json"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/go-webauthn/webauthn/protocol"
+	"time"
+)
+
+// ApiResponse confirms a request without a result, the message is in the language of the response
+type ApiResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// AuthDataResponse describes the user and the session behind a valid token
+type AuthDataResponse struct {
+	// Level of that proof, 1 for a password, 2 for a password with a second factor or a passkey verifying the user
+	AuthLevel int `json:"auth_level"`
+	// When the user last proved their identity in the session, at login or re-authentication
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	Email           string    `json:"email"`
+	ID              int64     `json:"id"`
+	// The language the user chose, absent if they did not
+	Language string   `json:"language,omitempty"`
+	Roles    []string `json:"roles"`
+	// SHA-256 digest of the session token
+	SessionID string `json:"session_id"`
+}
+
+// AuthRequest represents a login or registration request
+type AuthRequest struct {
+	Email    string         `json:"email" binding:"required,email"`
+	Password logging.Secret `json:"password" binding:"required"`
+	// Login only. A long session with a persistent cookie instead of a short one ending with the browser session
+	RememberMe bool `json:"remember_me,omitempty"`
+}
+
+// AuthResponse represents a successful authentication
+type AuthResponse struct {
+	// Expiry of the session, renewed while it is used up to its absolute lifetime
+	ExpiresAt  time.Time `json:"expires_at"`
+	RememberMe bool      `json:"remember_me"`
+	// Authentication session token
+	Token string `json:"token"`
+}
+
+// LanguageRequest sets the language of the user
+type LanguageRequest struct {
+	// Empty to negotiate the language from Accept-Language again
+	Language string `json:"language,omitempty" binding:"omitempty,oneof=en ru kk"`
+}
+
+// PasskeyAssertion starts a login with a passkey. Options are passed to navigator.credentials.get()
+// and the credential it returns is sent back with the token.
+type PasskeyAssertion struct {
+	// `PublicKeyCredentialRequestOptions` under `publicKey`, as defined by WebAuthn
+	Options *protocol.CredentialAssertion `json:"options"`
+	// Identifies the ceremony, valid until the challenge expires and used once
+	Token string `json:"token"`
+}
+
+// PasskeyCreation starts the registration of a passkey. Options are passed to navigator.credentials.create()
+// and the credential it returns is sent back with the token.
+type PasskeyCreation struct {
+	// `PublicKeyCredentialCreationOptions` under `publicKey`, as defined by WebAuthn
+	Options *protocol.CredentialCreation `json:"options"`
+	// Identifies the ceremony, valid until the challenge expires and used once
+	Token string `json:"token"`
+}
+
+// PasskeyLogin finishes a login with a passkey
+type PasskeyLogin struct {
+	// The `PublicKeyCredential` returned by `navigator.credentials.get()`, JSON encoded
+	Credential json.RawMessage `json:"credential" binding:"required"`
+	RememberMe bool            `json:"remember_me,omitempty"`
+	Token      string          `json:"token" binding:"required"`
+}
+
+// PasskeyRegistration finishes the registration of a passkey
+type PasskeyRegistration struct {
+	// The `PublicKeyCredential` returned by `navigator.credentials.create()`, JSON encoded
+	Credential json.RawMessage `json:"credential" binding:"required"`
+	// Defaults to "Passkey N"
+	Name  string `json:"name,omitempty" binding:"max=64"`
+	Token string `json:"token" binding:"required"`
+}
+
+// PasskeyRename renames a passkey
+type PasskeyRename struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// PasskeySignupRequest starts the registration of a user without a password
+type PasskeySignupRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordChange sets the new password with a password reset token
+type PasswordChange struct {
+	NewPassword logging.Secret `json:"newPassword" binding:"required"`
+}
+
+// PasswordChangeRequest asks for a password reset link sent by e-mail
+type PasswordChangeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ReauthRequest re-authenticates the current session
+type ReauthRequest struct {
+	Password logging.Secret `json:"password" binding:"required"`
+}
+
+// ReauthResponse represents a successful re-authentication
+type ReauthResponse struct {
+	AuthLevel       int       `json:"auth_level"`
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+}
+
+// TokenRequest represents a token validation request
+type TokenRequest struct {
+	Client *auth.ClientInfo `json:"client,omitempty"`
+	// Authentication session token
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,14 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/openapi/codegen"
+)
+
+// The generated types follow the OpenAPI document, run go generate after changing it
+func TestGeneratedTypesAreUpToDate(t *testing.T) {
+	if err := codegen.CheckFile("messages_gen.go", codegen.Types, "../../docs/openapi.yaml", codegen.Config{Package: "messages"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MailConfig is the SMTP server notifications are sent through
+type MailConfig struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN, no authentication if Username is empty
+	Username string
+	Password string
+	// From is the sender address
+	From string
+	// StartTLS upgrades the connection to TLS before authenticating
+	StartTLS bool
+}
+
+type mailNotifier struct {
+	config    MailConfig
+	templates templates
+}
+
+// NewMailNotifier sends notifications as plain text e-mails in the language of the recipient
+func NewMailNotifier(config MailConfig) Notifier {
+	return &mailNotifier{config: config, templates: mustLoadTemplates()}
+}
+
+func (m mailNotifier) NewDevice(ctx context.Context, to Recipient, login Login) error {
+	subject, body, err := m.templates.render(to.Language, "new_device", login)
+	if err != nil {
+		return err
+	}
+	return m.send(ctx, to.Email, subject, body)
+}
+
+// send delivers a message, the connection is bounded by the deadline of ctx
+func (m mailNotifier) send(ctx context.Context, to string, subject string, body string) error {
+	message, err := buildMessage(m.config.From, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.config.StartTLS {
+		if err = client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.config.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err = client.Mail(m.config.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage formats a plain text e-mail. Line breaks in header values are rejected, they
+// would let a crafted address inject headers.
+func buildMessage(from string, to string, subject string, body string, date time.Time) ([]byte, error) {
+	headers := [][2]string{
+		{"From", from},
+		{"To", to},
+		{"Subject", subject},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=UTF-8"},
+	}
+	var message bytes.Buffer
+	for _, header := range headers {
+		if strings.ContainsAny(header[1], "\r\n") {
+			return nil, fmt.Errorf("invalid %s header: contains a line break", header[0])
+		}
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	message.WriteString("\r\n")
+	message.WriteString(body)
+	return message.Bytes(), nil
+}
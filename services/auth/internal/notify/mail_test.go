@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	message, err := buildMessage("noreply@example.com", "user@example.com", "New sign-in", "Hello\r\n", date)
+	if err != nil {
+		t.Fatalf("Failed to build the message: %v", err)
+	}
+	text := string(message)
+	for _, header := range []string{"From: noreply@example.com\r\n", "To: user@example.com\r\n", "Subject: New sign-in\r\n", "Date: Mon, 19 Oct 2026 12:00:00 +0000\r\n"} {
+		if !strings.Contains(text, header) {
+			t.Errorf("Expected the header %q in %q", header, text)
+		}
+	}
+	if !strings.HasSuffix(text, "\r\n\r\nHello\r\n") {
+		t.Errorf("Expected the body after a blank line, got %q", text)
+	}
+
+	if _, err = buildMessage("noreply@example.com", "user@example.com\r\nBcc: victim@example.com", "New sign-in", "", date); err == nil {
+		t.Errorf("Expected a line break in a header to be rejected")
+	}
+}
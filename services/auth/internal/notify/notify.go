@@ -0,0 +1,44 @@
+// Package notify tells users about security relevant events on their account
+package notify
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Login describes a login the user is told about
+type Login struct {
+	// Device is the browser and operating system, e.g. "Chrome on Windows"
+	Device string
+	// IP is the address of the client
+	IP string
+	// Location is the country of the client, empty if unknown
+	Location string
+	At       time.Time
+}
+
+// Notifier sends notifications to users
+type Notifier interface {
+	// NewDevice tells the user their account was logged into from a device it was not used from before
+	NewDevice(ctx context.Context, to Recipient, login Login) error
+}
+
+type logNotifier struct {
+	logger *logrus.Logger
+}
+
+// NewLogNotifier logs notifications instead of sending them, for deployments without a mailer.
+// A nil logger stands for the global logger.
+func NewLogNotifier(logger *logrus.Logger) Notifier {
+	return &logNotifier{logger: logger}
+}
+
+func (l logNotifier) NewDevice(ctx context.Context, to Recipient, login Login) error {
+	logging.ForContext(l.logger, ctx).
+		WithField(logging.LoggerNameField, "auth.notify").
+		WithFields(logrus.Fields{"device": login.Device, "ip": login.IP, "location": login.Location}).
+		Info("New device login of ", to.Email, ", no mailer is configured to tell the user")
+	return nil
+}
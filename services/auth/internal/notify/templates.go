@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"text/template"
+)
+
+// templateFS holds the e-mail templates, a directory per language. A template file defines the
+// "<name>.subject" and "<name>.body" templates of a notification.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// fallbackLanguage is the language of e-mails to users whose language has no templates
+const fallbackLanguage = "en"
+
+// Recipient is the user a notification is sent to
+type Recipient struct {
+	Email string
+	// Language is the language of the notification, e.g. "kk"
+	Language string
+}
+
+// templates are the e-mail templates by language
+type templates map[string]*template.Template
+
+// mustLoadTemplates is loadTemplates panicking on an error, the templates are embedded in the binary
+func mustLoadTemplates() templates {
+	loaded, err := loadTemplates()
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+func loadTemplates() (templates, error) {
+	dirs, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(templates, len(dirs))
+	for _, dir := range dirs {
+		tmpl, err := template.New(dir.Name()).ParseFS(templateFS, "templates/"+dir.Name()+"/*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		loaded[dir.Name()] = tmpl
+	}
+	if loaded[fallbackLanguage] == nil {
+		return nil, fmt.Errorf("no templates for the fallback language %s", fallbackLanguage)
+	}
+	return loaded, nil
+}
+
+// render returns the subject and the body of the notification in the language
+func (t templates) render(language string, name string, data interface{}) (string, string, error) {
+	tmpl, ok := t[language]
+	if !ok {
+		tmpl = t[fallbackLanguage]
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// TestTemplatesAreTranslated checks every language has every template of the fallback language
+func TestTemplatesAreTranslated(t *testing.T) {
+	loaded, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Failed to load the templates: %v", err)
+	}
+	for _, language := range []string{"en", "ru", "kk"} {
+		if loaded[language] == nil {
+			t.Errorf("Expected templates for %s", language)
+		}
+	}
+
+	names := func(tmpl *template.Template) map[string]bool {
+		defined := make(map[string]bool)
+		for _, tmpl := range tmpl.Templates() {
+			if strings.Contains(tmpl.Name(), ".") && !strings.HasSuffix(tmpl.Name(), ".tmpl") {
+				defined[tmpl.Name()] = true
+			}
+		}
+		return defined
+	}
+	expected := names(loaded[fallbackLanguage])
+	for language, tmpl := range loaded {
+		defined := names(tmpl)
+		for name := range expected {
+			if !defined[name] {
+				t.Errorf("Template %s is not translated to %s", name, language)
+			}
+		}
+	}
+}
+
+func TestRenderNewDevice(t *testing.T) {
+	loaded, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Failed to load the templates: %v", err)
+	}
+	login := Login{Device: "Chrome on Windows", IP: "203.0.113.7", At: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		language string
+		subject  string
+		body     []string
+	}{
+		{"ru", "Новый вход в вашу учётную запись", []string{"Устройство: Chrome on Windows", "Местоположение: неизвестно", "Время: 19.10.2026 12:00:00 UTC"}},
+		{"kk", "Тіркелгіңізге жаңа кіру", []string{"IP мекенжайы: 203.0.113.7", "Орналасқан жері: белгісіз"}},
+		{"de", "New sign-in to your account", []string{"Location: unknown", "Time: Mon, 19 Oct 2026 12:00:00 UTC"}},
+	}
+	for _, tc := range tests {
+		subject, body, err := loaded.render(tc.language, "new_device", login)
+		if err != nil {
+			t.Fatalf("Failed to render in %s: %v", tc.language, err)
+		}
+		if subject != tc.subject {
+			t.Errorf("Expected the subject %q in %s, got %q", tc.subject, tc.language, subject)
+		}
+		for _, line := range tc.body {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected %q in the %s body %q", line, tc.language, body)
+			}
+		}
+	}
+}
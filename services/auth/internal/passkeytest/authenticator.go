@@ -0,0 +1,145 @@
+// Package passkeytest answers WebAuthn ceremonies in tests with a passkey in memory
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"testing"
+)
+
+// Authenticator is a passkey authenticator in memory, it answers ceremonies the way a browser
+// passes on the answers of a platform authenticator
+type Authenticator struct {
+	key *ecdsa.PrivateKey
+	// RPID is the relying party the passkey is created for
+	RPID         string
+	CredentialID []byte
+	// UserHandle is the handle of the user the passkey was created for
+	UserHandle []byte
+	// Counter is the signature counter, increased by every assertion
+	Counter uint32
+	// Origin is the origin the browser reports
+	Origin string
+}
+
+// New returns an authenticator answering ceremonies of the relying party from the origin
+func New(t testing.TB, rpID string, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate the key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	_, _ = rand.Read(credentialID)
+	return &Authenticator{key: key, RPID: rpID, CredentialID: credentialID, Origin: origin}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    a.Origin,
+	})
+	return data
+}
+
+// authenticatorData returns the authenticator data with the user present and verified, with the
+// credential if attested
+func (a *Authenticator) authenticatorData(t testing.TB, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.Counter)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode the public key: %v", err)
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+	data = append(data, a.CredentialID...)
+	return append(data, publicKey...)
+}
+
+// Create answers navigator.credentials.create() with a "none" attestation. The options are
+// taken as built by the service or as decoded from its response.
+func (a *Authenticator) Create(t testing.TB, options *protocol.CredentialCreation) json.RawMessage {
+	switch handle := options.Response.User.ID.(type) {
+	case protocol.URLEncodedBase64:
+		a.UserHandle = handle
+	case string:
+		decoded, err := base64.RawURLEncoding.DecodeString(handle)
+		if err != nil {
+			t.Fatalf("Failed to decode the user handle: %v", err)
+		}
+		a.UserHandle = decoded
+	default:
+		t.Fatalf("Expected a binary user handle, got %T", options.Response.User.ID)
+	}
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(t, true),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode the attestation: %v", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    encode(a.CredentialID),
+		"rawId": encode(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(a.clientData("webauthn.create", options.Response.Challenge)),
+			"attestationObject": encode(attestation),
+		},
+	})
+	return body
+}
+
+// Get answers navigator.credentials.get(), the counter is increased first
+func (a *Authenticator) Get(t testing.TB, options *protocol.CredentialAssertion) json.RawMessage {
+	a.Counter++
+	authData := a.authenticatorData(t, false)
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    encode(a.CredentialID),
+		"rawId": encode(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(a.UserHandle),
+		},
+	})
+	return body
+}
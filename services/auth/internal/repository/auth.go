@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"auth/pkg/auth"
+	"context"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"time"
@@ -9,27 +13,54 @@ import (
 
 // Auth represents an authentication in the database
 type Auth struct {
-	ID           int64     `json:"id" gorm:"primaryKey" gorm:"column:id"`
-	Email        string    `json:"email" gorm:"unique" gorm:"index" gorm:"column:email"`
-	PasswordHash string    `json:"password_hash" gorm:"column:password_hash"`
-	Active       bool      `json:"active" gorm:"column:active" gorm:"default:true"`
-	IsSeller     bool      `json:"is_seller" gorm:"column:is_seller" gorm:"default:false"`
-	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at" gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at" gorm:"autoUpdateTime"`
-	DeletedAt    time.Time `json:"delete_at" gorm:"column:delete_at"`
+	ID           int64      `json:"id" gorm:"column:id;primaryKey"`
+	Email        string     `json:"email" gorm:"column:email;unique"`
+	PasswordHash string     `json:"password_hash" gorm:"column:password_hash"`
+	Active       bool       `json:"active" gorm:"column:active"`
+	IsSeller     bool       `json:"is_seller" gorm:"column:is_seller"`
+	IsAdmin      bool       `json:"is_admin" gorm:"column:is_admin"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" gorm:"column:deleted_at"`
+	SuspendedAt  *time.Time `json:"suspended_at,omitempty" gorm:"column:suspended_at"`
+	// UserHandle identifies the user to their passkeys, nil until the first passkey is added
+	UserHandle []byte `json:"-" gorm:"column:user_handle;uniqueIndex"`
+	// Language is the language the user chose, e.g. "kk", empty to negotiate it per request
+	Language string `json:"language" gorm:"column:language"`
 }
 
 func (Auth) TableName() string {
 	return "auth"
 }
 
+// Roles returns the roles granted to the user
+func (a Auth) Roles() []string {
+	roles := []string{auth.RoleUser}
+	if a.IsSeller {
+		roles = append(roles, auth.RoleSeller)
+	}
+	if a.IsAdmin {
+		roles = append(roles, auth.RoleAdmin)
+	}
+	return roles
+}
+
+// HasPassword reports whether the user can log in with a password, users who signed up with a
+// passkey have none
+func (a Auth) HasPassword() bool {
+	return a.PasswordHash != ""
+}
+
 func (a Auth) ComparePassword(password string) bool {
+	if !a.HasPassword() {
+		return false
+	}
 	return bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) == nil
 }
 
 func (a Auth) GeneratePasswordHash(password string) (passwordHash string) {
 	pass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	logging.Logger.Debug("Generating password hash for user with email: ", a.Email, " Hash: ", string(pass))
+	logging.Logger.Debug("Generating password hash for user with email: ", a.Email)
 	if err != nil {
 		logging.Logger.Error("Failed to generate password hash: ", err)
 		a.PasswordHash = ""
@@ -40,59 +71,128 @@ func (a Auth) GeneratePasswordHash(password string) (passwordHash string) {
 
 // AuthRepository represents the repository for the authentication
 type AuthRepository interface {
-	Create(auth *Auth) error
-	GetByEmail(email string) (*Auth, error)
-	GetByID(id int64) (*Auth, error)
-	Update(auth *Auth) error
-	Delete(id int64) error
+	Create(ctx context.Context, auth *Auth) error
+	GetByEmail(ctx context.Context, email string) (*Auth, error)
+	GetByID(ctx context.Context, id int64) (*Auth, error)
+	Update(ctx context.Context, auth *Auth) error
+	// AssignUserHandle gives the user the passkey user handle unless they have one, either way
+	// auth.UserHandle is the handle of the user afterwards
+	AssignUserHandle(ctx context.Context, auth *Auth, handle []byte) error
+	Delete(ctx context.Context, id int64) error
+	// PurgeDeleted deletes users whose deletion was requested before the time, with their sessions,
+	// devices, passkeys and tokens, and returns how many users were deleted
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
 type authRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	logger *logrus.Logger
 }
 
-func NewAuthRepository(db *gorm.DB) AuthRepository {
+// NewAuthRepository creates the repository, a nil logger stands for the global logger
+func NewAuthRepository(db *gorm.DB, logger *logrus.Logger) AuthRepository {
 	return &authRepository{
-		db: db,
+		db:     db,
+		logger: logger,
 	}
 }
 
-func (a authRepository) Create(auth *Auth) error {
-	logging.Logger.Debug("Creating user with email: ", auth.Email)
-	return a.db.Create(auth).Error
+func (a authRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(a.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
 }
 
-func (a authRepository) GetByEmail(email string) (*Auth, error) {
-	logging.Logger.Debug("Getting user by email: ", email)
+func (a authRepository) Create(ctx context.Context, auth *Auth) (err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Creating user with email: ", auth.Email)
+	return a.db.WithContext(ctx).Create(auth).Error
+}
+
+func (a authRepository) GetByEmail(ctx context.Context, email string) (_ *Auth, err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.GetByEmail")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Getting user by email: ", email)
 
 	var auth Auth
-	err := a.db.Where("email = ?", email).First(&auth).Error
+	err = a.db.WithContext(ctx).Where("email = ?", email).First(&auth).Error
 	if err != nil {
-		logging.Logger.Error("Failed to get user by email: ", err)
+		a.log(ctx).Error("Failed to get user by email: ", err)
 		return nil, err
 	}
-	logging.Logger.Debug("User found with email: ", email)
+	a.log(ctx).Debug("User found with email: ", email)
 	return &auth, nil
 }
 
-func (a authRepository) GetByID(id int64) (*Auth, error) {
-	logging.Logger.Debug("Getting user by ID: ", id)
+func (a authRepository) GetByID(ctx context.Context, id int64) (_ *Auth, err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.GetByID")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Getting user by ID: ", id)
 	var auth Auth
-	err := a.db.Where("id = ?", id).First(&auth).Error
+	err = a.db.WithContext(ctx).Where("id = ?", id).First(&auth).Error
 	if err != nil {
-		logging.Logger.Error("Failed to get user by ID: ", err)
+		a.log(ctx).Error("Failed to get user by ID: ", err)
 		return nil, err
 	}
-	logging.Logger.Debug("User found with ID: ", id)
+	a.log(ctx).Debug("User found with ID: ", id)
 	return &auth, nil
 }
 
-func (a authRepository) Update(auth *Auth) error {
-	logging.Logger.Debug("Updating user with ID: ", auth.ID)
-	return a.db.Save(auth).Error
+func (a authRepository) Update(ctx context.Context, auth *Auth) (err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.Update")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Updating user with ID: ", auth.ID)
+	return a.db.WithContext(ctx).Save(auth).Error
 }
 
-func (a authRepository) Delete(id int64) error {
-	logging.Logger.Debug("Deleting user with ID: ", id)
-	return a.db.Delete(&Auth{}, "id = ?", id).Error
+func (a authRepository) AssignUserHandle(ctx context.Context, auth *Auth, handle []byte) (err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.AssignUserHandle")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Assigning user handle to user with ID: ", auth.ID)
+	// Concurrent ceremonies of the user agree on the handle assigned first
+	err = a.db.WithContext(ctx).Model(&Auth{}).
+		Where("id = ? AND user_handle IS NULL", auth.ID).
+		Update("user_handle", handle).Error
+	if err != nil {
+		return err
+	}
+	return a.db.WithContext(ctx).Model(&Auth{}).Select("user_handle").Where("id = ?", auth.ID).Scan(&auth.UserHandle).Error
+}
+
+func (a authRepository) Delete(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Deleting user with ID: ", id)
+	return a.db.WithContext(ctx).Delete(&Auth{}, "id = ?", id).Error
+}
+
+func (a authRepository) PurgeDeleted(ctx context.Context, before time.Time) (count int64, err error) {
+	ctx, span := startSpan(ctx, "AuthRepository.PurgeDeleted")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	a.log(ctx).Debug("Purging users deleted before: ", before)
+	err = a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Model(&Auth{}).Select("id").Where("deleted_at < ?", before.UTC())
+		if err := tx.Delete(&Session{}, "user_id IN (?)", deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&KnownDevice{}, "user_id IN (?)", deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Passkey{}, "user_id IN (?)", deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Token{}, "user_id IN (?)", deleted).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Auth{}, "deleted_at < ?", before.UTC())
+		count = result.RowsAffected
+		return result.Error
+	})
+	return count, err
 }
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// KnownDevice represents a device a user has logged in from
+type KnownDevice struct {
+	UserID int64 `json:"user_id" gorm:"column:user_id;primaryKey"`
+	// DeviceKey is binding.Signals.DeviceKey of the device
+	DeviceKey       string    `json:"-" gorm:"column:device_key;primaryKey"`
+	UserAgentFamily string    `json:"user_agent_family" gorm:"column:user_agent_family"`
+	IPPrefix        string    `json:"ip_prefix" gorm:"column:ip_prefix"`
+	Country         string    `json:"country,omitempty" gorm:"column:country"`
+	FirstSeenAt     time.Time `json:"first_seen_at" gorm:"column:first_seen_at"`
+	LastSeenAt      time.Time `json:"last_seen_at" gorm:"column:last_seen_at"`
+}
+
+func (KnownDevice) TableName() string {
+	return "known_devices"
+}
+
+// DeviceRepository represents the repository for the devices users log in from
+type DeviceRepository interface {
+	// Touch records a login from the device and reports whether the device is new to a user who
+	// already had other devices. The first device of a user is not new, there is nobody to warn.
+	Touch(ctx context.Context, device *KnownDevice) (isNew bool, err error)
+	// GetAllByUser returns the devices of the user, the latest seen first
+	GetAllByUser(ctx context.Context, userID int64) ([]*KnownDevice, error)
+}
+
+type deviceRepository struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewDeviceRepository creates the repository, a nil logger stands for the global logger
+func NewDeviceRepository(db *gorm.DB, logger *logrus.Logger) DeviceRepository {
+	return &deviceRepository{db: db, logger: logger}
+}
+
+func (d deviceRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(d.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
+}
+
+func (d deviceRepository) Touch(ctx context.Context, device *KnownDevice) (isNew bool, err error) {
+	ctx, span := startSpan(ctx, "DeviceRepository.Touch")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	d.log(ctx).Debug("Touching device of user with ID: ", device.UserID)
+	err = d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent logins from the same new device insert once, only the inserting one reports it
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(device)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Model(&KnownDevice{}).
+				Where("user_id = ? AND device_key = ?", device.UserID, device.DeviceKey).
+				Updates(map[string]interface{}{
+					"user_agent_family": device.UserAgentFamily,
+					"ip_prefix":         device.IPPrefix,
+					"country":           device.Country,
+					"last_seen_at":      device.LastSeenAt.UTC(),
+				}).Error
+		}
+		var others int64
+		err := tx.Model(&KnownDevice{}).
+			Where("user_id = ? AND device_key <> ?", device.UserID, device.DeviceKey).
+			Count(&others).Error
+		isNew = others > 0
+		return err
+	})
+	return isNew, err
+}
+
+func (d deviceRepository) GetAllByUser(ctx context.Context, userID int64) (_ []*KnownDevice, err error) {
+	ctx, span := startSpan(ctx, "DeviceRepository.GetAllByUser")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	d.log(ctx).Debug("Getting devices of user with ID: ", userID)
+	var devices []*KnownDevice
+	err = d.db.WithContext(ctx).Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
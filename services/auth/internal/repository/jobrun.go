@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// JobRun represents a run of a background job in the database
+type JobRun struct {
+	ID          int64     `json:"id" gorm:"column:id;primaryKey"`
+	Job         string    `json:"job" gorm:"column:job;index:idx_job_runs_job_started_at,priority:1"`
+	ScheduledAt time.Time `json:"scheduled_at" gorm:"column:scheduled_at"`
+	StartedAt   time.Time `json:"started_at" gorm:"column:started_at;index:idx_job_runs_job_started_at,priority:2,sort:desc"`
+	FinishedAt  time.Time `json:"finished_at" gorm:"column:finished_at"`
+	Status      string    `json:"status" gorm:"column:status"`
+	Processed   int64     `json:"processed" gorm:"column:processed"`
+	Error       string    `json:"error" gorm:"column:error"`
+	Instance    string    `json:"instance" gorm:"column:instance"`
+}
+
+func (JobRun) TableName() string {
+	return "job_runs"
+}
+
+func (r JobRun) toRun() scheduler.Run {
+	return scheduler.Run{
+		Job:         r.Job,
+		ScheduledAt: r.ScheduledAt,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+		Status:      r.Status,
+		Processed:   r.Processed,
+		Error:       r.Error,
+		Instance:    r.Instance,
+	}
+}
+
+// JobRunRepository stores the runs of the background jobs, it is the history shared by the
+// schedulers of all replicas
+type JobRunRepository interface {
+	scheduler.History
+	// DeleteBefore deletes runs started before the time and returns how many were deleted
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type jobRunRepository struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewJobRunRepository creates the repository, a nil logger stands for the global logger
+func NewJobRunRepository(db *gorm.DB, logger *logrus.Logger) JobRunRepository {
+	return &jobRunRepository{db: db, logger: logger}
+}
+
+func (j jobRunRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(j.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
+}
+
+func (j jobRunRepository) Record(ctx context.Context, run scheduler.Run) (err error) {
+	ctx, span := startSpan(ctx, "JobRunRepository.Record")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	j.log(ctx).Debug("Recording run of job: ", run.Job)
+	// The columns have no time zone, times are stored in UTC so replicas in other zones agree
+	return j.db.WithContext(ctx).Create(&JobRun{
+		Job:         run.Job,
+		ScheduledAt: run.ScheduledAt.UTC(),
+		StartedAt:   run.StartedAt.UTC(),
+		FinishedAt:  run.FinishedAt.UTC(),
+		Status:      run.Status,
+		Processed:   run.Processed,
+		Error:       run.Error,
+		Instance:    run.Instance,
+	}).Error
+}
+
+func (j jobRunRepository) Last(ctx context.Context, job string) (_ *scheduler.Run, err error) {
+	ctx, span := startSpan(ctx, "JobRunRepository.Last")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var run JobRun
+	err = j.db.WithContext(ctx).Where("job = ?", job).Order("started_at DESC").First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	last := run.toRun()
+	return &last, nil
+}
+
+func (j jobRunRepository) List(ctx context.Context, job string, limit int) (_ []scheduler.Run, err error) {
+	ctx, span := startSpan(ctx, "JobRunRepository.List")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	query := j.db.WithContext(ctx).Where("job = ?", job).Order("started_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var rows []JobRun
+	if err = query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	runs := make([]scheduler.Run, 0, len(rows))
+	for _, row := range rows {
+		runs = append(runs, row.toRun())
+	}
+	return runs, nil
+}
+
+func (j jobRunRepository) DeleteBefore(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "JobRunRepository.DeleteBefore")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	j.log(ctx).Debug("Deleting job runs started before: ", before)
+	result := j.db.WithContext(ctx).Delete(&JobRun{}, "started_at < ?", before.UTC())
+	return result.RowsAffected, result.Error
+}
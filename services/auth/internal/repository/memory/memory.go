@@ -0,0 +1,631 @@
+// Package memory implements the repositories in memory, for tests running the service without
+// a database. The repositories of a Store share its data like the tables of one database.
+package memory
+
+import (
+	"auth/internal/repository"
+	"bytes"
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/scheduler"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store holds the rows of the repositories
+type Store struct {
+	mu       sync.Mutex
+	users    map[int64]*repository.Auth
+	sessions map[string]*repository.Session
+	tokens   map[string]*repository.Token
+	devices  map[deviceKey]*repository.KnownDevice
+	passkeys map[int64]*repository.Passkey
+	runs     []scheduler.Run
+	nextID   int64
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{
+		users:    make(map[int64]*repository.Auth),
+		sessions: make(map[string]*repository.Session),
+		tokens:   make(map[string]*repository.Token),
+		devices:  make(map[deviceKey]*repository.KnownDevice),
+		passkeys: make(map[int64]*repository.Passkey),
+	}
+}
+
+// id returns the next primary key, shared by the tables
+func (s *Store) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// Auth returns the repository of the users
+func (s *Store) Auth() repository.AuthRepository {
+	return authRepository{s}
+}
+
+// Sessions returns the repository of the sessions
+func (s *Store) Sessions() repository.SessionRepository {
+	return sessionRepository{s}
+}
+
+// Tokens returns the repository of the one-time tokens
+func (s *Store) Tokens() repository.TokenRepository {
+	return tokenRepository{s}
+}
+
+// Devices returns the repository of the devices users log in from
+func (s *Store) Devices() repository.DeviceRepository {
+	return deviceRepository{s}
+}
+
+// Passkeys returns the repository of the passkeys
+func (s *Store) Passkeys() repository.PasskeyRepository {
+	return passkeyRepository{s}
+}
+
+// JobRuns returns the repository of the runs of the jobs
+func (s *Store) JobRuns() repository.JobRunRepository {
+	return jobRunRepository{s}
+}
+
+type authRepository struct{ *Store }
+
+func (a authRepository) Create(_ context.Context, user *repository.Auth) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.createUser(user)
+}
+
+func (s *Store) createUser(user *repository.Auth) error {
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	user.ID = s.id()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	row := *user
+	s.users[user.ID] = &row
+	return nil
+}
+
+func (a authRepository) GetByEmail(_ context.Context, email string) (*repository.Auth, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, user := range a.users {
+		if user.Email == email {
+			row := *user
+			return &row, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (a authRepository) GetByID(_ context.Context, id int64) (*repository.Auth, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user, ok := a.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	row := *user
+	return &row, nil
+}
+
+func (a authRepository) Update(_ context.Context, user *repository.Auth) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user.UpdatedAt = time.Now()
+	row := *user
+	a.users[user.ID] = &row
+	return nil
+}
+
+func (a authRepository) AssignUserHandle(_ context.Context, user *repository.Auth, handle []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	row, ok := a.users[user.ID]
+	if !ok {
+		return nil
+	}
+	if row.UserHandle == nil {
+		row.UserHandle = handle
+	}
+	user.UserHandle = row.UserHandle
+	return nil
+}
+
+func (a authRepository) Delete(_ context.Context, id int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.users, id)
+	return nil
+}
+
+func (a authRepository) PurgeDeleted(_ context.Context, before time.Time) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var count int64
+	for id, user := range a.users {
+		if user.DeletedAt == nil || !user.DeletedAt.Before(before) {
+			continue
+		}
+		for key, session := range a.sessions {
+			if session.UserID == id {
+				delete(a.sessions, key)
+			}
+		}
+		for key, device := range a.devices {
+			if device.UserID == id {
+				delete(a.devices, key)
+			}
+		}
+		for key, passkey := range a.passkeys {
+			if passkey.UserID == id {
+				delete(a.passkeys, key)
+			}
+		}
+		for key, token := range a.tokens {
+			if token.UserID == id {
+				delete(a.tokens, key)
+			}
+		}
+		delete(a.users, id)
+		count++
+	}
+	return count, nil
+}
+
+type sessionRepository struct{ *Store }
+
+// column returns a time as a TIMESTAMP column gives it back: its wall clock, read as UTC.
+// Sessions keep their times that way, so a time written in the local zone shows in tests run
+// in another zone.
+func column(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func (s sessionRepository) Create(_ context.Context, session *repository.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[session.SessionKey]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	row := *session
+	row.LastUsed = column(row.LastUsed)
+	row.ExpiresAt = column(row.ExpiresAt)
+	row.AuthenticatedAt = column(row.AuthenticatedAt)
+	row.CreatedAt = column(row.CreatedAt)
+	row.UpdatedAt = column(row.UpdatedAt)
+	s.sessions[session.SessionKey] = &row
+	return nil
+}
+
+func (s sessionRepository) GetAll(_ context.Context) ([]*repository.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.find(func(*repository.Session) bool { return true }), nil
+}
+
+func (s sessionRepository) Get(_ context.Context, sessionKey string) (*repository.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionKey]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	row := *session
+	return &row, nil
+}
+
+func (s sessionRepository) GetAllByUser(_ context.Context, userID int64) ([]*repository.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	return s.find(func(session *repository.Session) bool {
+		return session.UserID == userID && session.ExpiresAt.After(now)
+	}), nil
+}
+
+// find returns copies of the sessions matching, the oldest first
+func (s sessionRepository) find(match func(*repository.Session) bool) []*repository.Session {
+	// Like gorm, nothing found is an empty slice
+	sessions := []*repository.Session{}
+	for _, session := range s.sessions {
+		if match(session) {
+			row := *session
+			sessions = append(sessions, &row)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// update changes the session with the key if there is one
+func (s sessionRepository) update(sessionKey string, change func(*repository.Session)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[sessionKey]; ok {
+		change(session)
+		session.UpdatedAt = column(time.Now())
+	}
+	return nil
+}
+
+func (s sessionRepository) UpdateActivity(_ context.Context, sessionKey string, lastUsed time.Time, expiresAt time.Time) error {
+	return s.update(sessionKey, func(session *repository.Session) {
+		session.LastUsed = column(lastUsed)
+		session.ExpiresAt = column(expiresAt)
+	})
+}
+
+func (s sessionRepository) UpdateLocation(_ context.Context, sessionKey string, country string, latitude float64, longitude float64) error {
+	return s.update(sessionKey, func(session *repository.Session) {
+		session.LastCountry = country
+		session.LastLatitude = &latitude
+		session.LastLongitude = &longitude
+	})
+}
+
+func (s sessionRepository) UpdateAnomalies(_ context.Context, sessionKey string, anomalies string, reauthRequired bool) error {
+	return s.update(sessionKey, func(session *repository.Session) {
+		session.Anomalies = anomalies
+		session.ReauthRequired = reauthRequired
+	})
+}
+
+func (s sessionRepository) Reauthenticate(_ context.Context, reauthenticated *repository.Session) error {
+	return s.update(reauthenticated.SessionKey, func(session *repository.Session) {
+		session.AuthenticatedAt = column(reauthenticated.AuthenticatedAt)
+		session.AuthLevel = reauthenticated.AuthLevel
+		session.ReauthRequired = reauthenticated.ReauthRequired
+		session.Anomalies = reauthenticated.Anomalies
+		session.IPPrefix = reauthenticated.IPPrefix
+		session.UserAgentFamily = reauthenticated.UserAgentFamily
+		session.DeviceHash = reauthenticated.DeviceHash
+		session.LastCountry = reauthenticated.LastCountry
+		session.LastLatitude = reauthenticated.LastLatitude
+		session.LastLongitude = reauthenticated.LastLongitude
+	})
+}
+
+func (s sessionRepository) Delete(_ context.Context, sessionKey string) error {
+	return s.update(sessionKey, func(session *repository.Session) {
+		session.ExpiresAt = column(time.Now())
+	})
+}
+
+func (s sessionRepository) HardDelete(_ context.Context, sessionKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionKey)
+	return nil
+}
+
+func (s sessionRepository) HardDeleteAllExpired(_ context.Context) (int64, error) {
+	return s.deleteAll(s.expired()), nil
+}
+
+func (s sessionRepository) HardDeleteAllInactive(_ context.Context, rememberMe bool, idleTimeout time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inactive := s.inactive(rememberMe, idleTimeout)
+	keys := []string{}
+	for key, session := range s.sessions {
+		if inactive(session) {
+			delete(s.sessions, key)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s sessionRepository) CountExpired(_ context.Context) (int64, error) {
+	return s.count(s.expired()), nil
+}
+
+func (s sessionRepository) CountInactive(_ context.Context, rememberMe bool, idleTimeout time.Duration) (int64, error) {
+	return s.count(s.inactive(rememberMe, idleTimeout)), nil
+}
+
+func (s sessionRepository) CountActive(_ context.Context) (int64, error) {
+	now := time.Now()
+	return s.count(func(session *repository.Session) bool { return session.ExpiresAt.After(now) }), nil
+}
+
+func (s sessionRepository) expired() func(*repository.Session) bool {
+	now := time.Now()
+	return func(session *repository.Session) bool { return session.ExpiresAt.Before(now) }
+}
+
+func (s sessionRepository) inactive(rememberMe bool, idleTimeout time.Duration) func(*repository.Session) bool {
+	cutoff := time.Now().Add(-idleTimeout)
+	return func(session *repository.Session) bool {
+		return session.RememberMe == rememberMe && session.LastUsed.Before(cutoff) && session.CreatedAt.Before(cutoff)
+	}
+}
+
+func (s sessionRepository) count(match func(*repository.Session) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, session := range s.sessions {
+		if match(session) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s sessionRepository) deleteAll(match func(*repository.Session) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for key, session := range s.sessions {
+		if match(session) {
+			delete(s.sessions, key)
+			count++
+		}
+	}
+	return count
+}
+
+type tokenRepository struct{ *Store }
+
+func (t tokenRepository) Create(_ context.Context, token *repository.Token) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.tokens[token.TokenHash]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	token.CreatedAt = time.Now()
+	row := *token
+	t.tokens[token.TokenHash] = &row
+	return nil
+}
+
+func (t tokenRepository) Get(_ context.Context, tokenHash string, tokenType string) (*repository.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[tokenHash]
+	if !ok || token.Type != tokenType {
+		return nil, gorm.ErrRecordNotFound
+	}
+	row := *token
+	return &row, nil
+}
+
+func (t tokenRepository) Take(_ context.Context, tokenHash string, tokenType string) (*repository.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[tokenHash]
+	if !ok || token.Type != tokenType {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(t.tokens, tokenHash)
+	return token, nil
+}
+
+func (t tokenRepository) Delete(_ context.Context, tokenHash string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tokens, tokenHash)
+	return nil
+}
+
+func (t tokenRepository) DeleteExpired(_ context.Context) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	var count int64
+	for key, token := range t.tokens {
+		if token.ExpiresAt.Before(now) {
+			delete(t.tokens, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// deviceKey is the primary key of the known devices
+type deviceKey struct {
+	userID int64
+	key    string
+}
+
+type deviceRepository struct{ *Store }
+
+func (d deviceRepository) Touch(_ context.Context, device *repository.KnownDevice) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := deviceKey{userID: device.UserID, key: device.DeviceKey}
+	if known, ok := d.devices[key]; ok {
+		known.UserAgentFamily = device.UserAgentFamily
+		known.IPPrefix = device.IPPrefix
+		known.Country = device.Country
+		known.LastSeenAt = device.LastSeenAt
+		return false, nil
+	}
+	others := 0
+	for _, known := range d.devices {
+		if known.UserID == device.UserID {
+			others++
+		}
+	}
+	row := *device
+	d.devices[key] = &row
+	return others > 0, nil
+}
+
+func (d deviceRepository) GetAllByUser(_ context.Context, userID int64) ([]*repository.KnownDevice, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Like gorm, nothing found is an empty slice
+	devices := []*repository.KnownDevice{}
+	for _, device := range d.devices {
+		if device.UserID == userID {
+			row := *device
+			devices = append(devices, &row)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].LastSeenAt.After(devices[j].LastSeenAt) })
+	return devices, nil
+}
+
+type passkeyRepository struct{ *Store }
+
+func (p passkeyRepository) Create(_ context.Context, passkey *repository.Passkey) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.createPasskey(passkey)
+}
+
+func (s *Store) createPasskey(passkey *repository.Passkey) error {
+	for _, existing := range s.passkeys {
+		if bytes.Equal(existing.CredentialID, passkey.CredentialID) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	passkey.ID = s.id()
+	passkey.CreatedAt = time.Now()
+	row := *passkey
+	s.passkeys[passkey.ID] = &row
+	return nil
+}
+
+func (p passkeyRepository) CreateWithUser(_ context.Context, user *repository.Auth, passkey *repository.Passkey) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.createUser(user); err != nil {
+		return err
+	}
+	passkey.UserID = user.ID
+	if err := p.createPasskey(passkey); err != nil {
+		delete(p.users, user.ID)
+		return err
+	}
+	return nil
+}
+
+func (p passkeyRepository) GetAllByUser(_ context.Context, userID int64) ([]*repository.Passkey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Like gorm, nothing found is an empty slice
+	passkeys := []*repository.Passkey{}
+	for _, passkey := range p.passkeys {
+		if passkey.UserID == userID {
+			row := *passkey
+			passkeys = append(passkeys, &row)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool { return passkeys[i].ID < passkeys[j].ID })
+	return passkeys, nil
+}
+
+func (p passkeyRepository) GetByCredentialID(_ context.Context, credentialID []byte) (*repository.Passkey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, passkey := range p.passkeys {
+		if bytes.Equal(passkey.CredentialID, credentialID) {
+			row := *passkey
+			return &row, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (p passkeyRepository) UpdateUsage(_ context.Context, used *repository.Passkey) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if passkey, ok := p.passkeys[used.ID]; ok {
+		passkey.SignCount = used.SignCount
+		passkey.BackupState = used.BackupState
+		passkey.LastUsedAt = used.LastUsedAt
+	}
+	return nil
+}
+
+func (p passkeyRepository) Rename(_ context.Context, userID int64, id int64, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	passkey, ok := p.passkeys[id]
+	if !ok || passkey.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	passkey.Name = name
+	return nil
+}
+
+func (p passkeyRepository) Delete(_ context.Context, userID int64, id int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.users[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	passkey, ok := p.passkeys[id]
+	if !ok || passkey.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	if !user.HasPassword() {
+		left := 0
+		for _, other := range p.passkeys {
+			if other.UserID == userID {
+				left++
+			}
+		}
+		if left == 1 {
+			return repository.ErrLastPasskey
+		}
+	}
+	delete(p.passkeys, id)
+	return nil
+}
+
+type jobRunRepository struct{ *Store }
+
+func (j jobRunRepository) Record(_ context.Context, run scheduler.Run) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.runs = append(j.runs, run)
+	return nil
+}
+
+func (j jobRunRepository) Last(ctx context.Context, job string) (*scheduler.Run, error) {
+	runs, err := j.List(ctx, job, 1)
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return &runs[0], nil
+}
+
+func (j jobRunRepository) List(_ context.Context, job string, limit int) ([]scheduler.Run, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	runs := make([]scheduler.Run, 0)
+	for i := len(j.runs) - 1; i >= 0 && (limit <= 0 || len(runs) < limit); i-- {
+		if j.runs[i].Job == job {
+			runs = append(runs, j.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func (j jobRunRepository) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	kept := j.runs[:0]
+	for _, run := range j.runs {
+		if !run.StartedAt.Before(before) {
+			kept = append(kept, run)
+		}
+	}
+	count := int64(len(j.runs) - len(kept))
+	j.runs = kept
+	return count, nil
+}
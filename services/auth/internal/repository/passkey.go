@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ErrLastPasskey is returned when deleting the only passkey of an account without a password,
+// the user could not log in anymore
+var ErrLastPasskey = errors.New("last passkey of an account without a password")
+
+// Passkey represents a WebAuthn credential of a user
+type Passkey struct {
+	ID     int64 `json:"id" gorm:"column:id;primaryKey"`
+	UserID int64 `json:"-" gorm:"column:user_id;index"`
+	// Name tells the user's passkeys apart, e.g. "Work laptop"
+	Name string `json:"name" gorm:"column:name"`
+	// CredentialID is the ID the authenticator knows the credential by
+	CredentialID    []byte `json:"-" gorm:"column:credential_id;uniqueIndex"`
+	PublicKey       []byte `json:"-" gorm:"column:public_key"`
+	AttestationType string `json:"-" gorm:"column:attestation_type"`
+	// Transports are how the browser reaches the authenticator, comma separated, e.g. "internal,hybrid"
+	Transports string `json:"-" gorm:"column:transports"`
+	// AAGUID identifies the model of the authenticator
+	AAGUID []byte `json:"-" gorm:"column:aaguid"`
+	// SignCount is the signature counter of the last assertion, 0 for authenticators without one
+	SignCount uint32 `json:"-" gorm:"column:sign_count"`
+	// BackupEligible and BackupState tell whether the passkey can be and is synced to other devices
+	BackupEligible bool       `json:"backup_eligible" gorm:"column:backup_eligible"`
+	BackupState    bool       `json:"backup_state" gorm:"column:backup_state"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty" gorm:"column:last_used_at"`
+}
+
+func (Passkey) TableName() string {
+	return "passkeys"
+}
+
+// PasskeyRepository represents the repository for the passkeys of the users
+type PasskeyRepository interface {
+	Create(ctx context.Context, passkey *Passkey) error
+	// CreateWithUser creates a user signing up with a passkey together with the passkey
+	CreateWithUser(ctx context.Context, user *Auth, passkey *Passkey) error
+	// GetAllByUser returns the passkeys of the user, the oldest first
+	GetAllByUser(ctx context.Context, userID int64) ([]*Passkey, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error)
+	// UpdateUsage writes an assertion made with the passkey
+	UpdateUsage(ctx context.Context, passkey *Passkey) error
+	// Rename renames a passkey of the user
+	Rename(ctx context.Context, userID int64, id int64, name string) error
+	// Delete deletes a passkey of the user. The last passkey of a user without a password is
+	// kept and ErrLastPasskey returned.
+	Delete(ctx context.Context, userID int64, id int64) error
+}
+
+type passkeyRepository struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewPasskeyRepository creates the repository, a nil logger stands for the global logger
+func NewPasskeyRepository(db *gorm.DB, logger *logrus.Logger) PasskeyRepository {
+	return &passkeyRepository{db: db, logger: logger}
+}
+
+func (p passkeyRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(p.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
+}
+
+func (p passkeyRepository) Create(ctx context.Context, passkey *Passkey) (err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	p.log(ctx).Debug("Creating passkey for user with ID: ", passkey.UserID)
+	return p.db.WithContext(ctx).Create(passkey).Error
+}
+
+func (p passkeyRepository) CreateWithUser(ctx context.Context, user *Auth, passkey *Passkey) (err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.CreateWithUser")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	p.log(ctx).Debug("Creating user with email: ", user.Email, " and their passkey")
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		passkey.UserID = user.ID
+		return tx.Create(passkey).Error
+	})
+}
+
+func (p passkeyRepository) GetAllByUser(ctx context.Context, userID int64) (_ []*Passkey, err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.GetAllByUser")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	p.log(ctx).Debug("Getting passkeys of user with ID: ", userID)
+	var passkeys []*Passkey
+	err = p.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at, id").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func (p passkeyRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (_ *Passkey, err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.GetByCredentialID")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var passkey Passkey
+	err = p.db.WithContext(ctx).Where("credential_id = ?", credentialID).First(&passkey).Error
+	if err != nil {
+		p.log(ctx).Debug("Failed to get passkey by credential ID: ", err)
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+func (p passkeyRepository) UpdateUsage(ctx context.Context, passkey *Passkey) (err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.UpdateUsage")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return p.db.WithContext(ctx).Model(&Passkey{}).Where("id = ?", passkey.ID).Updates(map[string]interface{}{
+		"sign_count":   passkey.SignCount,
+		"backup_state": passkey.BackupState,
+		"last_used_at": passkey.LastUsedAt,
+	}).Error
+}
+
+func (p passkeyRepository) Rename(ctx context.Context, userID int64, id int64, name string) (err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.Rename")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	result := p.db.WithContext(ctx).Model(&Passkey{}).Where("id = ? AND user_id = ?", id, userID).Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (p passkeyRepository) Delete(ctx context.Context, userID int64, id int64) (err error) {
+	ctx, span := startSpan(ctx, "PasskeyRepository.Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	p.log(ctx).Debug("Deleting passkey with ID: ", id, " of user with ID: ", userID)
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The user is locked so concurrent deletions cannot remove the last passkey together
+		var user Auth
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Passkey{}, "id = ? AND user_id = ?", id, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if user.HasPassword() {
+			return nil
+		}
+		// Returning the error rolls the deletion back
+		var left int64
+		if err := tx.Model(&Passkey{}).Where("user_id = ?", userID).Count(&left).Error; err != nil {
+			return err
+		}
+		if left == 0 {
+			return ErrLastPasskey
+		}
+		return nil
+	})
+}
@@ -2,112 +2,280 @@ package repository
 
 import (
 	"auth/pkg/utils"
+	"context"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
 const (
-	// SessionTTL represents the time to live for the session in seconds. By default, it is set to 1 year.
+	// SessionTTL represents the default time to live for the session in seconds, 1 year.
 	SessionTTL = 60 * 60 * 24 * 365
 )
 
+// inactiveCondition matches sessions of a policy neither used nor created since a cutoff, sessions
+// that were never validated keep their creation time as the last activity
+const inactiveCondition = "remember_me = ? AND last_used < ? AND created_at < ?"
+
 // Session represents a session in the database
 type Session struct {
-	SessionKey string    `json:"session_key" gorm:"primaryKey" gorm:"column:session_key"`
-	UserID     int64     `json:"user_id" gorm:"column:user_id"`
-	LastUsed   time.Time `json:"last_used" gorm:"column:last_used"`
-	ExpiresAt  time.Time `json:"expires_at" gorm:"column:expires_at"`
-	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at" gorm:"autoCreateTime"`
-	UpdatedAt  time.Time `json:"updated_at" gorm:"column:updated_at" gorm:"autoUpdateTime"`
+	SessionKey string    `json:"session_key" gorm:"column:session_key;primaryKey"`
+	UserID     int64     `json:"user_id" gorm:"column:user_id;index"`
+	LastUsed   time.Time `json:"last_used" gorm:"column:last_used;index"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"column:expires_at;index"`
+	// RememberMe selects the long session policy
+	RememberMe bool `json:"remember_me" gorm:"column:remember_me"`
+	// IPPrefix, UserAgentFamily and DeviceHash are the client the session is bound to,
+	// empty if unknown
+	IPPrefix        string `json:"ip_prefix" gorm:"column:ip_prefix"`
+	UserAgentFamily string `json:"user_agent_family" gorm:"column:user_agent_family"`
+	DeviceHash      string `json:"-" gorm:"column:device_hash"`
+	// LastCountry, LastLatitude and LastLongitude are where the session was last used
+	LastCountry   string   `json:"last_country,omitempty" gorm:"column:last_country"`
+	LastLatitude  *float64 `json:"-" gorm:"column:last_latitude"`
+	LastLongitude *float64 `json:"-" gorm:"column:last_longitude"`
+	// Anomalies lists the anomalies flagged on the session, comma separated
+	Anomalies string `json:"anomalies,omitempty" gorm:"column:anomalies"`
+	// ReauthRequired rejects the session until the user enters their password again
+	ReauthRequired bool `json:"reauth_required" gorm:"column:reauth_required"`
+	// AuthenticatedAt is when the user last proved their identity in the session, at login or
+	// re-authentication
+	AuthenticatedAt time.Time `json:"authenticated_at" gorm:"column:authenticated_at"`
+	// AuthLevel is the level of that proof, e.g. auth.AuthLevelPassword
+	AuthLevel int       `json:"auth_level" gorm:"column:auth_level"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
 }
 
 func (Session) TableName() string {
 	return "sessions"
 }
 
-func NewSession(userID int64) *Session {
-
+// NewSession returns a session of the user expiring after ttl, the user just logged in with the
+// level, e.g. auth.AuthLevelPassword
+func NewSession(userID int64, ttl time.Duration, rememberMe bool, level int) *Session {
+	// The columns have no time zone, times are stored in UTC like everywhere in the repositories
+	now := time.Now().UTC()
 	return &Session{
-		SessionKey: utils.GenerateRandomString(64),
-		UserID:     userID,
-		LastUsed:   time.Unix(0, 0),
-		ExpiresAt:  time.Now().Add(time.Second * SessionTTL),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		SessionKey:      utils.GenerateRandomString(64),
+		UserID:          userID,
+		LastUsed:        now,
+		ExpiresAt:       now.Add(ttl),
+		RememberMe:      rememberMe,
+		AuthenticatedAt: now,
+		AuthLevel:       level,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
 }
 
 // SessionRepository represents the repository for the session
 type SessionRepository interface {
-	Create(session *Session) error
-	GetAll() ([]*Session, error)
-	Get(sessionKey string) (*Session, error)
-	UpdateLastUsed(sessionKey string) error
-	Delete(sessionKey string) error
-	HardDelete(sessionKey string) error
-	HardDeleteAllExpired() error
-	HardDeleteAllInactive() error
+	Create(ctx context.Context, session *Session) error
+	GetAll(ctx context.Context) ([]*Session, error)
+	Get(ctx context.Context, sessionKey string) (*Session, error)
+	// GetAllByUser returns the sessions of the user that are not expired
+	GetAllByUser(ctx context.Context, userID int64) ([]*Session, error)
+	// UpdateActivity writes the last use of a session and its expiry, which a renewal extends
+	UpdateActivity(ctx context.Context, sessionKey string, lastUsed time.Time, expiresAt time.Time) error
+	// UpdateLocation writes where the session was last used
+	UpdateLocation(ctx context.Context, sessionKey string, country string, latitude float64, longitude float64) error
+	// UpdateAnomalies writes the anomalies flagged on the session and whether it requires re-authentication
+	UpdateAnomalies(ctx context.Context, sessionKey string, anomalies string, reauthRequired bool) error
+	// Reauthenticate writes the re-authentication of a session: when and how the user proved
+	// their identity, the client the session is bound to from now on and its cleared anomalies
+	Reauthenticate(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, sessionKey string) error
+	HardDelete(ctx context.Context, sessionKey string) error
+	// HardDeleteAllExpired deletes expired sessions and returns how many were deleted
+	HardDeleteAllExpired(ctx context.Context) (int64, error)
+	// HardDeleteAllInactive deletes sessions of a policy idle for longer than idleTimeout and returns their keys
+	HardDeleteAllInactive(ctx context.Context, rememberMe bool, idleTimeout time.Duration) ([]string, error)
+	// CountExpired returns the number of sessions HardDeleteAllExpired would delete
+	CountExpired(ctx context.Context) (int64, error)
+	// CountInactive returns the number of sessions HardDeleteAllInactive would delete
+	CountInactive(ctx context.Context, rememberMe bool, idleTimeout time.Duration) (int64, error)
+	// CountActive returns the number of sessions that are not expired
+	CountActive(ctx context.Context) (int64, error)
 }
 
 type sessionRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	logger *logrus.Logger
 }
 
-func NewSessionRepository(db *gorm.DB) SessionRepository {
-	return &sessionRepository{db: db}
+// NewSessionRepository creates the repository, a nil logger stands for the global logger
+func NewSessionRepository(db *gorm.DB, logger *logrus.Logger) SessionRepository {
+	return &sessionRepository{db: db, logger: logger}
 }
 
-func (s sessionRepository) GetAll() ([]*Session, error) {
-	logging.Logger.Debug("Getting all sessions")
+func (s sessionRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(s.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
+}
+
+func (s sessionRepository) GetAll(ctx context.Context) (_ []*Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.GetAll")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Getting all sessions")
 	var sessions []*Session
-	err := s.db.Find(&sessions).Error
+	err = s.db.WithContext(ctx).Find(&sessions).Error
 	if err != nil {
-		logging.Logger.Error("Failed to get all sessions: ", err)
+		s.log(ctx).Error("Failed to get all sessions: ", err)
 		return nil, err
 	}
-	logging.Logger.Debug("Found ", len(sessions), " sessions")
+	s.log(ctx).Debug("Found ", len(sessions), " sessions")
 	return sessions, nil
 }
 
-func (s sessionRepository) Create(session *Session) error {
-	logging.Logger.Debug("Creating session with key: ", session.SessionKey[:5], "...")
-	return s.db.Create(session).Error
+func (s sessionRepository) Create(ctx context.Context, session *Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Creating session with key: ", logging.Fingerprint(session.SessionKey))
+	return s.db.WithContext(ctx).Create(session).Error
 }
 
-func (s sessionRepository) Get(sessionKey string) (*Session, error) {
-	logging.Logger.Debug("Getting session with key: ", sessionKey[:5], "...")
+func (s sessionRepository) Get(ctx context.Context, sessionKey string) (_ *Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.Get")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Getting session with key: ", logging.Fingerprint(sessionKey))
 	var session Session
-	err := s.db.Where("session_key = ?", sessionKey).Where("expires_at > ?", time.Now()).First(&session).Error
+	err = s.db.WithContext(ctx).Where("session_key = ?", sessionKey).Where("expires_at > ?", time.Now().UTC()).First(&session).Error
 	if err != nil {
-		logging.Logger.Error("Failed to get session with key: ", sessionKey[:5], "... - ", err)
+		s.log(ctx).Error("Failed to get session with key: ", logging.Fingerprint(sessionKey), " - ", err)
 		return nil, err
 	}
-	logging.Logger.Debug("Session found with key: ", sessionKey[:5], "...")
+	s.log(ctx).Debug("Session found with key: ", logging.Fingerprint(sessionKey))
 	return &session, nil
 }
 
-func (s sessionRepository) UpdateLastUsed(session string) error {
-	logging.Logger.Debug("Updating last used time for session with key: ", session[:5], "...")
-	return s.db.Model(&Session{}).Where("session_key = ?", session).Update("last_used", time.Now()).Error
+func (s sessionRepository) GetAllByUser(ctx context.Context, userID int64) (_ []*Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.GetAllByUser")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Getting sessions of user with ID: ", userID)
+	var sessions []*Session
+	err = s.db.WithContext(ctx).Where("user_id = ?", userID).Where("expires_at > ?", time.Now().UTC()).Find(&sessions).Error
+	return sessions, err
+}
+
+func (s sessionRepository) UpdateActivity(ctx context.Context, sessionKey string, lastUsed time.Time, expiresAt time.Time) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.UpdateActivity")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Updating activity of session with key: ", logging.Fingerprint(sessionKey))
+	return s.db.WithContext(ctx).Model(&Session{}).Where("session_key = ?", sessionKey).
+		Updates(map[string]interface{}{"last_used": lastUsed.UTC(), "expires_at": expiresAt.UTC()}).Error
+}
+
+func (s sessionRepository) UpdateLocation(ctx context.Context, sessionKey string, country string, latitude float64, longitude float64) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.UpdateLocation")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Updating location of session with key: ", logging.Fingerprint(sessionKey))
+	return s.db.WithContext(ctx).Model(&Session{}).Where("session_key = ?", sessionKey).
+		Updates(map[string]interface{}{"last_country": country, "last_latitude": latitude, "last_longitude": longitude}).Error
+}
+
+func (s sessionRepository) UpdateAnomalies(ctx context.Context, sessionKey string, anomalies string, reauthRequired bool) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.UpdateAnomalies")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Updating anomalies of session with key: ", logging.Fingerprint(sessionKey))
+	return s.db.WithContext(ctx).Model(&Session{}).Where("session_key = ?", sessionKey).
+		Updates(map[string]interface{}{"anomalies": anomalies, "reauth_required": reauthRequired}).Error
+}
+
+func (s sessionRepository) Reauthenticate(ctx context.Context, session *Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.Reauthenticate")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Re-authenticating session with key: ", logging.Fingerprint(session.SessionKey))
+	return s.db.WithContext(ctx).Model(&Session{}).Where("session_key = ?", session.SessionKey).
+		Updates(map[string]interface{}{
+			"authenticated_at":  session.AuthenticatedAt.UTC(),
+			"auth_level":        session.AuthLevel,
+			"reauth_required":   session.ReauthRequired,
+			"anomalies":         session.Anomalies,
+			"ip_prefix":         session.IPPrefix,
+			"user_agent_family": session.UserAgentFamily,
+			"device_hash":       session.DeviceHash,
+			"last_country":      session.LastCountry,
+			"last_latitude":     session.LastLatitude,
+			"last_longitude":    session.LastLongitude,
+		}).Error
 }
 
-func (s sessionRepository) Delete(sessionKey string) error {
-	logging.Logger.Debug("Expiring session with key: ", sessionKey[:5], "...")
-	return s.db.Model(&Session{}).Where("session_key = ?", sessionKey).Update("expires_at", time.Now()).Error
+func (s sessionRepository) Delete(ctx context.Context, sessionKey string) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Expiring session with key: ", logging.Fingerprint(sessionKey))
+	return s.db.WithContext(ctx).Model(&Session{}).Where("session_key = ?", sessionKey).Update("expires_at", time.Now().UTC()).Error
 }
 
-func (s sessionRepository) HardDelete(sessionKey string) error {
-	logging.Logger.Debug("Deleting session with key: ", sessionKey[:5], "...")
-	return s.db.Delete(&Session{}, "session_key = ?", sessionKey).Error
+func (s sessionRepository) HardDelete(ctx context.Context, sessionKey string) (err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.HardDelete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Deleting session with key: ", logging.Fingerprint(sessionKey))
+	return s.db.WithContext(ctx).Delete(&Session{}, "session_key = ?", sessionKey).Error
 }
 
-func (s sessionRepository) HardDeleteAllExpired() error {
-	logging.Logger.Debug("Deleting all expired sessions...")
-	return s.db.Delete(&Session{}, "expires_at < ?", time.Now()).Error
+func (s sessionRepository) HardDeleteAllExpired(ctx context.Context) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.HardDeleteAllExpired")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Deleting all expired sessions...")
+	result := s.db.WithContext(ctx).Delete(&Session{}, "expires_at < ?", time.Now().UTC())
+	return result.RowsAffected, result.Error
 }
 
-func (s sessionRepository) HardDeleteAllInactive() error {
-	logging.Logger.Debug("Deleting all inactive sessions...")
-	return s.db.Delete(&Session{}, "last_used < ?", time.Now().Add(-time.Second*SessionTTL)).Error
+func (s sessionRepository) HardDeleteAllInactive(ctx context.Context, rememberMe bool, idleTimeout time.Duration) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.HardDeleteAllInactive")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	s.log(ctx).Debug("Deleting all inactive sessions...")
+	cutoff := time.Now().UTC().Add(-idleTimeout)
+	var deleted []Session
+	err = s.db.WithContext(ctx).Clauses(clause.Returning{Columns: []clause.Column{{Name: "session_key"}}}).
+		Where(inactiveCondition, rememberMe, cutoff, cutoff).Delete(&deleted).Error
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(deleted))
+	for _, session := range deleted {
+		keys = append(keys, session.SessionKey)
+	}
+	return keys, nil
+}
+
+func (s sessionRepository) CountExpired(ctx context.Context) (count int64, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.CountExpired")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	err = s.db.WithContext(ctx).Model(&Session{}).Where("expires_at < ?", time.Now().UTC()).Count(&count).Error
+	return count, err
+}
+
+func (s sessionRepository) CountInactive(ctx context.Context, rememberMe bool, idleTimeout time.Duration) (count int64, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.CountInactive")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	cutoff := time.Now().UTC().Add(-idleTimeout)
+	err = s.db.WithContext(ctx).Model(&Session{}).Where(inactiveCondition, rememberMe, cutoff, cutoff).Count(&count).Error
+	return count, err
+}
+
+func (s sessionRepository) CountActive(ctx context.Context) (count int64, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.CountActive")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	err = s.db.WithContext(ctx).Model(&Session{}).Where("expires_at > ?", time.Now().UTC()).Count(&count).Error
+	return count, err
 }
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Token represents a one-time token in the database, e.g. an e-mail verification link or the
+// challenge of a passkey ceremony. Only the hash of the token is stored.
+type Token struct {
+	TokenHash string `json:"-" gorm:"column:token_hash;primaryKey"`
+	Type      string `json:"type" gorm:"column:type"`
+	// UserID is the user the token was issued to, 0 if there is none yet
+	UserID int64 `json:"user_id" gorm:"column:user_id;index"`
+	// Data is what the token stands for, its format is up to the type
+	Data      []byte    `json:"-" gorm:"column:data"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"column:expires_at;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+func (Token) TableName() string {
+	return "tokens"
+}
+
+// TokenRepository represents the repository for one-time tokens
+type TokenRepository interface {
+	Create(ctx context.Context, token *Token) error
+	// Get returns the token of the type with the hash, expired or not
+	Get(ctx context.Context, tokenHash string, tokenType string) (*Token, error)
+	// Take deletes the token of the type with the hash and returns it, a token is taken once
+	// however many requests race for it
+	Take(ctx context.Context, tokenHash string, tokenType string) (*Token, error)
+	Delete(ctx context.Context, tokenHash string) error
+	// DeleteExpired deletes expired tokens and returns how many were deleted
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type tokenRepository struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewTokenRepository creates the repository, a nil logger stands for the global logger
+func NewTokenRepository(db *gorm.DB, logger *logrus.Logger) TokenRepository {
+	return &tokenRepository{db: db, logger: logger}
+}
+
+func (t tokenRepository) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(t.logger, ctx).WithField(logging.LoggerNameField, "auth.repository")
+}
+
+func (t tokenRepository) Create(ctx context.Context, token *Token) (err error) {
+	ctx, span := startSpan(ctx, "TokenRepository.Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	t.log(ctx).Debug("Creating token of type: ", token.Type, " for user with ID: ", token.UserID)
+	return t.db.WithContext(ctx).Create(token).Error
+}
+
+func (t tokenRepository) Get(ctx context.Context, tokenHash string, tokenType string) (_ *Token, err error) {
+	ctx, span := startSpan(ctx, "TokenRepository.Get")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var token Token
+	err = t.db.WithContext(ctx).Where("token_hash = ? AND type = ?", tokenHash, tokenType).First(&token).Error
+	if err != nil {
+		t.log(ctx).Debug("Failed to get token of type: ", tokenType, " - ", err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (t tokenRepository) Take(ctx context.Context, tokenHash string, tokenType string) (_ *Token, err error) {
+	ctx, span := startSpan(ctx, "TokenRepository.Take")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var tokens []Token
+	err = t.db.WithContext(ctx).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND type = ?", tokenHash, tokenType).
+		Delete(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		t.log(ctx).Debug("No token of type: ", tokenType, " to take")
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (t tokenRepository) Delete(ctx context.Context, tokenHash string) (err error) {
+	ctx, span := startSpan(ctx, "TokenRepository.Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return t.db.WithContext(ctx).Delete(&Token{}, "token_hash = ?", tokenHash).Error
+}
+
+func (t tokenRepository) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "TokenRepository.DeleteExpired")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	t.log(ctx).Debug("Deleting expired tokens")
+	result := t.db.WithContext(ctx).Delete(&Token{}, "expires_at < ?", time.Now().UTC())
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("auth/internal/repository")
+
+// startSpan starts a client span around a database call
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+}
@@ -1,182 +1,306 @@
 package service
 
 import (
+	"auth/internal/binding"
 	"auth/internal/messages"
 	"auth/internal/repository"
+	"auth/pkg/auth"
+	"auth/pkg/utils"
+	"context"
 	"errors"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"strconv"
+	"time"
 )
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+// errWrongEmailOrPassword is the failed login with a password
+var errWrongEmailOrPassword = ErrInvalidCredentials.WithMessage("AUTH_INVALID_CREDENTIALS.password", nil)
 
 type AuthService interface {
-	Login(req *messages.AuthRequest) (*messages.AuthResponse, error)
-	Register(req *messages.AuthRequest) (*messages.AuthResponse, error)
-	Logout(token string) error
-	ChangePassword(req *messages.PasswordChangeRequest) error
-	ResetPassword(req *messages.PasswordChange, token string) error
-	VerifyUser(token string) error
-	GetUserData(userID int64) (*messages.AuthDataResponse, error)
+	// Login authenticates the user and opens a session bound to the client
+	Login(ctx context.Context, req *messages.AuthRequest, client binding.Client) (*messages.AuthResponse, error)
+	// Register creates the user and opens a session bound to the client
+	Register(ctx context.Context, req *messages.AuthRequest, client binding.Client) (*messages.AuthResponse, error)
+	// Reauthenticate confirms the password of the session's user, for operations requiring a recent
+	// authentication and sessions requiring re-authentication after an anomaly
+	Reauthenticate(ctx context.Context, token string, req *messages.ReauthRequest, client binding.Client) (*messages.ReauthResponse, error)
+	Logout(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, req *messages.PasswordChangeRequest) error
+	ResetPassword(ctx context.Context, req *messages.PasswordChange, token string) error
+	VerifyUser(ctx context.Context, token string) error
+	GetUserData(ctx context.Context, userID int64) (*messages.AuthDataResponse, error)
+	// SetLanguage sets the language the user is answered and e-mailed in, empty to negotiate it
+	SetLanguage(ctx context.Context, userID int64, language string) error
+
+	// CreateAdmin creates an active administrator. Admin method
+	CreateAdmin(ctx context.Context, email string, password string) (*repository.Auth, error)
+	// FindUser returns the user with the ID or e-mail. Admin method
+	FindUser(ctx context.Context, idOrEmail string) (*repository.Auth, error)
+	// SuspendUser blocks logins of the user and revokes their sessions. Admin method
+	SuspendUser(ctx context.Context, userID int64) error
+	// UnsuspendUser allows the user to log in again. Admin method
+	UnsuspendUser(ctx context.Context, userID int64) error
+	// SetPassword replaces the password of the user and revokes their sessions. Admin method
+	SetPassword(ctx context.Context, userID int64, password string) error
+	// ScheduleDeletion marks the user for deletion and revokes their sessions. Admin method
+	ScheduleDeletion(ctx context.Context, userID int64) error
+	// PurgeDeletedAccounts deletes users marked for deletion longer than gracePeriod ago and
+	// returns how many. Admin method
+	PurgeDeletedAccounts(ctx context.Context, gracePeriod time.Duration) (int64, error)
 }
 
 type authService struct {
 	authRepo       repository.AuthRepository
 	sessionService SessionService
 	tokenService   TokenService
+	deviceService  DeviceService
+	logger         *logrus.Logger
 }
 
-func NewAuthService(authRepo repository.AuthRepository, sessionService SessionService, tokenService TokenService) AuthService {
+// NewAuthService creates the service, a nil logger stands for the global logger
+func NewAuthService(authRepo repository.AuthRepository, sessionService SessionService, tokenService TokenService, deviceService DeviceService, logger *logrus.Logger) AuthService {
 	return &authService{
 		authRepo:       authRepo,
 		sessionService: sessionService,
 		tokenService:   tokenService,
+		deviceService:  deviceService,
+		logger:         logger,
 	}
 }
 
-// Login authenticates a user
-func (a authService) Login(req *messages.AuthRequest) (*messages.AuthResponse, error) {
-	logging.Logger.Debug("Authenticating user with email: ", req.Email, "...")
+func (a authService) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(a.logger, ctx).WithField(logging.LoggerNameField, "auth.service")
+}
 
-	user, err := a.authRepo.GetByEmail(req.Email)
-	if err != nil {
-		logging.Logger.Debug("User with email: ", req.Email, " not found")
+// Login authenticates a user
+func (a authService) Login(ctx context.Context, req *messages.AuthRequest, client binding.Client) (*messages.AuthResponse, error) {
+	a.log(ctx).Debug("Authenticating user with email: ", req.Email, "...")
+
+	user, err := a.authRepo.GetByEmail(ctx, req.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		a.log(ctx).Debug("User with email: ", req.Email, " not found")
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonUnknownUser)
+		return nil, errWrongEmailOrPassword
+	} else if err != nil {
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonError)
 		return nil, err
 	}
 
-	if !user.ComparePassword(req.Password) {
-		// Unsafe logging, delete in production
-		// TODO: Implement proper logging
-		logging.Logger.Debug("Invalid credentials for user with email: ", req.Email, "Password: ", req.Password, "User password: ", user.PasswordHash)
-		return nil, ErrInvalidCredentials
+	if !user.ComparePassword(req.Password.Reveal()) {
+		a.log(ctx).Debug("Invalid credentials for user with email: ", req.Email)
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonWrongPassword)
+		return nil, errWrongEmailOrPassword
 	}
 
-	logging.Logger.Debug("User with email: ", req.Email, " authenticated successfully, creating session...")
+	if user.DeletedAt != nil {
+		// An account pending deletion is gone for its owner
+		a.log(ctx).Debug("User with email: ", req.Email, " is pending deletion")
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonUnknownUser)
+		return nil, errWrongEmailOrPassword
+	}
 
-	session, err := a.sessionService.CreateSession(user.ID)
+	if user.SuspendedAt != nil {
+		a.log(ctx).Debug("User with email: ", req.Email, " is suspended")
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonSuspended)
+		return nil, ErrUserSuspended
+	}
+
+	a.log(ctx).Debug("User with email: ", req.Email, " authenticated successfully, creating session...")
+
+	// The device is recognized before the new session counts among the user's sessions
+	a.deviceService.Recognize(ctx, user, client)
+	session, err := a.sessionService.CreateSession(ctx, user.ID, req.RememberMe, auth.AuthLevelPassword, client)
 	if err != nil {
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonError)
 		return nil, err
 	}
 
-	logging.Logger.Debug("Session created with token: ", session.Token[:5])
+	a.log(ctx).Debug("Session created with token: ", logging.Fingerprint(session.Token))
+	metrics.RecordLogin(metrics.ResultSuccess, "")
 
 	return &session, nil
 }
 
 // Register creates a new user
-func (a authService) Register(req *messages.AuthRequest) (*messages.AuthResponse, error) {
-	logging.Logger.Debug("Registering user with email: ", req.Email, "...")
+func (a authService) Register(ctx context.Context, req *messages.AuthRequest, client binding.Client) (*messages.AuthResponse, error) {
+	a.log(ctx).Debug("Registering user with email: ", req.Email, "...")
 
-	_, err := a.authRepo.GetByEmail(req.Email)
+	_, err := a.authRepo.GetByEmail(ctx, req.Email)
 	if err == nil {
-		logging.Logger.Debug("User with email: ", req.Email, " already exists")
-		return nil, gorm.ErrDuplicatedKey
+		a.log(ctx).Debug("User with email: ", req.Email, " already exists")
+		metrics.RecordRegistration(metrics.ResultFailure, metrics.ReasonDuplicate)
+		return nil, ErrEmailTaken
 	}
 
 	user := &repository.Auth{
 		Email:        req.Email,
 		PasswordHash: "",
 	}
-	user.PasswordHash = user.GeneratePasswordHash(req.Password)
+	user.PasswordHash = user.GeneratePasswordHash(req.Password.Reveal())
 
-	logging.Logger.Debug("User model created: ", user)
+	a.log(ctx).Debug("User model created for email: ", req.Email)
 
-	err = a.authRepo.Create(user)
+	err = a.authRepo.Create(ctx, user)
 	if err != nil {
-		logging.Logger.Error("Failed to create user: ", err)
+		a.log(ctx).Error("Failed to create user: ", err)
+		metrics.RecordRegistration(metrics.ResultFailure, metrics.ReasonError)
 		return nil, err
 	}
-	logging.Logger.Debug("User with email: ", req.Email, " created successfully, id: ", user.ID)
+	metrics.RecordRegistration(metrics.ResultSuccess, "")
+	a.log(ctx).Debug("User with email: ", req.Email, " created successfully, id: ", user.ID)
 
-	session, err := a.sessionService.CreateSession(user.ID)
+	// The first device of the user is known from now on, nobody is notified of it
+	a.deviceService.Recognize(ctx, user, client)
+	session, err := a.sessionService.CreateSession(ctx, user.ID, false, auth.AuthLevelPassword, client)
 	if err != nil {
 		return nil, err
 	}
 
-	logging.Logger.Debug("Session created with token: ", session.Token[:5], "...")
+	a.log(ctx).Debug("Session created with token: ", logging.Fingerprint(session.Token))
 	return &session, nil
 }
 
+// Reauthenticate confirms the password of the session's user
+func (a authService) Reauthenticate(ctx context.Context, token string, req *messages.ReauthRequest, client binding.Client) (*messages.ReauthResponse, error) {
+	a.log(ctx).Debug("Re-authenticating session with token: ", logging.Fingerprint(token))
+
+	session, err := a.sessionService.FindSession(ctx, token)
+	if err != nil {
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonInvalidToken)
+		return nil, err
+	}
+	user, err := a.authRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonError)
+		return nil, orNotFound(err, ErrInvalidSession)
+	}
+	if user.DeletedAt != nil {
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonUnknownUser)
+		return nil, ErrInvalidSession
+	}
+	if user.SuspendedAt != nil {
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonSuspended)
+		return nil, ErrUserSuspended
+	}
+
+	fields := logrus.Fields{
+		"userId":          user.ID,
+		"sessionId":       utils.HashToken(token),
+		"ip":              client.IP,
+		"userAgentFamily": binding.UserAgentFamily(client.UserAgent),
+		"reauthRequired":  session.ReauthRequired,
+	}
+	if !user.ComparePassword(req.Password.Reveal()) {
+		a.log(ctx).Debug("Invalid password for re-authentication of user with ID: ", user.ID)
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonWrongPassword)
+		logging.Audit(ctx, "session.reauth_failed", fields)
+		return nil, ErrWrongPassword
+	}
+
+	if err = a.sessionService.Reauthenticate(ctx, session, auth.AuthLevelPassword, client); err != nil {
+		metrics.RecordReauthentication(metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+	metrics.RecordReauthentication(metrics.ResultSuccess, "")
+	logging.Audit(ctx, "session.reauthenticated", fields)
+	return &messages.ReauthResponse{AuthenticatedAt: session.AuthenticatedAt, AuthLevel: session.AuthLevel}, nil
+}
+
 // Logout logs out a user
-func (a authService) Logout(token string) error {
-	logging.Logger.Debug("Logging out user with token: ", token[:10], "...")
-	return a.sessionService.DeleteSession(token)
+func (a authService) Logout(ctx context.Context, token string) error {
+	a.log(ctx).Debug("Logging out user with token: ", logging.Fingerprint(token))
+	return a.sessionService.DeleteSession(ctx, token)
 }
 
-// ChangePassword requests a password change for a user. Link is sent to the user's email
-func (a authService) ChangePassword(req *messages.PasswordChangeRequest) error {
-	user, err := a.authRepo.GetByEmail(req.Email)
+// ChangePassword requests a password change for a user. Link is sent to the user's email.
+// An unknown email succeeds as well, the endpoint must not tell which accounts exist.
+func (a authService) ChangePassword(ctx context.Context, req *messages.PasswordChangeRequest) error {
+	user, err := a.authRepo.GetByEmail(ctx, req.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		a.log(ctx).Debug("Password change requested for an unknown email")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	token := a.tokenService.GenerateToken(user.ID, TokenTypePasswordReset)
-	// to not make error
+	token, err := a.tokenService.GenerateToken(ctx, user.ID, TokenTypePasswordReset)
+	if err != nil {
+		return err
+	}
 	_ = token
 
 	// Send email with link to change password
 	// TODO: Implement email sending
-	return a.authRepo.Update(user)
+	return a.authRepo.Update(ctx, user)
 }
 
 // ResetPassword resets the password for a user
-func (a authService) ResetPassword(req *messages.PasswordChange, token string) error {
+func (a authService) ResetPassword(ctx context.Context, req *messages.PasswordChange, token string) error {
 	// Verify token
-	logging.Logger.Debug("Resetting password for token: ", token[:10], "...")
-	userID, err := a.tokenService.ValidateToken(token, TokenTypePasswordReset)
+	a.log(ctx).Debug("Resetting password for token: ", logging.Fingerprint(token))
+	userID, err := a.tokenService.ValidateToken(ctx, token, TokenTypePasswordReset)
 	if err != nil {
-		logging.Logger.Debug("Failed to validate token: ", err)
+		a.log(ctx).Debug("Failed to validate token: ", err)
+		metrics.RecordPasswordReset(metrics.ResultFailure, metrics.ReasonInvalidToken)
 		return err
 	}
 
 	// Find user by token
-	logging.Logger.Debug("Getting user by ID: ", userID, "...")
-	user, err := a.authRepo.GetByID(userID)
+	a.log(ctx).Debug("Getting user by ID: ", userID, "...")
+	user, err := a.authRepo.GetByID(ctx, userID)
 	if err != nil {
-		logging.Logger.Debug("Failed to get user by ID: ", userID, " - ", err)
-		return err
+		a.log(ctx).Debug("Failed to get user by ID: ", userID, " - ", err)
+		metrics.RecordPasswordReset(metrics.ResultFailure, metrics.ReasonError)
+		return orNotFound(err, ErrUserNotFound)
 	}
 
 	// Update user password
-	logging.Logger.Debug("Updating user password...")
-	user.GeneratePasswordHash(req.NewPassword)
-	err = a.authRepo.Update(user)
+	a.log(ctx).Debug("Updating user password...")
+	user.GeneratePasswordHash(req.NewPassword.Reveal())
+	err = a.authRepo.Update(ctx, user)
 	if err != nil {
-		logging.Logger.Debug("Failed to update user: ", err)
+		a.log(ctx).Debug("Failed to update user: ", err)
+		metrics.RecordPasswordReset(metrics.ResultFailure, metrics.ReasonError)
 		return err
 	}
 
 	// Delete token
-	logging.Logger.Debug("Deleting token: ", token[:10], "...")
-	err = a.tokenService.DeleteToken(token)
+	a.log(ctx).Debug("Deleting token: ", logging.Fingerprint(token))
+	err = a.tokenService.DeleteToken(ctx, token)
 	if err != nil {
-		logging.Logger.Error("Failed to delete token: ", err)
+		a.log(ctx).Error("Failed to delete token: ", err)
+		metrics.RecordPasswordReset(metrics.ResultFailure, metrics.ReasonError)
 		return err
 	}
 
+	metrics.RecordPasswordReset(metrics.ResultSuccess, "")
 	return nil
 }
 
 // VerifyUser verifies a user
-func (a authService) VerifyUser(token string) error {
+func (a authService) VerifyUser(ctx context.Context, token string) error {
 	// Verify token
-	userID, err := a.tokenService.ValidateToken(token, TokenTypeVerification)
+	userID, err := a.tokenService.ValidateToken(ctx, token, TokenTypeVerification)
 	if err != nil {
 		return err
 	}
 
 	// Find user by token
-	user, err := a.authRepo.GetByID(userID)
+	user, err := a.authRepo.GetByID(ctx, userID)
 	if err != nil {
-		return err
+		return orNotFound(err, ErrUserNotFound)
 	}
 
 	// Update user
 	user.Active = true
-	err = a.authRepo.Update(user)
+	err = a.authRepo.Update(ctx, user)
 
 	// Delete token
-	err = a.tokenService.DeleteToken(token)
+	err = a.tokenService.DeleteToken(ctx, token)
 	if err != nil {
 		return err
 	}
@@ -185,14 +309,143 @@ func (a authService) VerifyUser(token string) error {
 }
 
 // GetUserData returns user data
-func (a authService) GetUserData(userID int64) (*messages.AuthDataResponse, error) {
-	user, err := a.authRepo.GetByID(userID)
+func (a authService) GetUserData(ctx context.Context, userID int64) (*messages.AuthDataResponse, error) {
+	user, err := a.authRepo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, orNotFound(err, ErrUserNotFound)
 	}
 
 	return &messages.AuthDataResponse{
-		ID:    user.ID,
-		Email: user.Email,
+		ID:       user.ID,
+		Email:    user.Email,
+		Roles:    user.Roles(),
+		Language: user.Language,
 	}, nil
 }
+
+// SetLanguage sets the language of the user
+func (a authService) SetLanguage(ctx context.Context, userID int64, language string) error {
+	user, err := a.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return orNotFound(err, ErrUserNotFound)
+	}
+	user.Language = language
+	return a.authRepo.Update(ctx, user)
+}
+
+// CreateAdmin creates an active administrator, the e-mail must not be taken
+func (a authService) CreateAdmin(ctx context.Context, email string, password string) (*repository.Auth, error) {
+	a.log(ctx).Info("Creating administrator with email: ", email)
+
+	_, err := a.authRepo.GetByEmail(ctx, email)
+	if err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user := &repository.Auth{
+		Email:   email,
+		Active:  true,
+		IsAdmin: true,
+	}
+	user.PasswordHash = user.GeneratePasswordHash(password)
+	if user.PasswordHash == "" {
+		return nil, ErrInvalidPassword
+	}
+
+	if err = a.authRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindUser returns the user by ID if idOrEmail is a number, by e-mail otherwise
+func (a authService) FindUser(ctx context.Context, idOrEmail string) (*repository.Auth, error) {
+	var user *repository.Auth
+	var err error
+	if id, parseErr := strconv.ParseInt(idOrEmail, 10, 64); parseErr == nil {
+		user, err = a.authRepo.GetByID(ctx, id)
+	} else {
+		user, err = a.authRepo.GetByEmail(ctx, idOrEmail)
+	}
+	return user, orNotFound(err, ErrUserNotFound)
+}
+
+// SuspendUser blocks logins of the user and revokes their sessions
+func (a authService) SuspendUser(ctx context.Context, userID int64) error {
+	a.log(ctx).Info("Suspending user with ID: ", userID)
+
+	user, err := a.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return orNotFound(err, ErrUserNotFound)
+	}
+	if user.SuspendedAt == nil {
+		now := time.Now().UTC()
+		user.SuspendedAt = &now
+		if err = a.authRepo.Update(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.sessionService.RevokeUserSessions(ctx, userID)
+	return err
+}
+
+// UnsuspendUser allows the user to log in again
+func (a authService) UnsuspendUser(ctx context.Context, userID int64) error {
+	a.log(ctx).Info("Unsuspending user with ID: ", userID)
+
+	user, err := a.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return orNotFound(err, ErrUserNotFound)
+	}
+	user.SuspendedAt = nil
+	return a.authRepo.Update(ctx, user)
+}
+
+// SetPassword replaces the password of the user. Sessions opened with the old password are revoked.
+func (a authService) SetPassword(ctx context.Context, userID int64, password string) error {
+	a.log(ctx).Info("Setting password of user with ID: ", userID)
+
+	user, err := a.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return orNotFound(err, ErrUserNotFound)
+	}
+	user.PasswordHash = user.GeneratePasswordHash(password)
+	if user.PasswordHash == "" {
+		return ErrInvalidPassword
+	}
+	if err = a.authRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	_, err = a.sessionService.RevokeUserSessions(ctx, userID)
+	return err
+}
+
+// ScheduleDeletion marks the user for deletion, PurgeDeletedAccounts deletes them after the grace period
+func (a authService) ScheduleDeletion(ctx context.Context, userID int64) error {
+	a.log(ctx).Info("Scheduling deletion of user with ID: ", userID)
+
+	user, err := a.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return orNotFound(err, ErrUserNotFound)
+	}
+	if user.DeletedAt == nil {
+		now := time.Now().UTC()
+		user.DeletedAt = &now
+		if err = a.authRepo.Update(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.sessionService.RevokeUserSessions(ctx, userID)
+	return err
+}
+
+// PurgeDeletedAccounts deletes users whose grace period after requesting deletion is over
+func (a authService) PurgeDeletedAccounts(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	a.log(ctx).Info("Purging accounts deleted more than ", gracePeriod, " ago...")
+	return a.authRepo.PurgeDeleted(ctx, time.Now().UTC().Add(-gracePeriod))
+}
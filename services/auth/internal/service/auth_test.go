@@ -0,0 +1,192 @@
+package service
+
+import (
+	"auth/internal/binding"
+	"auth/internal/repository/memory"
+	"auth/pkg/auth"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+)
+
+func newTestAuthService(t *testing.T) (AuthService, SessionService, *memory.Store) {
+	// Hashing passwords logs to the global logger
+	logging.BaseInitLogger(logging.LogConfig{Level: "error"})
+	store := memory.NewStore()
+	revocations := NewRevocationService()
+	t.Cleanup(revocations.Close)
+	sessions := NewSessionService(store.Sessions(), revocations, SessionConfig{}, nil)
+	service := NewAuthService(store.Auth(), sessions, NewTokenService(store.Tokens(), nil), ignoredDevices{}, nil)
+	return service, sessions, store
+}
+
+// openSession logs the user in, the token is checked against the sessions later
+func openSession(t *testing.T, sessions SessionService, userID int64) string {
+	t.Helper()
+	resp, err := sessions.CreateSession(context.Background(), userID, false, auth.AuthLevelPassword, binding.Client{})
+	if err != nil {
+		t.Fatalf("Failed to open a session: %v", err)
+	}
+	return resp.Token
+}
+
+func TestCreateAdmin(t *testing.T) {
+	ctx := context.Background()
+	service, _, store := newTestAuthService(t)
+
+	admin, err := service.CreateAdmin(ctx, "admin@example.com", "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create the administrator: %v", err)
+	}
+	stored, err := store.Auth().GetByID(ctx, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsAdmin || !stored.Active || !stored.ComparePassword("s3cret") {
+		t.Errorf("Expected an active administrator with the password, got %+v", stored)
+	}
+
+	if _, err = service.CreateAdmin(ctx, "admin@example.com", "other"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected the e-mail to be taken, got %v", err)
+	}
+	// bcrypt takes at most 72 bytes
+	if _, err = service.CreateAdmin(ctx, "long@example.com", strings.Repeat("x", 73)); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected the password to be rejected, got %v", err)
+	}
+	if _, err = store.Auth().GetByEmail(ctx, "long@example.com"); err == nil {
+		t.Error("Expected no user with a rejected password")
+	}
+}
+
+func TestFindUser(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestAuthService(t)
+	admin, err := service.CreateAdmin(ctx, "admin@example.com", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, idOrEmail := range []string{strconv.FormatInt(admin.ID, 10), "admin@example.com"} {
+		if user, err := service.FindUser(ctx, idOrEmail); err != nil || user.ID != admin.ID {
+			t.Errorf("Expected user %d by %q, got %+v, %v", admin.ID, idOrEmail, user, err)
+		}
+	}
+	for _, idOrEmail := range []string{"12345", "nobody@example.com"} {
+		if _, err := service.FindUser(ctx, idOrEmail); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected no user by %q, got %v", idOrEmail, err)
+		}
+	}
+}
+
+func TestSuspendUser(t *testing.T) {
+	ctx := context.Background()
+	service, sessions, store := newTestAuthService(t)
+	user, err := service.CreateAdmin(ctx, "admin@example.com", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := openSession(t, sessions, user.ID)
+
+	if err = service.SuspendUser(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to suspend the user: %v", err)
+	}
+	suspended, _ := store.Auth().GetByID(ctx, user.ID)
+	if suspended.SuspendedAt == nil {
+		t.Error("Expected the user to be suspended")
+	}
+	if _, err = sessions.GetSession(ctx, token, nil); err == nil {
+		t.Error("Expected the session to be revoked")
+	}
+
+	// Suspending again keeps the time of the suspension
+	if err = service.SuspendUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := store.Auth().GetByID(ctx, user.ID); !again.SuspendedAt.Equal(*suspended.SuspendedAt) {
+		t.Errorf("Expected the suspension at %v, got %v", suspended.SuspendedAt, again.SuspendedAt)
+	}
+
+	if err = service.UnsuspendUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if unsuspended, _ := store.Auth().GetByID(ctx, user.ID); unsuspended.SuspendedAt != nil {
+		t.Errorf("Expected the suspension to be lifted, got %v", unsuspended.SuspendedAt)
+	}
+
+	for name, act := range map[string]func(context.Context, int64) error{
+		"suspend":   service.SuspendUser,
+		"unsuspend": service.UnsuspendUser,
+		"delete":    service.ScheduleDeletion,
+	} {
+		if err = act(ctx, 12345); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected %s of a missing user to fail, got %v", name, err)
+		}
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	ctx := context.Background()
+	service, sessions, store := newTestAuthService(t)
+	user, err := service.CreateAdmin(ctx, "admin@example.com", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := openSession(t, sessions, user.ID)
+
+	if err = service.SetPassword(ctx, user.ID, "new s3cret"); err != nil {
+		t.Fatalf("Failed to set the password: %v", err)
+	}
+	stored, _ := store.Auth().GetByID(ctx, user.ID)
+	if !stored.ComparePassword("new s3cret") || stored.ComparePassword("s3cret") {
+		t.Error("Expected the new password to replace the old one")
+	}
+	if _, err = sessions.GetSession(ctx, token, nil); err == nil {
+		t.Error("Expected the session opened with the old password to be revoked")
+	}
+
+	token = openSession(t, sessions, user.ID)
+	if err = service.SetPassword(ctx, user.ID, strings.Repeat("x", 73)); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected the password to be rejected, got %v", err)
+	}
+	if stored, _ = store.Auth().GetByID(ctx, user.ID); !stored.ComparePassword("new s3cret") {
+		t.Error("Expected a rejected password to keep the current one")
+	}
+	if _, err = sessions.GetSession(ctx, token, nil); err != nil {
+		t.Errorf("Expected a rejected password to keep the sessions, got %v", err)
+	}
+	if err = service.SetPassword(ctx, 12345, "s3cret"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected a missing user to fail, got %v", err)
+	}
+}
+
+func TestScheduleDeletion(t *testing.T) {
+	ctx := context.Background()
+	service, sessions, store := newTestAuthService(t)
+	user, err := service.CreateAdmin(ctx, "admin@example.com", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := openSession(t, sessions, user.ID)
+
+	if err = service.ScheduleDeletion(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to schedule the deletion: %v", err)
+	}
+	if _, err = sessions.GetSession(ctx, token, nil); err == nil {
+		t.Error("Expected the session to be revoked")
+	}
+	// Kept during the grace period
+	if count, err := service.PurgeDeletedAccounts(ctx, time.Hour); err != nil || count != 0 {
+		t.Errorf("Expected no account purged in the grace period, got %d, %v", count, err)
+	}
+	if count, err := service.PurgeDeletedAccounts(ctx, -time.Second); err != nil || count != 1 {
+		t.Errorf("Expected the account purged after the grace period, got %d, %v", count, err)
+	}
+	if _, err = store.Auth().GetByID(ctx, user.ID); err == nil {
+		t.Error("Expected the user to be gone")
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"auth/internal/binding"
+	"auth/internal/notify"
+	"auth/internal/repository"
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// notifyTimeout bounds sending a notification, it is sent after the login has been answered
+const notifyTimeout = 30 * time.Second
+
+type DeviceService interface {
+	// Recognize records a login of the user from the client. A device new to the user and a login
+	// from a place the user's sessions could not have travelled to are audited, the user is
+	// notified of a new device. Failures are logged, they do not fail the login.
+	Recognize(ctx context.Context, user *repository.Auth, client binding.Client)
+
+	// ListUserDevices returns the devices of the user, the latest seen first
+	ListUserDevices(ctx context.Context, userID int64) ([]*repository.KnownDevice, error)
+}
+
+type deviceService struct {
+	deviceRepo  repository.DeviceRepository
+	sessionRepo repository.SessionRepository
+	binder      *binding.Binder
+	notifier    notify.Notifier
+	logger      *logrus.Logger
+}
+
+// NewDeviceService creates the service. A nil binder disables recognizing devices, a nil notifier
+// notifying users. A nil logger stands for the global logger.
+func NewDeviceService(deviceRepo repository.DeviceRepository, sessionRepo repository.SessionRepository, binder *binding.Binder, notifier notify.Notifier, logger *logrus.Logger) DeviceService {
+	return &deviceService{
+		deviceRepo:  deviceRepo,
+		sessionRepo: sessionRepo,
+		binder:      binder,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+func (d deviceService) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(d.logger, ctx).WithField(logging.LoggerNameField, "auth.service")
+}
+
+// Recognize records the device of a login
+func (d deviceService) Recognize(ctx context.Context, user *repository.Auth, client binding.Client) {
+	if d.binder == nil {
+		return
+	}
+	now := time.Now().UTC()
+	signals := d.binder.Signals(client)
+	location := d.binder.Locate(client.IP)
+	var country string
+	if location != nil {
+		country = location.Country
+	}
+	fields := logrus.Fields{
+		"userId":          user.ID,
+		"ip":              client.IP,
+		"userAgentFamily": signals.UserAgentFamily,
+		"country":         country,
+	}
+
+	if location != nil {
+		d.checkTravel(ctx, user.ID, location, now, fields)
+	}
+
+	deviceKey := signals.DeviceKey()
+	if deviceKey == "" {
+		d.log(ctx).Debug("Login of user with ID: ", user.ID, " from an unidentifiable device")
+		return
+	}
+	isNew, err := d.deviceRepo.Touch(ctx, &repository.KnownDevice{
+		UserID:          user.ID,
+		DeviceKey:       deviceKey,
+		UserAgentFamily: signals.UserAgentFamily,
+		IPPrefix:        signals.IPPrefix,
+		Country:         country,
+		FirstSeenAt:     now,
+		LastSeenAt:      now,
+	})
+	if err != nil {
+		d.log(ctx).Warn("Failed to record the device of user with ID: ", user.ID, " - ", err)
+		return
+	}
+	if !isNew {
+		return
+	}
+	logging.Audit(ctx, "device.new", fields)
+
+	if d.notifier == nil {
+		return
+	}
+	login := notify.Login{Device: signals.UserAgentFamily, IP: client.IP, Location: country, At: now}
+	// Users who did not choose a language are written to in the language of the login request
+	to := notify.Recipient{Email: user.Email, Language: user.Language}
+	if to.Language == "" {
+		to.Language = i18n.FromContext(ctx).Language().String()
+	}
+	go func() {
+		// The login is answered meanwhile, its request must not cancel the notification
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+		if err := d.notifier.NewDevice(ctx, to, login); err != nil {
+			d.log(ctx).Warn("Failed to notify user with ID: ", user.ID, " of a new device - ", err)
+		}
+	}()
+}
+
+// checkTravel audits a login from a location none of the user's sessions could have travelled to
+func (d deviceService) checkTravel(ctx context.Context, userID int64, location *binding.Location, now time.Time, fields logrus.Fields) {
+	sessions, err := d.sessionRepo.GetAllByUser(ctx, userID)
+	if err != nil {
+		d.log(ctx).Warn("Failed to get the sessions of user with ID: ", userID, " - ", err)
+		return
+	}
+	for _, session := range sessions {
+		bound := boundSession(session)
+		if d.binder.ImpossibleTravel(bound.Location, bound.LastUsed, location, now) {
+			fields["previousCountry"] = bound.Location.Country
+			logging.Audit(ctx, "login.impossible_travel", fields)
+			return
+		}
+	}
+}
+
+// ListUserDevices returns the devices of the user
+func (d deviceService) ListUserDevices(ctx context.Context, userID int64) ([]*repository.KnownDevice, error) {
+	return d.deviceRepo.GetAllByUser(ctx, userID)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"auth/pkg/auth"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"gorm.io/gorm"
+)
+
+// Errors returned by the services. The codes are part of the API, clients act on them.
+var (
+	// ErrInvalidCredentials is returned for a failed login. An unknown e-mail and a wrong password
+	// look the same, the detail tells the credential that failed.
+	ErrInvalidCredentials = apierror.New(apierror.KindUnauthenticated, "AUTH_INVALID_CREDENTIALS", "Invalid credentials")
+	// ErrWrongPassword is returned for a wrong password of a signed in user, e.g. re-authenticating
+	ErrWrongPassword   = apierror.New(apierror.KindForbidden, "AUTH_WRONG_PASSWORD", "Wrong password")
+	ErrInvalidPassword = apierror.New(apierror.KindInvalid, "AUTH_INVALID_PASSWORD", "Invalid password")
+	ErrUserSuspended   = apierror.New(apierror.KindForbidden, "AUTH_ACCOUNT_SUSPENDED", "Account suspended")
+	ErrUserNotFound    = apierror.New(apierror.KindNotFound, "AUTH_USER_NOT_FOUND", "User not found")
+	ErrEmailTaken      = apierror.New(apierror.KindConflict, "AUTH_EMAIL_TAKEN", "User with this email already registered")
+
+	// ErrInvalidSession is returned for an unknown session token, or one of a user that is gone
+	ErrInvalidSession = auth.ErrInvalidToken
+	// ErrSessionExpired is returned for a session that went idle or reached its absolute lifetime
+	ErrSessionExpired = apierror.New(apierror.KindUnauthenticated, "AUTH_TOKEN_EXPIRED", "Session expired")
+	// ErrReauthRequired is returned for a session used with an anomaly until the user enters
+	// their password again
+	ErrReauthRequired = auth.ErrReauthRequired
+	// ErrSessionRevoked is returned for a session revoked because of an anomaly
+	ErrSessionRevoked = apierror.New(apierror.KindUnauthenticated, "AUTH_TOKEN_REVOKED", "Session revoked")
+
+	// ErrInvalidToken is returned for a single-use token that is unknown, expired, already used or
+	// of another type
+	ErrInvalidToken     = apierror.New(apierror.KindInvalid, "AUTH_SINGLE_USE_TOKEN_INVALID", "Token expired or already used")
+	ErrInvalidTokenType = errors.New("invalid token type")
+
+	// ErrInvalidPasskey is returned for a WebAuthn response that failed verification
+	ErrInvalidPasskey = apierror.New(apierror.KindInvalid, "AUTH_PASSKEY_INVALID", "Invalid passkey")
+	// ErrClonedPasskey is returned for an assertion whose sign counter did not increase, another
+	// copy of the passkey may be in use
+	ErrClonedPasskey = apierror.New(apierror.KindUnauthenticated, "AUTH_PASSKEY_CLONED", "Passkey sign counter did not increase")
+	// ErrPasskeyExists is returned when registering a passkey that is already registered
+	ErrPasskeyExists   = apierror.New(apierror.KindConflict, "AUTH_PASSKEY_EXISTS", "Passkey already registered")
+	ErrPasskeyNotFound = apierror.New(apierror.KindNotFound, "AUTH_PASSKEY_NOT_FOUND", "Passkey not found")
+	// ErrLastPasskey is returned when deleting the last passkey of a user without a password
+	ErrLastPasskey = apierror.New(apierror.KindConflict, "AUTH_LAST_PASSKEY", "The last passkey of an account without a password cannot be deleted")
+)
+
+// orNotFound returns notFound for a missing record, err otherwise
+func orNotFound(err error, notFound error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return err
+}
@@ -0,0 +1,551 @@
+package service
+
+import (
+	"auth/internal/binding"
+	"auth/internal/messages"
+	"auth/internal/repository"
+	"auth/pkg/auth"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// userHandleLength is the length of the random user handles, the most WebAuthn allows
+const userHandleLength = 64
+
+// errPasskeyRejected is the failed login with a passkey, the cause tells why
+var errPasskeyRejected = ErrInvalidCredentials.WithMessage("AUTH_INVALID_CREDENTIALS.passkey", nil)
+
+// PasskeyConfig is the relying party passkeys are registered with
+type PasskeyConfig struct {
+	// RPID is the domain passkeys are scoped to, e.g. example.com
+	RPID string
+	// RPDisplayName is the name of the service shown by authenticators
+	RPDisplayName string
+	// RPOrigins are the origins of the pages running the ceremonies, e.g. https://example.com
+	RPOrigins []string
+	// ChallengeTTL is how long the browser has to answer a challenge
+	ChallengeTTL time.Duration
+}
+
+type PasskeyService interface {
+	// BeginRegistration starts adding a passkey to the account of the user
+	BeginRegistration(ctx context.Context, userID int64) (*messages.PasskeyCreation, error)
+	// FinishRegistration verifies the new passkey of the user and stores it
+	FinishRegistration(ctx context.Context, userID int64, req *messages.PasskeyRegistration) (*repository.Passkey, error)
+
+	// BeginSignup starts the registration of a user signing up with a passkey instead of a password
+	BeginSignup(ctx context.Context, req *messages.PasskeySignupRequest) (*messages.PasskeyCreation, error)
+	// FinishSignup verifies the passkey, creates the user and opens a session bound to the client
+	FinishSignup(ctx context.Context, req *messages.PasskeyRegistration, client binding.Client) (*messages.AuthResponse, error)
+
+	// BeginLogin starts a login with any passkey the browser knows for the service
+	BeginLogin(ctx context.Context) (*messages.PasskeyAssertion, error)
+	// FinishLogin verifies the assertion and opens a session bound to the client
+	FinishLogin(ctx context.Context, req *messages.PasskeyLogin, client binding.Client) (*messages.AuthResponse, error)
+
+	// ListPasskeys returns the passkeys of the user, the oldest first
+	ListPasskeys(ctx context.Context, userID int64) ([]*repository.Passkey, error)
+	// RenamePasskey renames a passkey of the user
+	RenamePasskey(ctx context.Context, userID int64, id int64, name string) error
+	// DeletePasskey deletes a passkey of the user, the last one of a user without a password is kept
+	DeletePasskey(ctx context.Context, userID int64, id int64) error
+}
+
+// passkeyCeremony is what a ceremony keeps under its token until the browser answers
+type passkeyCeremony struct {
+	Session webauthn.SessionData `json:"session"`
+	// Email and UserHandle are the user signing up
+	Email      string `json:"email,omitempty"`
+	UserHandle []byte `json:"user_handle,omitempty"`
+}
+
+// passkeyUser is a user as the WebAuthn ceremonies see them
+type passkeyUser struct {
+	handle   []byte
+	email    string
+	passkeys []*repository.Passkey
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	return u.handle
+}
+
+func (u passkeyUser) WebAuthnName() string {
+	return u.email
+}
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	return u.email
+}
+
+func (u passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		credentials = append(credentials, credentialOf(passkey))
+	}
+	return credentials
+}
+
+// credentialOf returns the stored passkey as WebAuthn sees it
+func credentialOf(passkey *repository.Passkey) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, transport := range strings.Split(passkey.Transports, ",") {
+		if transport != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+	return webauthn.Credential{
+		ID:              passkey.CredentialID,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: passkey.BackupEligible,
+			BackupState:    passkey.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    passkey.AAGUID,
+			SignCount: passkey.SignCount,
+		},
+	}
+}
+
+// newPasskey returns the passkey to store for a registered credential
+func newPasskey(userID int64, name string, credential *webauthn.Credential) *repository.Passkey {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	return &repository.Passkey{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now().UTC(),
+	}
+}
+
+// authLevelOf returns the level of a login with the credential, a passkey verifying the user
+// is a second factor by itself
+func authLevelOf(credential *webauthn.Credential) int {
+	if credential.Flags.UserVerified {
+		return auth.AuthLevelMFA
+	}
+	return auth.AuthLevelPassword
+}
+
+type passkeyService struct {
+	webAuthn       *webauthn.WebAuthn
+	challengeTTL   time.Duration
+	authRepo       repository.AuthRepository
+	passkeyRepo    repository.PasskeyRepository
+	tokenService   TokenService
+	sessionService SessionService
+	deviceService  DeviceService
+	logger         *logrus.Logger
+}
+
+// NewPasskeyService creates the service, a nil logger stands for the global logger. Passkeys are
+// discoverable and verify the user, so they are enough to log in.
+func NewPasskeyService(config PasskeyConfig, authRepo repository.AuthRepository, passkeyRepo repository.PasskeyRepository, tokenService TokenService, sessionService SessionService, deviceService DeviceService, logger *logrus.Logger) (PasskeyService, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: config.ChallengeTTL, TimeoutUVD: config.ChallengeTTL}
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  config.RPID,
+		RPDisplayName:         config.RPDisplayName,
+		RPOrigins:             config.RPOrigins,
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyService{
+		webAuthn:       webAuthn,
+		challengeTTL:   config.ChallengeTTL,
+		authRepo:       authRepo,
+		passkeyRepo:    passkeyRepo,
+		tokenService:   tokenService,
+		sessionService: sessionService,
+		deviceService:  deviceService,
+		logger:         logger,
+	}, nil
+}
+
+func (p passkeyService) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(p.logger, ctx).WithField(logging.LoggerNameField, "auth.service")
+}
+
+// BeginRegistration starts adding a passkey, the passkeys of the user are excluded so an
+// authenticator is not registered twice
+func (p passkeyService) BeginRegistration(ctx context.Context, userID int64) (*messages.PasskeyCreation, error) {
+	user, err := p.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.UserHandle == nil {
+		handle, err := newUserHandle()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.authRepo.AssignUserHandle(ctx, user, handle); err != nil {
+			return nil, err
+		}
+	}
+	passkeys, err := p.passkeyRepo.GetAllByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := passkeyUser{handle: user.UserHandle, email: user.Email, passkeys: passkeys}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeys))
+	for _, credential := range owner.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	creation, session, err := p.webAuthn.BeginRegistration(owner, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.issueCeremony(ctx, userID, TokenTypePasskeyRegistration, passkeyCeremony{Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	p.log(ctx).Debug("Passkey registration started for user with ID: ", userID)
+	return &messages.PasskeyCreation{Token: token, Options: creation}, nil
+}
+
+// FinishRegistration stores the passkey created for the challenge of the token
+func (p passkeyService) FinishRegistration(ctx context.Context, userID int64, req *messages.PasskeyRegistration) (*repository.Passkey, error) {
+	ceremony, tokenUserID, err := p.consumeCeremony(ctx, req.Token, TokenTypePasskeyRegistration)
+	if err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonInvalidToken)
+		return nil, err
+	}
+	if tokenUserID != userID {
+		p.log(ctx).Warn("Passkey registration of user with ID: ", tokenUserID, " finished by user with ID: ", userID)
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonInvalidToken)
+		return nil, ErrInvalidToken
+	}
+	user, err := p.activeUser(ctx, userID)
+	if err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+	passkeys, err := p.passkeyRepo.GetAllByUser(ctx, userID)
+	if err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+
+	owner := passkeyUser{handle: user.UserHandle, email: user.Email, passkeys: passkeys}
+	credential, err := p.createCredential(ctx, owner, ceremony, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(passkeys)+1)
+	}
+	passkey := newPasskey(userID, name, credential)
+	if err = p.passkeyRepo.Create(ctx, passkey); err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+
+	metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultSuccess, "")
+	logging.Audit(ctx, "passkey.registered", logrus.Fields{"userId": userID, "passkeyId": passkey.ID})
+	return passkey, nil
+}
+
+// BeginSignup starts the registration of a new user, nothing is stored before the passkey is
+func (p passkeyService) BeginSignup(ctx context.Context, req *messages.PasskeySignupRequest) (*messages.PasskeyCreation, error) {
+	if _, err := p.authRepo.GetByEmail(ctx, req.Email); err == nil {
+		p.log(ctx).Debug("User with email: ", req.Email, " already exists")
+		metrics.RecordRegistration(metrics.ResultFailure, metrics.ReasonDuplicate)
+		return nil, ErrEmailTaken
+	}
+	handle, err := newUserHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := p.webAuthn.BeginRegistration(passkeyUser{handle: handle, email: req.Email})
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.issueCeremony(ctx, 0, TokenTypePasskeySignup, passkeyCeremony{
+		Session:    *session,
+		Email:      req.Email,
+		UserHandle: handle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.log(ctx).Debug("Passkey signup started for email: ", req.Email)
+	return &messages.PasskeyCreation{Token: token, Options: creation}, nil
+}
+
+// FinishSignup creates the user of the token with their passkey and no password
+func (p passkeyService) FinishSignup(ctx context.Context, req *messages.PasskeyRegistration, client binding.Client) (*messages.AuthResponse, error) {
+	ceremony, _, err := p.consumeCeremony(ctx, req.Token, TokenTypePasskeySignup)
+	if err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonInvalidToken)
+		return nil, err
+	}
+
+	credential, err := p.createCredential(ctx, passkeyUser{handle: ceremony.UserHandle, email: ceremony.Email}, ceremony, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+	// The e-mail may have been taken while the browser created the passkey
+	if _, err = p.authRepo.GetByEmail(ctx, ceremony.Email); err == nil {
+		p.log(ctx).Debug("User with email: ", ceremony.Email, " already exists")
+		metrics.RecordRegistration(metrics.ResultFailure, metrics.ReasonDuplicate)
+		return nil, ErrEmailTaken
+	}
+
+	user := &repository.Auth{Email: ceremony.Email, UserHandle: ceremony.UserHandle}
+	name := req.Name
+	if name == "" {
+		name = "Passkey 1"
+	}
+	passkey := newPasskey(0, name, credential)
+	if err = p.passkeyRepo.CreateWithUser(ctx, user, passkey); err != nil {
+		p.log(ctx).Error("Failed to create user: ", err)
+		metrics.RecordRegistration(metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+	metrics.RecordRegistration(metrics.ResultSuccess, "")
+	metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultSuccess, "")
+	logging.Audit(ctx, "passkey.registered", logrus.Fields{"userId": user.ID, "passkeyId": passkey.ID, "signup": true})
+
+	// The first device of the user is known from now on, nobody is notified of it
+	p.deviceService.Recognize(ctx, user, client)
+	session, err := p.sessionService.CreateSession(ctx, user.ID, false, authLevelOf(credential), client)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// BeginLogin starts a login, the browser offers the user their passkeys for the service
+func (p passkeyService) BeginLogin(ctx context.Context) (*messages.PasskeyAssertion, error) {
+	assertion, session, err := p.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.issueCeremony(ctx, 0, TokenTypePasskeyLogin, passkeyCeremony{Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	return &messages.PasskeyAssertion{Token: token, Options: assertion}, nil
+}
+
+// FinishLogin logs in the owner of the passkey that signed the challenge of the token. The sign
+// counter of the passkey must increase, unless the authenticator does not count.
+func (p passkeyService) FinishLogin(ctx context.Context, req *messages.PasskeyLogin, client binding.Client) (*messages.AuthResponse, error) {
+	ceremony, _, err := p.consumeCeremony(ctx, req.Token, TokenTypePasskeyLogin)
+	if err != nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultFailure, metrics.ReasonInvalidToken)
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		p.log(ctx).Debug("Failed to parse passkey assertion: ", describeWebAuthnError(err))
+		metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultFailure, metrics.ReasonInvalidPasskey)
+		return nil, errPasskeyRejected.Wrap(ErrInvalidPasskey)
+	}
+
+	var (
+		user      *repository.Auth
+		passkey   *repository.Passkey
+		lookupErr error
+	)
+	findOwner := func(credentialID []byte, userHandle []byte) (webauthn.User, error) {
+		passkey, lookupErr = p.passkeyRepo.GetByCredentialID(ctx, credentialID)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		user, lookupErr = p.authRepo.GetByID(ctx, passkey.UserID)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return passkeyUser{handle: user.UserHandle, email: user.Email, passkeys: []*repository.Passkey{passkey}}, nil
+	}
+	credential, err := p.webAuthn.ValidateDiscoverableLogin(findOwner, ceremony.Session, parsed)
+	if lookupErr != nil && !errors.Is(lookupErr, gorm.ErrRecordNotFound) {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultFailure, metrics.ReasonError)
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonError)
+		return nil, lookupErr
+	} else if err != nil {
+		p.log(ctx).Debug("Invalid passkey assertion: ", describeWebAuthnError(err))
+		metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultFailure, metrics.ReasonInvalidPasskey)
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonInvalidPasskey)
+		return nil, errPasskeyRejected.Wrap(ErrInvalidPasskey)
+	}
+
+	fields := logrus.Fields{"userId": user.ID, "passkeyId": passkey.ID, "ip": client.IP}
+	if credential.Authenticator.CloneWarning {
+		// The signature is valid, but it was made by a copy of the passkey or replayed
+		fields["storedSignCount"] = passkey.SignCount
+		fields["signCount"] = parsed.Response.AuthenticatorData.Counter
+		logging.Audit(ctx, "passkey.clone_detected", fields)
+		metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultFailure, metrics.ReasonClonedPasskey)
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonClonedPasskey)
+		return nil, errPasskeyRejected.Wrap(ErrClonedPasskey)
+	}
+	if user.DeletedAt != nil {
+		p.log(ctx).Debug("User with ID: ", user.ID, " is pending deletion")
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonUnknownUser)
+		return nil, errPasskeyRejected
+	}
+	if user.SuspendedAt != nil {
+		p.log(ctx).Debug("User with ID: ", user.ID, " is suspended")
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonSuspended)
+		return nil, ErrUserSuspended
+	}
+
+	now := time.Now().UTC()
+	passkey.SignCount = credential.Authenticator.SignCount
+	passkey.BackupState = credential.Flags.BackupState
+	passkey.LastUsedAt = &now
+	if err = p.passkeyRepo.UpdateUsage(ctx, passkey); err != nil {
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+
+	// The device is recognized before the new session counts among the user's sessions
+	p.deviceService.Recognize(ctx, user, client)
+	session, err := p.sessionService.CreateSession(ctx, user.ID, req.RememberMe, authLevelOf(credential), client)
+	if err != nil {
+		metrics.RecordLogin(metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+	metrics.RecordPasskeyCeremony(metrics.CeremonyLogin, metrics.ResultSuccess, "")
+	metrics.RecordLogin(metrics.ResultSuccess, "")
+	p.log(ctx).Debug("User with ID: ", user.ID, " logged in with passkey with ID: ", passkey.ID)
+	return &session, nil
+}
+
+func (p passkeyService) ListPasskeys(ctx context.Context, userID int64) ([]*repository.Passkey, error) {
+	return p.passkeyRepo.GetAllByUser(ctx, userID)
+}
+
+func (p passkeyService) RenamePasskey(ctx context.Context, userID int64, id int64, name string) error {
+	return orNotFound(p.passkeyRepo.Rename(ctx, userID, id, name), ErrPasskeyNotFound)
+}
+
+func (p passkeyService) DeletePasskey(ctx context.Context, userID int64, id int64) error {
+	err := p.passkeyRepo.Delete(ctx, userID, id)
+	if errors.Is(err, repository.ErrLastPasskey) {
+		return ErrLastPasskey
+	} else if err != nil {
+		return orNotFound(err, ErrPasskeyNotFound)
+	}
+	logging.Audit(ctx, "passkey.deleted", logrus.Fields{"userId": userID, "passkeyId": id})
+	return nil
+}
+
+// activeUser returns the signed in user unless their account is gone or pending deletion, the
+// session is invalid then
+func (p passkeyService) activeUser(ctx context.Context, userID int64) (*repository.Auth, error) {
+	user, err := p.authRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, orNotFound(err, ErrInvalidSession)
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrInvalidSession
+	}
+	return user, nil
+}
+
+// createCredential verifies the credential created by the browser for the ceremony
+func (p passkeyService) createCredential(ctx context.Context, owner passkeyUser, ceremony *passkeyCeremony, body json.RawMessage) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		p.log(ctx).Debug("Failed to parse passkey credential: ", describeWebAuthnError(err))
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+	credential, err := p.webAuthn.CreateCredential(owner, ceremony.Session, parsed)
+	if err != nil {
+		p.log(ctx).Debug("Invalid passkey credential: ", describeWebAuthnError(err))
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+	if _, err = p.passkeyRepo.GetByCredentialID(ctx, credential.ID); err == nil {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonDuplicate)
+		return nil, ErrPasskeyExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		metrics.RecordPasskeyCeremony(metrics.CeremonyRegistration, metrics.ResultFailure, metrics.ReasonError)
+		return nil, err
+	}
+	return credential, nil
+}
+
+// issueCeremony stores the ceremony under a new token valid as long as the challenge
+func (p passkeyService) issueCeremony(ctx context.Context, userID int64, tokenType string, ceremony passkeyCeremony) (string, error) {
+	data, err := json.Marshal(ceremony)
+	if err != nil {
+		return "", err
+	}
+	return p.tokenService.IssueToken(ctx, userID, tokenType, data, p.challengeTTL)
+}
+
+// consumeCeremony returns the ceremony of the token and the user it was started for, a
+// challenge is answered once
+func (p passkeyService) consumeCeremony(ctx context.Context, token string, tokenType string) (*passkeyCeremony, int64, error) {
+	userID, data, err := p.tokenService.ConsumeToken(ctx, token, tokenType)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ceremony passkeyCeremony
+	if err = json.Unmarshal(data, &ceremony); err != nil {
+		return nil, 0, err
+	}
+	return &ceremony, userID, nil
+}
+
+// newUserHandle returns a random user handle, it reveals nothing about the user
+func newUserHandle() ([]byte, error) {
+	handle := make([]byte, userHandleLength)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// describeWebAuthnError returns the details of a WebAuthn error, its message alone is generic
+func describeWebAuthnError(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
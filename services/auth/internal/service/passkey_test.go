@@ -0,0 +1,223 @@
+package service
+
+import (
+	"auth/internal/binding"
+	"auth/internal/messages"
+	"auth/internal/passkeytest"
+	"auth/internal/repository"
+	"auth/internal/repository/memory"
+	"auth/pkg/auth"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newSoftAuthenticator(t *testing.T) *passkeytest.Authenticator {
+	return passkeytest.New(t, testRPID, testOrigin)
+}
+
+// recordingSessions records the sessions created instead of storing them
+type recordingSessions struct {
+	SessionService
+	levels map[int64]int
+}
+
+func (s *recordingSessions) CreateSession(_ context.Context, userID int64, rememberMe bool, level int, _ binding.Client) (messages.AuthResponse, error) {
+	s.levels[userID] = level
+	return messages.AuthResponse{Token: "session", ExpiresAt: time.Now().Add(time.Hour), RememberMe: rememberMe}, nil
+}
+
+type ignoredDevices struct {
+	DeviceService
+}
+
+func (ignoredDevices) Recognize(context.Context, *repository.Auth, binding.Client) {}
+
+func newTestPasskeyService(t *testing.T) (PasskeyService, *memory.Store, *recordingSessions) {
+	store := memory.NewStore()
+	sessions := &recordingSessions{levels: map[int64]int{}}
+	tokens := NewTokenService(store.Tokens(), nil)
+	service, err := NewPasskeyService(PasskeyConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+		ChallengeTTL:  time.Minute,
+	}, store.Auth(), store.Passkeys(), tokens, sessions, ignoredDevices{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create the service: %v", err)
+	}
+	return service, store, sessions
+}
+
+func signup(t *testing.T, service PasskeyService, authenticator *passkeytest.Authenticator, email string) {
+	ctx := context.Background()
+	creation, err := service.BeginSignup(ctx, &messages.PasskeySignupRequest{Email: email})
+	if err != nil {
+		t.Fatalf("Failed to begin the signup: %v", err)
+	}
+	_, err = service.FinishSignup(ctx, &messages.PasskeyRegistration{
+		Token:      creation.Token,
+		Credential: authenticator.Create(t, creation.Options),
+	}, binding.Client{})
+	if err != nil {
+		t.Fatalf("Failed to finish the signup: %v", err)
+	}
+}
+
+func login(t *testing.T, service PasskeyService, authenticator *passkeytest.Authenticator) error {
+	ctx := context.Background()
+	assertion, err := service.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin the login: %v", err)
+	}
+	_, err = service.FinishLogin(ctx, &messages.PasskeyLogin{
+		Token:      assertion.Token,
+		Credential: authenticator.Get(t, assertion.Options),
+	}, binding.Client{})
+	return err
+}
+
+func TestPasskeySignupAndLogin(t *testing.T) {
+	service, store, sessions := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	signup(t, service, authenticator, "alice@example.com")
+
+	user, _ := store.Auth().GetByEmail(context.Background(), "alice@example.com")
+	if user == nil || user.HasPassword() || user.ComparePassword("") {
+		t.Fatalf("Expected a user without a password, got %+v", user)
+	}
+	if sessions.levels[user.ID] != auth.AuthLevelMFA {
+		t.Errorf("Expected the signup to open a multi-factor session, got level %d", sessions.levels[user.ID])
+	}
+	passkeys, _ := service.ListPasskeys(context.Background(), user.ID)
+	if len(passkeys) != 1 || passkeys[0].Name != "Passkey 1" {
+		t.Fatalf("Expected the passkey of the signup, got %+v", passkeys)
+	}
+
+	if err := login(t, service, authenticator); err != nil {
+		t.Fatalf("Expected the login to succeed, got %v", err)
+	}
+	passkeys, _ = service.ListPasskeys(context.Background(), user.ID)
+	if passkeys[0].SignCount != 1 || passkeys[0].LastUsedAt == nil {
+		t.Errorf("Expected the assertion to be recorded, got %+v", passkeys[0])
+	}
+
+	if _, err := service.BeginSignup(context.Background(), &messages.PasskeySignupRequest{Email: "alice@example.com"}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected a taken e-mail to be rejected, got %v", err)
+	}
+}
+
+func TestPasskeyLoginRejectsCounterRegression(t *testing.T) {
+	service, _, _ := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	signup(t, service, authenticator, "alice@example.com")
+	for i := 0; i < 2; i++ {
+		if err := login(t, service, authenticator); err != nil {
+			t.Fatalf("Expected the login to succeed, got %v", err)
+		}
+	}
+
+	// A copy of the authenticator is behind the original
+	authenticator.Counter = 0
+	if err := login(t, service, authenticator); !errors.Is(err, ErrClonedPasskey) {
+		t.Errorf("Expected a cloned passkey to be rejected, got %v", err)
+	}
+}
+
+func TestPasskeyLoginRejectsInvalidAssertions(t *testing.T) {
+	service, _, _ := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	signup(t, service, authenticator, "alice@example.com")
+	ctx := context.Background()
+
+	// A phishing site relays the challenge to the authenticator
+	authenticator.Origin = "https://example.com.evil.test"
+	if err := login(t, service, authenticator); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("Expected an assertion for another origin to be rejected, got %v", err)
+	}
+	authenticator.Origin = testOrigin
+
+	unknown := newSoftAuthenticator(t)
+	unknown.UserHandle = authenticator.UserHandle
+	if err := login(t, service, unknown); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("Expected an unknown passkey to be rejected, got %v", err)
+	}
+
+	assertion, _ := service.BeginLogin(ctx)
+	req := &messages.PasskeyLogin{Token: assertion.Token, Credential: authenticator.Get(t, assertion.Options)}
+	if _, err := service.FinishLogin(ctx, req, binding.Client{}); err != nil {
+		t.Fatalf("Expected the login to succeed, got %v", err)
+	}
+	if _, err := service.FinishLogin(ctx, req, binding.Client{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a challenge to be answered once, got %v", err)
+	}
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	service, store, _ := newTestPasskeyService(t)
+	ctx := context.Background()
+	bob := &repository.Auth{Email: "bob@example.com", PasswordHash: "hash"}
+	eve := &repository.Auth{Email: "eve@example.com", PasswordHash: "hash"}
+	for _, user := range []*repository.Auth{bob, eve} {
+		if err := store.Auth().Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	register := func(userID int64, authenticator *passkeytest.Authenticator, name string) (*repository.Passkey, *messages.PasskeyCreation, error) {
+		creation, err := service.BeginRegistration(ctx, userID)
+		if err != nil {
+			t.Fatalf("Failed to begin the registration: %v", err)
+		}
+		passkey, err := service.FinishRegistration(ctx, userID, &messages.PasskeyRegistration{
+			Token:      creation.Token,
+			Name:       name,
+			Credential: authenticator.Create(t, creation.Options),
+		})
+		return passkey, creation, err
+	}
+
+	laptop := newSoftAuthenticator(t)
+	if passkey, _, err := register(bob.ID, laptop, "Laptop"); err != nil || passkey.Name != "Laptop" {
+		t.Fatalf("Expected the passkey to be registered, got %+v, %v", passkey, err)
+	}
+	phone := newSoftAuthenticator(t)
+	_, creation, err := register(bob.ID, phone, "")
+	if err != nil {
+		t.Fatalf("Expected a second passkey to be registered, got %v", err)
+	}
+	if excluded := creation.Options.Response.CredentialExcludeList; len(excluded) != 1 || !bytes.Equal(excluded[0].CredentialID, laptop.CredentialID) {
+		t.Errorf("Expected the registered passkey to be excluded, got %+v", excluded)
+	}
+	if _, _, err = register(bob.ID, laptop, "Again"); !errors.Is(err, ErrPasskeyExists) {
+		t.Errorf("Expected a registered passkey to be rejected, got %v", err)
+	}
+	passkeys, _ := service.ListPasskeys(ctx, bob.ID)
+	if len(passkeys) != 2 || passkeys[1].Name != "Passkey 2" {
+		t.Errorf("Expected two named passkeys, got %+v", passkeys)
+	}
+
+	// The challenge of one user cannot register a passkey for another
+	creation, _ = service.BeginRegistration(ctx, bob.ID)
+	_, err = service.FinishRegistration(ctx, eve.ID, &messages.PasskeyRegistration{
+		Token:      creation.Token,
+		Credential: newSoftAuthenticator(t).Create(t, creation.Options),
+	})
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the challenge of another user to be rejected, got %v", err)
+	}
+
+	// Both passkeys log the user in
+	for _, authenticator := range []*passkeytest.Authenticator{laptop, phone} {
+		if err = login(t, service, authenticator); err != nil {
+			t.Errorf("Expected the login to succeed, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"auth/pkg/auth"
+	"auth/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// revocationBacklog is the number of events kept for subscribers that reconnect
+	revocationBacklog = 1024
+	// revocationSubscriberBuffer is the number of events a slow subscriber may lag behind before it is dropped
+	revocationSubscriberBuffer = 64
+)
+
+// RevocationEvent is a revoked session announced on the revocation feed
+type RevocationEvent struct {
+	// ID is "<epoch>-<sequence>". The epoch is drawn when the service starts, so the IDs of a
+	// previous run or of another instance are told apart from its own.
+	ID    string
+	Type  string
+	Event auth.RevocationEvent
+	seq   uint64
+}
+
+// RevocationService announces revoked sessions on a feed kept in memory. Every instance has its
+// own feed with the sessions it revoked, a subscriber only hears of the revocations made by the
+// instance it follows and gets a reset when it moves to another one.
+type RevocationService interface {
+	// Revoke announces that the session with the given ID is no longer valid
+	Revoke(sessionID string)
+
+	// RevokeAll tells subscribers to forget every session they know
+	RevokeAll()
+
+	// Subscribe returns the events after lastID and a channel of new events.
+	// The channel is closed if the subscriber falls behind. If the events after lastID
+	// are no longer known, e.g. it is from another epoch, the backlog is a single reset event.
+	Subscribe(lastID string) (backlog []RevocationEvent, events <-chan RevocationEvent, cancel func())
+
+	// Close ends every subscription, so open streams do not hold up a shutdown.
+	// Subscribers reconnect to another instance and resume from their last event.
+	Close()
+}
+
+type revocationService struct {
+	epoch       string
+	mu          sync.Mutex
+	lastID      uint64
+	backlog     []RevocationEvent
+	subscribers map[chan RevocationEvent]struct{}
+	closed      bool
+}
+
+func NewRevocationService() RevocationService {
+	return &revocationService{
+		epoch:       utils.GenerateRandomString(8),
+		subscribers: make(map[chan RevocationEvent]struct{}),
+	}
+}
+
+func (r *revocationService) Revoke(sessionID string) {
+	r.publish(auth.RevocationEventRevoke, sessionID)
+}
+
+func (r *revocationService) RevokeAll() {
+	r.publish(auth.RevocationEventReset, "")
+}
+
+func (r *revocationService) publish(type_ string, sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	event := RevocationEvent{
+		ID:   r.eventID(r.lastID),
+		seq:  r.lastID,
+		Type: type_,
+		Event: auth.RevocationEvent{
+			SessionID: sessionID,
+			RevokedAt: time.Now(),
+		},
+	}
+
+	r.backlog = append(r.backlog, event)
+	if len(r.backlog) > revocationBacklog {
+		r.backlog = r.backlog[len(r.backlog)-revocationBacklog:]
+	}
+
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// The subscriber reconnects and replays the backlog
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (r *revocationService) Subscribe(lastID string) ([]RevocationEvent, <-chan RevocationEvent, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var backlog []RevocationEvent
+	if lastID != "" {
+		// The first retained event must directly follow lastID, otherwise events were lost.
+		// Another epoch means another instance or a restart, whatever its sequence.
+		epoch, seq, ok := strings.Cut(lastID, "-")
+		last, err := strconv.ParseUint(seq, 10, 64)
+		oldest := r.lastID + 1
+		if len(r.backlog) > 0 {
+			oldest = r.backlog[0].seq
+		}
+		if !ok || err != nil || epoch != r.epoch || last > r.lastID || last+1 < oldest {
+			backlog = []RevocationEvent{{
+				ID:    r.eventID(r.lastID),
+				seq:   r.lastID,
+				Type:  auth.RevocationEventReset,
+				Event: auth.RevocationEvent{RevokedAt: time.Now()},
+			}}
+		} else {
+			for _, event := range r.backlog {
+				if event.seq > last {
+					backlog = append(backlog, event)
+				}
+			}
+		}
+	}
+
+	ch := make(chan RevocationEvent, revocationSubscriberBuffer)
+	if r.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+	r.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, exists := r.subscribers[ch]; exists {
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, cancel
+}
+
+// eventID returns the ID of the event with the sequence number
+func (r *revocationService) eventID(seq uint64) string {
+	return r.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+func (r *revocationService) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for ch := range r.subscribers {
+		delete(r.subscribers, ch)
+		close(ch)
+	}
+}
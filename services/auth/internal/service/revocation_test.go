@@ -0,0 +1,46 @@
+package service
+
+import (
+	"auth/pkg/auth"
+	"testing"
+)
+
+func TestRevocationSubscribe(t *testing.T) {
+	revocations := NewRevocationService()
+	defer revocations.Close()
+	revocations.Revoke("first")
+	revocations.Revoke("second")
+
+	backlog, _, cancel := revocations.Subscribe("")
+	cancel()
+	if len(backlog) != 0 {
+		t.Errorf("Expected no backlog for a new subscriber, got %+v", backlog)
+	}
+
+	first, _, cancel := revocations.Subscribe("unknown-0")
+	cancel()
+	if len(first) != 1 || first[0].Type != auth.RevocationEventReset {
+		t.Fatalf("Expected a reset, got %+v", first)
+	}
+	backlog, _, cancel = revocations.Subscribe(first[0].ID)
+	cancel()
+	if len(backlog) != 0 {
+		t.Errorf("Expected nothing after the latest event, got %+v", backlog)
+	}
+
+	revocations.Revoke("third")
+	backlog, _, cancel = revocations.Subscribe(first[0].ID)
+	cancel()
+	if len(backlog) != 1 || backlog[0].Event.SessionID != "third" {
+		t.Errorf("Expected the event after the last one, got %+v", backlog)
+	}
+
+	// Another instance or a previous run numbered its events the same way
+	for _, lastID := range []string{"restarted-1", "1", "restarted"} {
+		backlog, _, cancel = revocations.Subscribe(lastID)
+		cancel()
+		if len(backlog) != 1 || backlog[0].Type != auth.RevocationEventReset {
+			t.Errorf("Expected a reset after %q, got %+v", lastID, backlog)
+		}
+	}
+}
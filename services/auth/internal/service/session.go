@@ -1,109 +1,514 @@
 package service
 
 import (
+	"auth/internal/binding"
 	"auth/internal/messages"
 	"auth/internal/repository"
+	"auth/pkg/utils"
+	"context"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
-	"gorm.io/gorm"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
 type SessionService interface {
-	// CreateSession creates a new session. Returns prepared response with token.
-	CreateSession(userId int64) (messages.AuthResponse, error)
+	// CreateSession creates a new session with the long policy if rememberMe is set, the short one
+	// otherwise, bound to the client. The user logged in with the level, e.g. auth.AuthLevelPassword.
+	// Returns prepared response with token.
+	CreateSession(ctx context.Context, userId int64, rememberMe bool, level int, client binding.Client) (messages.AuthResponse, error)
 
-	// GetUserID returns the user ID associated with a session
-	GetUserID(token string) (int64, error)
+	// GetUserID returns the user ID associated with a session used by the client, nil if the
+	// client is unknown
+	GetUserID(ctx context.Context, token string, client *binding.Client) (int64, error)
+
+	// GetSession returns a session used by the client, nil if the client is unknown
+	GetSession(ctx context.Context, token string, client *binding.Client) (repository.Session, error)
+
+	// FindSession returns a session to re-authenticate. Its lifetime policy applies, but unlike
+	// GetSession a session requiring re-authentication is returned.
+	FindSession(ctx context.Context, token string) (*repository.Session, error)
+
+	// Reauthenticate records that the user proved their identity with the level in the session
+	// now. The session is bound to the client from now on and its anomalies are cleared.
+	Reauthenticate(ctx context.Context, session *repository.Session, level int, client binding.Client) error
 
 	// DeleteSession deletes a session
-	DeleteSession(token string) error
+	DeleteSession(ctx context.Context, token string) error
+
+	// HardDeleteSessions deletes all expired sessions and returns how many. Admin method
+	HardDeleteSessions(ctx context.Context) (int64, error)
+
+	// DeleteInactiveSessions deletes sessions idle for longer than the idle timeout of their policy and returns how many. Admin method
+	DeleteInactiveSessions(ctx context.Context) (int64, error)
+
+	// CountExpiredSessions returns how many sessions HardDeleteSessions would delete
+	CountExpiredSessions(ctx context.Context) (int64, error)
+
+	// CountInactiveSessions returns how many sessions DeleteInactiveSessions would delete
+	CountInactiveSessions(ctx context.Context) (int64, error)
+
+	// ListUserSessions returns the sessions of the user that are not expired
+	ListUserSessions(ctx context.Context, userID int64) ([]*repository.Session, error)
+
+	// RevokeUserSessions expires every session of the user and returns how many. Admin method
+	RevokeUserSessions(ctx context.Context, userID int64) (int64, error)
+}
+
+// SessionPolicy is how long a session lives
+type SessionPolicy struct {
+	// Lifetime is how long a session is valid after it is created or renewed
+	Lifetime time.Duration
+	// AbsoluteLifetime caps a session from its creation however often it is renewed, Lifetime if zero
+	AbsoluteLifetime time.Duration
+	// IdleTimeout ends a session unused for this long, zero disables it
+	IdleTimeout time.Duration
+	// RenewWindow extends a session used with less than this left by Lifetime from the use,
+	// zero disables sliding renewal
+	RenewWindow time.Duration
+}
+
+// MaxLifetime is the longest a session of the policy can live
+func (p SessionPolicy) MaxLifetime() time.Duration {
+	if p.AbsoluteLifetime > 0 {
+		return p.AbsoluteLifetime
+	}
+	return p.Lifetime
+}
+
+// expired reports whether the session went idle or reached its absolute lifetime by now.
+// Sessions past their expiry are not found at all.
+func (p SessionPolicy) expired(session *repository.Session, now time.Time) bool {
+	if p.IdleTimeout > 0 && now.Sub(session.LastUsed) > p.IdleTimeout {
+		return true
+	}
+	return now.After(session.CreatedAt.Add(p.MaxLifetime()))
+}
+
+// renewal returns the expiry of the session used now, its current expiry if it is not renewed
+func (p SessionPolicy) renewal(session *repository.Session, now time.Time) time.Time {
+	if p.RenewWindow <= 0 || session.ExpiresAt.Sub(now) >= p.RenewWindow {
+		return session.ExpiresAt
+	}
+	expiresAt := now.Add(p.Lifetime)
+	if limit := session.CreatedAt.Add(p.MaxLifetime()); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if expiresAt.Before(session.ExpiresAt) {
+		return session.ExpiresAt
+	}
+	return expiresAt
+}
+
+// SessionConfig is the session policy of the service
+type SessionConfig struct {
+	// Short is the policy of sessions created without "remember me"
+	Short SessionPolicy
+	// Long is the policy of "remember me" sessions
+	Long SessionPolicy
+	// LastUsedInterval throttles writes of the last use of a session to one per interval,
+	// a renewal is always written
+	LastUsedInterval time.Duration
+	// Binder binds sessions to their clients, nil disables the binding
+	Binder *binding.Binder
+}
 
-	// HardDeleteSessions deletes all expired sessions. Admin method
-	HardDeleteSessions() error
+// DefaultSessionConfig returns short sessions for a working day and "remember me" sessions
+// for a year, as long as they are used monthly
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		Short: SessionPolicy{
+			Lifetime:         12 * time.Hour,
+			AbsoluteLifetime: 24 * time.Hour,
+			IdleTimeout:      2 * time.Hour,
+			RenewWindow:      6 * time.Hour,
+		},
+		Long: SessionPolicy{
+			Lifetime:         30 * 24 * time.Hour,
+			AbsoluteLifetime: time.Second * repository.SessionTTL,
+			IdleTimeout:      30 * 24 * time.Hour,
+			RenewWindow:      15 * 24 * time.Hour,
+		},
+		LastUsedInterval: time.Minute,
+	}
+}
 
-	// DeleteInactiveSessions deletes all sessions that are expired. Admin method
-	DeleteInactiveSessions() error
+// policy returns the policy of a session
+func (c SessionConfig) policy(rememberMe bool) SessionPolicy {
+	if rememberMe {
+		return c.Long
+	}
+	return c.Short
 }
 
 type sessionService struct {
-	sessionRepo repository.SessionRepository
+	sessionRepo       repository.SessionRepository
+	revocationService RevocationService
+	config            SessionConfig
+	logger            *logrus.Logger
 }
 
-func NewSessionService(sessionRepo repository.SessionRepository) SessionService {
+// NewSessionService creates the service, a nil logger stands for the global logger
+func NewSessionService(sessionRepo repository.SessionRepository, revocationService RevocationService, config SessionConfig, logger *logrus.Logger) SessionService {
+	defaults := DefaultSessionConfig()
+	if config.Short.Lifetime <= 0 {
+		config.Short = defaults.Short
+	}
+	if config.Long.Lifetime <= 0 {
+		config.Long = defaults.Long
+	}
 	return &sessionService{
-		sessionRepo: sessionRepo,
+		sessionRepo:       sessionRepo,
+		revocationService: revocationService,
+		config:            config,
+		logger:            logger,
 	}
 }
 
+func (s sessionService) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(s.logger, ctx).WithField(logging.LoggerNameField, "auth.service")
+}
+
 // CreateSession creates a new session
-func (s sessionService) CreateSession(userId int64) (messages.AuthResponse, error) {
-	logging.Logger.Debug("Creating session for user with ID: ", userId)
+func (s sessionService) CreateSession(ctx context.Context, userId int64, rememberMe bool, level int, client binding.Client) (messages.AuthResponse, error) {
+	s.log(ctx).Debug("Creating session for user with ID: ", userId, ", remember me: ", rememberMe)
 
-	session := repository.NewSession(userId)
-	err := s.sessionRepo.Create(session)
+	session := repository.NewSession(userId, s.config.policy(rememberMe).Lifetime, rememberMe, level)
+	if s.config.Binder != nil {
+		signals := s.config.Binder.Signals(client)
+		session.IPPrefix = signals.IPPrefix
+		session.UserAgentFamily = signals.UserAgentFamily
+		session.DeviceHash = signals.DeviceHash
+		if location := s.config.Binder.Locate(client.IP); location != nil {
+			setLocation(session, location)
+		}
+	}
+	err := s.sessionRepo.Create(ctx, session)
 
 	if err != nil {
-		logging.Logger.Error("Failed to create session: ", err)
+		s.log(ctx).Error("Failed to create session: ", err)
 		return messages.AuthResponse{}, err
 	}
-	logging.Logger.Debug("Session created with token: ", session.SessionKey[:5])
-	return messages.AuthResponse{Token: session.SessionKey}, nil
+	metrics.RecordSessionCreated()
+	s.log(ctx).Debug("Session created with token: ", logging.Fingerprint(session.SessionKey))
+	return messages.AuthResponse{Token: session.SessionKey, ExpiresAt: session.ExpiresAt, RememberMe: rememberMe}, nil
 }
 
-func (s sessionService) GetSession(token string) (repository.Session, error) {
-	session, err := s.sessionRepo.Get(token)
-	err = s.sessionRepo.UpdateLastUsed(session.SessionKey)
+// GetSession returns a session in use by the client, applying its policy: an idle session or one
+// past its absolute lifetime is expired, one close to its expiry is renewed. A known client is
+// checked against the client the session is bound to.
+func (s sessionService) GetSession(ctx context.Context, token string, client *binding.Client) (repository.Session, error) {
+	now := time.Now().UTC()
+	session, err := s.activeSession(ctx, token, now)
 	if err != nil {
 		return repository.Session{}, err
 	}
-	return *session, err
+	policy := s.config.policy(session.RememberMe)
+	if session.ReauthRequired {
+		return repository.Session{}, ErrReauthRequired
+	}
+	if client != nil && s.config.Binder != nil {
+		if err = s.checkBinding(ctx, session, *client, now); err != nil {
+			return repository.Session{}, err
+		}
+	}
+
+	expiresAt := policy.renewal(session, now)
+	renewed := expiresAt.After(session.ExpiresAt)
+	if !renewed && now.Sub(session.LastUsed) < s.config.LastUsedInterval {
+		return *session, nil
+	}
+	if err = s.sessionRepo.UpdateActivity(ctx, token, now, expiresAt); err != nil {
+		return repository.Session{}, err
+	}
+	if renewed {
+		s.log(ctx).Debug("Session with token: ", logging.Fingerprint(token), " renewed until ", expiresAt)
+		metrics.RecordSessionRenewed()
+	}
+	session.LastUsed = now
+	session.ExpiresAt = expiresAt
+	return *session, nil
+}
+
+// activeSession returns the session unless it went idle or reached its absolute lifetime by
+// now, such a session is expired
+func (s sessionService) activeSession(ctx context.Context, token string, now time.Time) (*repository.Session, error) {
+	session, err := s.sessionRepo.Get(ctx, token)
+	if err != nil {
+		return nil, orNotFound(err, ErrInvalidSession)
+	}
+	if !s.config.policy(session.RememberMe).expired(session, now) {
+		return session, nil
+	}
+
+	s.log(ctx).Debug("Session with token: ", logging.Fingerprint(token), " went idle or reached its absolute lifetime")
+	if err = s.sessionRepo.Delete(ctx, token); err != nil {
+		return nil, err
+	}
+	s.revocationService.Revoke(utils.HashToken(token))
+	metrics.RecordSessionsRevoked(metrics.RevokeExpired, 1)
+	return nil, ErrSessionExpired
+}
+
+// FindSession returns a session to re-authenticate
+func (s sessionService) FindSession(ctx context.Context, token string) (*repository.Session, error) {
+	return s.activeSession(ctx, token, time.Now().UTC())
+}
+
+// Reauthenticate records a re-authentication of the session
+func (s sessionService) Reauthenticate(ctx context.Context, session *repository.Session, level int, client binding.Client) error {
+	s.log(ctx).Debug("Re-authenticating session with token: ", logging.Fingerprint(session.SessionKey), " with level: ", level)
+
+	session.AuthenticatedAt = time.Now().UTC()
+	session.AuthLevel = level
+	session.ReauthRequired = false
+	session.Anomalies = ""
+	if s.config.Binder != nil {
+		// The user vouched for the client, keeping the old binding would flag it again at once
+		signals := s.config.Binder.Signals(client)
+		session.IPPrefix = signals.IPPrefix
+		session.UserAgentFamily = signals.UserAgentFamily
+		session.DeviceHash = signals.DeviceHash
+		if location := s.config.Binder.Locate(client.IP); location != nil {
+			setLocation(session, location)
+		}
+	}
+	if err := s.sessionRepo.Reauthenticate(ctx, session); err != nil {
+		return err
+	}
+	// Services caching the session drop the previous authentication and ask again
+	s.revocationService.Revoke(utils.HashToken(session.SessionKey))
+	return nil
+}
+
+// checkBinding evaluates the session used by the client and takes the action of the policy.
+// It returns ErrReauthRequired or ErrSessionRevoked if the session may no longer be used.
+func (s sessionService) checkBinding(ctx context.Context, session *repository.Session, client binding.Client, now time.Time) error {
+	evaluation := s.config.Binder.Evaluate(boundSession(session), client, now)
+	if evaluation.Location != nil && !sameLocation(session, evaluation.Location) {
+		// Travel is measured from the last place the session was seen, so a move is written at once
+		location := evaluation.Location
+		if err := s.sessionRepo.UpdateLocation(ctx, session.SessionKey, location.Country, location.Latitude, location.Longitude); err != nil {
+			s.log(ctx).Warn("Failed to update the location of session with token: ", logging.Fingerprint(session.SessionKey), " - ", err)
+		}
+		setLocation(session, location)
+	}
+	if len(evaluation.Anomalies) == 0 {
+		return nil
+	}
+
+	action := evaluation.Action
+	for _, anomaly := range evaluation.Anomalies {
+		metrics.RecordSessionAnomaly(anomaly, action.String())
+	}
+	sessionID := utils.HashToken(session.SessionKey)
+	fields := logrus.Fields{
+		"userId":          session.UserID,
+		"sessionId":       sessionID,
+		"anomalies":       strings.Join(evaluation.Anomalies, ","),
+		"action":          action.String(),
+		"ip":              client.IP,
+		"userAgentFamily": binding.UserAgentFamily(client.UserAgent),
+	}
+	if evaluation.Location != nil {
+		fields["country"] = evaluation.Location.Country
+	}
+	anomalies := mergeAnomalies(session.Anomalies, evaluation.Anomalies)
+
+	switch action {
+	case binding.ActionFlag:
+		if anomalies == session.Anomalies {
+			// Every anomaly of the session is audited once
+			return nil
+		}
+		if err := s.sessionRepo.UpdateAnomalies(ctx, session.SessionKey, anomalies, false); err != nil {
+			return err
+		}
+		session.Anomalies = anomalies
+		logging.Audit(ctx, "session.flagged", fields)
+	case binding.ActionReauth:
+		if err := s.sessionRepo.UpdateAnomalies(ctx, session.SessionKey, anomalies, true); err != nil {
+			return err
+		}
+		// Services caching the session for the original client have to ask again
+		s.revocationService.Revoke(sessionID)
+		logging.Audit(ctx, "session.reauth_required", fields)
+		return ErrReauthRequired
+	case binding.ActionRevoke:
+		if err := s.sessionRepo.Delete(ctx, session.SessionKey); err != nil {
+			return err
+		}
+		s.revocationService.Revoke(sessionID)
+		metrics.RecordSessionsRevoked(metrics.RevokeAnomaly, 1)
+		logging.Audit(ctx, "session.revoked", fields)
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// boundSession returns what the binder knows about the session
+func boundSession(session *repository.Session) binding.Session {
+	bound := binding.Session{
+		Signals: binding.Signals{
+			IPPrefix:        session.IPPrefix,
+			UserAgentFamily: session.UserAgentFamily,
+			DeviceHash:      session.DeviceHash,
+		},
+		LastUsed: session.LastUsed,
+	}
+	if session.LastLatitude != nil && session.LastLongitude != nil {
+		bound.Location = &binding.Location{
+			Country:   session.LastCountry,
+			Latitude:  *session.LastLatitude,
+			Longitude: *session.LastLongitude,
+		}
+	}
+	return bound
+}
+
+func setLocation(session *repository.Session, location *binding.Location) {
+	latitude, longitude := location.Latitude, location.Longitude
+	session.LastCountry = location.Country
+	session.LastLatitude = &latitude
+	session.LastLongitude = &longitude
+}
+
+func sameLocation(session *repository.Session, location *binding.Location) bool {
+	return session.LastLatitude != nil && session.LastLongitude != nil &&
+		*session.LastLatitude == location.Latitude && *session.LastLongitude == location.Longitude
+}
+
+// mergeAnomalies adds the found anomalies to the comma separated anomalies of a session
+func mergeAnomalies(recorded string, found []string) string {
+	var anomalies []string
+	if recorded != "" {
+		anomalies = strings.Split(recorded, ",")
+	}
+	for _, anomaly := range found {
+		known := false
+		for _, existing := range anomalies {
+			known = known || existing == anomaly
+		}
+		if !known {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	return strings.Join(anomalies, ",")
 }
 
 // GetUserID returns the user ID associated with a session
-func (s sessionService) GetUserID(token string) (int64, error) {
-	logging.Logger.Debug("Getting user ID for session with token: ", token[:5], "...")
+func (s sessionService) GetUserID(ctx context.Context, token string, client *binding.Client) (int64, error) {
+	s.log(ctx).Debug("Getting user ID for session with token: ", logging.Fingerprint(token))
 
-	session, err := s.GetSession(token)
+	session, err := s.GetSession(ctx, token, client)
 	if err != nil {
 		return 0, err
 	}
 
-	logging.Logger.Debug("User ID for session with token: ", token[:5], " is: ", session.UserID)
+	s.log(ctx).Debug("User ID for session with token: ", logging.Fingerprint(token), " is: ", session.UserID)
 	return session.UserID, nil
 }
 
-// UpdateLastUsed updates the last used time of a session
-
 // DeleteSession deletes a session
-func (s sessionService) DeleteSession(token string) error {
-	logging.Logger.Info("Deleting session with token: ", token[:5], "...")
-	session, err := s.sessionRepo.Get(token)
+func (s sessionService) DeleteSession(ctx context.Context, token string) error {
+	s.log(ctx).Info("Deleting session with token: ", logging.Fingerprint(token))
+	session, err := s.sessionRepo.Get(ctx, token)
 
 	if err != nil {
-		return err
+		return orNotFound(err, ErrInvalidSession)
 	}
 
-	if session.ExpiresAt.Before(time.Now()) {
-		return gorm.ErrRecordNotFound
+	if session.ExpiresAt.Before(time.Now().UTC()) {
+		return ErrInvalidSession
 	}
 
-	err = s.sessionRepo.Delete(token)
+	err = s.sessionRepo.Delete(ctx, token)
 	if err != nil {
-		logging.Logger.Error("Failed to delete session with token: ", token[:5], " - ", err)
+		s.log(ctx).Error("Failed to delete session with token: ", logging.Fingerprint(token), " - ", err)
+		return err
 	}
-	return err
+
+	s.revocationService.Revoke(utils.HashToken(token))
+	metrics.RecordSessionsRevoked(metrics.RevokeLogout, 1)
+	return nil
 }
 
 // HardDeleteSessions deletes all expired sessions
-func (s sessionService) HardDeleteSessions() error {
-	logging.Logger.Info("Deleting expired sessions...")
+func (s sessionService) HardDeleteSessions(ctx context.Context) (int64, error) {
+	s.log(ctx).Info("Deleting expired sessions...")
+
+	return s.sessionRepo.HardDeleteAllExpired(ctx)
+}
+
+// DeleteInactiveSessions deletes all inactive sessions
+func (s sessionService) DeleteInactiveSessions(ctx context.Context) (int64, error) {
+	s.log(ctx).Info("Deleting inactive sessions...")
 
-	return s.sessionRepo.HardDeleteAllExpired()
+	var count int64
+	for _, rememberMe := range []bool{false, true} {
+		idleTimeout := s.config.policy(rememberMe).IdleTimeout
+		if idleTimeout <= 0 {
+			continue
+		}
+		deleted, err := s.sessionRepo.HardDeleteAllInactive(ctx, rememberMe, idleTimeout)
+		if err != nil {
+			return count, err
+		}
+		// The sessions were rejected as idle already, the announcements only spare caches the wait
+		for _, key := range deleted {
+			s.revocationService.Revoke(utils.HashToken(key))
+		}
+		count += int64(len(deleted))
+	}
+	metrics.RecordSessionsRevoked(metrics.RevokeAdmin, int(count))
+	return count, nil
+}
+
+// CountExpiredSessions returns the number of expired sessions
+func (s sessionService) CountExpiredSessions(ctx context.Context) (int64, error) {
+	return s.sessionRepo.CountExpired(ctx)
+}
+
+// CountInactiveSessions returns the number of inactive sessions
+func (s sessionService) CountInactiveSessions(ctx context.Context) (int64, error) {
+	var count int64
+	for _, rememberMe := range []bool{false, true} {
+		idleTimeout := s.config.policy(rememberMe).IdleTimeout
+		if idleTimeout <= 0 {
+			continue
+		}
+		inactive, err := s.sessionRepo.CountInactive(ctx, rememberMe, idleTimeout)
+		if err != nil {
+			return 0, err
+		}
+		count += inactive
+	}
+	return count, nil
 }
 
-// DeleteInactiveSessions deletes all sessions that are expired
-func (s sessionService) DeleteInactiveSessions() error {
-	logging.Logger.Info("Deleting inactive sessions...")
+// ListUserSessions returns the sessions of the user that are not expired
+func (s sessionService) ListUserSessions(ctx context.Context, userID int64) ([]*repository.Session, error) {
+	return s.sessionRepo.GetAllByUser(ctx, userID)
+}
+
+// RevokeUserSessions expires every session of the user, e.g. after a suspension or a password reset
+func (s sessionService) RevokeUserSessions(ctx context.Context, userID int64) (int64, error) {
+	s.log(ctx).Info("Revoking sessions of user with ID: ", userID)
 
-	return s.sessionRepo.HardDeleteAllInactive()
+	sessions, err := s.sessionRepo.GetAllByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, session := range sessions {
+		if err = s.sessionRepo.Delete(ctx, session.SessionKey); err != nil {
+			s.log(ctx).Error("Failed to revoke session with token: ", logging.Fingerprint(session.SessionKey), " - ", err)
+			return count, err
+		}
+		s.revocationService.Revoke(utils.HashToken(session.SessionKey))
+		count++
+	}
+	metrics.RecordSessionsRevoked(metrics.RevokeAdmin, int(count))
+	return count, nil
 }
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"auth/internal/binding"
+	"auth/internal/repository"
+	"auth/internal/repository/memory"
+	"auth/pkg/auth"
+	"auth/pkg/utils"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionPolicy(t *testing.T) {
+	policy := SessionPolicy{
+		Lifetime:         12 * time.Hour,
+		AbsoluteLifetime: 24 * time.Hour,
+		IdleTimeout:      2 * time.Hour,
+		RenewWindow:      6 * time.Hour,
+	}
+	created := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	session := func(lastUsed time.Duration, expiresIn time.Duration) *repository.Session {
+		return &repository.Session{
+			CreatedAt: created,
+			LastUsed:  created.Add(lastUsed),
+			ExpiresAt: created.Add(expiresIn),
+		}
+	}
+
+	cases := []struct {
+		name      string
+		session   *repository.Session
+		now       time.Duration
+		expired   bool
+		expiresAt time.Duration
+	}{
+		{"fresh", session(0, 12*time.Hour), time.Hour, false, 12 * time.Hour},
+		{"idle", session(time.Hour, 12*time.Hour), 3*time.Hour + time.Second, true, 12 * time.Hour},
+		{"renewed in the window", session(6*time.Hour, 12*time.Hour), 7 * time.Hour, false, 19 * time.Hour},
+		{"renewal capped by the absolute lifetime", session(19*time.Hour, 22*time.Hour), 20 * time.Hour, false, 24 * time.Hour},
+		{"past the absolute lifetime", session(23*time.Hour, 25*time.Hour), 24*time.Hour + time.Second, true, 25 * time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := created.Add(tc.now)
+			if expired := policy.expired(tc.session, now); expired != tc.expired {
+				t.Errorf("Expected expired=%v, got %v", tc.expired, expired)
+			}
+			if expiresAt := policy.renewal(tc.session, now); !expiresAt.Equal(created.Add(tc.expiresAt)) {
+				t.Errorf("Expected expiry %v, got %v", created.Add(tc.expiresAt), expiresAt)
+			}
+		})
+	}
+
+	policy.RenewWindow = 0
+	if expiresAt := policy.renewal(session(6*time.Hour, 12*time.Hour), created.Add(11*time.Hour)); !expiresAt.Equal(created.Add(12 * time.Hour)) {
+		t.Errorf("Expected no renewal without a window, got %v", expiresAt)
+	}
+}
+
+func TestMergeAnomalies(t *testing.T) {
+	cases := []struct {
+		recorded string
+		found    []string
+		expected string
+	}{
+		{"", []string{"ip_changed"}, "ip_changed"},
+		{"ip_changed", []string{"ip_changed"}, "ip_changed"},
+		{"ip_changed", []string{"device_changed", "ip_changed"}, "ip_changed,device_changed"},
+	}
+	for _, tc := range cases {
+		if merged := mergeAnomalies(tc.recorded, tc.found); merged != tc.expected {
+			t.Errorf("Expected %q from %q and %v, got %q", tc.expected, tc.recorded, tc.found, merged)
+		}
+	}
+}
+
+// The service runs with TZ=Asia/Aqtobe in docker-compose, the session times must not be skewed
+// by the zone when the TIMESTAMP columns give them back
+func TestSessionTimesInLocalTimeZone(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("+05", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	ctx := context.Background()
+	sessions := memory.NewStore().Sessions()
+	service := NewSessionService(sessions, NewRevocationService(), SessionConfig{LastUsedInterval: time.Minute}, nil)
+	resp, err := service.CreateSession(ctx, 1, false, auth.AuthLevelPassword, binding.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := sessions.Get(ctx, resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for name, at := range map[string]time.Time{"last use": session.LastUsed, "authentication": session.AuthenticatedAt, "creation": session.CreatedAt} {
+		if at.After(now) || now.Sub(at) > time.Minute {
+			t.Errorf("Expected the %s at %v, got %v", name, now, at)
+		}
+	}
+	if lifetime := session.ExpiresAt.Sub(now); lifetime > DefaultSessionConfig().Short.Lifetime {
+		t.Errorf("Expected the session to expire within its lifetime, got %v", lifetime)
+	}
+
+	// Used again after the interval, the use is written
+	used := now.Add(-2 * time.Minute)
+	if err = sessions.UpdateActivity(ctx, resp.Token, used, session.ExpiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.GetSession(ctx, resp.Token, nil); err != nil {
+		t.Fatal(err)
+	}
+	if session, _ = sessions.Get(ctx, resp.Token); !session.LastUsed.After(used) {
+		t.Errorf("Expected the last use to be written, got %v", session.LastUsed)
+	}
+	if deleted, _ := sessions.HardDeleteAllInactive(ctx, false, DefaultSessionConfig().Short.IdleTimeout); len(deleted) != 0 {
+		t.Errorf("Expected the session in use to be kept, %v deleted", deleted)
+	}
+}
+
+// The idle sessions job runs every hour, it must not make every service drop its cache
+func TestDeleteInactiveSessionsRevokesThem(t *testing.T) {
+	ctx := context.Background()
+	sessions := memory.NewStore().Sessions()
+	revocations := NewRevocationService()
+	defer revocations.Close()
+	service := NewSessionService(sessions, revocations, SessionConfig{}, nil)
+
+	idle := time.Now().UTC().Add(-3 * time.Hour)
+	for _, key := range []string{"idle", "active"} {
+		session := &repository.Session{SessionKey: key, UserID: 1, LastUsed: idle, CreatedAt: idle, ExpiresAt: idle.Add(12 * time.Hour)}
+		if key == "active" {
+			session.LastUsed = time.Now().UTC()
+		}
+		if err := sessions.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, events, cancel := revocations.Subscribe("")
+	defer cancel()
+
+	count, err := service.DeleteInactiveSessions(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected one session deleted, got %d, %v", count, err)
+	}
+	select {
+	case event := <-events:
+		if event.Type != auth.RevocationEventRevoke || event.Event.SessionID != utils.HashToken("idle") {
+			t.Errorf("Expected the idle session to be revoked, got %+v", event)
+		}
+	default:
+		t.Fatal("Expected a revocation")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected a single revocation, got %+v", event)
+	default:
+	}
+}
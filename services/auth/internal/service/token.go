@@ -1,65 +1,132 @@
 package service
 
 import (
+	"auth/internal/repository"
 	"auth/pkg/utils"
+	"context"
 	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
 )
 
-// TODO: Add redis to cache the token
-
 const (
 	TokenTypeVerification  = "verification"
 	TokenTypePasswordReset = "password_reset"
+	// Passkey ceremonies keep their challenge under a token until the browser answers
+	TokenTypePasskeyRegistration = "passkey_registration"
+	TokenTypePasskeySignup       = "passkey_signup"
+	TokenTypePasskeyLogin        = "passkey_login"
 )
 
-var (
-	ErrInvalidTokenType = errors.New("invalid token type")
-)
+// tokenLength is the length of the tokens handed out
+const tokenLength = 64
 
-type Token struct {
-	Token string `json:"token"`
-	Type  string `json:"type"`
+// generatedTokenTTLs are how long the tokens of GenerateToken are valid, by type
+var generatedTokenTTLs = map[string]time.Duration{
+	TokenTypeVerification:  48 * time.Hour,
+	TokenTypePasswordReset: time.Hour,
 }
 
 type TokenService interface {
-	// GenerateToken generates a new token for the user
-	GenerateToken(userID int64, type_ string) error
+	// GenerateToken generates a verification or password reset token for the user
+	GenerateToken(ctx context.Context, userID int64, type_ string) (string, error)
 
-	// ValidateToken validates a token and returns the user ID
-	ValidateToken(token string, tokenType string) (userID int64, err error)
+	// ValidateToken validates a token and returns the user ID, the token stays valid
+	ValidateToken(ctx context.Context, token string, tokenType string) (userID int64, err error)
 
 	// DeleteToken deletes a token
-	DeleteToken(token string) error
+	DeleteToken(ctx context.Context, token string) error
+
+	// IssueToken stores data under a new token of the type, valid for ttl. userID is 0 if the
+	// token is not issued to a user.
+	IssueToken(ctx context.Context, userID int64, tokenType string, data []byte, ttl time.Duration) (string, error)
+
+	// ConsumeToken returns the user ID and the data of a token and deletes it, a token is
+	// consumed once
+	ConsumeToken(ctx context.Context, token string, tokenType string) (userID int64, data []byte, err error)
+
+	// DeleteExpiredTokens deletes tokens that can no longer be used and returns how many
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
 }
 
 type tokenService struct {
+	tokenRepo repository.TokenRepository
+	logger    *logrus.Logger
 }
 
-func NewTokenService() TokenService {
-	return &tokenService{}
+// NewTokenService creates the service, a nil logger stands for the global logger
+func NewTokenService(tokenRepo repository.TokenRepository, logger *logrus.Logger) TokenService {
+	return &tokenService{tokenRepo: tokenRepo, logger: logger}
 }
 
-func (t tokenService) GenerateToken(userID int64, type_ string) error {
-	// TODO+REFACTOR: Make a better token type validation
-	if type_ != TokenTypeVerification && type_ != TokenTypePasswordReset {
-		return ErrInvalidTokenType
+func (t tokenService) log(ctx context.Context) *logrus.Entry {
+	return logging.ForContext(t.logger, ctx).WithField(logging.LoggerNameField, "auth.service")
+}
+
+func (t tokenService) GenerateToken(ctx context.Context, userID int64, type_ string) (string, error) {
+	ttl, ok := generatedTokenTTLs[type_]
+	if !ok {
+		return "", ErrInvalidTokenType
 	}
+	return t.IssueToken(ctx, userID, type_, nil, ttl)
+}
 
-	token := utils.GenerateRandomString(64)
-	// TODO: Add redis to cache the token
-	// Token will be mapped to the user ID and type
-	tok := Token{
-		Token: token,
-		Type:  type_,
+func (t tokenService) ValidateToken(ctx context.Context, token string, tokenType string) (userID int64, err error) {
+	stored, err := t.tokenRepo.Get(ctx, utils.HashToken(token), tokenType)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrInvalidToken
+	} else if err != nil {
+		return 0, err
+	}
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		t.log(ctx).Debug("Token of type: ", tokenType, " expired at: ", stored.ExpiresAt)
+		return 0, ErrInvalidToken
 	}
-	_ = tok
-	return nil
+	return stored.UserID, nil
 }
 
-func (t tokenService) ValidateToken(token string, tokenType string) (userID int64, err error) {
-	return 0, nil
+func (t tokenService) DeleteToken(ctx context.Context, token string) error {
+	return t.tokenRepo.Delete(ctx, utils.HashToken(token))
+}
+
+func (t tokenService) IssueToken(ctx context.Context, userID int64, tokenType string, data []byte, ttl time.Duration) (string, error) {
+	if tokenType == "" {
+		return "", ErrInvalidTokenType
+	}
+	token := utils.GenerateRandomString(tokenLength)
+	now := time.Now().UTC()
+	err := t.tokenRepo.Create(ctx, &repository.Token{
+		TokenHash: utils.HashToken(token),
+		Type:      tokenType,
+		UserID:    userID,
+		Data:      data,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.log(ctx).Error("Failed to store token of type: ", tokenType, " - ", err)
+		return "", err
+	}
+	t.log(ctx).Debug("Issued token of type: ", tokenType, " to user with ID: ", userID)
+	return token, nil
+}
+
+func (t tokenService) ConsumeToken(ctx context.Context, token string, tokenType string) (userID int64, data []byte, err error) {
+	stored, err := t.tokenRepo.Take(ctx, utils.HashToken(token), tokenType)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil, ErrInvalidToken
+	} else if err != nil {
+		return 0, nil, err
+	}
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		t.log(ctx).Debug("Token of type: ", tokenType, " expired at: ", stored.ExpiresAt)
+		return 0, nil, ErrInvalidToken
+	}
+	return stored.UserID, stored.Data, nil
 }
 
-func (t tokenService) DeleteToken(token string) error {
-	return nil
+func (t tokenService) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	return t.tokenRepo.DeleteExpired(ctx)
 }
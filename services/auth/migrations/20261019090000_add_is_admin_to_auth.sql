@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE auth ADD COLUMN is_admin BOOLEAN DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE auth DROP COLUMN IF EXISTS is_admin;
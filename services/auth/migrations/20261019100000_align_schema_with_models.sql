@@ -0,0 +1,25 @@
+-- +goose Up
+-- The model calls it DeletedAt, and rows created so far stored the zero time instead of NULL
+ALTER TABLE auth RENAME COLUMN delete_at TO deleted_at;
+UPDATE auth SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+
+-- IDs are int64 in the models
+ALTER TABLE auth ALTER COLUMN id TYPE BIGINT;
+ALTER SEQUENCE auth_id_seq AS BIGINT;
+ALTER TABLE sessions ALTER COLUMN user_id TYPE BIGINT;
+
+-- Sessions are looked up per user and purged by expiry and activity
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_used ON sessions (last_used);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_last_used;
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+ALTER TABLE sessions ALTER COLUMN user_id TYPE INT;
+ALTER SEQUENCE auth_id_seq AS INT;
+ALTER TABLE auth ALTER COLUMN id TYPE INT;
+
+ALTER TABLE auth RENAME COLUMN deleted_at TO delete_at;
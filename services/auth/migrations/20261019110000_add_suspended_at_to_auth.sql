@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE auth ADD COLUMN suspended_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE auth DROP COLUMN IF EXISTS suspended_at;
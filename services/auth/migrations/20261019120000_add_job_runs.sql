@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(100) NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    processed BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    instance VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_job_runs_job_started_at ON job_runs (job, started_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS job_runs;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Sessions created before the policies lived a year, they keep the long policy
+ALTER TABLE sessions ADD COLUMN remember_me BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE sessions ALTER COLUMN remember_me SET DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN IF EXISTS remember_me;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- Sessions created before the binding have no signals, they are never compared
+ALTER TABLE sessions ADD COLUMN ip_prefix VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN user_agent_family VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN device_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_latitude DOUBLE PRECISION;
+ALTER TABLE sessions ADD COLUMN last_longitude DOUBLE PRECISION;
+ALTER TABLE sessions ADD COLUMN anomalies VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN reauth_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE known_devices (
+    user_id BIGINT NOT NULL,
+    device_key VARCHAR(64) NOT NULL,
+    user_agent_family VARCHAR(128) NOT NULL DEFAULT '',
+    ip_prefix VARCHAR(64) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, device_key)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS known_devices;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS reauth_required;
+ALTER TABLE sessions DROP COLUMN IF EXISTS anomalies;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_longitude;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_latitude;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_country;
+ALTER TABLE sessions DROP COLUMN IF EXISTS device_hash;
+ALTER TABLE sessions DROP COLUMN IF EXISTS user_agent_family;
+ALTER TABLE sessions DROP COLUMN IF EXISTS ip_prefix;
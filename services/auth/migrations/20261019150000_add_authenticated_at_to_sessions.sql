@@ -0,0 +1,10 @@
+-- +goose Up
+-- Existing sessions were authenticated with the password when they were created
+ALTER TABLE sessions ADD COLUMN authenticated_at TIMESTAMP;
+UPDATE sessions SET authenticated_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE sessions ALTER COLUMN authenticated_at SET NOT NULL;
+ALTER TABLE sessions ADD COLUMN auth_level SMALLINT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN IF EXISTS auth_level;
+ALTER TABLE sessions DROP COLUMN IF EXISTS authenticated_at;
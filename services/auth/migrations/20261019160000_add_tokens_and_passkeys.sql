@@ -0,0 +1,42 @@
+-- +goose Up
+-- One-time tokens, only their SHA-256 hash is stored
+CREATE TABLE tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    type VARCHAR(32) NOT NULL,
+    user_id BIGINT NOT NULL DEFAULT 0,
+    data BYTEA,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_tokens_user_id ON tokens (user_id);
+CREATE INDEX idx_tokens_expires_at ON tokens (expires_at);
+
+-- Users who signed up with a passkey have an empty password hash and a user handle
+ALTER TABLE auth ADD COLUMN user_handle BYTEA;
+CREATE UNIQUE INDEX idx_auth_user_handle ON auth (user_handle);
+
+CREATE TABLE passkeys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    credential_id BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+    transports VARCHAR(128) NOT NULL DEFAULT '',
+    aaguid BYTEA,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP
+);
+CREATE INDEX idx_passkeys_user_id ON passkeys (user_id);
+CREATE UNIQUE INDEX idx_passkeys_credential_id ON passkeys (credential_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS passkeys;
+
+DROP INDEX IF EXISTS idx_auth_user_handle;
+ALTER TABLE auth DROP COLUMN IF EXISTS user_handle;
+
+DROP TABLE IF EXISTS tokens;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- The language the user chose for messages and e-mails, empty to negotiate it per request
+ALTER TABLE auth ADD COLUMN language VARCHAR(16) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE auth DROP COLUMN IF EXISTS language;
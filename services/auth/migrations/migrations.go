@@ -0,0 +1,88 @@
+// Package migrations holds the SQL migrations of the auth database. They are embedded in the
+// binary, so a deployed service always carries the schema it expects.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// FS contains the goose SQL migrations, applied in the order of their version prefix
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Migrator applies the embedded migrations. Every command holds a Postgres advisory lock,
+// so replicas starting at the same time apply each migration once.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, FS,
+		goose.WithSessionLocker(locker),
+		goose.WithDisableGlobalRegistry(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+	logResults(ctx, results)
+	return results, err
+}
+
+// Down rolls back the latest applied migration
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+	if result != nil {
+		logResults(ctx, []*goose.MigrationResult{result})
+	}
+	return result, err
+}
+
+// Redo rolls back the latest applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	down, err := m.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+	up, err := m.provider.UpByOne(ctx)
+	if up != nil {
+		logResults(ctx, []*goose.MigrationResult{up})
+	}
+	return []*goose.MigrationResult{down, up}, err
+}
+
+// Status lists every migration and whether it is applied
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return m.provider.Status(ctx)
+}
+
+// Pending reports whether there are migrations to apply
+func (m *Migrator) Pending(ctx context.Context) (bool, error) {
+	return m.provider.HasPending(ctx)
+}
+
+func logResults(ctx context.Context, results []*goose.MigrationResult) {
+	logger := logging.FromContext(ctx).WithField(logging.LoggerNameField, "auth.migrations")
+	for _, result := range results {
+		if result.Error != nil {
+			logger.WithError(result.Error).Errorf("Migration %s failed", result.Source.Path)
+			continue
+		}
+		logger.Infof("Migrated %s %s in %s", result.Direction, result.Source.Path, result.Duration)
+	}
+}
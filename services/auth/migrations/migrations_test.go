@@ -0,0 +1,144 @@
+package migrations
+
+import (
+	"auth/internal/repository"
+	"context"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	files, err := fs.Glob(FS, "*.sql")
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+
+	versions := map[string]string{}
+	for _, file := range files {
+		version, _, found := strings.Cut(file, "_")
+		if !found {
+			t.Errorf("Expected %s to be named <version>_<name>.sql", file)
+		}
+		if other, ok := versions[version]; ok {
+			t.Errorf("Version %s is used by %s and %s", version, other, file)
+		}
+		versions[version] = file
+
+		content, err := fs.ReadFile(FS, file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		for _, marker := range []string{"-- +goose Up", "-- +goose Down"} {
+			if !strings.Contains(string(content), marker) {
+				t.Errorf("Expected %s to contain %q", file, marker)
+			}
+		}
+	}
+}
+
+// TestModelsMatchSchema migrates a real database and checks that every column the models map
+// exists. It runs when TEST_DATABASE_URL points at a disposable Postgres database.
+func TestModelsMatchSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get the connection: %v", err)
+	}
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		t.Fatalf("Failed to create the migrator: %v", err)
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate up: %v", err)
+	}
+	// The latest migration must roll back cleanly
+	if _, err = migrator.Redo(ctx); err != nil {
+		t.Fatalf("Failed to redo the latest migration: %v", err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending {
+		t.Fatalf("Expected no pending migrations, got %v, %v", pending, err)
+	}
+
+	for _, model := range []interface{}{&repository.Auth{}, &repository.Session{}, &repository.JobRun{}, &repository.KnownDevice{}, &repository.Token{}, &repository.Passkey{}} {
+		parsed, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			t.Fatalf("Failed to parse %T: %v", model, err)
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			t.Fatalf("Failed to read the columns of %s: %v", parsed.Table, err)
+		}
+		columns := map[string]bool{}
+		for _, column := range columnTypes {
+			columns[column.Name()] = true
+		}
+		for _, field := range parsed.Fields {
+			if field.DBName != "" && !columns[field.DBName] {
+				t.Errorf("%s.%s has no column %s.%s", parsed.Name, field.Name, parsed.Table, field.DBName)
+			}
+		}
+		for _, index := range parsed.ParseIndexes() {
+			if !db.Migrator().HasIndex(model, index.Name) {
+				t.Errorf("%s is missing the index %s", parsed.Table, index.Name)
+			}
+		}
+	}
+}
+
+func TestConcurrentUp(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	// Replicas starting together wait for each other instead of applying a migration twice
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			sqlDB, _ := db.DB()
+			defer sqlDB.Close()
+			migrator, err := NewMigrator(sqlDB)
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = migrator.Up(context.Background())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected concurrent migrations to succeed, got %v", err)
+		}
+	}
+}
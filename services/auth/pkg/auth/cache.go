@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached validation result. A nil principal marks a negative result.
+type cacheEntry struct {
+	key string
+	// client identifies the client the result was given to, sessions can be bound to clients
+	client    string
+	principal *Principal
+	expiresAt time.Time
+}
+
+// validationCache is a size bounded LRU cache of validation results with per entry expiry.
+// Keys are token digests, the raw token is never stored.
+type validationCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+func newValidationCache(size int) *validationCache {
+	return &validationCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached principal and whether the entry was found for the client.
+// A found entry with a nil principal is a cached negative result.
+func (vc *validationCache) get(key string, client string) (*Principal, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	elem, ok := vc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if vc.now().After(entry.expiresAt) {
+		vc.removeElement(elem)
+		return nil, false
+	}
+	if entry.client != client {
+		// Another client has to be checked by the auth service, it replaces the entry
+		return nil, false
+	}
+	vc.order.MoveToFront(elem)
+	return entry.principal, true
+}
+
+func (vc *validationCache) set(key string, client string, principal *Principal, ttl time.Duration) {
+	if vc.size <= 0 || ttl <= 0 {
+		return
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	expiresAt := vc.now().Add(ttl)
+	if elem, ok := vc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.client = client
+		entry.principal = principal
+		entry.expiresAt = expiresAt
+		vc.order.MoveToFront(elem)
+		return
+	}
+
+	vc.entries[key] = vc.order.PushFront(&cacheEntry{key: key, client: client, principal: principal, expiresAt: expiresAt})
+	for vc.order.Len() > vc.size {
+		vc.removeElement(vc.order.Back())
+	}
+}
+
+func (vc *validationCache) delete(key string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if elem, ok := vc.entries[key]; ok {
+		vc.removeElement(elem)
+	}
+}
+
+// purge drops every entry
+func (vc *validationCache) purge() {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	vc.entries = make(map[string]*list.Element)
+	vc.order.Init()
+}
+
+func (vc *validationCache) len() int {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	return vc.order.Len()
+}
+
+func (vc *validationCache) removeElement(elem *list.Element) {
+	vc.order.Remove(elem)
+	delete(vc.entries, elem.Value.(*cacheEntry).key)
+}
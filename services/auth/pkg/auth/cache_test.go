@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidationCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newValidationCache(2)
+	cache.set("a", "", &Principal{UserID: 1}, time.Minute)
+	cache.set("b", "", &Principal{UserID: 2}, time.Minute)
+
+	// Touch "a" so that "b" is the oldest entry
+	cache.get("a", "")
+	cache.set("c", "", &Principal{UserID: 3}, time.Minute)
+
+	if cache.len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", cache.len())
+	}
+	if _, ok := cache.get("b", ""); ok {
+		t.Errorf("Expected 'b' to be evicted")
+	}
+	if _, ok := cache.get("a", ""); !ok {
+		t.Errorf("Expected 'a' to be kept")
+	}
+}
+
+func TestValidationCacheExpiry(t *testing.T) {
+	now := time.Now()
+	cache := newValidationCache(10)
+	cache.now = func() time.Time { return now }
+
+	cache.set("valid", "", &Principal{UserID: 1}, time.Minute)
+	cache.set("invalid", "", nil, 10*time.Second)
+
+	principal, ok := cache.get("invalid", "")
+	if !ok || principal != nil {
+		t.Errorf("Expected cached negative result, got %v, %v", principal, ok)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, ok = cache.get("invalid", ""); ok {
+		t.Errorf("Expected negative result to expire")
+	}
+	if _, ok = cache.get("valid", ""); !ok {
+		t.Errorf("Expected positive result to be kept")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok = cache.get("valid", ""); ok {
+		t.Errorf("Expected positive result to expire")
+	}
+}
+
+func TestValidationCacheDisabled(t *testing.T) {
+	cache := newValidationCache(0)
+	cache.set("a", "", &Principal{UserID: 1}, time.Minute)
+
+	if _, ok := cache.get("a", ""); ok {
+		t.Errorf("Expected nothing to be cached")
+	}
+}
+
+func TestValidationCacheIsPerClient(t *testing.T) {
+	cache := newValidationCache(10)
+	cache.set("a", "laptop", &Principal{UserID: 1}, time.Minute)
+
+	if _, ok := cache.get("a", "phone"); ok {
+		t.Errorf("Expected another client to miss the cache")
+	}
+	if principal, ok := cache.get("a", "laptop"); !ok || principal.UserID != 1 {
+		t.Errorf("Expected the client to hit the cache, got %v, %v", principal, ok)
+	}
+	// The entry is still found by its key, so a revocation forgets it
+	cache.delete("a")
+	if _, ok := cache.get("a", "laptop"); ok {
+		t.Errorf("Expected the removed entry to be gone")
+	}
+}
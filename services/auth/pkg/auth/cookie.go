@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// HostCookiePrefix makes browsers require Secure, path "/" and no domain
+	HostCookiePrefix = "__Host-"
+	// SecureCookiePrefix makes browsers require Secure
+	SecureCookiePrefix = "__Secure-"
+)
+
+// CookiePolicy decides how the session cookie is written, every endpoint that sets or clears
+// the cookie goes through it so the attributes never diverge
+type CookiePolicy struct {
+	// Name is the cookie name, a HostCookiePrefix or SecureCookiePrefix is honoured
+	Name string
+	// Domain is the cookie domain, empty for the host only
+	Domain string
+	// Path is the cookie path
+	Path string
+	// Secure sends the cookie over HTTPS only
+	Secure bool
+	// SameSite limits cross-site requests carrying the cookie
+	SameSite http.SameSite
+	// MaxAge is the lifetime of the cookie, it should match the session lifetime. Zero makes
+	// a session cookie, dropped when the browser closes.
+	MaxAge time.Duration
+}
+
+// DefaultCookiePolicy is a host only, secure, lax cookie named DefaultCookieName living for a year
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{
+		Name:     DefaultCookieName,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   365 * 24 * time.Hour,
+	}
+}
+
+// ParseSameSite parses lax, strict or none
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("must be lax, strict or none, got %q", value)
+}
+
+// Validate rejects cookies browsers would drop
+func (p CookiePolicy) Validate() error {
+	var errs []error
+	if p.Name == "" {
+		errs = append(errs, errors.New("cookie name is required"))
+	}
+	if p.SameSite == http.SameSiteNoneMode && !p.Secure {
+		errs = append(errs, errors.New("a SameSite=None cookie must be secure"))
+	}
+	if strings.HasPrefix(p.Name, HostCookiePrefix) && (!p.Secure || p.Path != "/" || p.Domain != "") {
+		errs = append(errs, fmt.Errorf("a %s cookie must be secure, have path / and no domain", HostCookiePrefix))
+	}
+	if strings.HasPrefix(p.Name, SecureCookiePrefix) && !p.Secure {
+		errs = append(errs, fmt.Errorf("a %s cookie must be secure", SecureCookiePrefix))
+	}
+	if p.MaxAge < 0 {
+		errs = append(errs, errors.New("cookie max age must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Set writes the session token cookie
+func (p CookiePolicy) Set(c *gin.Context, token string) {
+	cookie := p.cookie(token)
+	if p.MaxAge > 0 {
+		cookie.MaxAge = int(p.MaxAge / time.Second)
+		cookie.Expires = time.Now().Add(p.MaxAge)
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// Clear removes the session token cookie
+func (p CookiePolicy) Clear(c *gin.Context) {
+	cookie := p.cookie("")
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	http.SetCookie(c.Writer, cookie)
+}
+
+func (p CookiePolicy) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     p.Name,
+		Value:    value,
+		Path:     p.Path,
+		Domain:   p.Domain,
+		Secure:   p.Secure,
+		HttpOnly: true,
+		SameSite: p.SameSite,
+	}
+}
+
+// Extractors returns DefaultExtractors reading the cookie of the policy
+func (p CookiePolicy) Extractors() []CredentialExtractor {
+	return []CredentialExtractor{
+		CookieExtractor(p.Name),
+		BearerExtractor(),
+		APIKeyExtractor(DefaultAPIKeyHeader),
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCookiePolicySetAndClear(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := CookiePolicy{
+		Name:     "__Host-token",
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   time.Hour,
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	policy.Set(c, "secret")
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected one cookie, got %d", len(cookies))
+	}
+	cookie := cookies[0]
+	if cookie.Name != "__Host-token" || cookie.Value != "secret" || cookie.MaxAge != 3600 {
+		t.Errorf("Unexpected cookie %+v", cookie)
+	}
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Path != "/" {
+		t.Errorf("Expected the policy attributes, got %+v", cookie)
+	}
+
+	recorder = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	policy.Clear(c)
+	if cookie := recorder.Result().Cookies()[0]; cookie.MaxAge >= 0 || cookie.Value != "" || !cookie.Secure {
+		t.Errorf("Expected the cookie to be cleared with the same attributes, got %+v", cookie)
+	}
+}
+
+func TestSessionCookieWithoutMaxAge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := DefaultCookiePolicy()
+	policy.MaxAge = 0
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	policy.Set(c, "secret")
+
+	header := recorder.Header().Get("Set-Cookie")
+	if strings.Contains(header, "Max-Age") || strings.Contains(header, "Expires") {
+		t.Errorf("Expected a session cookie without expiry, got %s", header)
+	}
+}
+
+func TestCookiePolicyValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(p *CookiePolicy)
+		valid  bool
+	}{
+		{"default", func(p *CookiePolicy) {}, true},
+		{"host prefix", func(p *CookiePolicy) { p.Name = "__Host-token" }, true},
+		{"host prefix with domain", func(p *CookiePolicy) { p.Name = "__Host-token"; p.Domain = "example.com" }, false},
+		{"host prefix with path", func(p *CookiePolicy) { p.Name = "__Host-token"; p.Path = "/api" }, false},
+		{"secure prefix over http", func(p *CookiePolicy) { p.Name = "__Secure-token"; p.Secure = false }, false},
+		{"same site none over http", func(p *CookiePolicy) { p.SameSite = http.SameSiteNoneMode; p.Secure = false }, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := DefaultCookiePolicy()
+			tc.modify(&policy)
+			if err := policy.Validate(); (err == nil) != tc.valid {
+				t.Errorf("Expected valid=%v, got %v", tc.valid, err)
+			}
+		})
+	}
+}
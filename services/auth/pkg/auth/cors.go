@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultCORSHeaders are the request headers browsers may send cross-origin
+var DefaultCORSHeaders = []string{
+	"Origin",
+	"Accept",
+	"Accept-Encoding",
+	"Content-Type",
+	"Content-Length",
+	"Authorization",
+	DefaultCSRFHeader,
+	DeviceFingerprintHeader,
+	tracing.RequestIDHeader,
+}
+
+// CORSPolicy decides which origins may call the API from a browser
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as "https://shop.example.com". A "*." in front of
+	// the host allows its subdomains, "https://*.example.com". A lone "*" allows every origin,
+	// it cannot be combined with AllowCredentials.
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send the session cookie cross-origin
+	AllowCredentials bool
+	// MaxAge is how long browsers cache a preflight response
+	MaxAge time.Duration
+	// AllowHeaders are request headers allowed besides DefaultCORSHeaders
+	AllowHeaders []string
+}
+
+// Validate rejects origins that are not a scheme and host, and "*" together with credentials
+func (p CORSPolicy) Validate() error {
+	var errs []error
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			if p.AllowCredentials {
+				errs = append(errs, errors.New(`the origin "*" cannot be combined with credentials`))
+			}
+			continue
+		}
+		parsed, err := url.Parse(strings.Replace(origin, "*.", "", 1))
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || strings.Trim(parsed.Path, "/") != "" ||
+			strings.Count(origin, "*") > 1 || (strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+			errs = append(errs, fmt.Errorf("origin %q must be a scheme and host such as https://example.com", origin))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AllowsOrigin reports whether a browser at the origin may call the API
+func (p CORSPolicy) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		scheme, host, found := strings.Cut(allowed, "://*.")
+		if found && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware answers preflight requests and sets the CORS headers.
+// Requests from origins that are not allowed are rejected with 403.
+func (p CORSPolicy) Middleware() gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOriginFunc:  p.AllowsOrigin,
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:     append(append([]string(nil), DefaultCORSHeaders...), p.AllowHeaders...),
+		ExposeHeaders:    []string{tracing.RequestIDHeader},
+		AllowCredentials: p.AllowCredentials,
+		MaxAge:           p.MaxAge,
+	})
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSPolicyAllowsOrigin(t *testing.T) {
+	policy := CORSPolicy{AllowedOrigins: []string{"https://shop.example.com", "https://*.example.org"}}
+
+	cases := map[string]bool{
+		"https://shop.example.com":  true,
+		"https://SHOP.example.com":  true,
+		"http://shop.example.com":   false,
+		"https://evil.com":          false,
+		"https://a.example.org":     true,
+		"https://example.org":       false,
+		"https://evil-example.org":  false,
+		"https://shop.example.com.": false,
+	}
+	for origin, expected := range cases {
+		if policy.AllowsOrigin(origin) != expected {
+			t.Errorf("Expected %s allowed=%v", origin, expected)
+		}
+	}
+}
+
+func TestCORSPolicyValidate(t *testing.T) {
+	if err := (CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}).Validate(); err == nil {
+		t.Errorf("Expected * with credentials to be rejected")
+	}
+	if err := (CORSPolicy{AllowedOrigins: []string{"*"}}).Validate(); err != nil {
+		t.Errorf("Expected * without credentials to be allowed, got %v", err)
+	}
+	for _, origin := range []string{"example.com", "https://example.com/path", "https://a.*.example.com"} {
+		if err := (CORSPolicy{AllowedOrigins: []string{origin}}).Validate(); err == nil {
+			t.Errorf("Expected %q to be rejected", origin)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSPolicy{AllowedOrigins: []string{"https://shop.example.com"}, AllowCredentials: true}.Middleware())
+	router.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/login", nil)
+	preflight.Header.Set("Origin", "https://shop.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	preflight.Header.Set("Access-Control-Request-Headers", "Content-Type, X-CSRF-Token")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, preflight)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("Expected the preflight to pass, got %d", recorder.Code)
+	}
+	header := recorder.Header()
+	if header.Get("Access-Control-Allow-Origin") != "https://shop.example.com" || header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Unexpected CORS headers %v", header)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/login", nil)
+	request.Header.Set("Origin", "https://evil.com")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected a foreign origin to be rejected, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// AuthMethod describes how the caller presented its credential
+type AuthMethod string
+
+const (
+	AuthMethodCookie AuthMethod = "cookie"
+	AuthMethodBearer AuthMethod = "bearer"
+	AuthMethodAPIKey AuthMethod = "api_key"
+	AuthMethodQuery  AuthMethod = "query"
+)
+
+const (
+	// DefaultCookieName is the cookie the auth service stores the session token in
+	DefaultCookieName = "token"
+	// DefaultAPIKeyHeader is the header server-to-server callers put their key in
+	DefaultAPIKeyHeader = "X-API-Key"
+	// DefaultQueryParam is the query parameter accepted on websocket upgrades
+	DefaultQueryParam = "access_token"
+	// DeviceFingerprintHeader carries the device fingerprint computed by the frontend,
+	// sessions can be bound to it
+	DeviceFingerprintHeader = "X-Device-Fingerprint"
+)
+
+// Credential is a raw token taken from the request together with the way it was sent
+type Credential struct {
+	Token  string
+	Method AuthMethod
+	// Client is the client presenting the token, the auth service checks it against the session
+	Client ClientInfo
+}
+
+// ClientInfo describes the client of a request
+type ClientInfo struct {
+	IP                string `json:"ip,omitempty"`
+	UserAgent         string `json:"user_agent,omitempty"`
+	DeviceFingerprint string `json:"device_fingerprint,omitempty"`
+}
+
+// ClientInfoFromRequest returns the client of the request
+func ClientInfoFromRequest(c *gin.Context) ClientInfo {
+	return ClientInfo{
+		IP:                c.ClientIP(),
+		UserAgent:         c.Request.UserAgent(),
+		DeviceFingerprint: c.GetHeader(DeviceFingerprintHeader),
+	}
+}
+
+// key identifies the client in the validation cache
+func (ci ClientInfo) key() string {
+	return ci.IP + "\x00" + ci.UserAgent + "\x00" + ci.DeviceFingerprint
+}
+
+// CredentialExtractor pulls a credential out of the request.
+// It returns false if the request does not carry a credential it understands.
+type CredentialExtractor interface {
+	Extract(c *gin.Context) (Credential, bool)
+}
+
+// CredentialExtractorFunc allows plain functions to be used as extractors
+type CredentialExtractorFunc func(c *gin.Context) (Credential, bool)
+
+func (f CredentialExtractorFunc) Extract(c *gin.Context) (Credential, bool) {
+	return f(c)
+}
+
+// CookieExtractor reads the token from the cookie with the given name
+func CookieExtractor(name string) CredentialExtractor {
+	return CredentialExtractorFunc(func(c *gin.Context) (Credential, bool) {
+		token, err := c.Cookie(name)
+		if err != nil || token == "" {
+			return Credential{}, false
+		}
+		return Credential{Token: token, Method: AuthMethodCookie}, true
+	})
+}
+
+// BearerExtractor reads the token from the "Authorization: Bearer <token>" header
+func BearerExtractor() CredentialExtractor {
+	return CredentialExtractorFunc(func(c *gin.Context) (Credential, bool) {
+		header := c.GetHeader("Authorization")
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return Credential{}, false
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return Credential{}, false
+		}
+		return Credential{Token: token, Method: AuthMethodBearer}, true
+	})
+}
+
+// APIKeyExtractor reads the token from the given header
+func APIKeyExtractor(header string) CredentialExtractor {
+	return CredentialExtractorFunc(func(c *gin.Context) (Credential, bool) {
+		token := strings.TrimSpace(c.GetHeader(header))
+		if token == "" {
+			return Credential{}, false
+		}
+		return Credential{Token: token, Method: AuthMethodAPIKey}, true
+	})
+}
+
+// WebSocketQueryExtractor reads the token from the given query parameter.
+// Browsers cannot set headers on websocket handshakes, so the query parameter
+// is only honoured for upgrade requests to keep tokens out of ordinary URLs.
+func WebSocketQueryExtractor(param string) CredentialExtractor {
+	return CredentialExtractorFunc(func(c *gin.Context) (Credential, bool) {
+		if !isWebSocketUpgrade(c) {
+			return Credential{}, false
+		}
+		token := c.Query(param)
+		if token == "" {
+			return Credential{}, false
+		}
+		return Credential{Token: token, Method: AuthMethodQuery}, true
+	})
+}
+
+// DefaultExtractors returns the extractor chain used when none is configured.
+// The cookie wins over the Authorization header, which wins over the API key header.
+func DefaultExtractors() []CredentialExtractor {
+	return DefaultCookiePolicy().Extractors()
+}
+
+// ExtractCredential runs the extractors in order and returns the first credential found,
+// together with the client presenting it
+func ExtractCredential(c *gin.Context, extractors []CredentialExtractor) (Credential, bool) {
+	for _, extractor := range extractors {
+		if cred, ok := extractor.Extract(c); ok {
+			cred.Client = ClientInfoFromRequest(c)
+			return cred, true
+		}
+	}
+	return Credential{}, false
+}
+
+func isWebSocketUpgrade(c *gin.Context) bool {
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range strings.Split(c.GetHeader("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(value), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
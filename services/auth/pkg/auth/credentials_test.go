@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestContext(req *http.Request) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	return c
+}
+
+func TestExtractCredentialPrecedence(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: "cookie-token"})
+	req.Header.Set("Authorization", "Bearer bearer-token")
+
+	cred, ok := ExtractCredential(newTestContext(req), DefaultExtractors())
+	if !ok {
+		t.Fatalf("Expected a credential to be extracted")
+	}
+	if cred.Token != "cookie-token" || cred.Method != AuthMethodCookie {
+		t.Errorf("Expected cookie credential, got %+v", cred)
+	}
+
+	reversed := []CredentialExtractor{BearerExtractor(), CookieExtractor(DefaultCookieName)}
+	cred, ok = ExtractCredential(newTestContext(req), reversed)
+	if !ok {
+		t.Fatalf("Expected a credential to be extracted")
+	}
+	if cred.Token != "bearer-token" || cred.Method != AuthMethodBearer {
+		t.Errorf("Expected bearer credential, got %+v", cred)
+	}
+}
+
+func TestBearerExtractorRejectsOtherSchemes(t *testing.T) {
+	for _, header := range []string{"Basic dXNlcjpwYXNz", "Bearer", "Bearer   ", "bearer-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+
+		if cred, ok := BearerExtractor().Extract(newTestContext(req)); ok {
+			t.Errorf("Expected no credential for header %q, got %+v", header, cred)
+		}
+	}
+}
+
+func TestAPIKeyExtractor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultAPIKeyHeader, "service-key")
+
+	cred, ok := ExtractCredential(newTestContext(req), DefaultExtractors())
+	if !ok {
+		t.Fatalf("Expected a credential to be extracted")
+	}
+	if cred.Token != "service-key" || cred.Method != AuthMethodAPIKey {
+		t.Errorf("Expected api key credential, got %+v", cred)
+	}
+}
+
+func TestWebSocketQueryExtractorOnlyOnUpgrade(t *testing.T) {
+	extractor := WebSocketQueryExtractor(DefaultQueryParam)
+
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token=query-token", nil)
+	if _, ok := extractor.Extract(newTestContext(req)); ok {
+		t.Errorf("Expected query token to be ignored on plain requests")
+	}
+
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	cred, ok := extractor.Extract(newTestContext(req))
+	if !ok {
+		t.Fatalf("Expected query token to be extracted on websocket upgrade")
+	}
+	if cred.Token != "query-token" || cred.Method != AuthMethodQuery {
+		t.Errorf("Expected query credential, got %+v", cred)
+	}
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCSRFHeader is the header clients send the CSRF token in
+	DefaultCSRFHeader = "X-CSRF-Token"
+	// DefaultCSRFFormField is the form field HTML forms send the CSRF token in
+	DefaultCSRFFormField = "csrf_token"
+	// DefaultCSRFCookieName is the cookie the token is also delivered in, readable by scripts
+	DefaultCSRFCookieName = "csrf_token"
+	// DefaultCSRFTokenTTL is how long a CSRF token is accepted
+	DefaultCSRFTokenTTL = 12 * time.Hour
+	// MinCSRFSecretLength is the shortest accepted signing secret
+	MinCSRFSecretLength = 32
+)
+
+var (
+	ErrCSRFTokenMissing = errors.New("csrf token missing")
+	ErrCSRFTokenInvalid = errors.New("csrf token invalid")
+	ErrCSRFTokenExpired = errors.New("csrf token expired")
+	ErrCSRFOrigin       = errors.New("cross-origin request")
+)
+
+// CSRFConfig is the configuration of the CSRF protection. Services sharing the session
+// cookie must share the secret, so a token issued by the auth service is accepted everywhere.
+type CSRFConfig struct {
+	// Secret signs the tokens, at least MinCSRFSecretLength bytes
+	Secret []byte
+	// TTL is how long a token is accepted, DefaultCSRFTokenTTL if zero
+	TTL time.Duration
+	// Header is the request header carrying the token, DefaultCSRFHeader if empty
+	Header string
+	// FormField is the form field carrying the token, DefaultCSRFFormField if empty
+	FormField string
+	// Cookie sets the attributes of the token cookie, its name defaults to DefaultCSRFCookieName.
+	// The cookie is not HttpOnly, so scripts can copy it into the header.
+	Cookie CookiePolicy
+	// TrustedOrigins are origins besides the request's own that may send unsafe requests,
+	// usually the CORS allow-list
+	TrustedOrigins []string
+}
+
+// CSRF issues and checks tokens bound to the session. A token is the issue time and a random
+// nonce signed together with the session ID, so it needs no server-side storage and cannot be
+// used with another session.
+type CSRF struct {
+	config  CSRFConfig
+	trusted CORSPolicy
+	now     func() time.Time
+}
+
+func NewCSRF(config CSRFConfig) (*CSRF, error) {
+	if len(config.Secret) < MinCSRFSecretLength {
+		return nil, errors.New("csrf secret must be at least 32 bytes")
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultCSRFTokenTTL
+	}
+	if config.Header == "" {
+		config.Header = DefaultCSRFHeader
+	}
+	if config.FormField == "" {
+		config.FormField = DefaultCSRFFormField
+	}
+	if config.Cookie.Name == "" {
+		config.Cookie.Name = DefaultCSRFCookieName
+	}
+	if config.Cookie.Path == "" {
+		config.Cookie.Path = "/"
+	}
+	return &CSRF{
+		config:  config,
+		trusted: CORSPolicy{AllowedOrigins: config.TrustedOrigins},
+		now:     time.Now,
+	}, nil
+}
+
+// Token issues a token for the session
+func (x *CSRF) Token(sessionID string) string {
+	payload := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(payload, uint64(x.now().Unix()))
+	_, _ = rand.Read(payload[8:])
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(x.sign(sessionID, payload))
+}
+
+// Verify checks that the token was issued for the session and has not expired
+func (x *CSRF) Verify(sessionID string, token string) error {
+	if token == "" {
+		return ErrCSRFTokenMissing
+	}
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return ErrCSRFTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != 8+16 {
+		return ErrCSRFTokenInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, x.sign(sessionID, payload)) {
+		return ErrCSRFTokenInvalid
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if x.now().Sub(issuedAt) > x.config.TTL {
+		return ErrCSRFTokenExpired
+	}
+	return nil
+}
+
+func (x *CSRF) sign(sessionID string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, x.config.Secret)
+	mac.Write([]byte("csrf\x00" + sessionID + "\x00"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// CSRFTokenResponse is the answer of the token endpoint
+type CSRFTokenResponse struct {
+	Token  string `json:"token"`
+	Header string `json:"header"`
+}
+
+// TokenHandler issues a token for the session of the principal, and sets it as a cookie too.
+// Mount it behind CookieTokenMiddleware.
+func (x *CSRF) TokenHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok || principal.SessionID == "" {
+			apierror.Abort(c, ErrAuthenticationRequired)
+			return
+		}
+
+		token := x.Token(principal.SessionID)
+		cookie := x.config.Cookie
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     cookie.Name,
+			Value:    token,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			Secure:   cookie.Secure,
+			SameSite: cookie.SameSite,
+			MaxAge:   int(x.config.TTL / time.Second),
+		})
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, CSRFTokenResponse{Token: token, Header: x.config.Header})
+	}
+}
+
+// Middleware protects unsafe methods. Requests from a foreign origin are rejected first,
+// then requests authenticated with the session cookie need a token for their session.
+// Bearer and API key callers are exempt, browsers never attach those on their own.
+// Mount it after the authentication middleware, so the credential is known.
+func (x *CSRF) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if cred, ok := GetCredential(c); ok && cred.Method != AuthMethodCookie {
+			c.Next()
+			return
+		}
+
+		if err := x.checkOrigin(c); err != nil {
+			x.reject(c, err)
+			return
+		}
+
+		principal, ok := GetPrincipal(c)
+		if !ok || principal.Method != AuthMethodCookie {
+			// Without a session cookie there is nothing to forge
+			c.Next()
+			return
+		}
+
+		token := c.GetHeader(x.config.Header)
+		if token == "" {
+			token = c.PostForm(x.config.FormField)
+		}
+		if err := x.Verify(principal.SessionID, token); err != nil {
+			x.reject(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkOrigin compares Origin, or Referer if there is no Origin, with the request's own origin
+// and the trusted origins. Requests carrying neither come from non-browser clients.
+func (x *CSRF) checkOrigin(c *gin.Context) error {
+	origin := c.GetHeader("Origin")
+	if origin == "" || origin == "null" {
+		referer := c.GetHeader("Referer")
+		if referer == "" {
+			if origin == "null" {
+				return ErrCSRFOrigin
+			}
+			return nil
+		}
+		parsed, err := url.Parse(referer)
+		if err != nil || parsed.Host == "" {
+			return ErrCSRFOrigin
+		}
+		origin = parsed.Scheme + "://" + parsed.Host
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return ErrCSRFOrigin
+	}
+	if strings.EqualFold(parsed.Host, requestHost(c)) || x.trusted.AllowsOrigin(origin) {
+		return nil
+	}
+	return ErrCSRFOrigin
+}
+
+func (x *CSRF) reject(c *gin.Context, err error) {
+	logging.FromContext(c.Request.Context()).WithError(err).Warn("CSRF check failed, aborting.")
+	apierror.Abort(c, ErrCSRFFailed.WithDetail(err.Error()))
+}
+
+// requestHost is the host the browser talked to, the proxy passes it in X-Forwarded-Host
+func requestHost(c *gin.Context) string {
+	if host := c.GetHeader("X-Forwarded-Host"); host != "" {
+		host, _, _ = strings.Cut(host, ",")
+		return strings.TrimSpace(host)
+	}
+	return c.Request.Host
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
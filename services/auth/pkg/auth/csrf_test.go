@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/gin-gonic/gin"
+)
+
+var testCSRFSecret = []byte(strings.Repeat("s", MinCSRFSecretLength))
+
+func newTestCSRF(t *testing.T) *CSRF {
+	t.Helper()
+	csrf, err := NewCSRF(CSRFConfig{Secret: testCSRFSecret, TrustedOrigins: []string{"https://shop.example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to create CSRF: %v", err)
+	}
+	return csrf
+}
+
+func TestCSRFTokenIsBoundToSession(t *testing.T) {
+	csrf := newTestCSRF(t)
+	token := csrf.Token("session-a")
+
+	if err := csrf.Verify("session-a", token); err != nil {
+		t.Errorf("Expected the token to be valid, got %v", err)
+	}
+	if err := csrf.Verify("session-b", token); !errors.Is(err, ErrCSRFTokenInvalid) {
+		t.Errorf("Expected the token to be rejected for another session, got %v", err)
+	}
+	if err := csrf.Verify("session-a", token[:len(token)-2]+"xx"); !errors.Is(err, ErrCSRFTokenInvalid) {
+		t.Errorf("Expected a tampered token to be rejected, got %v", err)
+	}
+	if err := csrf.Verify("session-a", ""); !errors.Is(err, ErrCSRFTokenMissing) {
+		t.Errorf("Expected a missing token to be reported, got %v", err)
+	}
+
+	now := time.Now().Add(DefaultCSRFTokenTTL + time.Minute)
+	csrf.now = func() time.Time { return now }
+	if err := csrf.Verify("session-a", token); !errors.Is(err, ErrCSRFTokenExpired) {
+		t.Errorf("Expected the token to expire, got %v", err)
+	}
+}
+
+func TestNewCSRFRejectsShortSecret(t *testing.T) {
+	if _, err := NewCSRF(CSRFConfig{Secret: []byte("short")}); err == nil {
+		t.Errorf("Expected a short secret to be rejected")
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	csrf := newTestCSRF(t)
+	token := csrf.Token("session")
+
+	cases := []struct {
+		name     string
+		method   AuthMethod
+		headers  map[string]string
+		expected int
+	}{
+		{"cookie with token", AuthMethodCookie, map[string]string{DefaultCSRFHeader: token}, http.StatusOK},
+		{"cookie without token", AuthMethodCookie, nil, http.StatusForbidden},
+		{"cookie with token of another session", AuthMethodCookie, map[string]string{DefaultCSRFHeader: csrf.Token("other")}, http.StatusForbidden},
+		{"bearer without token", AuthMethodBearer, map[string]string{"Origin": "https://evil.com"}, http.StatusOK},
+		{"foreign origin", AuthMethodCookie, map[string]string{DefaultCSRFHeader: token, "Origin": "https://evil.com"}, http.StatusForbidden},
+		{"cookie claiming an internal call", AuthMethodCookie, map[string]string{communication.InternalCallHeader: "true", "Origin": "https://evil.com"}, http.StatusForbidden},
+		{"foreign referer", AuthMethodCookie, map[string]string{DefaultCSRFHeader: token, "Referer": "https://evil.com/page"}, http.StatusForbidden},
+		{"trusted origin", AuthMethodCookie, map[string]string{DefaultCSRFHeader: token, "Origin": "https://shop.example.com"}, http.StatusOK},
+		{"same origin behind proxy", AuthMethodCookie, map[string]string{DefaultCSRFHeader: token, "Origin": "http://localhost", "X-Forwarded-Host": "localhost"}, http.StatusOK},
+		{"anonymous foreign origin", "", map[string]string{"Origin": "https://evil.com"}, http.StatusForbidden},
+		{"anonymous same origin", "", map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tc.method != "" {
+					SetPrincipal(c, &Principal{UserID: 1, SessionID: "session", Method: tc.method}, Credential{Method: tc.method})
+				}
+			}, csrf.Middleware())
+			router.POST("/change", func(c *gin.Context) { c.Status(http.StatusOK) })
+			router.GET("/read", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			request := httptest.NewRequest(http.MethodPost, "/change", nil)
+			for key, value := range tc.headers {
+				request.Header.Set(key, value)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tc.expected {
+				t.Errorf("Expected %d, got %d: %s", tc.expected, recorder.Code, recorder.Body.String())
+			}
+
+			recorder = httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/read", nil))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected safe methods to pass, got %d", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	csrf := newTestCSRF(t)
+	router := gin.New()
+	router.GET("/csrf", func(c *gin.Context) {
+		SetPrincipal(c, &Principal{UserID: 1, SessionID: "session", Method: AuthMethodCookie}, Credential{Method: AuthMethodCookie})
+	}, csrf.TokenHandler())
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/csrf", nil))
+
+	var response CSRFTokenResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if err := csrf.Verify("session", response.Token); err != nil || response.Header != DefaultCSRFHeader {
+		t.Errorf("Expected a valid token for the session, got %+v: %v", response, err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCSRFCookieName || cookies[0].HttpOnly {
+		t.Errorf("Expected a script readable token cookie, got %+v", cookies)
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"embed"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+)
+
+// Catalogs translate the errors of the middlewares, services mounting them load the catalogs into
+// their i18n bundle
+//
+//go:embed locales/*.yaml
+var Catalogs embed.FS
+
+// Errors of the authentication middlewares. The auth service reports sessions with the same
+// codes, so a client tells them apart whichever service answered.
+var (
+	// ErrInvalidToken is returned for a token that is unknown, expired or revoked
+	ErrInvalidToken = apierror.New(apierror.KindUnauthenticated, "AUTH_TOKEN_INVALID", "Invalid token")
+	// ErrReauthRequired is returned for a session the user has to re-authenticate before using it
+	// again, e.g. after it was used from another device
+	ErrReauthRequired = apierror.New(apierror.KindUnauthenticated, "AUTH_REAUTH_REQUIRED", "Re-authentication required")
+	ErrTokenMissing   = apierror.New(apierror.KindUnauthenticated, "AUTH_TOKEN_MISSING", "No token provided")
+	// ErrAuthenticationRequired is returned by middlewares mounted without the token middleware before them
+	ErrAuthenticationRequired = apierror.New(apierror.KindUnauthenticated, "AUTH_REQUIRED", "Authentication required")
+	ErrAlreadyAuthenticated   = apierror.New(apierror.KindForbidden, "AUTH_ALREADY_AUTHENTICATED", "You are already authenticated")
+	ErrAccessDenied           = apierror.New(apierror.KindForbidden, "AUTH_ACCESS_DENIED", "Access denied")
+	// ErrCSRFFailed is returned for a request failing the CSRF check, the detail tells why
+	ErrCSRFFailed = apierror.New(apierror.KindForbidden, "AUTH_CSRF_FAILED", "CSRF check failed")
+	// ErrAuthUnavailable is returned when the auth service cannot validate the token
+	ErrAuthUnavailable = apierror.New(apierror.KindUnavailable, "AUTH_UNAVAILABLE", "Authentication is temporarily unavailable")
+)
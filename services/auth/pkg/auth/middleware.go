@@ -1,99 +1,115 @@
 package auth
 
 import (
-	"fmt"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
 	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
 	"github.com/Ruletk/GoMarketplace/pkg/logging"
 	"github.com/gin-gonic/gin"
-	"net/http"
 )
 
-const (
-	TokenKey           string = "token"
-	TokenValidationKey string = "token_validation"
-)
-
-// ApiResponse represents a generic API response
-// In future, messages will be moved to a separate package
-// This is a temporary solution
-// TODO: Move to a separate package
-type ApiResponse struct {
-	Code    int    `json:"code"`
-	Type    string `json:"type"`
-	Message string `json:"message"`
-}
-
 // NoAuthMiddleware is a middleware that checks if the user is authenticated.
 // If the user is authenticated, it returns an error message and aborts the request.
-func NoAuthMiddleware() gin.HandlerFunc {
+func NoAuthMiddleware(extractors ...CredentialExtractor) gin.HandlerFunc {
+	if len(extractors) == 0 {
+		extractors = DefaultExtractors()
+	}
+
 	return func(c *gin.Context) {
-		if c.GetHeader("Internal-Call") == "true" {
+		if communication.IsInternalCall(c.Request) {
 			c.Next()
 			return
 		}
-		token, err := c.Cookie("token")
-		if err != nil {
-			logging.Logger.Info("No token provided, continuing.")
+		if _, ok := ExtractCredential(c, extractors); !ok {
+			logging.FromContext(c.Request.Context()).Info("No token provided, continuing.")
 			c.Next()
 			return
 		}
-		if token != "" {
-			logging.Logger.Info("User is already authenticated, aborting.")
-			c.JSON(http.StatusForbidden, ApiResponse{
-				Code:    http.StatusForbidden,
-				Type:    "error",
-				Message: "You are already authenticated",
-			})
-			c.Abort()
-			return
-		}
 
-		c.Next()
+		logging.FromContext(c.Request.Context()).Info("User is already authenticated, aborting.")
+		apierror.Abort(c, ErrAlreadyAuthenticated)
 	}
 }
 
+// MiddlewareConfig is the configuration for the token middleware
+type MiddlewareConfig struct {
+	// Extractors are tried in order to find the credential, DefaultExtractors is used if empty
+	Extractors []CredentialExtractor
+	// Validator checks the credential, DefaultValidator is used if nil
+	Validator *Validator
+}
+
 // CookieTokenMiddleware is a middleware that checks if the user is authenticated.
-// If the user is authenticated, it sets the token in the context.
-func CookieTokenMiddleware() gin.HandlerFunc {
+// The credential is looked up with the given extractors in order, DefaultExtractors is used if none are given.
+// If the user is authenticated, it sets the Principal in the context, see GetPrincipal.
+func CookieTokenMiddleware(extractors ...CredentialExtractor) gin.HandlerFunc {
+	return NewTokenMiddleware(MiddlewareConfig{Extractors: extractors})
+}
+
+// NewTokenMiddleware creates a middleware that authenticates the request with the given configuration
+func NewTokenMiddleware(config MiddlewareConfig) gin.HandlerFunc {
+	if len(config.Extractors) == 0 {
+		config.Extractors = DefaultExtractors()
+	}
+	if config.Validator == nil {
+		config.Validator = DefaultValidator()
+	}
+
 	return func(c *gin.Context) {
-		if c.GetHeader("Internal-Call") == "true" {
+		if communication.IsInternalCall(c.Request) {
 			c.Next()
 			return
 		}
 
-		token, err := c.Cookie("token")
-		if err != nil {
-			logging.Logger.Info("No token provided, aborting.")
-			c.JSON(http.StatusUnauthorized, ApiResponse{
-				Code:    http.StatusUnauthorized,
-				Type:    "error",
-				Message: "No token provided",
-			})
-			c.Abort()
+		cred, ok := ExtractCredential(c, config.Extractors)
+		if !ok {
+			logging.FromContext(c.Request.Context()).Info("No token provided, aborting.")
+			apierror.Abort(c, ErrTokenMissing)
+			return
+		}
+
+		principal, err := config.Validator.Validate(c.Request.Context(), cred)
+		if errors.Is(err, ErrReauthRequired) {
+			logging.FromContext(c.Request.Context()).Info("Session requires re-authentication, aborting.")
+			abortReauthRequired(c, ErrReauthRequired, 0)
+			return
+		} else if errors.Is(err, ErrInvalidToken) {
+			logging.FromContext(c.Request.Context()).Info("Invalid token provided, aborting.")
+			apierror.Abort(c, ErrInvalidToken)
+			return
+		} else if err != nil {
+			logging.FromContext(c.Request.Context()).Error("Token validation failed: ", err)
+			apierror.Abort(c, ErrAuthUnavailable.Wrap(err))
+			return
 		}
-		tokenValidation := validateToken(token)
 
-		c.Set(TokenKey, token)
-		c.Set(TokenValidationKey, tokenValidation)
+		SetPrincipal(c, principal, cred)
+		// The language the user chose wins over the one their browser asks for
+		i18n.Prefer(c, principal.Language)
 
 		c.Next()
 	}
 }
 
-func validateToken(token string) bool {
-	if token == "" {
-		return false
-	}
-	// TODO: Make a discovery service to get the URL of the auth service
-	resp, err := communication.PostJSON("http://web:80/api/v1/auth/validate", []byte(`{"token": "`+token+`"}`))
-	if err != nil {
-		fmt.Println("Error: ", err)
-		return false
-	}
+// RequireRole allows only principals having one of the roles.
+// It must be mounted after the token middleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			apierror.Abort(c, ErrAuthenticationRequired)
+			return
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return false
-	}
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				c.Next()
+				return
+			}
+		}
 
-	return true
+		logging.FromContext(c.Request.Context()).Warn("Access denied, missing role: ", roles)
+		apierror.Abort(c, ErrAccessDenied)
+	}
 }
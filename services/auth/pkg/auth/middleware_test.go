@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name      string
+		principal *Principal
+		expected  int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", &Principal{UserID: 1, Roles: []string{RoleUser}}, http.StatusForbidden},
+		{"admin", &Principal{UserID: 1, Roles: []string{RoleUser, RoleAdmin}}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tc.principal != nil {
+					SetPrincipal(c, tc.principal, Credential{})
+				}
+			})
+			router.GET("/admin", RequireRole(RoleAdmin), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin", nil))
+			if recorder.Code != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := time.Now()
+	cases := []struct {
+		name      string
+		principal *Principal
+		expected  int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"recent", &Principal{UserID: 1, AuthenticatedAt: now.Add(-time.Minute), AuthLevel: AuthLevelPassword}, http.StatusOK},
+		{"stale", &Principal{UserID: 1, AuthenticatedAt: now.Add(-time.Hour), AuthLevel: AuthLevelPassword}, http.StatusUnauthorized},
+		{"unknown", &Principal{UserID: 1}, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tc.principal != nil {
+					SetPrincipal(c, tc.principal, Credential{})
+				}
+			})
+			router.DELETE("/account", RequireRecentAuth(5*time.Minute), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/account", nil))
+			if recorder.Code != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, recorder.Code)
+			}
+			if tc.principal == nil || tc.expected == http.StatusOK {
+				return
+			}
+			var problem map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil || problem["code"] != ErrReauthRequired.Code || problem["max_age"] != float64(300) {
+				t.Errorf("Expected a re-authentication error, got %s", recorder.Body.String())
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, "insufficient_user_authentication") {
+				t.Errorf("Expected a step-up challenge, got %q", challenge)
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuthLevel(t *testing.T) {
+	principal := &Principal{AuthenticatedAt: time.Now(), AuthLevel: AuthLevelPassword}
+	if principal.AuthenticatedWithin(time.Hour, AuthLevelMFA, time.Now()) {
+		t.Errorf("Expected a password to fall short of a second factor")
+	}
+	if !principal.AuthenticatedWithin(time.Hour, AuthLevelPassword, time.Now()) {
+		t.Errorf("Expected a fresh password to do")
+	}
+}
+
+func TestTokenMiddlewarePrefersTheUserLanguage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := &fakeAuthService{token: "valid-token"}
+
+	router := gin.New()
+	router.Use(i18n.Middleware(i18n.MustNewBundle(language.English, i18n.Catalogs, Catalogs)))
+	router.DELETE("/account", NewTokenMiddleware(MiddlewareConfig{Validator: newTestValidator(t, fake)}), RequireRecentAuth(5*time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodDelete, "/account", nil)
+	request.Header.Set("Accept-Language", "ru")
+	request.Header.Set("Authorization", "Bearer valid-token")
+	router.ServeHTTP(recorder, request)
+
+	var problem map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil || problem["title"] != "Қайта аутентификация қажет" {
+		t.Errorf("Expected the problem in the language of the user, got %s", recorder.Body.String())
+	}
+	if lang := recorder.Header().Get("Content-Language"); lang != "kk" {
+		t.Errorf("Expected kk, got %q", lang)
+	}
+}
+
+func TestTokenMiddlewareTrustsOnlyTheSharedSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv(communication.InternalCallSecretEnv, "shared-secret")
+	router := gin.New()
+	router.POST("/validate", NewTokenMiddleware(MiddlewareConfig{Validator: newTestValidator(t, &fakeAuthService{token: "valid-token"})}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for value, expected := range map[string]int{"": http.StatusUnauthorized, "true": http.StatusUnauthorized, "shared-secret": http.StatusOK} {
+		request := httptest.NewRequest(http.MethodPost, "/validate", nil)
+		request.Header.Set(communication.InternalCallHeader, value)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != expected {
+			t.Errorf("%q: expected %d, got %d", value, expected, recorder.Code)
+		}
+	}
+}
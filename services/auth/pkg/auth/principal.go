@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	PrincipalKey  string = "principal"
+	CredentialKey string = "credential"
+)
+
+const (
+	RoleUser   = "user"
+	RoleSeller = "seller"
+	RoleAdmin  = "admin"
+)
+
+// Levels of the authentication of a session, a higher level is a stronger proof of identity
+const (
+	// AuthLevelPassword is a login or re-authentication with the password
+	AuthLevelPassword = 1
+	// AuthLevelMFA is a multi-factor proof: a password confirmed with a second factor, or a passkey
+	// verifying the user
+	AuthLevelMFA = 2
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID    int64
+	Email     string
+	Roles     []string
+	SessionID string
+	Method    AuthMethod
+	// AuthenticatedAt is when the user last proved their identity in the session, at login or
+	// re-authentication
+	AuthenticatedAt time.Time
+	// AuthLevel is the level of that proof, e.g. AuthLevelPassword
+	AuthLevel int
+	// Language is the language the user chose, empty if they did not
+	Language string
+}
+
+// HasRole reports whether the principal has the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatedWithin reports whether the user proved their identity with at least the level
+// within maxAge before now
+func (p *Principal) AuthenticatedWithin(maxAge time.Duration, level int, now time.Time) bool {
+	if p.AuthLevel < level || p.AuthenticatedAt.IsZero() {
+		return false
+	}
+	return now.Sub(p.AuthenticatedAt) <= maxAge
+}
+
+// SetPrincipal stores the principal and the credential it was built from in the context.
+// The user ID is added to the request scoped log fields.
+func SetPrincipal(c *gin.Context, principal *Principal, cred Credential) {
+	c.Set(PrincipalKey, principal)
+	c.Set(CredentialKey, cred)
+	logging.AddFields(c, logrus.Fields{"user_id": principal.UserID})
+}
+
+// GetPrincipal returns the authenticated principal, if any
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(PrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok && principal != nil
+}
+
+// MustGetPrincipal returns the authenticated principal and panics if there is none.
+// Only use it in handlers that are mounted behind CookieTokenMiddleware.
+func MustGetPrincipal(c *gin.Context) *Principal {
+	principal, ok := GetPrincipal(c)
+	if !ok {
+		panic("auth: no principal in context, is the auth middleware installed?")
+	}
+	return principal
+}
+
+// GetUserID returns the ID of the authenticated user, if any
+func GetUserID(c *gin.Context) (int64, bool) {
+	principal, ok := GetPrincipal(c)
+	if !ok {
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+// GetCredential returns the raw credential the request was authenticated with
+func GetCredential(c *gin.Context) (Credential, bool) {
+	value, ok := c.Get(CredentialKey)
+	if !ok {
+		return Credential{}, false
+	}
+	cred, ok := value.(Credential)
+	return cred, ok
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// RevocationEventRevoke announces a single revoked session
+	RevocationEventRevoke = "revoke"
+	// RevocationEventReset tells subscribers to drop everything they cached,
+	// sent when events were missed or many sessions were revoked at once
+	RevocationEventReset = "reset"
+)
+
+const (
+	revocationMinBackoff = time.Second
+	revocationMaxBackoff = 30 * time.Second
+)
+
+// RevocationEvent is the payload of a revocation feed event
+type RevocationEvent struct {
+	SessionID string    `json:"session_id,omitempty"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// watchRevocations follows the revocation feed, reconnecting with backoff until the context is done.
+// The feed is read from a single auth instance, revocations made on other replicas are only
+// picked up once the cached result expires.
+func (v *Validator) watchRevocations(ctx context.Context) {
+	lastEventID := ""
+	backoff := revocationMinBackoff
+
+	for {
+		connected, err := v.followRevocations(ctx, &lastEventID)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = revocationMinBackoff
+		}
+		logging.Logger.Info("Revocation feed disconnected, reconnecting in ", backoff, ": ", err)
+
+		// Events may be lost while disconnected, the feed replays them on reconnect
+		// or sends a reset if it cannot.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > revocationMaxBackoff {
+			backoff = revocationMaxBackoff
+		}
+	}
+}
+
+// followRevocations reads one connection of the feed until it breaks.
+// It reports whether the connection was established.
+func (v *Validator) followRevocations(ctx context.Context, lastEventID *string) (bool, error) {
+	url, done, err := v.config.Upstream.URL(ctx, "/revocations")
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	communication.MarkInternalCall(req.Header)
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New("revocation feed returned " + resp.Status)
+	}
+
+	if *lastEventID == "" {
+		// Nothing is known about what happened before the first connection
+		v.cache.purge()
+	}
+
+	var id, event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			v.handleRevocationEvent(event, data)
+			if id != "" {
+				*lastEventID = id
+			}
+			id, event, data = "", "", ""
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data += value
+		}
+	}
+
+	if err = scanner.Err(); err == nil {
+		err = errors.New("revocation feed closed")
+	}
+	return true, err
+}
+
+func (v *Validator) handleRevocationEvent(event string, data string) {
+	switch event {
+	case RevocationEventRevoke:
+		var payload RevocationEvent
+		if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.SessionID == "" {
+			logging.Logger.Warn("Malformed revocation event, dropping cache")
+			v.cache.purge()
+			return
+		}
+		v.Forget(payload.SessionID)
+	case RevocationEventReset:
+		logging.Logger.Info("Revocation feed reset, dropping cache")
+		v.cache.purge()
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/i18n"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/gin-gonic/gin"
+	"math"
+	"time"
+)
+
+// RequireRecentAuth allows only principals who entered their password within maxAge, e.g. for
+// changing the e-mail or deleting the account. It must be mounted after the token middleware.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return RequireRecentAuthLevel(maxAge, AuthLevelPassword)
+}
+
+// RequireRecentAuthLevel is RequireRecentAuth with the level the authentication must reach,
+// e.g. AuthLevelMFA for payouts
+func RequireRecentAuthLevel(maxAge time.Duration, level int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			apierror.Abort(c, ErrAuthenticationRequired)
+			return
+		}
+		if principal.AuthenticatedWithin(maxAge, level, time.Now()) {
+			c.Next()
+			return
+		}
+
+		logging.FromContext(c.Request.Context()).Info("Authentication is not recent enough, asking to re-authenticate.")
+		// The problem tells how recent and strong the authentication must be
+		minutes := int(math.Ceil(maxAge.Minutes()))
+		err := ErrReauthRequired.WithMessage("AUTH_REAUTH_REQUIRED.recent", i18n.Args{"count": minutes}).With("auth_level", level)
+		if !principal.AuthenticatedAt.IsZero() {
+			err = err.With("authenticated_at", principal.AuthenticatedAt)
+		}
+		abortReauthRequired(c, err, maxAge)
+	}
+}
+
+// abortReauthRequired aborts the request with the error telling the client to re-authenticate
+// with POST /auth/reauth and retry. maxAge is how recent the authentication must be, 0 if the
+// session has to re-authenticate whatever its age. The WWW-Authenticate header follows RFC 9470,
+// so OAuth clients recognise the step-up challenge.
+func abortReauthRequired(c *gin.Context, err *apierror.Error, maxAge time.Duration) {
+	challenge := `Bearer error="insufficient_user_authentication"`
+	if seconds := int64(maxAge / time.Second); seconds > 0 {
+		challenge += fmt.Sprintf(", max_age=%d", seconds)
+		err = err.With("max_age", seconds)
+	}
+	c.Header("WWW-Authenticate", challenge)
+	apierror.Abort(c, err)
+}
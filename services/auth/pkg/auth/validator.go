@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"auth/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// validationResponse mirrors the body returned by the auth service on /validate
+type validationResponse struct {
+	ID        int64    `json:"id"`
+	Email     string   `json:"email"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"session_id"`
+	// AuthenticatedAt and AuthLevel are when and how the user last proved their identity
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	AuthLevel       int       `json:"auth_level"`
+	Language        string    `json:"language"`
+}
+
+// ValidatorConfig is the configuration for the token validator
+type ValidatorConfig struct {
+	// Upstream is where the auth service is reached
+	Upstream *communication.Upstream
+	// Client makes the calls to the auth service
+	Client *communication.Client
+	// CacheSize is the maximum number of cached validation results, 0 disables caching
+	CacheSize int
+	// PositiveTTL is how long a valid token is trusted without asking the auth service
+	PositiveTTL time.Duration
+	// NegativeTTL is how long an invalid token is rejected without asking the auth service
+	NegativeTTL time.Duration
+	// RevocationFeed enables the subscription to the revocation feed of the auth service
+	RevocationFeed bool
+}
+
+// AuthServiceName is the name the auth service registers under
+const AuthServiceName = "auth"
+
+// DefaultValidatorConfig returns the configuration used by CookieTokenMiddleware.
+// The auth service is resolved from the environment, see communication.NewResolverFromEnv.
+func DefaultValidatorConfig() ValidatorConfig {
+	resolver, err := communication.NewResolverFromEnv()
+	if err != nil {
+		logging.Logger.Error("Invalid service discovery configuration, using defaults: ", err)
+		resolver = communication.DefaultStaticEndpoints
+	}
+
+	return ValidatorConfig{
+		Upstream:       communication.NewUpstream(AuthServiceName, resolver, communication.NewLeastPendingBalancer()),
+		Client:         communication.DefaultClient,
+		CacheSize:      10000,
+		PositiveTTL:    time.Minute,
+		NegativeTTL:    10 * time.Second,
+		RevocationFeed: true,
+	}
+}
+
+// Validator validates tokens against the auth service.
+// Results are cached by token digest, concurrent lookups of the same token are collapsed into one call,
+// and revoked sessions are evicted as soon as the auth service announces them.
+type Validator struct {
+	config ValidatorConfig
+	cache  *validationCache
+	group  singleflight.Group
+
+	watchOnce sync.Once
+}
+
+func NewValidator(config ValidatorConfig) *Validator {
+	return &Validator{
+		config: config,
+		cache:  newValidationCache(config.CacheSize),
+	}
+}
+
+var (
+	defaultValidator     *Validator
+	defaultValidatorOnce sync.Once
+)
+
+// DefaultValidator returns the process wide validator, following the revocation feed in the background
+func DefaultValidator() *Validator {
+	defaultValidatorOnce.Do(func() {
+		defaultValidator = NewValidator(DefaultValidatorConfig())
+		defaultValidator.Start(context.Background())
+	})
+	return defaultValidator
+}
+
+// Start subscribes to the revocation feed until the context is cancelled.
+// It does nothing if the feed is disabled or already followed.
+func (v *Validator) Start(ctx context.Context) {
+	if !v.config.RevocationFeed || v.config.CacheSize <= 0 {
+		return
+	}
+	v.watchOnce.Do(func() {
+		go v.watchRevocations(ctx)
+	})
+}
+
+// Validate returns the principal the token belongs to, ErrInvalidToken or ErrReauthRequired.
+// A session requiring re-authentication is not cached, it is valid again once the user did.
+func (v *Validator) Validate(ctx context.Context, cred Credential) (*Principal, error) {
+	if cred.Token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	key := utils.HashToken(cred.Token)
+	client := cred.Client.key()
+	if principal, ok := v.cache.get(key, client); ok {
+		if principal == nil {
+			return nil, ErrInvalidToken
+		}
+		return principal.withMethod(cred.Method), nil
+	}
+
+	result, err, _ := v.group.Do(key+client, func() (interface{}, error) {
+		// Other requests wait for this lookup, it must not fail because the first one went away
+		principal, err := v.fetch(context.WithoutCancel(ctx), cred)
+		if errors.Is(err, ErrInvalidToken) {
+			v.cache.set(key, client, nil, v.config.NegativeTTL)
+		} else if err == nil {
+			v.cache.set(key, client, principal, v.config.PositiveTTL)
+		}
+		return principal, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Principal).withMethod(cred.Method), nil
+}
+
+// Forget drops the cached result for the session with the given ID
+func (v *Validator) Forget(sessionID string) {
+	v.cache.delete(sessionID)
+}
+
+// validationRequest mirrors the body the auth service expects on /validate
+type validationRequest struct {
+	Token  string     `json:"token"`
+	Client ClientInfo `json:"client"`
+}
+
+// fetch asks the auth service about the token presented by the client
+func (v *Validator) fetch(ctx context.Context, cred Credential) (*Principal, error) {
+	// Validation records the use of the session: it sets last_used, renews a sliding session and
+	// records anomalies of the client. A retry is still safe, it does what the next
+	// request of the client would do anyway. Anomalies are merged into the session and audited
+	// once, only their metrics count a retried validation twice.
+	idempotent := true
+	data, err := communication.Do[validationResponse](ctx, v.config.Client, communication.Request{
+		Method:     http.MethodPost,
+		URL:        "/validate",
+		Upstream:   v.config.Upstream,
+		Body:       validationRequest{Token: cred.Token, Client: cred.Client},
+		Idempotent: &idempotent,
+	})
+	if upstreamErr, ok := communication.AsUpstreamError(err); ok && upstreamErr.StatusCode == http.StatusUnauthorized {
+		var problem apierror.Problem
+		if json.Unmarshal(upstreamErr.Body, &problem) == nil && problem.Code == ErrReauthRequired.Code {
+			return nil, ErrReauthRequired
+		}
+		return nil, ErrInvalidToken
+	} else if communication.IsStatus(err, http.StatusBadRequest) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:          data.ID,
+		Email:           data.Email,
+		Roles:           data.Roles,
+		SessionID:       data.SessionID,
+		AuthenticatedAt: data.AuthenticatedAt,
+		AuthLevel:       data.AuthLevel,
+		Language:        data.Language,
+	}, nil
+}
+
+// withMethod returns a copy of the principal for a request authenticated with the given method,
+// so handlers never share the cached value
+func (p *Principal) withMethod(method AuthMethod) *Principal {
+	principal := *p
+	principal.Method = method
+	return &principal
+}
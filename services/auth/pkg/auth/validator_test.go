@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"auth/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+)
+
+// fakeAuthService answers /validate for a single known token and serves a revocation feed
+type fakeAuthService struct {
+	token string
+	// reauthToken is a session requiring re-authentication
+	reauthToken string
+	calls       atomic.Int32
+	release     chan struct{}
+	revocations chan string
+}
+
+func (f *fakeAuthService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/validate":
+		f.calls.Add(1)
+		if f.release != nil {
+			<-f.release
+		}
+		var req struct {
+			Token string `json:"token"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Token != "" && req.Token == f.reauthToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(apierror.Problem{Status: http.StatusUnauthorized, Code: ErrReauthRequired.Code})
+			return
+		}
+		if req.Token != f.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(validationResponse{
+			ID:        42,
+			Email:     "user@example.com",
+			Roles:     []string{RoleUser},
+			SessionID: utils.HashToken(req.Token),
+			Language:  "kk",
+		})
+	case "/revocations":
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		id := 0
+		for {
+			select {
+			case sessionID := <-f.revocations:
+				id++
+				_, _ = fmt.Fprintf(w, "id: %d\nevent: revoke\ndata: {\"session_id\":%q}\n\n", id, sessionID)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestValidator(t *testing.T, fake *fakeAuthService) *Validator {
+	logging.BaseInitLogger(logging.LogConfig{Level: "error"})
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	config := DefaultValidatorConfig()
+	config.Upstream = communication.NewUpstream(AuthServiceName, communication.StaticResolver{AuthServiceName: {server.URL}}, nil)
+	return NewValidator(config)
+}
+
+func TestValidatorCachesResults(t *testing.T) {
+	fake := &fakeAuthService{token: "valid-token"}
+	validator := newTestValidator(t, fake)
+
+	for i := 0; i < 3; i++ {
+		principal, err := validator.Validate(context.Background(), Credential{Token: "valid-token", Method: AuthMethodBearer})
+		if err != nil {
+			t.Fatalf("Expected token to be valid, got %v", err)
+		}
+		if principal.UserID != 42 || principal.Method != AuthMethodBearer {
+			t.Errorf("Unexpected principal %+v", principal)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		_, err := validator.Validate(context.Background(), Credential{Token: "bad-token", Method: AuthMethodCookie})
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Expected ErrInvalidToken, got %v", err)
+		}
+	}
+
+	if calls := fake.calls.Load(); calls != 2 {
+		t.Errorf("Expected 2 calls to the auth service, got %d", calls)
+	}
+}
+
+func TestValidatorReportsReauthRequired(t *testing.T) {
+	fake := &fakeAuthService{token: "valid-token", reauthToken: "flagged-token"}
+	validator := newTestValidator(t, fake)
+
+	for i := 0; i < 2; i++ {
+		_, err := validator.Validate(context.Background(), Credential{Token: "flagged-token"})
+		if !errors.Is(err, ErrReauthRequired) {
+			t.Fatalf("Expected ErrReauthRequired, got %v", err)
+		}
+	}
+	// The session is valid again once the user re-authenticated, so it is not cached
+	if calls := fake.calls.Load(); calls != 2 {
+		t.Errorf("Expected 2 calls to the auth service, got %d", calls)
+	}
+}
+
+func TestValidatorCollapsesConcurrentLookups(t *testing.T) {
+	fake := &fakeAuthService{token: "valid-token", release: make(chan struct{})}
+	validator := newTestValidator(t, fake)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := validator.Validate(context.Background(), Credential{Token: "valid-token"}); err != nil {
+				t.Errorf("Expected token to be valid, got %v", err)
+			}
+		}()
+	}
+
+	// Give the goroutines time to pile up behind the first lookup
+	time.Sleep(50 * time.Millisecond)
+	close(fake.release)
+	wg.Wait()
+
+	if calls := fake.calls.Load(); calls != 1 {
+		t.Errorf("Expected 1 call to the auth service, got %d", calls)
+	}
+}
+
+func TestValidatorForgetsRevokedSessions(t *testing.T) {
+	fake := &fakeAuthService{token: "valid-token", revocations: make(chan string)}
+	validator := newTestValidator(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validator.Start(ctx)
+
+	// Blocks until the feed is connected, the validator drops its cache on the first connection
+	fake.revocations <- "unknown-session"
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := validator.Validate(context.Background(), Credential{Token: "valid-token"}); err != nil {
+		t.Fatalf("Expected token to be valid, got %v", err)
+	}
+	if validator.cache.len() != 1 {
+		t.Fatalf("Expected the result to be cached")
+	}
+
+	fake.revocations <- utils.HashToken("valid-token")
+
+	deadline := time.Now().Add(time.Second)
+	for validator.cache.len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected revoked session to be evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,7 @@
+// Package authclient calls the auth API through methods generated from docs/openapi.yaml.
+// Non 2xx answers are returned as *communication.UpstreamError, most carry an
+// apierror.Problem in their body. The types are the client's own, so other services do not
+// depend on the internals of the auth service.
+package authclient
+
+//go:generate go run github.com/Ruletk/GoMarketplace/pkg/openapi/cmd/openapi-gen client -spec ../../docs/openapi.yaml -package authclient -o authclient_gen.go
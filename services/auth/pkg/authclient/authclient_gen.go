@@ -0,0 +1,672 @@
+// Code generated by openapi-gen from ../../docs/openapi.yaml. DO NOT EDIT.
+
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ruletk/GoMarketplace/pkg/communication"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ApiResponse confirms a request without a result, the message is in the language of the response
+type ApiResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// AuthDataResponse describes the user and the session behind a valid token
+type AuthDataResponse struct {
+	// Level of that proof, 1 for a password, 2 for a password with a second factor or a passkey verifying the user
+	AuthLevel int `json:"auth_level"`
+	// When the user last proved their identity in the session, at login or re-authentication
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	Email           string    `json:"email"`
+	ID              int64     `json:"id"`
+	// The language the user chose, absent if they did not
+	Language string   `json:"language,omitempty"`
+	Roles    []string `json:"roles"`
+	// SHA-256 digest of the session token
+	SessionID string `json:"session_id"`
+}
+
+// AuthRequest represents a login or registration request
+type AuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Login only. A long session with a persistent cookie instead of a short one ending with the browser session
+	RememberMe bool `json:"remember_me,omitempty"`
+}
+
+// AuthResponse represents a successful authentication
+type AuthResponse struct {
+	// Expiry of the session, renewed while it is used up to its absolute lifetime
+	ExpiresAt  time.Time `json:"expires_at"`
+	RememberMe bool      `json:"remember_me"`
+	// Authentication session token
+	Token string `json:"token"`
+}
+
+// BuildInfo is generated from the BuildInfo schema
+type BuildInfo struct {
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	GoVersion  string `json:"go_version,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	Module     string `json:"module,omitempty"`
+	Version    string `json:"version,omitempty"`
+}
+
+// CSRFTokenResponse is generated from the CSRFTokenResponse schema
+type CSRFTokenResponse struct {
+	Header string `json:"header,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// CheckResult is generated from the CheckResult schema
+type CheckResult struct {
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// ClientInfo the client presenting the token, services forward it from the request they authenticate
+type ClientInfo struct {
+	// Sent by the frontend in the X-Device-Fingerprint header
+	DeviceFingerprint string `json:"device_fingerprint,omitempty"`
+	IP                string `json:"ip,omitempty"`
+	UserAgent         string `json:"user_agent,omitempty"`
+}
+
+// FieldError is generated from the FieldError schema
+type FieldError struct {
+	// JSON path of the field
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Parameter of the rule, e.g. the length for `max`
+	Param string `json:"param,omitempty"`
+	// The validation rule the value broke
+	Rule string `json:"rule"`
+}
+
+// HealthReport is generated from the HealthReport schema
+type HealthReport struct {
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+	Status string                 `json:"status,omitempty"`
+}
+
+// JobRun is generated from the JobRun schema
+type JobRun struct {
+	Error      string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// The replica that ran the job
+	Instance string `json:"instance,omitempty"`
+	Job      string `json:"job,omitempty"`
+	// Items the job processed, e.g. deleted sessions
+	Processed   int64      `json:"processed,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	Status      string     `json:"status,omitempty"`
+}
+
+// JobStatus is generated from the JobStatus schema
+type JobStatus struct {
+	LastRun *JobRun    `json:"last_run,omitempty"`
+	Name    string     `json:"name,omitempty"`
+	Next    *time.Time `json:"next,omitempty"`
+	// Whether this replica is running the job
+	Running  bool   `json:"running,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// LanguageRequest sets the language of the user
+type LanguageRequest struct {
+	// Empty to negotiate the language from Accept-Language again
+	Language string `json:"language,omitempty"`
+}
+
+// LogLevelRequest is generated from the LogLevelRequest schema
+type LogLevelRequest struct {
+	Level  string `json:"level"`
+	Logger string `json:"logger,omitempty"`
+}
+
+// LogLevels is generated from the LogLevels schema
+type LogLevels map[string]string
+
+// Passkey is generated from the Passkey schema
+type Passkey struct {
+	// The passkey can be synced to the user's other devices
+	BackupEligible bool `json:"backup_eligible,omitempty"`
+	// The passkey is synced
+	BackupState bool       `json:"backup_state,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ID          int64      `json:"id,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	Name        string     `json:"name,omitempty"`
+}
+
+// PasskeyAssertion starts a login with a passkey. Options are passed to navigator.credentials.get()
+// and the credential it returns is sent back with the token.
+type PasskeyAssertion struct {
+	// `PublicKeyCredentialRequestOptions` under `publicKey`, as defined by WebAuthn
+	Options json.RawMessage `json:"options"`
+	// Identifies the ceremony, valid until the challenge expires and used once
+	Token string `json:"token"`
+}
+
+// PasskeyCreation starts the registration of a passkey. Options are passed to navigator.credentials.create()
+// and the credential it returns is sent back with the token.
+type PasskeyCreation struct {
+	// `PublicKeyCredentialCreationOptions` under `publicKey`, as defined by WebAuthn
+	Options json.RawMessage `json:"options"`
+	// Identifies the ceremony, valid until the challenge expires and used once
+	Token string `json:"token"`
+}
+
+// PasskeyLogin finishes a login with a passkey
+type PasskeyLogin struct {
+	// The `PublicKeyCredential` returned by `navigator.credentials.get()`, JSON encoded
+	Credential json.RawMessage `json:"credential"`
+	RememberMe bool            `json:"remember_me,omitempty"`
+	Token      string          `json:"token"`
+}
+
+// PasskeyRegistration finishes the registration of a passkey
+type PasskeyRegistration struct {
+	// The `PublicKeyCredential` returned by `navigator.credentials.create()`, JSON encoded
+	Credential json.RawMessage `json:"credential"`
+	// Defaults to "Passkey N"
+	Name  string `json:"name,omitempty"`
+	Token string `json:"token"`
+}
+
+// PasskeyRename renames a passkey
+type PasskeyRename struct {
+	Name string `json:"name"`
+}
+
+// PasskeySignupRequest starts the registration of a user without a password
+type PasskeySignupRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordChange sets the new password with a password reset token
+type PasswordChange struct {
+	NewPassword string `json:"newPassword"`
+}
+
+// PasswordChangeRequest asks for a password reset link sent by e-mail
+type PasswordChangeRequest struct {
+	Email string `json:"email"`
+}
+
+// PprofStatus is generated from the PprofStatus schema
+type PprofStatus struct {
+	Enabled bool       `json:"enabled,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// Problem RFC 7807 problem details, the body of every error response. `code` is stable and identifies the error,
+// `title` and `detail` are meant for humans and may change. They are in the language negotiated from
+// the `Accept-Language` header, or the one the user chose, like the messages of the fields; the
+// `Content-Language` header tells which. Problems may carry additional members, e.g. `max_age` for
+// `AUTH_REAUTH_REQUIRED`.
+type Problem struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	// The invalid fields of an `INVALID_REQUEST`
+	Errors []FieldError `json:"errors,omitempty"`
+	// Path of the request
+	Instance string `json:"instance,omitempty"`
+	// ID of the request, quote it when reporting the error
+	RequestID string `json:"request_id,omitempty"`
+	Status    int    `json:"status"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+}
+
+// ReauthRequest re-authenticates the current session
+type ReauthRequest struct {
+	Password string `json:"password"`
+}
+
+// ReauthRequired returned with status 401 and a `WWW-Authenticate` step-up challenge when the session has to re-authenticate
+type ReauthRequired struct {
+	AuthLevel       int        `json:"auth_level,omitempty"`
+	AuthenticatedAt *time.Time `json:"authenticated_at,omitempty"`
+	Code            string     `json:"code"`
+	Detail          string     `json:"detail,omitempty"`
+	// The invalid fields of an `INVALID_REQUEST`
+	Errors []FieldError `json:"errors,omitempty"`
+	// Path of the request
+	Instance string `json:"instance,omitempty"`
+	// How recent the authentication must be in seconds, absent if the session has to re-authenticate whatever its age
+	MaxAge int `json:"max_age,omitempty"`
+	// ID of the request, quote it when reporting the error
+	RequestID string `json:"request_id,omitempty"`
+	Status    int    `json:"status"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+}
+
+// ReauthResponse represents a successful re-authentication
+type ReauthResponse struct {
+	AuthLevel       int       `json:"auth_level"`
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+}
+
+// RevocationEvent is generated from the RevocationEvent schema
+type RevocationEvent struct {
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// SHA-256 digest of the revoked session token
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// TokenRequest represents a token validation request
+type TokenRequest struct {
+	Client *ClientInfo `json:"client,omitempty"`
+	// Authentication session token
+	Token string `json:"token"`
+}
+
+// AdminEnablePprofRequest is generated from the AdminEnablePprofRequest schema
+type AdminEnablePprofRequest struct {
+	Duration string `json:"duration"`
+}
+
+// AdminListJobRunsParams are the parameters of AdminListJobRuns
+type AdminListJobRunsParams struct {
+	// Limit is the query parameter limit
+	Limit *int
+}
+
+// HealthzResponse is generated from the HealthzResponse schema
+type HealthzResponse struct {
+	Status string `json:"status,omitempty"`
+}
+
+// AuthLoginParams are the parameters of AuthLogin
+type AuthLoginParams struct {
+	// Fingerprint of the device computed by the frontend. The session is bound to it, the user is notified of logins from new devices.
+	XDeviceFingerprint *string
+}
+
+// AuthPasskeyLoginFinishParams are the parameters of AuthPasskeyLoginFinish
+type AuthPasskeyLoginFinishParams struct {
+	// Fingerprint of the device computed by the frontend. The session is bound to it, the user is notified of logins from new devices.
+	XDeviceFingerprint *string
+}
+
+// AuthPasskeySignupFinishParams are the parameters of AuthPasskeySignupFinish
+type AuthPasskeySignupFinishParams struct {
+	// Fingerprint of the device computed by the frontend. The session is bound to it, the user is notified of logins from new devices.
+	XDeviceFingerprint *string
+}
+
+// AuthRegistrationParams are the parameters of AuthRegistration
+type AuthRegistrationParams struct {
+	// Fingerprint of the device computed by the frontend. The session is bound to it, the user is notified of logins from new devices.
+	XDeviceFingerprint *string
+}
+
+// AuthRevocationsParams are the parameters of AuthRevocations
+type AuthRevocationsParams struct {
+	// ID of the last event received
+	LastEventID *string
+}
+
+// Client calls the operations of the GoMarketplace auth service
+type Client struct {
+	upstream *communication.Upstream
+	client   *communication.Client
+}
+
+// New returns a client making the calls with client to the service the upstream resolves
+func New(upstream *communication.Upstream, client *communication.Client) *Client {
+	return &Client{upstream: upstream, client: client}
+}
+
+// request returns the request of an operation
+func (c *Client) request(method string, path string, body interface{}) communication.Request {
+	return communication.Request{Method: method, URL: path, Upstream: c.upstream, Body: body, Header: http.Header{}, Query: url.Values{}}
+}
+
+// apply changes the request with the options of the call
+func apply(req communication.Request, opts []communication.RequestOption) communication.Request {
+	for _, opt := range opts {
+		opt(&req)
+	}
+	return req
+}
+
+// AdminDiagnosticsBuild calls GET /admin/diagnostics/build: Build info
+func (c *Client) AdminDiagnosticsBuild(ctx context.Context, opts ...communication.RequestOption) (*BuildInfo, error) {
+	req := c.request(http.MethodGet, "/admin/diagnostics/build", nil)
+	return communication.Do[*BuildInfo](ctx, c.client, apply(req, opts))
+}
+
+// AdminDiagnosticsConfig calls GET /admin/diagnostics/config: Effective configuration
+func (c *Client) AdminDiagnosticsConfig(ctx context.Context, opts ...communication.RequestOption) (json.RawMessage, error) {
+	req := c.request(http.MethodGet, "/admin/diagnostics/config", nil)
+	return communication.Do[json.RawMessage](ctx, c.client, apply(req, opts))
+}
+
+// AdminGetLogLevels calls GET /admin/diagnostics/log-levels: Log levels
+func (c *Client) AdminGetLogLevels(ctx context.Context, opts ...communication.RequestOption) (LogLevels, error) {
+	req := c.request(http.MethodGet, "/admin/diagnostics/log-levels", nil)
+	return communication.Do[LogLevels](ctx, c.client, apply(req, opts))
+}
+
+// AdminSetLogLevel calls PUT /admin/diagnostics/log-levels: Change a log level
+func (c *Client) AdminSetLogLevel(ctx context.Context, body *LogLevelRequest, opts ...communication.RequestOption) (LogLevels, error) {
+	req := c.request(http.MethodPut, "/admin/diagnostics/log-levels", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[LogLevels](ctx, c.client, apply(req, opts))
+}
+
+// AdminResetLogLevel calls DELETE /admin/diagnostics/log-levels/{logger}: Reset a log level
+func (c *Client) AdminResetLogLevel(ctx context.Context, logger string, opts ...communication.RequestOption) (LogLevels, error) {
+	req := c.request(http.MethodDelete, "/admin/diagnostics/log-levels/"+url.PathEscape(logger), nil)
+	return communication.Do[LogLevels](ctx, c.client, apply(req, opts))
+}
+
+// AdminPprofStatus calls GET /admin/diagnostics/pprof: pprof status
+func (c *Client) AdminPprofStatus(ctx context.Context, opts ...communication.RequestOption) (*PprofStatus, error) {
+	req := c.request(http.MethodGet, "/admin/diagnostics/pprof", nil)
+	return communication.Do[*PprofStatus](ctx, c.client, apply(req, opts))
+}
+
+// AdminEnablePprof calls POST /admin/diagnostics/pprof: Enable pprof
+func (c *Client) AdminEnablePprof(ctx context.Context, body *AdminEnablePprofRequest, opts ...communication.RequestOption) (*PprofStatus, error) {
+	req := c.request(http.MethodPost, "/admin/diagnostics/pprof", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*PprofStatus](ctx, c.client, apply(req, opts))
+}
+
+// AdminDisablePprof calls DELETE /admin/diagnostics/pprof: Disable pprof
+func (c *Client) AdminDisablePprof(ctx context.Context, opts ...communication.RequestOption) (*PprofStatus, error) {
+	req := c.request(http.MethodDelete, "/admin/diagnostics/pprof", nil)
+	return communication.Do[*PprofStatus](ctx, c.client, apply(req, opts))
+}
+
+// AdminPprofProfile calls GET /admin/diagnostics/pprof/{profile}: pprof profile
+//
+// The response is application/octet-stream, the caller must close its body.
+func (c *Client) AdminPprofProfile(ctx context.Context, profile string, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/admin/diagnostics/pprof/"+url.PathEscape(profile), nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// AdminListJobs calls GET /admin/jobs: Background jobs
+func (c *Client) AdminListJobs(ctx context.Context, opts ...communication.RequestOption) ([]JobStatus, error) {
+	req := c.request(http.MethodGet, "/admin/jobs", nil)
+	return communication.Do[[]JobStatus](ctx, c.client, apply(req, opts))
+}
+
+// AdminRunJob calls POST /admin/jobs/{job}/run: Run a job now
+func (c *Client) AdminRunJob(ctx context.Context, job string, opts ...communication.RequestOption) (*JobRun, error) {
+	req := c.request(http.MethodPost, "/admin/jobs/"+url.PathEscape(job)+"/run", nil)
+	return communication.Do[*JobRun](ctx, c.client, apply(req, opts))
+}
+
+// AdminListJobRuns calls GET /admin/jobs/{job}/runs: Job history
+func (c *Client) AdminListJobRuns(ctx context.Context, job string, params AdminListJobRunsParams, opts ...communication.RequestOption) ([]JobRun, error) {
+	req := c.request(http.MethodGet, "/admin/jobs/"+url.PathEscape(job)+"/runs", nil)
+	if params.Limit != nil {
+		req.Query.Set("limit", fmt.Sprint(*params.Limit))
+	}
+	return communication.Do[[]JobRun](ctx, c.client, apply(req, opts))
+}
+
+// AdminDeleteInactiveSessions calls DELETE /admin/sessions/delete-inactive: Delete inactive sessions
+func (c *Client) AdminDeleteInactiveSessions(ctx context.Context, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodDelete, "/admin/sessions/delete-inactive", nil)
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AdminHardDeleteSessions calls DELETE /admin/sessions/hard-delete: Hard delete all sessions
+func (c *Client) AdminHardDeleteSessions(ctx context.Context, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodDelete, "/admin/sessions/hard-delete", nil)
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasswordRequest calls POST /change-password: Change password request
+func (c *Client) AuthPasswordRequest(ctx context.Context, body *PasswordChangeRequest, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodPost, "/change-password", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasswordChange calls POST /change-password/{token}: Change user password
+func (c *Client) AuthPasswordChange(ctx context.Context, token string, body *PasswordChange, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodPost, "/change-password/"+url.PathEscape(token), nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthCSRF calls GET /csrf: CSRF token
+func (c *Client) AuthCSRF(ctx context.Context, opts ...communication.RequestOption) (*CSRFTokenResponse, error) {
+	req := c.request(http.MethodGet, "/csrf", nil)
+	return communication.Do[*CSRFTokenResponse](ctx, c.client, apply(req, opts))
+}
+
+// DocsSwaggerUI calls GET /docs: Swagger UI
+//
+// The response is text/html, the caller must close its body.
+func (c *Client) DocsSwaggerUI(ctx context.Context, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/docs", nil)
+	req.Header.Set("Accept", "text/html")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// DocsAsset calls GET /docs/assets/{name}: Documentation assets
+//
+// The response is text/css, the caller must close its body.
+func (c *Client) DocsAsset(ctx context.Context, name string, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/docs/assets/"+url.PathEscape(name), nil)
+	req.Header.Set("Accept", "text/css")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// Healthz calls GET /healthz: Liveness
+func (c *Client) Healthz(ctx context.Context, opts ...communication.RequestOption) (*HealthzResponse, error) {
+	req := c.request(http.MethodGet, "/healthz", nil)
+	return communication.Do[*HealthzResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthSetLanguage calls PUT /language: Set the language of the user
+func (c *Client) AuthSetLanguage(ctx context.Context, body *LanguageRequest, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodPut, "/language", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthLogin calls POST /login: User login
+func (c *Client) AuthLogin(ctx context.Context, body *AuthRequest, params AuthLoginParams, opts ...communication.RequestOption) (*AuthResponse, error) {
+	req := c.request(http.MethodPost, "/login", nil)
+	if body != nil {
+		req.Body = body
+	}
+	if params.XDeviceFingerprint != nil {
+		req.Header.Set("X-Device-Fingerprint", fmt.Sprint(*params.XDeviceFingerprint))
+	}
+	return communication.Do[*AuthResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthLogout calls POST /logout: User logout
+func (c *Client) AuthLogout(ctx context.Context, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodPost, "/logout", nil)
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// DocsOpenAPIJSON calls GET /openapi.json: This document as JSON
+func (c *Client) DocsOpenAPIJSON(ctx context.Context, opts ...communication.RequestOption) (json.RawMessage, error) {
+	req := c.request(http.MethodGet, "/openapi.json", nil)
+	return communication.Do[json.RawMessage](ctx, c.client, apply(req, opts))
+}
+
+// DocsOpenAPIYAML calls GET /openapi.yaml: This document
+//
+// The response is application/yaml, the caller must close its body.
+func (c *Client) DocsOpenAPIYAML(ctx context.Context, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/openapi.yaml", nil)
+	req.Header.Set("Accept", "application/yaml")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// AuthPasskeyList calls GET /passkeys: List the user's passkeys
+func (c *Client) AuthPasskeyList(ctx context.Context, opts ...communication.RequestOption) ([]Passkey, error) {
+	req := c.request(http.MethodGet, "/passkeys", nil)
+	return communication.Do[[]Passkey](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyLoginBegin calls POST /passkeys/login/begin: Begin a passkey login
+func (c *Client) AuthPasskeyLoginBegin(ctx context.Context, opts ...communication.RequestOption) (*PasskeyAssertion, error) {
+	req := c.request(http.MethodPost, "/passkeys/login/begin", nil)
+	return communication.Do[*PasskeyAssertion](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyLoginFinish calls POST /passkeys/login/finish: Finish a passkey login
+func (c *Client) AuthPasskeyLoginFinish(ctx context.Context, body *PasskeyLogin, params AuthPasskeyLoginFinishParams, opts ...communication.RequestOption) (*AuthResponse, error) {
+	req := c.request(http.MethodPost, "/passkeys/login/finish", nil)
+	if body != nil {
+		req.Body = body
+	}
+	if params.XDeviceFingerprint != nil {
+		req.Header.Set("X-Device-Fingerprint", fmt.Sprint(*params.XDeviceFingerprint))
+	}
+	return communication.Do[*AuthResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyRegisterBegin calls POST /passkeys/register/begin: Begin registering a passkey
+func (c *Client) AuthPasskeyRegisterBegin(ctx context.Context, opts ...communication.RequestOption) (*PasskeyCreation, error) {
+	req := c.request(http.MethodPost, "/passkeys/register/begin", nil)
+	return communication.Do[*PasskeyCreation](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyRegisterFinish calls POST /passkeys/register/finish: Finish registering a passkey
+func (c *Client) AuthPasskeyRegisterFinish(ctx context.Context, body *PasskeyRegistration, opts ...communication.RequestOption) (*Passkey, error) {
+	req := c.request(http.MethodPost, "/passkeys/register/finish", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*Passkey](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeySignupBegin calls POST /passkeys/signup/begin: Begin a passkey-only signup
+func (c *Client) AuthPasskeySignupBegin(ctx context.Context, body *PasskeySignupRequest, opts ...communication.RequestOption) (*PasskeyCreation, error) {
+	req := c.request(http.MethodPost, "/passkeys/signup/begin", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*PasskeyCreation](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeySignupFinish calls POST /passkeys/signup/finish: Finish a passkey-only signup
+func (c *Client) AuthPasskeySignupFinish(ctx context.Context, body *PasskeyRegistration, params AuthPasskeySignupFinishParams, opts ...communication.RequestOption) (*AuthResponse, error) {
+	req := c.request(http.MethodPost, "/passkeys/signup/finish", nil)
+	if body != nil {
+		req.Body = body
+	}
+	if params.XDeviceFingerprint != nil {
+		req.Header.Set("X-Device-Fingerprint", fmt.Sprint(*params.XDeviceFingerprint))
+	}
+	return communication.Do[*AuthResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyRename calls PATCH /passkeys/{id}: Rename a passkey
+func (c *Client) AuthPasskeyRename(ctx context.Context, id int64, body *PasskeyRename, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodPatch, "/passkeys/"+url.PathEscape(fmt.Sprint(id)), nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthPasskeyDelete calls DELETE /passkeys/{id}: Delete a passkey
+func (c *Client) AuthPasskeyDelete(ctx context.Context, id int64, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodDelete, "/passkeys/"+url.PathEscape(fmt.Sprint(id)), nil)
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
+
+// Readyz calls GET /readyz: Readiness
+func (c *Client) Readyz(ctx context.Context, opts ...communication.RequestOption) (*HealthReport, error) {
+	req := c.request(http.MethodGet, "/readyz", nil)
+	return communication.Do[*HealthReport](ctx, c.client, apply(req, opts))
+}
+
+// AuthReauth calls POST /reauth: Re-authenticate the session
+func (c *Client) AuthReauth(ctx context.Context, body *ReauthRequest, opts ...communication.RequestOption) (*ReauthResponse, error) {
+	req := c.request(http.MethodPost, "/reauth", nil)
+	if body != nil {
+		req.Body = body
+	}
+	return communication.Do[*ReauthResponse](ctx, c.client, apply(req, opts))
+}
+
+// DocsRedoc calls GET /redoc: Redoc
+//
+// The response is text/html, the caller must close its body.
+func (c *Client) DocsRedoc(ctx context.Context, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/redoc", nil)
+	req.Header.Set("Accept", "text/html")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// AuthRegistration calls POST /register: User Registration
+func (c *Client) AuthRegistration(ctx context.Context, body *AuthRequest, params AuthRegistrationParams, opts ...communication.RequestOption) (*AuthResponse, error) {
+	req := c.request(http.MethodPost, "/register", nil)
+	if body != nil {
+		req.Body = body
+	}
+	if params.XDeviceFingerprint != nil {
+		req.Header.Set("X-Device-Fingerprint", fmt.Sprint(*params.XDeviceFingerprint))
+	}
+	return communication.Do[*AuthResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthRevocations calls GET /revocations: Revoked sessions feed
+//
+// The response is text/event-stream, the caller must close its body.
+func (c *Client) AuthRevocations(ctx context.Context, params AuthRevocationsParams, opts ...communication.RequestOption) (*http.Response, error) {
+	req := c.request(http.MethodGet, "/revocations", nil)
+	if params.LastEventID != nil {
+		req.Header.Set("Last-Event-ID", fmt.Sprint(*params.LastEventID))
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	return c.client.Send(ctx, apply(req, opts))
+}
+
+// AuthValidate calls POST /validate: Validate user session
+func (c *Client) AuthValidate(ctx context.Context, body *TokenRequest, opts ...communication.RequestOption) (*AuthDataResponse, error) {
+	req := c.request(http.MethodPost, "/validate", nil)
+	if body != nil {
+		req.Body = body
+	}
+	idempotent := true
+	req.Idempotent = &idempotent
+	return communication.Do[*AuthDataResponse](ctx, c.client, apply(req, opts))
+}
+
+// AuthVerifyUser calls GET /verify/{token}: Verify user account
+func (c *Client) AuthVerifyUser(ctx context.Context, token string, opts ...communication.RequestOption) (*ApiResponse, error) {
+	req := c.request(http.MethodGet, "/verify/"+url.PathEscape(token), nil)
+	return communication.Do[*ApiResponse](ctx, c.client, apply(req, opts))
+}
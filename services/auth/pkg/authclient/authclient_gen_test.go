@@ -0,0 +1,14 @@
+package authclient
+
+import (
+	"testing"
+
+	"github.com/Ruletk/GoMarketplace/pkg/openapi/codegen"
+)
+
+// The client follows the OpenAPI document, run go generate after changing it
+func TestGeneratedClientIsUpToDate(t *testing.T) {
+	if err := codegen.CheckFile("authclient_gen.go", codegen.Client, "../../docs/openapi.yaml", codegen.Config{Package: "authclient"}); err != nil {
+		t.Error(err)
+	}
+}
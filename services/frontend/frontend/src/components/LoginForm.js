@@ -24,7 +24,7 @@ const LoginForm = () => {
             if (response.ok) {
                 setMessage(`Login successful! Token saved in cookie.`);
             } else {
-                setMessage(`Error ${data.code}: ${data.message}`);
+                setMessage(`Error ${data.code}: ${data.detail || data.title}`);
             }
         } catch (error) {
             console.error('Error:', error);
@@ -9,10 +9,15 @@ const LogoutButton = () => {
         event.preventDefault();
 
         try {
+            // Logging out changes state, the session cookie needs a CSRF token for it
+            const csrf = await fetch('http://localhost/api/v1/auth/csrf', {
+                credentials: 'include',
+            }).then((response) => response.json());
             const response = await fetch('http://localhost/api/v1/auth/logout', {
-                method: 'GET',
+                method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    [csrf.header]: csrf.token,
                 },
                 credentials: 'include',
             });
@@ -22,7 +27,7 @@ const LogoutButton = () => {
             if (response.ok) {
                 setMessage(data.message);
             } else {
-                setMessage(`Error ${data.code}: ${data.message}`);
+                setMessage(`Error ${data.code}: ${data.detail || data.title}`);
             }
         } catch (error) {
             console.error('Logout error:', error);
@@ -19,7 +19,7 @@ function RegForm() {
 
             if (!response.ok) {
                 const errorData = await response.json();
-                throw new Error(errorData.message || "Something went wrong");
+                throw new Error(errorData.detail || errorData.title || "Something went wrong");
             }
 
             const data = await response.json();
@@ -25,7 +25,7 @@ function VerifyForm() {
 
                 if (!response.ok) {
                     const errorData = await response.json();
-                    throw new Error(errorData.message || "Verification failed");
+                    throw new Error(errorData.detail || errorData.title || "Verification failed");
                 }
 
                 const data = await response.json();
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"github.com/Ruletk/GoMarketplace/pkg/apierror"
+	"github.com/Ruletk/GoMarketplace/pkg/discovery"
+	"github.com/Ruletk/GoMarketplace/pkg/logging"
+	"github.com/Ruletk/GoMarketplace/pkg/metrics"
+	"github.com/Ruletk/GoMarketplace/pkg/server"
+	"github.com/Ruletk/GoMarketplace/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+func main() {
+	logging.InitLogger(logging.LogConfig{
+		Level:      "info",
+		LoggerName: "registry",
+	})
+
+	logging.Logger.Info("Starting the service registry")
+
+	ctx, stop := server.SignalContext(context.Background())
+	defer stop()
+
+	registry := discovery.NewRegistry(discovery.DefaultTTL, discovery.DefaultDeregisterAfter)
+	go registry.RunReaper(ctx, 5*time.Second)
+
+	r := gin.New()
+	r.Use(gin.Recovery(), tracing.GinMiddleware("registry"), logging.GinLogger(logging.Logger), metrics.GinMiddleware(), apierror.Middleware())
+	r.NoRoute(apierror.NoRoute)
+	registry.RegisterRoutes(r.Group("/"))
+
+	go func() {
+		if err := metrics.Serve(ctx, ":9090"); err != nil {
+			logging.Logger.Error("Metrics server failed: ", err)
+		}
+	}()
+
+	srv := server.New(server.Config{Addr: ":8080", Handler: r})
+	if err := srv.Run(ctx); err != nil {
+		logging.Logger.Fatal(err)
+	}
+}